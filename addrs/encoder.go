@@ -0,0 +1,73 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package addrs encodes the distinct destinations of open network files
+// one per line, without any decoration, ready to be piped to xargs,
+// nmap or curl.
+package addrs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/notation"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes the distinct destination addresses (host:port) of
+// the open network files, in order of appearance, or their distinct
+// hosts only.
+type Encoder struct {
+	w         io.Writer
+	hostsOnly bool
+	notation  notation.Notation
+}
+
+// NewEncoder returns an Encoder writing destination addresses, or
+// destination hosts when `hostsOnly` is true.
+func NewEncoder(w io.Writer, hostsOnly bool) *Encoder {
+	return &Encoder{w: w, hostsOnly: hostsOnly}
+}
+
+// NewEncoderNotation is the same as NewEncoder, but the addresses are
+// written in notation `n`, i.e. as the reverse DNS names of the hosts
+// collected into a DNS RPZ zone. The notation is applied once the
+// distinct destinations are found, as the alternative notations cannot
+// be parsed; addresses sharing the host are merged when the notation
+// drops the port.
+func NewEncoderNotation(w io.Writer, hostsOnly bool, n notation.Notation) *Encoder {
+	return &Encoder{w: w, hostsOnly: hostsOnly, notation: n}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	s := aggr.Summarize(set)
+	lines := s.Addrs
+	if e.hostsOnly {
+		lines = s.Hosts
+	}
+	w := bufio.NewWriter(e.w)
+	seen := make(map[string]bool, len(lines))
+	for _, v := range lines {
+		if v = notation.FormatAddr(v, e.notation); !seen[v] {
+			seen[v] = true
+			fmt.Fprintln(w, v)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
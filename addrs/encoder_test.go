@@ -0,0 +1,56 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package addrs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/addrs"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/notation"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "35.186.224.47:80")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5003"), Dst: internal.NewAddr("tcp", "[2001:db8::1]:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+	}
+	tt := []struct {
+		hostsOnly bool
+		notation  notation.Notation
+		want      string
+	}{
+		{false, notation.Default, "35.186.224.47:443\n35.186.224.47:80\n[2001:db8::1]:443\n"},
+		{true, notation.Default, "35.186.224.47\n2001:db8::1\n"},
+		{false, notation.Int, "599449647:443\n599449647:80\n42540766411282592856903984951653826561:443\n"},
+		{false, notation.Arpa, "47.224.186.35.in-addr.arpa\n1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa\n"},
+		{true, notation.Hex, "0x23bae02f\n0x20010db8000000000000000000000001\n"},
+	}
+	for _, v := range tt {
+		var b bytes.Buffer
+		if err := addrs.NewEncoderNotation(&b, v.hostsOnly, v.notation).Encode(set); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("Unexpected output: wanted %q, found %q", v.want, b.String())
+		}
+	}
+}
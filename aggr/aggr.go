@@ -0,0 +1,535 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package aggr provides aggregations of open network file sets, used
+// by the encoders that do not print each file on its own.
+package aggr
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Summary describes an open network file set as a whole.
+type Summary struct {
+	Cmds  []string // distinct commands, in order of appearance
+	Pids  []int    // distinct pids, in order of appearance
+	Hosts []string // distinct destination hosts
+	Addrs []string // distinct destination addresses (host:port)
+	Files int      // number of open network files
+	Conns int      // number of open network files with a destination
+}
+
+// Name returns the commands of the summary, joined by ",".
+func (s Summary) Name() string {
+	return strings.Join(s.Cmds, ",")
+}
+
+// Summarize aggregates `set` into a Summary.
+func Summarize(set []onf.ONF) Summary {
+	var s Summary
+	cmds := make(map[string]bool)
+	pids := make(map[int]bool)
+	hosts := make(map[string]bool)
+	addrs := make(map[string]bool)
+	for _, v := range set {
+		s.Files++
+		if v.Cmd != "" && !cmds[v.Cmd] {
+			cmds[v.Cmd] = true
+			s.Cmds = append(s.Cmds, v.Cmd)
+		}
+		if !pids[v.Pid] {
+			pids[v.Pid] = true
+			s.Pids = append(s.Pids, v.Pid)
+		}
+		host, ok := DstHost(v)
+		if !ok {
+			continue
+		}
+		s.Conns++
+		if !hosts[host] {
+			hosts[host] = true
+			s.Hosts = append(s.Hosts, host)
+		}
+		if addr := v.Dst.String(); !addrs[addr] {
+			addrs[addr] = true
+			s.Addrs = append(s.Addrs, addr)
+		}
+	}
+	return s
+}
+
+// DstHost returns the host part of the destination address of `f`.
+// Returns false when `f` has no usable destination, as it happens for
+// listening sockets.
+func DstHost(f onf.ONF) (string, bool) {
+	if f.Dst == nil {
+		return "", false
+	}
+	host, _, err := net.SplitHostPort(f.Dst.String())
+	if err != nil || host == "" || host == "*" {
+		return "", false
+	}
+	return host, true
+}
+
+// Dst is a destination address, together with the distinct commands
+// connected to it.
+type Dst struct {
+	Addr string
+	Cmds []string // in order of appearance
+}
+
+// TopDsts returns the `n` destination addresses of `set` contacted by
+// the largest number of distinct commands, which usually identifies
+// shared infrastructure such as DNS servers, proxies or telemetry
+// sinks. Ties are broken by address. When `n` is not positive, every
+// destination is returned.
+func TopDsts(set []onf.ONF, n int) []Dst {
+	var acc []Dst
+	index := make(map[string]int)
+	seen := make(map[string]map[string]bool)
+	for _, v := range set {
+		if _, ok := DstHost(v); !ok || v.Cmd == "" {
+			continue
+		}
+		addr := v.Dst.String()
+		i, ok := index[addr]
+		if !ok {
+			i = len(acc)
+			index[addr] = i
+			seen[addr] = make(map[string]bool)
+			acc = append(acc, Dst{Addr: addr})
+		}
+		if !seen[addr][v.Cmd] {
+			seen[addr][v.Cmd] = true
+			acc[i].Cmds = append(acc[i].Cmds, v.Cmd)
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if len(acc[i].Cmds) != len(acc[j].Cmds) {
+			return len(acc[i].Cmds) > len(acc[j].Cmds)
+		}
+		return acc[i].Addr < acc[j].Addr
+	})
+	if n > 0 && len(acc) > n {
+		acc = acc[:n]
+	}
+	return acc
+}
+
+// Endpoint is a remote service contacted by the open network files of
+// a set, as firewall rules see it.
+type Endpoint struct {
+	Proto string // tcp or udp
+	IP    net.IP
+	Port  string   // empty when unknown
+	Cmds  []string // in order of appearance, made printable
+}
+
+// IPv6 reports whether the address of `e` is an IPv6 one.
+func (e Endpoint) IPv6() bool {
+	return e.IP.To4() == nil
+}
+
+// Endpoints returns the distinct destinations of `set`, in order of
+// appearance, skipping the open network files without a usable
+// destination and the ones pointing to unspecified addresses. The
+// commands are made printable (see Printable), as encoders write them
+// in the comments of scripts and configuration files.
+func Endpoints(set []onf.ONF) []Endpoint {
+	var acc []Endpoint
+	index := make(map[string]int)
+	seen := make(map[string]map[string]bool)
+	for _, v := range set {
+		host, ok := DstHost(v)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsUnspecified() {
+			continue
+		}
+		_, port, _ := net.SplitHostPort(v.Dst.String())
+		if port == "*" || port == "0" {
+			port = ""
+		}
+		proto := strings.TrimRight(strings.ToLower(v.Dst.Network()), "46")
+		key := proto + " " + net.JoinHostPort(host, port)
+		i, ok := index[key]
+		if !ok {
+			i = len(acc)
+			index[key] = i
+			seen[key] = make(map[string]bool)
+			acc = append(acc, Endpoint{Proto: proto, IP: ip, Port: port})
+		}
+		if cmd := Printable(v.Cmd); cmd != "" && !seen[key][cmd] {
+			seen[key][cmd] = true
+			acc[i].Cmds = append(acc[i].Cmds, cmd)
+		}
+	}
+	return acc
+}
+
+// Host is a destination address contacted by the open network files
+// of a set, on any port and protocol.
+type Host struct {
+	IP   net.IP
+	Cmds []string // in order of appearance, made printable
+}
+
+// IPv6 reports whether the address of `h` is an IPv6 one.
+func (h Host) IPv6() bool {
+	return h.IP.To4() == nil
+}
+
+// Hosts returns the distinct destination addresses of the endpoints
+// of `set` (see Endpoints), in order of appearance, for the encoders
+// matching addresses only.
+func Hosts(set []onf.ONF) []Host {
+	var acc []Host
+	index := make(map[string]int)
+	for _, v := range Endpoints(set) {
+		i, ok := index[v.IP.String()]
+		if !ok {
+			i = len(acc)
+			index[v.IP.String()] = i
+			acc = append(acc, Host{IP: v.IP})
+		}
+		for _, cmd := range v.Cmds {
+			var found bool
+			for _, w := range acc[i].Cmds {
+				found = found || cmd == w
+			}
+			if !found {
+				acc[i].Cmds = append(acc[i].Cmds, cmd)
+			}
+		}
+	}
+	return acc
+}
+
+// Printable returns `s` with its control characters, line and
+// paragraph separators included, replaced by "?". Command names are
+// chosen by the processes themselves: a newline in one would end the
+// comment it is written into, turning the rest of the name into
+// commands or rules.
+func Printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || unicode.In(r, unicode.Zl, unicode.Zp) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// Matrix counts the connections of each command to each destination
+// host: Conns[i][j] is the number of open network files of Cmds[i]
+// connected to Hosts[j].
+type Matrix struct {
+	Cmds  []string // in order of appearance
+	Hosts []string // connected to by the most commands first, then by host
+	Conns [][]int
+}
+
+// Shared returns the number of distinct commands connected to
+// Hosts[j].
+func (m Matrix) Shared(j int) int {
+	var n int
+	for _, row := range m.Conns {
+		if row[j] > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// NewMatrix returns the Matrix of `set`, skipping the open network
+// files without a command or a usable destination. Hosts shared by
+// several commands come first, which highlights the third-party
+// services an application portfolio depends on.
+func NewMatrix(set []onf.ONF) Matrix {
+	var m Matrix
+	rows := make(map[string]int)
+	counts := make(map[string]map[string]int)
+	cmds := make(map[string]int)
+	for _, v := range set {
+		host, ok := DstHost(v)
+		if !ok || v.Cmd == "" {
+			continue
+		}
+		if _, ok := rows[v.Cmd]; !ok {
+			rows[v.Cmd] = len(m.Cmds)
+			m.Cmds = append(m.Cmds, v.Cmd)
+		}
+		if _, ok := counts[host]; !ok {
+			counts[host] = make(map[string]int)
+			m.Hosts = append(m.Hosts, host)
+		}
+		if counts[host][v.Cmd] == 0 {
+			cmds[host]++
+		}
+		counts[host][v.Cmd]++
+	}
+	sort.Slice(m.Hosts, func(i, j int) bool {
+		hi, hj := m.Hosts[i], m.Hosts[j]
+		if cmds[hi] != cmds[hj] {
+			return cmds[hi] > cmds[hj]
+		}
+		return hi < hj
+	})
+	m.Conns = make([][]int, len(m.Cmds))
+	for i, cmd := range m.Cmds {
+		m.Conns[i] = make([]int, len(m.Hosts))
+		for j, host := range m.Hosts {
+			m.Conns[i][j] = counts[host][cmd]
+		}
+	}
+	return m
+}
+
+// Peer is a remote host connected to a local port.
+type Peer struct {
+	Host   string
+	Conns  int            // number of connections from Host
+	States map[string]int // number of connections in each state
+}
+
+// Peers returns the remote hosts of `set` connected to the local
+// `port`, sorted by number of connections. It is the server side
+// counterpart of Summarize.
+func Peers(set []onf.ONF, port string) []Peer {
+	var acc []Peer
+	index := make(map[string]int)
+	for _, v := range set {
+		if v.Src == nil {
+			continue
+		}
+		_, sport, err := net.SplitHostPort(v.Src.String())
+		if err != nil || sport != port {
+			continue
+		}
+		host, ok := DstHost(v)
+		if !ok {
+			continue
+		}
+		i, ok := index[host]
+		if !ok {
+			i = len(acc)
+			index[host] = i
+			acc = append(acc, Peer{Host: host, States: make(map[string]int)})
+		}
+		acc[i].Conns++
+		if v.State != "" {
+			acc[i].States[v.State]++
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if acc[i].Conns != acc[j].Conns {
+			return acc[i].Conns > acc[j].Conns
+		}
+		return acc[i].Host < acc[j].Host
+	})
+	return acc
+}
+
+// Proc is a node of a process tree.
+type Proc struct {
+	Ppid int    // parent pid, 0 when unknown
+	Path string // executable path, empty when unknown
+}
+
+// Binary counts the connections of the processes running the same
+// executable, merging the instances of daemons running many copies of
+// the same worker.
+type Binary struct {
+	Path string
+	Pids []int // processes running Path owning or descending to a connection, sorted
+	Flat int   // connections owned by the processes running Path
+	Cum  int   // Flat, plus the connections owned by their descendants
+}
+
+// Binaries aggregates the open network files of `set` with a
+// destination by executable path, as pprof does with functions: the
+// flat count of a binary includes the connections owned by its
+// processes, the cumulative one those owned by their descendants too,
+// each connection counted once per binary. `tree` maps pids to their
+// parent and executable (see exe.Tree); processes with no known
+// executable are grouped by command name. The result is sorted by
+// flat count, then cumulative count, then path.
+func Binaries(set []onf.ONF, tree map[int]Proc) []Binary {
+	var acc []Binary
+	index := make(map[string]int)
+	pids := make(map[string]map[int]bool)
+	add := func(path string, pid int) int {
+		i, ok := index[path]
+		if !ok {
+			i = len(acc)
+			index[path] = i
+			pids[path] = make(map[int]bool)
+			acc = append(acc, Binary{Path: path})
+		}
+		if !pids[path][pid] {
+			pids[path][pid] = true
+			acc[i].Pids = append(acc[i].Pids, pid)
+		}
+		acc[i].Cum++
+		return i
+	}
+	for _, v := range set {
+		if _, ok := DstHost(v); !ok || v.Pid <= 0 {
+			continue
+		}
+		path := binaryPath(v, tree[v.Pid])
+		acc[add(path, v.Pid)].Flat++
+
+		seen := map[string]bool{path: true}
+		visited := map[int]bool{v.Pid: true}
+		for pid := tree[v.Pid].Ppid; pid > 0 && !visited[pid]; pid = tree[pid].Ppid {
+			visited[pid] = true
+			p := tree[pid].Path
+			if p == "" || seen[p] {
+				continue
+			}
+			seen[p] = true
+			add(p, pid)
+		}
+	}
+	for i := range acc {
+		sort.Ints(acc[i].Pids)
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if acc[i].Flat != acc[j].Flat {
+			return acc[i].Flat > acc[j].Flat
+		}
+		if acc[i].Cum != acc[j].Cum {
+			return acc[i].Cum > acc[j].Cum
+		}
+		return acc[i].Path < acc[j].Path
+	})
+	return acc
+}
+
+func binaryPath(f onf.ONF, p Proc) string {
+	switch {
+	case p.Path != "":
+		return p.Path
+	case f.Exe != nil && f.Exe.Path != "":
+		return f.Exe.Path
+	default:
+		return f.Cmd
+	}
+}
+
+// Snapshot is the set of open network files found by a lookup.
+type Snapshot struct {
+	Time time.Time
+	Set  []onf.ONF
+}
+
+// Beacon describes how regularly a destination host appears in a
+// series of snapshots.
+type Beacon struct {
+	Host       string
+	Cmds       []string // distinct commands connected to Host, in order of appearance
+	Seen       int      // number of snapshots Host appears in
+	Regularity float64  // 1 when Host appears at constant intervals, 0 when sporadic
+	Score      float64  // share of snapshots Host appears in, weighted by Regularity
+}
+
+// Beacons scores the destination hosts of `snaps` by regularity of
+// appearance: hosts contacted at constant intervals score higher than
+// hosts contacted sporadically, which flags beaconing and telemetry
+// endpoints. Regularity is 1 minus the coefficient of variation of the
+// intervals between consecutive appearances, and it is 0 for hosts
+// appearing less than 3 times. Snapshots are sorted by time. The result
+// is sorted by score, then host.
+func Beacons(snaps []Snapshot) []Beacon {
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	var acc []Beacon
+	index := make(map[string]int)
+	cmds := make(map[string]map[string]bool)
+	times := make(map[string][]time.Time)
+	for _, s := range snaps {
+		seen := make(map[string]bool)
+		for _, v := range s.Set {
+			host, ok := DstHost(v)
+			if !ok {
+				continue
+			}
+			i, ok := index[host]
+			if !ok {
+				i = len(acc)
+				index[host] = i
+				cmds[host] = make(map[string]bool)
+				acc = append(acc, Beacon{Host: host})
+			}
+			if v.Cmd != "" && !cmds[host][v.Cmd] {
+				cmds[host][v.Cmd] = true
+				acc[i].Cmds = append(acc[i].Cmds, v.Cmd)
+			}
+			if !seen[host] {
+				seen[host] = true
+				acc[i].Seen++
+				times[host] = append(times[host], s.Time)
+			}
+		}
+	}
+	for i, v := range acc {
+		acc[i].Regularity = regularity(times[v.Host])
+		acc[i].Score = float64(v.Seen) / float64(len(snaps)) * acc[i].Regularity
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if acc[i].Score != acc[j].Score {
+			return acc[i].Score > acc[j].Score
+		}
+		return acc[i].Host < acc[j].Host
+	})
+	return acc
+}
+
+// regularity returns 1 minus the coefficient of variation of the
+// intervals between `times`, clamped to [0, 1].
+func regularity(times []time.Time) float64 {
+	if len(times) < 3 {
+		return 0
+	}
+	intervals := make([]float64, len(times)-1)
+	var mean float64
+	for i := range intervals {
+		intervals[i] = float64(times[i+1].Sub(times[i]))
+		mean += intervals[i]
+	}
+	mean /= float64(len(intervals))
+	if mean <= 0 {
+		return 0
+	}
+	var variance float64
+	for _, v := range intervals {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(intervals))
+	r := 1 - math.Sqrt(variance)/mean
+	if r < 0 {
+		return 0
+	}
+	return r
+}
@@ -0,0 +1,226 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package aggr_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+var set0 = []onf.ONF{
+	{Cmd: "Spotify", Pid: 1, Src: tcp("10.0.0.2:5000"), Dst: tcp("35.186.224.47:443")},
+	{Cmd: "Spotify", Pid: 1, Src: tcp("10.0.0.2:5001"), Dst: tcp("35.186.224.47:443")},
+	{Cmd: "Spotify", Pid: 2, Src: tcp("10.0.0.2:5002"), Dst: tcp("35.186.224.53:80")},
+	{Cmd: "Spotify", Pid: 2, Src: tcp("*:57621"), Dst: tcp("")},
+}
+
+func TestSummarize(t *testing.T) {
+	t.Parallel()
+	s := aggr.Summarize(set0)
+	if s.Name() != "Spotify" {
+		t.Fatalf("Unexpected name: %s", s.Name())
+	}
+	if s.Files != 4 || s.Conns != 3 {
+		t.Fatalf("Unexpected counters: files %d, conns %d", s.Files, s.Conns)
+	}
+	if len(s.Pids) != 2 || len(s.Hosts) != 2 || len(s.Addrs) != 2 {
+		t.Fatalf("Unexpected summary: %+v", s)
+	}
+}
+
+func tcp(addr string) net.Addr {
+	return internal.NewAddr("tcp", addr)
+}
+
+func TestEndpoints(t *testing.T) {
+	t.Parallel()
+	set := append(set0[:len(set0):len(set0)], onf.ONF{Cmd: "x\ntouch /tmp/pwned", Src: tcp("10.0.0.2:5003"), Dst: tcp("35.186.224.53:80")})
+	dsts := aggr.Endpoints(set)
+	if len(dsts) != 2 {
+		t.Fatalf("Unexpected endpoints: %+v", dsts)
+	}
+	if want := []string{"Spotify", "x?touch /tmp/pwned"}; !reflect.DeepEqual(dsts[1].Cmds, want) {
+		t.Fatalf("Unexpected commands: wanted %q, found %q", want, dsts[1].Cmds)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	t.Parallel()
+	set := append(set0[:len(set0):len(set0)],
+		onf.ONF{Cmd: "curl", Src: tcp("10.0.0.2:5003"), Dst: tcp("35.186.224.47:80")},
+		onf.ONF{Cmd: "dig", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+	)
+	hosts := aggr.Hosts(set)
+	if len(hosts) != 3 {
+		t.Fatalf("Unexpected hosts: %+v", hosts)
+	}
+	if want := []string{"Spotify", "curl"}; hosts[0].IP.String() != "35.186.224.47" || !reflect.DeepEqual(hosts[0].Cmds, want) {
+		t.Fatalf("Unexpected host: %+v", hosts[0])
+	}
+	if hosts[1].IPv6() || !hosts[2].IPv6() {
+		t.Fatalf("Unexpected address families: %+v", hosts)
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in, want string
+	}{
+		{"Spotify", "Spotify"},
+		{"Google Chrome Helper", "Google Chrome Helper"},
+		{"x\ntouch /tmp/pwned", "x?touch /tmp/pwned"},
+		{"a\r\tb\x00c\u2028d", "a??b?c?d"},
+	}
+	for i, v := range tt {
+		if s := aggr.Printable(v.in); s != v.want {
+			t.Fatalf("%d: Unexpected printable string: wanted %q, found %q", i, v.want, s)
+		}
+	}
+}
+
+func TestTopDsts(t *testing.T) {
+	t.Parallel()
+	set := append([]onf.ONF{
+		{Cmd: "curl", Pid: 3, Src: tcp("10.0.0.2:6000"), Dst: tcp("35.186.224.53:80")},
+		{Cmd: "systemd-resolved", Pid: 4, Src: tcp("10.0.0.2:6001"), Dst: tcp("1.1.1.1:53")},
+	}, set0...)
+	top := aggr.TopDsts(set, 2)
+	if len(top) != 2 {
+		t.Fatalf("Unexpected number of destinations: %v", top)
+	}
+	if top[0].Addr != "35.186.224.53:80" || len(top[0].Cmds) != 2 {
+		t.Fatalf("Unexpected top destination: %+v", top[0])
+	}
+	if top[1].Addr != "1.1.1.1:53" {
+		t.Fatalf("Unexpected second destination: %+v", top[1])
+	}
+	if all := aggr.TopDsts(set, 0); len(all) != 3 {
+		t.Fatalf("Unexpected number of destinations: %v", all)
+	}
+}
+
+func TestNewMatrix(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "curl", Pid: 1, Src: tcp("10.0.0.2:6000"), Dst: tcp("35.186.224.53:80")},
+		{Cmd: "curl", Pid: 1, Src: tcp("10.0.0.2:6001"), Dst: tcp("35.186.224.53:443")},
+		{Cmd: "Spotify", Pid: 2, Src: tcp("10.0.0.2:6002"), Dst: tcp("35.186.224.53:443")},
+		{Cmd: "Spotify", Pid: 2, Src: tcp("10.0.0.2:6003"), Dst: tcp("1.1.1.1:53")},
+		{Cmd: "sshd", Pid: 3, Src: tcp("*:22"), Dst: tcp("")},
+	}
+	m := aggr.NewMatrix(set)
+	if !reflect.DeepEqual(m.Cmds, []string{"curl", "Spotify"}) {
+		t.Fatalf("Unexpected commands: %v", m.Cmds)
+	}
+	if !reflect.DeepEqual(m.Hosts, []string{"35.186.224.53", "1.1.1.1"}) {
+		t.Fatalf("Unexpected hosts: %v", m.Hosts)
+	}
+	if !reflect.DeepEqual(m.Conns, [][]int{{2, 0}, {1, 1}}) {
+		t.Fatalf("Unexpected connections: %v", m.Conns)
+	}
+	if m.Shared(0) != 2 || m.Shared(1) != 1 {
+		t.Fatalf("Unexpected shared counts: %d, %d", m.Shared(0), m.Shared(1))
+	}
+}
+
+func TestPeers(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "nginx", Pid: 1, Src: tcp("*:443"), State: "LISTEN"},
+		{Cmd: "nginx", Pid: 1, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.7:50000"), State: "ESTABLISHED"},
+		{Cmd: "nginx", Pid: 1, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.9:50001"), State: "ESTABLISHED"},
+		{Cmd: "nginx", Pid: 2, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.9:50002"), State: "CLOSE_WAIT"},
+		{Cmd: "curl", Pid: 3, Src: tcp("10.0.0.2:50003"), Dst: tcp("10.0.0.9:443"), State: "ESTABLISHED"},
+	}
+	peers := aggr.Peers(set, "443")
+	if len(peers) != 2 {
+		t.Fatalf("Unexpected peers: %+v", peers)
+	}
+	if p := peers[0]; p.Host != "10.0.0.9" || p.Conns != 2 || p.States["ESTABLISHED"] != 1 || p.States["CLOSE_WAIT"] != 1 {
+		t.Fatalf("Unexpected first peer: %+v", p)
+	}
+	if p := peers[1]; p.Host != "10.0.0.7" || p.Conns != 1 {
+		t.Fatalf("Unexpected second peer: %+v", p)
+	}
+}
+
+func TestBinaries(t *testing.T) {
+	t.Parallel()
+	// systemd (1) runs nginx (10), whose workers (11, 12) run the same
+	// binary, and a shell (20) running curl (21).
+	tree := map[int]aggr.Proc{
+		1:  {Path: "/lib/systemd/systemd"},
+		10: {Ppid: 1, Path: "/usr/sbin/nginx"},
+		11: {Ppid: 10, Path: "/usr/sbin/nginx"},
+		12: {Ppid: 10, Path: "/usr/sbin/nginx"},
+		20: {Ppid: 1, Path: "/bin/bash"},
+		21: {Ppid: 20},
+	}
+	set := []onf.ONF{
+		{Cmd: "nginx", Pid: 10, Src: tcp("*:443")},
+		{Cmd: "nginx", Pid: 11, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.7:50000")},
+		{Cmd: "nginx", Pid: 11, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.9:50001")},
+		{Cmd: "nginx", Pid: 12, Src: tcp("10.0.0.2:443"), Dst: tcp("10.0.0.9:50002")},
+		{Cmd: "curl", Pid: 21, Src: tcp("10.0.0.2:50003"), Dst: tcp("10.0.0.9:443")},
+	}
+	want := []aggr.Binary{
+		{Path: "/usr/sbin/nginx", Pids: []int{11, 12}, Flat: 3, Cum: 3},
+		{Path: "curl", Pids: []int{21}, Flat: 1, Cum: 1},
+		{Path: "/lib/systemd/systemd", Pids: []int{1}, Flat: 0, Cum: 4},
+		{Path: "/bin/bash", Pids: []int{20}, Flat: 0, Cum: 1},
+	}
+	if bins := aggr.Binaries(set, tree); !reflect.DeepEqual(want, bins) {
+		t.Fatalf("Unexpected binaries: wanted %+v, found %+v", want, bins)
+	}
+}
+
+func TestBeacons(t *testing.T) {
+	t.Parallel()
+	telemetry := onf.ONF{Cmd: "Spotify", Pid: 1, Src: tcp("10.0.0.2:5000"), Dst: tcp("35.186.224.47:443")}
+	web := onf.ONF{Cmd: "curl", Pid: 2, Src: tcp("10.0.0.2:5001"), Dst: tcp("93.184.216.34:443")}
+	listen := onf.ONF{Cmd: "sshd", Pid: 3, Src: tcp("*:22")}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	snaps := []aggr.Snapshot{
+		{Time: at(0), Set: []onf.ONF{telemetry, web, listen}},
+		{Time: at(5), Set: []onf.ONF{listen}},
+		{Time: at(10), Set: []onf.ONF{telemetry, listen}},
+		{Time: at(1), Set: []onf.ONF{web}},
+		{Time: at(15), Set: []onf.ONF{listen}},
+		{Time: at(20), Set: []onf.ONF{telemetry, telemetry}},
+		{Time: at(30), Set: []onf.ONF{telemetry, web}},
+	}
+	beacons := aggr.Beacons(snaps)
+	if len(beacons) != 2 {
+		t.Fatalf("Unexpected beacons: %+v", beacons)
+	}
+	if b := beacons[0]; b.Host != "35.186.224.47" || b.Seen != 4 || b.Regularity != 1 || b.Score != 4.0/7 {
+		t.Fatalf("Unexpected first beacon: %+v", b)
+	}
+	if b := beacons[1]; b.Host != "93.184.216.34" || b.Seen != 3 || b.Regularity >= 0.5 {
+		t.Fatalf("Unexpected second beacon: %+v", b)
+	}
+	if r := aggr.Beacons(snaps[:2]); r[0].Regularity != 0 || r[0].Score != 0 {
+		t.Fatalf("Unexpected score of a host seen once: %+v", r[0])
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package batch describes audits of several targets, run in a single
+// invocation against the same snapshot of the open network files of
+// the system (see "lsaddr batch").
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/expr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Spec is the content of a job file.
+type Spec struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Job selects a subset of the open network files, enriches and
+// encodes it. Its fields mirror the flags of the same name.
+type Job struct {
+	Name   string `json:"name"`   // used in error messages, defaults to the position of the job
+	Target string `json:"target"` // regular expression or application bundle, every open network file when empty
+
+	// Filters.
+	To         string   `json:"to"`
+	Proto      string   `json:"proto"`
+	State      string   `json:"state"`
+	DstNet     []string `json:"dst_net"`
+	NotDstNet  []string `json:"not_dst_net"`
+	NoLoopback bool     `json:"no_loopback"`
+	Where      string   `json:"where"`
+
+	// Enrichments.
+	Resolve    bool     `json:"resolve"`
+	ResolveSrc bool     `json:"resolve_src"`
+	Exe        bool     `json:"exe"`
+	GeoIP      []string `json:"geoip"`
+
+	Format string   `json:"format"` // csv when empty
+	Opts   []string `json:"opts"`   // as "<format>.<key>=<value>"
+	Output string   `json:"output"` // stdout when empty
+}
+
+// Read decodes the job file read from `r`. Unknown fields are refused,
+// as they are likely misspelled options.
+func Read(r io.Reader) (Spec, error) {
+	var s Spec
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("unable to decode jobs: %w", err)
+	}
+	if len(s.Jobs) == 0 {
+		return s, fmt.Errorf("unable to decode jobs: no job found")
+	}
+	for i := range s.Jobs {
+		j := &s.Jobs[i]
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if j.Format == "" {
+			j.Format = "csv"
+		}
+		if j.Output == "" {
+			j.Output = "-"
+		}
+		if strings.TrimSpace(j.Target) == "" {
+			j.Target = onf.All
+		}
+	}
+	return s, nil
+}
+
+// Select returns the open network files of `set` selected by the
+// target and the filters of `j`. `set` is not modified.
+func (j Job) Select(ctx context.Context, set []onf.ONF) ([]onf.ONF, error) {
+	acc, err := onf.Filter(set, j.Target)
+	if err != nil {
+		return nil, err
+	}
+	// Filter returns `set` itself when every open network file is
+	// selected: copy it, as enrichers modify their input.
+	acc = append([]onf.ONF(nil), acc...)
+	if j.To != "" {
+		t, err := onf.ParseTarget(ctx, j.To, nil)
+		if err != nil {
+			return nil, err
+		}
+		acc = onf.FilterTarget(acc, t)
+	}
+	p, err := onf.ParseProtos(j.Proto)
+	if err != nil {
+		return nil, err
+	}
+	acc = onf.FilterStates(onf.FilterProtos(acc, p), onf.ParseStates(j.State))
+	var n onf.DstNets
+	if n.In, err = onf.ParseNets(j.DstNet); err != nil {
+		return nil, err
+	}
+	if n.Out, err = onf.ParseNets(j.NotDstNet); err != nil {
+		return nil, err
+	}
+	acc = onf.FilterDstNets(acc, n)
+	if j.NoLoopback {
+		acc = onf.FilterLocal(acc)
+	}
+	if j.Where != "" {
+		e, err := expr.Compile(j.Where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid where expression: %w", err)
+		}
+		if acc, err = expr.Filter(acc, e); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package batch_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/batch"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	s, err := batch.Read(strings.NewReader(`{"jobs": [
+		{"name": "spotify", "target": "Spotify", "format": "ndjson", "output": "spotify.ndjson"},
+		{"proto": "tcp"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(s.Jobs) != 2 {
+		t.Fatalf("Unexpected jobs: %+v", s.Jobs)
+	}
+	if j := s.Jobs[0]; j.Name != "spotify" || j.Format != "ndjson" || j.Output != "spotify.ndjson" {
+		t.Fatalf("Unexpected job: %+v", j)
+	}
+	if j := s.Jobs[1]; j.Name != "#2" || j.Target != onf.All || j.Format != "csv" || j.Output != "-" {
+		t.Fatalf("Unexpected job: %+v", j)
+	}
+
+	for _, v := range []string{`{"jobs": []}`, `{"jobs": [{"taget": "Spotify"}]}`, `[`} {
+		if _, err := batch.Read(strings.NewReader(v)); err == nil {
+			t.Fatalf("Expected an error decoding %s", v)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Raw: "Spotify 1", Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443"), State: "ESTABLISHED"},
+		{Raw: "Spotify 1", Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Raw: "code 2", Cmd: "code", Pid: 2, Src: internal.NewAddr("tcp", "127.0.0.1:5001"), Dst: internal.NewAddr("tcp", "127.0.0.1:6000"), State: "ESTABLISHED"},
+		{Raw: "curl 3", Cmd: "curl", Pid: 3, Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "10.0.0.7:80"), State: "ESTABLISHED"},
+	}
+	tt := []struct {
+		job  batch.Job
+		pids []int
+	}{
+		{batch.Job{Target: onf.All}, []int{1, 1, 2, 3}},
+		{batch.Job{Target: "Spotify", Proto: "tcp"}, []int{1}},
+		{batch.Job{Target: onf.All, NoLoopback: true, NotDstNet: []string{"10.0.0.0/8"}}, []int{1, 1}},
+		{batch.Job{Target: onf.All, State: "established", Where: "dst.port == 80"}, []int{3}},
+	}
+	for i, v := range tt {
+		acc, err := v.job.Select(context.Background(), set)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+		}
+		for j, f := range acc {
+			if f.Pid != v.pids[j] {
+				t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+			}
+		}
+	}
+	if _, err := (batch.Job{Target: onf.All, Proto: "sctp"}).Select(context.Background(), set); err == nil {
+		t.Fatalf("Expected an error with an invalid protocol")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package binaries encodes open network files into a pprof-like report
+// of the connections of each executable.
+package binaries
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Tree returns the process tree of the open network files of a set,
+// see aggr.Binaries.
+type Tree func([]onf.ONF) map[int]aggr.Proc
+
+// Encoder writes one line for each executable, with the flat and
+// cumulative number of connections of its processes (see
+// aggr.Binaries), and their share of the total.
+type Encoder struct {
+	w    io.Writer
+	tree Tree
+}
+
+// NewEncoder returns an Encoder using `tree` to attribute connections
+// to the ancestors of their processes. When nil, only flat counts are
+// computed.
+func NewEncoder(w io.Writer, tree Tree) *Encoder {
+	return &Encoder{w: w, tree: tree}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	var tree map[int]aggr.Proc
+	if e.tree != nil {
+		tree = e.tree(set)
+	}
+	bins := aggr.Binaries(set, tree)
+	var total int
+	for _, v := range bins {
+		total += v.Flat
+	}
+	tw := tabwriter.NewWriter(e.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FLAT\tFLAT%\tCUM\tCUM%\tPIDS\tBINARY")
+	for _, v := range bins {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%d\t%s\n", v.Flat, percent(v.Flat, total), v.Cum, percent(v.Cum, total), len(v.Pids), v.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
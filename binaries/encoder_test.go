@@ -0,0 +1,53 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package binaries_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/binaries"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "nginx", Pid: 11, Src: internal.NewAddr("tcp", "10.0.0.2:443"), Dst: internal.NewAddr("tcp", "10.0.0.7:50000")},
+		{Cmd: "nginx", Pid: 12, Src: internal.NewAddr("tcp", "10.0.0.2:443"), Dst: internal.NewAddr("tcp", "10.0.0.9:50002")},
+		{Cmd: "curl", Pid: 21, Src: internal.NewAddr("tcp", "10.0.0.2:50003"), Dst: internal.NewAddr("tcp", "10.0.0.9:443")},
+	}
+	tree := func([]onf.ONF) map[int]aggr.Proc {
+		return map[int]aggr.Proc{
+			10: {Path: "/usr/sbin/nginx"},
+			11: {Ppid: 10, Path: "/usr/sbin/nginx"},
+			12: {Ppid: 10, Path: "/usr/sbin/nginx"},
+		}
+	}
+	var b bytes.Buffer
+	if err := binaries.NewEncoder(&b, tree).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `FLAT  FLAT%  CUM  CUM%   PIDS  BINARY
+2     66.7%  2    66.7%  2     /usr/sbin/nginx
+1     33.3%  1    33.3%  1     curl
+`
+	if b.String() != want {
+		t.Fatalf("Unexpected output: wanted\n%s\nfound\n%s", want, b.String())
+	}
+}
@@ -17,27 +17,119 @@ package bpf
 import (
 	"fmt"
 	"io"
+	"net"
+	"strconv"
 
+	"github.com/jecoz/lsaddr/internal"
 	"github.com/jecoz/lsaddr/onf"
 )
 
 type Encoder struct {
-	w io.Writer
+	w      io.Writer
+	dir    Dir
+	stable bool
+	ports  PortRange
 }
 
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: w}
+	return &Encoder{w: w, dir: NODIR, ports: EphemeralRange()}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "direction": "src" or "dst" restricts the expression of each
+// address to the packets coming from or headed to it, respectively.
+// "both" (the default) matches packets in both directions.
+// - "stable": "true" leaves out the addresses with an ephemeral port
+// (see EphemeralRange), which are soon reused by other applications,
+// so that captures started later do not pick up unrelated traffic.
+// When both addresses of a connection have an ephemeral port, the
+// destination host is kept, without port.
+// - "ephemeral": the ephemeral port range, as "<lo>-<hi>", of the host
+// the expression is used on, instead of the local one.
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "direction":
+			switch v {
+			case "src":
+				e.dir = SRC
+			case "dst":
+				e.dir = DST
+			case "both":
+				e.dir = NODIR
+			default:
+				return nil, fmt.Errorf("invalid direction %q: expected src, dst or both", v)
+			}
+		case "stable":
+			stable, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stable option %q: %w", v, err)
+			}
+			e.stable = stable
+		case "ephemeral":
+			r, err := ParsePortRange(v)
+			if err != nil {
+				return nil, err
+			}
+			e.ports = r
+		default:
+			return nil, fmt.Errorf("unknown bpf option %q", k)
+		}
+	}
+	return e, nil
 }
 
 func (e *Encoder) Encode(set []onf.ONF) error {
-	var expr Expr
+	addrs := make([]net.Addr, 0, 2*len(set))
+	for _, v := range set {
+		if !e.stable {
+			addrs = append(addrs, v.Src, v.Dst)
+			continue
+		}
+		src, dst := v.Src, v.Dst
+		if src != nil && ephemeral(e.ports, src) {
+			src = nil
+		}
+		if dst != nil && ephemeral(e.ports, dst) {
+			if src != nil {
+				dst = nil
+			} else if host, _, err := net.SplitHostPort(dst.String()); err == nil {
+				dst = internal.NewAddr(dst.Network(), net.JoinHostPort(host, "*"))
+			}
+		}
+		addrs = append(addrs, src, dst)
+	}
+	return e.EncodeAddrs(addrs)
+}
+
+// Ephemeral returns the number of addresses of `set` with an ephemeral
+// port the expression written by Encode filters on: as these ports are
+// soon reused by other applications, captures started later may pick
+// up unrelated traffic. It is always zero with the "stable" option.
+func (e *Encoder) Ephemeral(set []onf.ONF) int {
+	if e.stable {
+		return 0
+	}
+	var n int
 	for _, v := range set {
-		src := string(FromAddr(NODIR, v.Src).Wrap())
-		dst := string(FromAddr(NODIR, v.Dst).Wrap())
-		expr = expr.Or(src).Or(dst)
+		for _, addr := range []net.Addr{v.Src, v.Dst} {
+			if addr != nil && ephemeral(e.ports, addr) {
+				n++
+			}
+		}
 	}
-	if _, err := io.Copy(e.w, expr.NewReader()); err != nil {
-		return fmt.Errorf("unable to encode open network files: %w", err)
+	return n
+}
+
+// EncodeAddrs writes the expression matching the packets headed to or
+// coming from any of `addrs`, which do not need to belong to an open
+// network file: host/port tuples can be provided as *net.TCPAddr or
+// *net.UDPAddr values.
+func (e *Encoder) EncodeAddrs(addrs []net.Addr) error {
+	if _, err := io.Copy(e.w, fromAddrs(e.dir, addrs).NewReader()); err != nil {
+		return fmt.Errorf("unable to encode addresses: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,87 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package bpf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Lo, Hi int
+}
+
+// IANARange is the ephemeral port range suggested by IANA, used by
+// windows, macOS and most BSDs.
+var IANARange = PortRange{Lo: 49152, Hi: 65535}
+
+// ParsePortRange parses `s`, a range in the "<lo>-<hi>" form.
+func ParsePortRange(s string) (PortRange, error) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		return PortRange{}, fmt.Errorf("invalid port range %q: expected <lo>-<hi>", s)
+	}
+	lo, err := strconv.Atoi(strings.TrimSpace(s[:i]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(s[i+1:]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if lo < 1 || hi > 65535 || lo > hi {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{Lo: lo, Hi: hi}, nil
+}
+
+// Contains reports whether `port` falls inside `r`.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.Lo && port <= r.Hi
+}
+
+// EphemeralRange returns the range ports are allocated from when
+// sockets are bound implicitly, as configured on linux, or IANARange
+// elsewhere. Once released, these ports are soon handed to other
+// applications.
+func EphemeralRange() PortRange {
+	data, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return IANARange
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return IANARange
+	}
+	r, err := ParsePortRange(fields[0] + "-" + fields[1])
+	if err != nil {
+		return IANARange
+	}
+	return r
+}
+
+// ephemeral reports whether the port of `addr` falls inside `r`.
+func ephemeral(r PortRange, addr net.Addr) bool {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && r.Contains(n)
+}
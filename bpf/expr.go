@@ -84,6 +84,24 @@ func FromAddr(d Dir, addr net.Addr) Expr {
 	return expr.And(string(d)).Join(addrExprRaw) // and <src, dst>
 }
 
+// FromAddrs returns the disjunction of the expressions matching
+// each address of `addrs`, in both directions. Nil addresses are
+// skipped.
+func FromAddrs(addrs []net.Addr) Expr {
+	return fromAddrs(NODIR, addrs)
+}
+
+func fromAddrs(d Dir, addrs []net.Addr) Expr {
+	var expr Expr
+	for _, v := range addrs {
+		if v == nil {
+			continue
+		}
+		expr = expr.Or(string(FromAddr(d, v).Wrap()))
+	}
+	return expr
+}
+
 func fromAddr(addr net.Addr) Expr {
 	var expr Expr
 	host, port, err := net.SplitHostPort(addr.String())
@@ -15,10 +15,12 @@
 package bpf_test
 
 import (
+	"net"
 	"strings"
 	"testing"
 
 	"github.com/jecoz/lsaddr/bpf"
+	"github.com/jecoz/lsaddr/onf"
 )
 
 func TestJoin(t *testing.T) {
@@ -136,3 +138,70 @@ func (a addr) Network() string {
 func (a addr) String() string {
 	return a.host
 }
+
+func TestFromAddrs(t *testing.T) {
+	t.Parallel()
+	addrs := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+		nil,
+		&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 53},
+		newAddr("tcp://*:*"),
+	}
+	want := "(tcp and host 10.0.0.1 and port 443) or (udp and host 10.0.0.2 and port 53) or (tcp)"
+	if expr := bpf.FromAddrs(addrs); string(expr) != want {
+		t.Fatalf("expected \"%v\", found \"%v\"", want, expr)
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	t.Parallel()
+	var b strings.Builder
+	enc, err := bpf.NewEncoderOptions(&b, map[string]string{"direction": "dst"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := enc.EncodeAddrs([]net.Addr{&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "(tcp and dst host 10.0.0.1 and port 443)\n"; b.String() != want {
+		t.Fatalf("expected \"%v\", found \"%v\"", want, b.String())
+	}
+	if _, err := bpf.NewEncoderOptions(&b, map[string]string{"direction": "up"}); err == nil {
+		t.Fatalf("Expected an error for an invalid direction")
+	}
+}
+
+func TestEncoderStable(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Src: newAddr("tcp://10.0.0.2:51291"), Dst: newAddr("tcp://35.186.224.47:443")},
+		{Src: newAddr("tcp://10.0.0.2:22"), Dst: newAddr("tcp://10.0.0.7:50000")},
+		{Src: newAddr("udp://10.0.0.2:50001"), Dst: newAddr("udp://10.0.0.9:50002")},
+	}
+	var b strings.Builder
+	enc, err := bpf.NewEncoderOptions(&b, map[string]string{"stable": "true", "ephemeral": "49152-65535"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := enc.Ephemeral(set); n != 0 {
+		t.Fatalf("Unexpected ephemeral ports: %d", n)
+	}
+	if err := enc.Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "(tcp and host 35.186.224.47 and port 443) or (tcp and host 10.0.0.2 and port 22) or (udp and host 10.0.0.9)\n"
+	if b.String() != want {
+		t.Fatalf("expected \"%v\", found \"%v\"", want, b.String())
+	}
+
+	enc, err = bpf.NewEncoderOptions(&b, map[string]string{"ephemeral": "49152-65535"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := enc.Ephemeral(set); n != 4 {
+		t.Fatalf("Unexpected ephemeral ports: wanted 4, found %d", n)
+	}
+	if _, err := bpf.NewEncoderOptions(&b, map[string]string{"ephemeral": "60000-50000"}); err == nil {
+		t.Fatalf("Expected an error for an invalid port range")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Cache stores lookup results on disk, so that repeated invocations
+// within TTL do not have to run the external tools again.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+type entry struct {
+	StoredAt time.Time `json:"stored_at"`
+	Files    []onf.ONF `json:"files"`
+}
+
+// New returns a Cache rooted in the user's cache directory
+// (i.e. $XDG_CACHE_HOME/lsaddr on linux).
+func New(ttl time.Duration) (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to locate cache directory: %w", err)
+	}
+	return &Cache{
+		Dir: filepath.Join(dir, "lsaddr"),
+		TTL: ttl,
+	}, nil
+}
+
+// Key returns the cache key associated with the results produced
+// by `backend` when filtered with `filter`.
+func Key(backend, filter string) string {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		filter = "*"
+	}
+	sum := sha256.Sum256([]byte(backend + "\x00" + filter))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get returns the entry stored under `key`, if present and
+// not older than the cache's TTL.
+func (c *Cache) Get(key string) ([]onf.ONF, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Discarding corrupted cache entry %s: %v", key, err)
+		return nil, false
+	}
+	if time.Since(e.StoredAt) > c.TTL {
+		return nil, false
+	}
+	return e.Files, true
+}
+
+// Put stores `set` under `key`, replacing any previous entry.
+func (c *Cache) Put(key string, set []onf.ONF) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return fmt.Errorf("unable to create cache directory: %w", err)
+	}
+	data, err := json.Marshal(entry{
+		StoredAt: time.Now(),
+		Files:    set,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode cache entry: %w", err)
+	}
+	f, err := ioutil.TempFile(c.Dir, key)
+	if err != nil {
+		return fmt.Errorf("unable to store cache entry: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to store cache entry: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to store cache entry: %w", err)
+	}
+	return os.Rename(f.Name(), c.path(key))
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/cache"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &cache.Cache{Dir: dir, TTL: time.Minute}
+	key := cache.Key("lsof", "Spotify")
+	if _, ok := c.Get(key); ok {
+		t.Fatalf("Unexpected cache hit on empty cache")
+	}
+
+	set := []onf.ONF{{
+		Cmd: "Spotify",
+		Pid: 11778,
+		Src: internal.NewAddr("tcp", "192.168.0.61:51291"),
+		Dst: internal.NewAddr("tcp", "35.186.224.47:443"),
+	}}
+	if err := c.Put(key, set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cached, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("Expected cache hit")
+	}
+	if len(cached) != 1 {
+		t.Fatalf("Unexpected cached set length: wanted 1, found %d", len(cached))
+	}
+	if s := cached[0].String(); s != set[0].String() {
+		t.Fatalf("Unexpected cached value: wanted %v, found %v", set[0], s)
+	}
+
+	c.TTL = 0
+	if _, ok := c.Get(key); ok {
+		t.Fatalf("Unexpected cache hit on expired entry")
+	}
+}
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+	if cache.Key("lsof", "") != cache.Key("lsof", " * ") {
+		t.Fatalf("Expected empty and wildcard filters to share the same key")
+	}
+	if cache.Key("lsof", "foo") == cache.Key("netstat", "foo") {
+		t.Fatalf("Expected different backends to produce different keys")
+	}
+}
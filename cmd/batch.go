@@ -0,0 +1,160 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jecoz/lsaddr/batch"
+	"github.com/jecoz/lsaddr/exe"
+	"github.com/jecoz/lsaddr/geoip"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/proxy"
+	"github.com/jecoz/lsaddr/resolve"
+	"github.com/jecoz/lsaddr/transport"
+	"github.com/spf13/cobra"
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <jobs.json>",
+	Short: "Run the audits described by a job file against a single snapshot.",
+	Long: `Run the audits described by a JSON job file, sharing a single snapshot of the open network files
+of the system: the external tool is executed once, however many jobs are listed. Each job selects,
+enriches and encodes a subset of the snapshot, and writes it to its own output, as:
+
+  {"jobs": [
+    {"name": "spotify", "target": "Spotify", "proto": "tcp", "resolve": true,
+     "format": "ndjson", "output": "spotify.ndjson"},
+    {"name": "outside", "not_dst_net": ["10.0.0.0/8"], "no_loopback": true, "output": "outside.csv"}
+  ]}
+
+Supported fields are "name", "target" (the filter argument, every open network file when empty), the
+filters "to", "proto", "state", "dst_net", "not_dst_net", "no_loopback" and "where", the enrichments
+"resolve", "resolve_src", "exe" and "geoip" (a list of paths), "format" (csv by default), "opts" (a list
+of "<format>.<key>=<value>" options) and "output" (stdout by default). They work as the flags of the
+same name. Reverse DNS lookups are configured by the "--dns" flags.
+
+Failed jobs are reported on stderr without stopping the others, and make the command exit with status 1.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		spec, err := batch.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		set, err := onf.FetchContext(runCtx, onf.All)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		if ok, reason := onf.Partial(); ok {
+			fmt.Fprintf(os.Stderr, "warning: results may be incomplete: %s\n", reason)
+		}
+		if tagProxies {
+			proxy.Tag(runCtx, set, proxy.Detect())
+		}
+
+		code := 0
+		for _, v := range spec.Jobs {
+			if err := runJob(v, set); err != nil {
+				fmt.Fprintf(os.Stderr, "error: job %s: %v\n", v.Name, err)
+				code = 1
+			}
+		}
+		os.Exit(code)
+	},
+}
+
+// runJob selects the open network files of `set` described by `j`,
+// enriching and writing them to its output.
+func runJob(j batch.Job, set []onf.ONF) error {
+	ctx := runCtx
+	set, err := j.Select(ctx, set)
+	if err != nil {
+		return err
+	}
+	log.Printf("Job %s: # of open network files: %d", j.Name, len(set))
+	if j.Exe {
+		exe.Run(ctx, set)
+	}
+	if j.Resolve || j.ResolveSrc {
+		r, err := resolve.New(resolve.Options{
+			Server:  dnsServer,
+			DoH:     dnsDoH,
+			Rate:    dnsRate,
+			Timeout: dnsTimeout,
+		})
+		if err != nil {
+			return err
+		}
+		var which resolve.Addrs
+		if j.Resolve {
+			which |= resolve.Dst
+		}
+		if j.ResolveSrc {
+			which |= resolve.Src
+		}
+		resolve.RunAddrs(ctx, set, r, which)
+	}
+	if len(j.GeoIP) > 0 {
+		var dbs []*geoip.DB
+		for _, v := range j.GeoIP {
+			db, err := geoip.Open(strings.TrimSpace(v))
+			if err != nil {
+				return err
+			}
+			dbs = append(dbs, db)
+		}
+		geoip.Annotate(ctx, set, dbs)
+	}
+
+	out, err := transport.OpenContext(ctx, j.Output, transport.Options{
+		ContentType: contentType(j.Format),
+	})
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	enc, err := newEncoderOpts(w, j.Format, j.Opts)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	onf.Sort(set)
+	if err := enc.Encode(set); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to encode output: %w", err)
+	}
+	w.Flush()
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to deliver output: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+}
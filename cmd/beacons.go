@@ -0,0 +1,120 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/record"
+	"github.com/spf13/cobra"
+)
+
+var minScore float64
+
+var beaconsCmd = &cobra.Command{
+	Use:   "beacons <snapshot|recording>...",
+	Short: "Score destinations by regularity of appearance across recorded snapshots.",
+	Long: `Score the destination hosts of a series of recorded snapshots by regularity of appearance,
+flagging likely beaconing and telemetry endpoints: hosts contacted at constant intervals score higher
+than hosts contacted sporadically. Each snapshot is a file produced by "lsaddr --format ndjson", for
+example recorded every minute by cron, and its time is the earliest "created_at" of its records.
+Recordings produced with "lsaddr --record" are accepted too, and contribute all their snapshots.
+
+The SCORE column is the share of snapshots the host appears in, weighted by REGULARITY, that is 1 minus
+the coefficient of variation of the intervals between consecutive appearances (0 for hosts appearing
+less than 3 times). Only hosts scoring at least "--min-score" are listed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		snaps := make([]aggr.Snapshot, 0, len(args))
+		for _, v := range args {
+			s, err := readSnapshots(v)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			snaps = append(snaps, s...)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "SCORE\tSEEN\tREGULARITY\tHOST\tCOMMANDS")
+		for _, v := range aggr.Beacons(snaps) {
+			if v.Score < minScore {
+				continue
+			}
+			fmt.Fprintf(tw, "%.2f\t%d/%d\t%.2f\t%s\t%s\n", v.Score, v.Seen, len(snaps), v.Regularity, v.Host, strings.Join(v.Cmds, ","))
+		}
+		tw.Flush()
+	},
+}
+
+// readSnapshots decodes the file at `path`, that is either a
+// recording (see the record package), or a single snapshot made of
+// NDJSON records.
+func readSnapshots(path string) ([]aggr.Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot: %w", err)
+	}
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if json.NewDecoder(bytes.NewReader(data)).Decode(&probe) == nil && probe.Type != "" {
+		snaps, err := record.ReadAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return snaps, nil
+	}
+
+	var s aggr.Snapshot
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var v onf.ONF
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to decode snapshot %s: %w", path, err)
+		}
+		if s.Time.IsZero() || v.CreatedAt.Before(s.Time) {
+			s.Time = v.CreatedAt
+		}
+		s.Set = append(s.Set, v)
+	}
+	if s.Time.IsZero() {
+		// Empty snapshots still count, at the time they were
+		// recorded.
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read snapshot: %w", err)
+		}
+		s.Time = info.ModTime()
+	}
+	return []aggr.Snapshot{s}, nil
+}
+
+func init() {
+	beaconsCmd.Flags().Float64VarP(&minScore, "min-score", "", 0.5, "Minimum score of the hosts listed, between 0 and 1.")
+	rootCmd.AddCommand(beaconsCmd)
+}
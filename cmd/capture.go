@@ -0,0 +1,194 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"github.com/jecoz/lsaddr/bpf"
+	"github.com/jecoz/lsaddr/expr"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	captureIface string
+	captureFile  string
+)
+
+var captureCmd = &cobra.Command{
+	Use:   "capture <filter>...",
+	Short: "Capture the traffic of the open network files matching the filters with tcpdump.",
+	Long: `Capture the traffic of the open network files matching the filters, which are the same accepted
+by lsaddr: the BPF expression produced by the "bpf" format is built and passed to tcpdump (windump on
+windows), which is executed in place of lsaddr, printing the packets captured or, with "--write"
+("-w"), writing them to a pcap file. The options of the bpf format apply, i.e. "--opt
+bpf.stable=true" leaves out ephemeral ports, soon reused by other applications. Capturing usually
+requires administrative privileges. Interrupt tcpdump to stop the capture: its exit status is
+returned.
+
+The open network files captured are selected by the filters and by the flags that narrow them down,
+as "-4", "--tcp", "--state", "--dst-net", "--to" and "--where" do. "--timeout" bounds the lookup.
+
+In hardened mode tcpdump must be allowed with "--allow-exec tcpdump=<path>".`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, v := range args {
+			if strings.TrimSpace(v) == "" {
+				fmt.Fprintf(os.Stderr, "error: empty filter\n")
+				os.Exit(1)
+			}
+		}
+		target, err := parseFilters()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		var e *expr.Expr
+		if where != "" {
+			if e, err = expr.Compile(where); err != nil {
+				fmt.Fprintf(os.Stderr, "error: invalid \"--where\" expression: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		pivot := onf.Any(args...)
+		set, err := onf.FetchContext(runCtx, pivot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		if len(set) == 0 {
+			err := onf.Diagnose(pivot)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		set = filterSet(set, target)
+		if e != nil {
+			if set, err = expr.Filter(set, e); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if ok, reason := onf.Partial(); ok {
+			fmt.Fprintf(os.Stderr, "warning: results may be incomplete: %s\n", reason)
+		}
+
+		var b bytes.Buffer
+		opts, err := encoderOptions("bpf", encOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		enc, err := bpf.NewEncoderOptions(&b, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := enc.Encode(set); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		expr := strings.TrimSpace(b.String())
+		if expr == "" {
+			fmt.Fprintf(os.Stderr, "error: the open network files matching the filters have no address to capture\n")
+			os.Exit(1)
+		}
+		if n := enc.Ephemeral(set); n > 0 {
+			fmt.Fprintf(os.Stderr, "warning: the expression filters on %d ephemeral ports, which may soon be reused by other applications: use \"--opt bpf.stable=true\" to filter on stable ports only\n", n)
+		}
+
+		code, err := runCapture(captureArgs(captureIface, captureFile, expr))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		os.Exit(code)
+	},
+}
+
+// captureTool returns the name of the packet capture tool of the
+// platform.
+func captureTool() string {
+	if runtime.GOOS == "windows" {
+		return "windump"
+	}
+	return "tcpdump"
+}
+
+// captureArgs returns the arguments of the capture tool, capturing the
+// packets matching `expr` on `iface` (the default interface of the tool
+// when empty) and writing them to `file`, when not empty. Packets are
+// written as soon as they are captured, so that the pcap file can be
+// followed while the capture is running.
+func captureArgs(iface, file, expr string) []string {
+	var args []string
+	if iface != "" {
+		args = append(args, "-i", iface)
+	}
+	if file != "" {
+		args = append(args, "-U", "-w", file)
+	}
+	return append(args, expr)
+}
+
+// runCapture executes the capture tool with `args`, inheriting the
+// standard streams, and returns its exit status. Interrupts are left
+// to the tool, which receives them as part of the same process group
+// and flushes its output before exiting.
+func runCapture(args []string) (int, error) {
+	name := captureTool()
+	path := name
+	if a, ok := runner.Default.(*runner.Allowlist); ok {
+		p, ok := a.Path(name)
+		if !ok {
+			return 1, fmt.Errorf("unable to run %s: %w", name, runner.ErrNotAllowed)
+		}
+		path = p
+	}
+	log.Printf("Executing: %s %s", name, strings.Join(args, " "))
+	c := exec.Command(path, args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	err := c.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, fmt.Errorf("unable to run %s: %w", name, err)
+	}
+	return 0, nil
+}
+
+func init() {
+	captureCmd.Flags().StringVarP(&captureIface, "interface", "i", "", "Interface to capture on, instead of the default one of tcpdump.")
+	captureCmd.Flags().StringVarP(&captureFile, "write", "w", "", "Write the packets captured to a pcap file, instead of printing them.")
+	rootCmd.AddCommand(captureCmd)
+}
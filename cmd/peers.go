@@ -0,0 +1,75 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/spf13/cobra"
+)
+
+var peersCmd = &cobra.Command{
+	Use:   "peers <listen-port>",
+	Short: "List the remote peers connected to a local listening port.",
+	Long: `List the remote peers currently connected to a local listening port, grouped by remote
+host, together with the number of connections and their states. It is the server side counterpart
+of the default, client focused, view.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		port := args[0]
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			fmt.Fprintf(os.Stderr, "error: invalid port %q\n", port)
+			os.Exit(1)
+		}
+		set, err := onf.FetchContext(runCtx, onf.All)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if ok, reason := onf.Partial(); ok {
+			fmt.Fprintf(os.Stderr, "warning: results may be incomplete: %s\n", reason)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "HOST\tCONNS\tSTATES")
+		for _, v := range aggr.Peers(set, port) {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", v.Host, v.Conns, formatStates(v.States))
+		}
+		tw.Flush()
+	},
+}
+
+// formatStates returns states and counters like
+// "CLOSE_WAIT=1,ESTABLISHED=3".
+func formatStates(states map[string]int) string {
+	acc := make([]string, 0, len(states))
+	for k, v := range states {
+		acc = append(acc, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(acc)
+	return strings.Join(acc, ",")
+}
+
+func init() {
+	rootCmd.AddCommand(peersCmd)
+}
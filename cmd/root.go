@@ -16,16 +16,63 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jecoz/lsaddr/addrs"
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/binaries"
 	"github.com/jecoz/lsaddr/bpf"
+	"github.com/jecoz/lsaddr/cache"
+	"github.com/jecoz/lsaddr/config"
 	"github.com/jecoz/lsaddr/csv"
+	"github.com/jecoz/lsaddr/elevate"
+	"github.com/jecoz/lsaddr/exe"
+	"github.com/jecoz/lsaddr/expr"
+	"github.com/jecoz/lsaddr/firewalld"
+	"github.com/jecoz/lsaddr/geoip"
+	"github.com/jecoz/lsaddr/heartbeat"
+	"github.com/jecoz/lsaddr/ifaddr"
+	"github.com/jecoz/lsaddr/iptables"
+	"github.com/jecoz/lsaddr/long"
+	"github.com/jecoz/lsaddr/matrix"
+	"github.com/jecoz/lsaddr/mermaid"
+	"github.com/jecoz/lsaddr/ndjson"
+	"github.com/jecoz/lsaddr/nftables"
+	"github.com/jecoz/lsaddr/notation"
+	"github.com/jecoz/lsaddr/oneline"
 	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/pcapng"
+	"github.com/jecoz/lsaddr/pf"
+	"github.com/jecoz/lsaddr/pgroup"
+	"github.com/jecoz/lsaddr/probe"
+	"github.com/jecoz/lsaddr/procnet"
+	"github.com/jecoz/lsaddr/proxy"
+	"github.com/jecoz/lsaddr/record"
+	"github.com/jecoz/lsaddr/resolve"
+	"github.com/jecoz/lsaddr/runner"
+	"github.com/jecoz/lsaddr/session"
+	"github.com/jecoz/lsaddr/suricata"
+	"github.com/jecoz/lsaddr/tlspeek"
+	"github.com/jecoz/lsaddr/top"
+	"github.com/jecoz/lsaddr/transport"
+	"github.com/jecoz/lsaddr/ufw"
+	"github.com/jecoz/lsaddr/verify"
+	"github.com/jecoz/lsaddr/vm"
+	"github.com/jecoz/lsaddr/winpid"
+	"github.com/jecoz/lsaddr/zeek"
 	"github.com/spf13/cobra"
 )
 
@@ -38,9 +85,96 @@ var (
 
 // Flags.
 var (
-	verbose bool
-	version bool
-	format  string
+	verbose  bool
+	version  bool
+	listAll  bool
+	format   string
+	longView bool
+	tmpl     string
+	topN     int
+	encOpts  []string
+	fields   string
+	output   string
+
+	hostsOnly bool // used by the "addrs" format
+
+	runTimeout time.Duration
+
+	addrNotation string
+	nice         bool
+	backend      string
+	hardened     bool
+	allowExec    []string
+	maxExec      int
+	maxExecCmd   int
+	cacheTTL     time.Duration
+	allApps      bool
+
+	listenHealth    bool
+	buffers         bool
+	sortBy          string
+	includeTimeWait bool
+
+	probeDsts        bool
+	probeTimeout     time.Duration
+	probeConcurrency int
+
+	tlsPeek     bool
+	tlsPeekRate int
+
+	tagProxies bool
+
+	verifyBackends bool
+
+	where string
+	to    string
+
+	proto    string
+	tcpOnly  bool
+	udpOnly  bool
+	protocol onf.Protos // parsed from proto, tcpOnly and udpOnly
+	state    string
+	states   onf.States // parsed from state
+
+	dstNet    []string
+	notDstNet []string
+	dstNets   onf.DstNets // parsed from dstNet and notDstNet
+
+	noLoopback bool
+
+	ipv4Only bool
+	ipv6Only bool
+	family   onf.Family // parsed from ipv4Only and ipv6Only
+
+	watch         bool
+	watchInterval time.Duration
+	stateDir      string
+	recordPath    string
+	keyframe      int
+	rollup        time.Duration
+
+	heartbeatInterval time.Duration
+
+	service string
+	window  string
+	pgid    int
+	sid     int
+
+	elevateSelf bool
+
+	inspectExes bool
+	stableSrc   bool
+	annotateVMs bool
+
+	resolveDsts bool
+	resolveSrcs bool
+	geoipPaths  string
+	dstCountry  string
+	dstASN      string
+	dnsServer   string
+	dnsDoH      string
+	dnsRate     int
+	dnsTimeout  time.Duration
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -48,65 +182,1054 @@ var rootCmd = &cobra.Command{
 	Use:   "lsaddr",
 	Short: "List used network addresses.",
 	Long:  usage,
-	Args:  cobra.MaximumNArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		file, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if cmd.HasParent() {
+			// Flags of the root command only, such as "--watch",
+			// do not apply to subcommands.
+			for k := range file {
+				if cmd.Root().LocalNonPersistentFlags().Lookup(k) != nil {
+					delete(file, k)
+				}
+			}
+		}
+		if err := config.Apply(cmd.Flags(), config.Env{}, file); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
 		log.SetPrefix("[lsaddr] ")
 		if !verbose {
 			log.SetOutput(ioutil.Discard)
 		}
+		if nice {
+			runner.Default = runner.Local{LowPriority: true}
+		}
+		if maxExec > 0 || maxExecCmd > 0 {
+			runner.Default = runner.NewLimit(runner.Default, maxExec, maxExecCmd)
+		}
+		if hardened {
+			if nice {
+				fmt.Fprintf(os.Stderr, "error: \"--nice\" cannot be used in hardened mode\n")
+				os.Exit(1)
+			}
+			paths, err := runner.ParseAllowlist(allowExec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			a, err := runner.NewAllowlist(paths)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			log.Printf("Hardened mode, allowed commands: %v", a.Allowed())
+			a.Runner = runner.Default
+			runner.Default = a
+		} else if len(allowExec) > 0 {
+			fmt.Fprintf(os.Stderr, "error: \"--allow-exec\" requires \"--hardened\"\n")
+			os.Exit(1)
+		}
+		rt, err := selectRuntime(backend)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		onf.DefaultRuntime = rt
+		if runTimeout > 0 {
+			runCtx, stopTimeout = context.WithTimeout(context.Background(), runTimeout)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if version {
 			fmt.Printf("Version: %s, Commit: %s, Built at: %s\n\n", Version, Commit, BuildTime)
 			os.Exit(0)
 		}
-		w := bufio.NewWriter(os.Stdout)
-		enc, err := newEncoder(w, format)
+		if elevateSelf && !elevate.Elevated() {
+			if hardened {
+				fmt.Fprintf(os.Stderr, "error: \"--elevate\" cannot be used in hardened mode\n")
+				os.Exit(1)
+			}
+			log.Printf("Not running with administrative privileges, elevating")
+			// The elevated process does not find the environment
+			// and configuration file of the user.
+			args := append(config.Args(cmd.Flags()), os.Args[1:]...)
+			code, err := elevate.Run(elevate.Args(args))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+			os.Exit(code)
+		}
+		if verifyBackends {
+			os.Exit(runVerify())
+		}
+		if longView {
+			if config.FromCommandLine(cmd.Flags(), "format") && !strings.EqualFold(format, "long") {
+				fmt.Fprintf(os.Stderr, "error: \"--long\" cannot be used with the %s format\n", format)
+				os.Exit(1)
+			}
+			format = "long"
+		}
+		if hostsOnly && !strings.EqualFold(format, "addrs") {
+			fmt.Fprintf(os.Stderr, "error: \"--hosts-only\" cannot be used with the %s format\n", format)
+			os.Exit(1)
+		}
+		if sortBy != "" && sortBy != "bufsize" {
+			fmt.Fprintf(os.Stderr, "error: unrecognised sort option %s\n", sortBy)
+			os.Exit(1)
+		}
+		if strings.ToLower(format) == "top" && len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "error: the top format reports on the whole system, and cannot be used with a filter\n")
+			os.Exit(1)
+		}
+		out, err := transport.OpenContext(runCtx, output, transport.Options{
+			ContentType: contentType(format),
+		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-
-		set, err := onf.FetchAll()
+		w := bufio.NewWriter(out)
+		enc, err := newEncoder(w, format)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		pivot := "*"
+
+		// Without a filter every open network file is selected, which
+		// "--all" makes explicit. An empty filter is refused instead of
+		// matching everything, as empty regular expressions do. Several
+		// filters select the open network files matching any of them.
+		pivot := onf.All
 		if len(args) > 0 {
-			pivot = args[0]
+			if listAll {
+				fmt.Fprintf(os.Stderr, "error: \"--all\" cannot be used with a filter\n")
+				os.Exit(1)
+			}
+			for _, v := range args {
+				if strings.TrimSpace(v) == "" {
+					fmt.Fprintf(os.Stderr, "error: empty filter, use \"--all\" to list every open network file\n")
+					os.Exit(1)
+				}
+			}
+			pivot = onf.Any(args...)
 		}
-		set, err = onf.Filter(set, pivot)
+		target, err := parseFilters()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: unable to filter with %s: %v\n", pivot, err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		geoFilter, err := geoip.ParseFilter(dstCountry, dstASN)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		if !geoFilter.Empty() && geoipPaths == "" {
+			fmt.Fprintf(os.Stderr, "error: \"--dst-country\" and \"--dst-asn\" require \"--geoip\"\n")
+			os.Exit(1)
+		}
+		if heartbeatInterval > 0 {
+			beat = heartbeat.Start(os.Stderr, heartbeatInterval)
+		}
+		if rollup > 0 && recordPath == "" {
+			fmt.Fprintf(os.Stderr, "error: \"--rollup\" can only be used with \"--record\"\n")
+			exit(1)
+		}
+		if recordPath != "" {
+			if watch || config.FromCommandLine(cmd.Flags(), "format") || !streamable() {
+				fmt.Fprintf(os.Stderr, "error: \"--record\" cannot be used with \"--watch\", \"--format\" or flags that need the whole set of results\n")
+				exit(1)
+			}
+			exit(runRecord(pivot, target))
+		}
+		if stateDir != "" && !watch {
+			fmt.Fprintf(os.Stderr, "error: \"--state-dir\" can only be used with \"--watch\"\n")
+			exit(1)
+		}
+		if watch {
+			if config.FromCommandLine(cmd.Flags(), "format") || !streamable() {
+				fmt.Fprintf(os.Stderr, "error: \"--watch\" prints one line per change, and cannot be used with \"--format\" or flags that need the whole set of results\n")
+				exit(1)
+			}
+			exit(runWatch(w, out, pivot, target))
+		}
+		if e, ok := enc.(*ndjson.Encoder); ok && streamable() {
+			exit(runStream(e, w, out, pivot, target))
+		}
+		beat.Phase("lookup")
+		set, err := lookup(pivot)
+		timedOut := errors.Is(err, context.DeadlineExceeded) && truncated("lookup")
+		if err != nil && !timedOut {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			exit(exitCode(err))
+		}
+		if len(set) == 0 && pivot != onf.All && !timedOut {
+			err := onf.Diagnose(pivot)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			exit(exitCode(err))
+		}
+		set = filterSet(set, target)
+		if service != "" || window != "" {
+			pids, err := selectedPids()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(exitCode(err))
+			}
+			log.Printf("Filtering by pids %v", pids)
+			set = onf.FilterPids(set, pids)
+		}
+		if pgid != 0 || sid != 0 {
+			pids, err := pgroup.Select(aggr.Summarize(set).Pids, pgroup.Ids{Pgid: pgid, Sid: sid})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			log.Printf("Filtering by pids %v (pgid %d, sid %d)", pids, pgid, sid)
+			set = onf.FilterPids(set, pids)
+		}
+		if includeTimeWait {
+			socks, err := procnet.Read("/proc")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			set = append(set, procnet.TimeWait(socks)...)
+		}
+		if ok, reason := onf.Partial(); ok {
+			fmt.Fprintf(os.Stderr, "warning: results may be incomplete: %s\n", reason)
+		}
+		if allApps {
+			apps, err := onf.RunningApps()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			set = onf.GroupByApp(set, apps)
+		}
+		beat.Add(len(set))
+		beat.Phase("enrich")
+		if tagProxies {
+			proxy.Tag(runCtx, set, proxy.Detect())
+		}
+		if listenHealth {
+			socks, err := procnet.Read("/proc")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			set = procnet.ListenHealth(set, socks)
+		}
+		if buffers || sortBy == "bufsize" {
+			socks, err := procnet.Read("/proc")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			procnet.Buffers(set, socks)
+		}
+		if inspectExes {
+			exe.Run(runCtx, set)
+		}
+		if stableSrc {
+			addrs, err := ifaddr.List()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			ifaddr.Annotate(set, addrs)
+		}
+		if resolveDsts || resolveSrcs {
+			r, err := resolve.New(resolve.Options{
+				Server:  dnsServer,
+				DoH:     dnsDoH,
+				Rate:    dnsRate,
+				Timeout: dnsTimeout,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			var which resolve.Addrs
+			if resolveDsts {
+				which |= resolve.Dst
+			}
+			if resolveSrcs {
+				which |= resolve.Src
+			}
+			resolve.RunAddrs(runCtx, set, r, which)
+		}
+		if geoipPaths != "" {
+			var dbs []*geoip.DB
+			for _, v := range strings.Split(geoipPaths, ",") {
+				db, err := geoip.Open(strings.TrimSpace(v))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					exit(1)
+				}
+				log.Printf("Using GeoIP database %s (%s)", v, db.Type)
+				dbs = append(dbs, db)
+			}
+			geoip.Annotate(runCtx, set, dbs)
+			set = geoip.Select(set, geoFilter)
+		}
+		if annotateVMs {
+			procs, err := onf.DefaultRuntime.Processes()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+			vm.Annotate(set, procs)
+		}
+		if probeDsts {
+			probe.Run(runCtx, set, probe.Options{
+				Concurrency: probeConcurrency,
+				Timeout:     probeTimeout,
+			})
+		}
+		if tlsPeek {
+			tlspeek.Run(runCtx, set, tlspeek.Options{
+				Rate: tlsPeekRate,
+			})
+		}
 
+		if where != "" {
+			e, err := expr.Compile(where)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: invalid \"--where\" expression: %v\n", err)
+				exit(1)
+			}
+			if set, err = expr.Filter(set, e); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				exit(1)
+			}
+		}
+
+		if n, err := notation.Parse(addrNotation); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			exit(1)
+		} else if n != notation.Default && parsesAddrs(format) {
+			fmt.Fprintf(os.Stderr, "error: address notation %s cannot be used with the %s format\n", n, strings.ToLower(format))
+			exit(1)
+		} else if !strings.EqualFold(format, "addrs") {
+			// The addrs encoder applies it to the distinct
+			// destinations instead.
+			set = notation.Apply(set, n)
+		}
+
+		if !timedOut {
+			timedOut = truncated("enrich")
+		}
+
+		beat.Phase("encode")
+		onf.Sort(set)
+		if sortBy == "bufsize" {
+			onf.SortBuffers(set)
+		}
+		if allApps {
+			onf.SortByApp(set)
+		}
+		if annotateVMs {
+			vm.Group(set)
+		}
 		log.Printf("# of open network files: %d", len(set))
+		if limit := listLimit(pivot); limit > 0 && len(set) > limit {
+			fmt.Fprintf(os.Stderr, "warning: listing %d of %d open network files, use a filter or \"--all\" to list them all\n", limit, len(set))
+			set = set[:limit]
+		}
+		if e, ok := enc.(*bpf.Encoder); ok {
+			if n := e.Ephemeral(set); n > 0 {
+				fmt.Fprintf(os.Stderr, "warning: the expression filters on %d ephemeral ports, which may soon be reused by other applications: use \"--opt bpf.stable=true\" to filter on stable ports only\n", n)
+			}
+		}
 		if err := enc.Encode(set); err != nil {
 			fmt.Fprintf(os.Stderr, "error: unable to encode output: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 		w.Flush()
-		os.Exit(0)
+		if err := out.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: unable to deliver output: %v\n", err)
+			exit(1)
+		}
+		if timedOut {
+			exit(exitTimeout)
+		}
+		exit(0)
 	},
 }
 
+// runCtx is done when the "--timeout" provided expires, bounding the
+// whole invocation of any command. Without a timeout it is never done.
+// stopTimeout releases its timer.
+var (
+	runCtx      = context.Background()
+	stopTimeout = func() {}
+)
+
+// truncated reports whether the "--timeout" provided expired, warning
+// that the results are truncated as `phase` did not complete.
+func truncated(phase string) bool {
+	if runCtx.Err() == nil {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "warning: timed out after %v during %s, results are truncated\n", runTimeout, phase)
+	return true
+}
+
+// beat reports the progress of the lookup when "--heartbeat" is
+// provided, and is nil otherwise.
+var beat *heartbeat.Heartbeat
+
+// exit stops the heartbeat, writing its last line, and exits with
+// status `code`.
+func exit(code int) {
+	beat.Stop()
+	stopTimeout()
+	os.Exit(code)
+}
+
+// parseFilters parses the flags selecting open network files by
+// protocol, state, address family and destination into protocol,
+// states, family and dstNets, returning the target of "--to", nil
+// when not provided.
+func parseFilters() (*onf.Target, error) {
+	var target *onf.Target
+	if to != "" {
+		t, err := onf.ParseTarget(runCtx, to, nil)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Target %s resolved to %v", t, t.IPs)
+		target = &t
+	}
+	p, err := onf.ParseProtos(proto)
+	if err != nil {
+		return nil, err
+	}
+	if tcpOnly {
+		p = append(p, "tcp")
+	}
+	if udpOnly {
+		p = append(p, "udp")
+	}
+	protocol = p
+	states = onf.ParseStates(state)
+	switch {
+	case ipv4Only && !ipv6Only:
+		family = onf.IPv4
+	case ipv6Only && !ipv4Only:
+		family = onf.IPv6
+	}
+	if dstNets.In, err = onf.ParseNets(dstNet); err != nil {
+		return nil, err
+	}
+	if dstNets.Out, err = onf.ParseNets(notDstNet); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// filterSet keeps the open network files of `set` selected by the
+// flags parsed by parseFilters, connected to `target` when not nil.
+func filterSet(set []onf.ONF, target *onf.Target) []onf.ONF {
+	if target != nil {
+		set = onf.FilterTarget(set, *target)
+	}
+	set = onf.FilterProtos(set, protocol)
+	set = onf.FilterStates(set, states)
+	set = onf.FilterDstNets(set, dstNets)
+	if noLoopback {
+		set = onf.FilterLocal(set)
+	}
+	return onf.FilterFamily(set, family)
+}
+
+// selectedPids returns the pids of the processes running the service
+// selected by "--service", or owning a window whose title contains the
+// text provided with "--window" (windows only). When both are
+// provided, the processes selected by either are returned.
+func selectedPids() ([]int, error) {
+	var pids []int
+	if service != "" {
+		list, err := winpid.Services()
+		if err != nil {
+			return nil, err
+		}
+		p := winpid.MatchServices(list, service)
+		if len(p) == 0 {
+			return nil, &onf.NoProcessError{Pivot: service}
+		}
+		pids = append(pids, p...)
+	}
+	if window != "" {
+		list, err := winpid.Windows()
+		if err != nil {
+			return nil, err
+		}
+		p := winpid.MatchWindows(list, window)
+		if len(p) == 0 {
+			return nil, &onf.NoProcessError{Pivot: window}
+		}
+		pids = append(pids, p...)
+	}
+	return pids, nil
+}
+
+// terminalLimit is the maximum number of open network files listed on
+// a terminal when no filter is provided, unless "--all" is.
+const terminalLimit = 100
+
+// listLimit returns the maximum number of open network files listed
+// for `pivot`, or 0 when they are not limited. Only whole-system
+// listings printed one line per open network file on a terminal are
+// limited: output consumed by other programs is never truncated, and
+// aggregating formats, such as "top" and "oneline", need every open
+// network file.
+func listLimit(pivot string) int {
+	if pivot != onf.All || listAll || service != "" || window != "" || output != "-" || !isTerminal(os.Stdout) {
+		return 0
+	}
+	switch strings.ToLower(format) {
+	case "csv", "long":
+		return terminalLimit
+	default:
+		return 0
+	}
+}
+
+// isTerminal reports whether `f` is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runVerify compares the open network files reported by the default
+// backend with the sockets listed in the /proc/net tables, printing
+// the discrepancies found. Returns the exit status.
+func runVerify() int {
+	set, err := onf.FetchContext(runCtx, onf.All)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if onf.Backend() == (procnet.Runtime{}).Backend() {
+		fmt.Fprintf(os.Stderr, "error: no other backend to verify %s against\n", onf.Backend())
+		return 1
+	}
+	socks, err := procnet.Read("/proc")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: no other backend to verify %s against: %v\n", onf.Backend(), err)
+		return 1
+	}
+	diff := verify.Compare(
+		verify.Source{Name: onf.Backend(), Set: set},
+		verify.Source{Name: "procnet", Set: procnet.Owned(socks)},
+	)
+	for _, v := range diff {
+		fmt.Println(v)
+	}
+	if len(diff) > 0 {
+		fmt.Fprintf(os.Stderr, "%d discrepancies found\n", len(diff))
+		return 1
+	}
+	return 0
+}
+
+// selectRuntime returns the onf.Runtime registered as `name`. When
+// `name` is "auto", the default runtime of the platform is used, unless
+// it is linux and lsof cannot be executed: the /proc tables are read
+// instead.
+func selectRuntime(name string) (onf.Runtime, error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "auto" {
+		if runtime.GOOS == "linux" && !canExec("lsof") {
+			log.Printf("lsof cannot be executed, reading /proc instead")
+			return procnet.Runtime{}, nil
+		}
+		return onf.DefaultRuntime, nil
+	}
+	return onf.RuntimeByName(name)
+}
+
+// canExec reports whether the external tool `name` can be executed,
+// taking hardened mode into account.
+func canExec(name string) bool {
+	if a, ok := runner.Default.(*runner.Allowlist); ok {
+		for _, v := range a.Allowed() {
+			if v == name {
+				return true
+			}
+		}
+		return false
+	}
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// streamable reports whether the open network files can be encoded
+// one at a time, as they are decoded: that is not the case when the
+// flags provided require the whole set, as enrichers and sorting do.
+func streamable() bool {
+	return !includeTimeWait && !allApps && !listenHealth && !buffers &&
+		sortBy == "" && !inspectExes && !stableSrc && !resolveDsts && !resolveSrcs &&
+		geoipPaths == "" && !probeDsts && !tlsPeek && cacheTTL == 0 &&
+		service == "" && window == "" && pgid == 0 && sid == 0 && !annotateVMs
+}
+
+// runWatch prints the open network files matching `pivot` opened and
+// closed every watchInterval, one per line, until interrupted. When
+// `target` is not nil, only the ones connected to it are reported.
+// Returns the exit status.
+func runWatch(w *bufio.Writer, out io.Closer, pivot string, target *onf.Target) int {
+	var e *expr.Expr
+	if where != "" {
+		var err error
+		if e, err = expr.Compile(where); err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid \"--where\" expression: %v\n", err)
+			return 1
+		}
+	}
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	filter := func(set []onf.ONF) ([]onf.ONF, error) {
+		set = filterSet(set, target)
+		if e != nil {
+			return expr.Filter(set, e)
+		}
+		return set, nil
+	}
+	report := func(sign string, t time.Time, set []onf.ONF) {
+		for _, v := range set {
+			fmt.Fprintf(w, "%s %s %s %d %s\n", t.Format(time.RFC3339), sign, v.Cmd, v.Pid, connName(v))
+		}
+	}
+	// With a state directory, the watch resumes from the last lookup
+	// of the previous one with the same configuration, if any, and
+	// its state is saved after each change.
+	var (
+		store session.Store
+		key   string
+		st    *session.State
+	)
+	if stateDir != "" {
+		store = session.Store{Dir: stateDir}
+		key = session.Key(onf.Backend(), pivot, to, where, fmt.Sprint(protocol, states, family, dstNet, notDstNet))
+		if s, ok := store.Load(key); ok {
+			log.Printf("Resuming the watch saved at %v", s.Time.Format(time.RFC3339))
+			st = s
+		} else {
+			now := time.Now()
+			set, err := onf.FetchWith(ctx, onf.DefaultRuntime, pivot)
+			if err == nil {
+				set, err = filter(set)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				out.Close()
+				return exitCode(err)
+			}
+			st = session.New(set, now)
+			if err := store.Save(key, st); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				out.Close()
+				return 1
+			}
+		}
+	}
+	log.Printf("Watching %s every %v, reading from %s", pivot, watchInterval, onf.Backend())
+	beat.Phase("watch")
+	fn := func(c onf.Change) error {
+		if c.Resolved {
+			pids := make([]string, 0, len(c.Pids))
+			for _, v := range c.Pids {
+				pids = append(pids, strconv.Itoa(v))
+			}
+			fmt.Fprintf(w, "%s ~ target re-resolved to pids %s\n", c.Time.Format(time.RFC3339), strings.Join(pids, ","))
+		}
+		report("+", c.Time, c.Opened)
+		report("-", c.Time, c.Closed)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		// Delivers each change as it happens to the outputs
+		// that buffer it, such as http ones.
+		if f, ok := out.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+		if st != nil {
+			st.Apply(c)
+			return store.Save(key, st)
+		}
+		return nil
+	}
+	var err error
+	if st != nil {
+		err = onf.Resume(ctx, onf.DefaultRuntime, pivot, watchInterval, st.Files(), filter, fn)
+	} else {
+		err = onf.WatchWith(ctx, onf.DefaultRuntime, pivot, watchInterval, filter, fn)
+	}
+	code := 0
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		code = exitCode(err)
+	}
+	// The changes reported before an error are delivered anyway.
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: unable to deliver output: %v\n", err)
+		return 1
+	}
+	return code
+}
+
+// runRecord appends a snapshot of the open network files matching
+// `pivot` to recordPath every watchInterval, until interrupted. When
+// `target` is not nil, only the ones connected to it are recorded.
+// Lookup errors are reported, but do not stop the recording. Returns
+// the exit status.
+func runRecord(pivot string, target *onf.Target) int {
+	var e *expr.Expr
+	if where != "" {
+		var err error
+		if e, err = expr.Compile(where); err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid \"--where\" expression: %v\n", err)
+			return 1
+		}
+	}
+	if n, err := notation.Parse(addrNotation); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	} else if n != notation.Default {
+		fmt.Fprintf(os.Stderr, "error: address notation %s cannot be used with \"--record\", recordings keep the addresses as they are\n", n)
+		return 1
+	}
+	f, err := os.OpenFile(recordPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: unable to open recording: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	w := record.NewWriterRollup(f, keyframe, rollup)
+
+	// Interrupts abort the lookup in progress too.
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	tick := time.NewTicker(watchInterval)
+	defer tick.Stop()
+	log.Printf("Recording %s every %v to %s", pivot, watchInterval, recordPath)
+	beat.Phase("record")
+	for {
+		now := time.Now()
+		set, err := onf.FetchContext(ctx, pivot)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "warning: lookup failed: %v\n", err)
+		} else {
+			set = filterSet(set, target)
+			if e != nil {
+				if set, err = expr.Filter(set, e); err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					return 1
+				}
+			}
+			beat.Add(len(set))
+			if err := w.Write(aggr.Snapshot{Time: now, Set: set}); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 1
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-tick.C:
+		}
+	}
+}
+
+// connName formats the addresses and state of `f` as lsof does in its
+// NAME column.
+func connName(f onf.ONF) string {
+	var s string
+	if f.Src != nil {
+		s = f.Src.String()
+	}
+	if f.Dst != nil && f.Dst.String() != "" {
+		s += "->" + f.Dst.String()
+	}
+	if f.State != "" {
+		s += " (" + f.State + ")"
+	}
+	return s
+}
+
+// runStream encodes the open network files matching `pivot` with
+// `enc` as soon as they are decoded, flushing `w` after each of them.
+// When `target` is not nil, only the ones connected to it are kept.
+// Returns the exit status.
+func runStream(enc *ndjson.Encoder, w *bufio.Writer, out io.Closer, pivot string, target *onf.Target) int {
+	var e *expr.Expr
+	if where != "" {
+		var err error
+		if e, err = expr.Compile(where); err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid \"--where\" expression: %v\n", err)
+			return 1
+		}
+	}
+	n, err := notation.Parse(addrNotation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	var proxies []*url.URL
+	if tagProxies {
+		proxies = proxy.Detect()
+	}
+	var found int
+	beat.Phase("lookup")
+	err = onf.EachContext(runCtx, pivot, func(f onf.ONF) error {
+		found++
+		beat.Add(1)
+		if (target != nil && !target.Match(f)) || !protocol.Match(f) || !states.Match(f) || !dstNets.Match(f) || (noLoopback && onf.IsLocal(f)) || !family.Match(f) {
+			return nil
+		}
+		set := []onf.ONF{f}
+		proxy.Tag(runCtx, set, proxies)
+		if e != nil {
+			if ok, err := e.Match(set[0]); err != nil || !ok {
+				return err
+			}
+		}
+		if err := enc.EncodeONF(notation.Apply(set, n)[0]); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+	timedOut := errors.Is(err, context.DeadlineExceeded) && truncated("lookup")
+	if timedOut {
+		err = nil
+	} else if err == nil && found == 0 && pivot != onf.All {
+		err = onf.Diagnose(pivot)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitCode(err)
+	}
+	if ok, reason := onf.Partial(); ok {
+		fmt.Fprintf(os.Stderr, "warning: results may be incomplete: %s\n", reason)
+	}
+	log.Printf("# of open network files: %d", found)
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: unable to deliver output: %v\n", err)
+		return 1
+	}
+	if timedOut {
+		return exitTimeout
+	}
+	return 0
+}
+
+// Exit statuses reported when a filter selects no open network file,
+// and when the results are truncated by "--timeout".
+const (
+	exitNoProcess     = 2
+	exitNoConnections = 3
+	exitTimeout       = 4
+)
+
+// exitCode returns the exit status matching `err`.
+func exitCode(err error) int {
+	var np *onf.NoProcessError
+	var nc *onf.NoConnectionsError
+	switch {
+	case errors.As(err, &np):
+		return exitNoProcess
+	case errors.As(err, &nc):
+		log.Printf("Processes matching %s: %v", nc.Pivot, nc.Pids)
+		return exitNoConnections
+	default:
+		return 1
+	}
+}
+
+// lookup fetches the open network files and filters them using
+// `pivot`. When cacheTTL is set, results are served from (and stored
+// into) the on-disk cache.
+func lookup(pivot string) ([]onf.ONF, error) {
+	var c *cache.Cache
+	if cacheTTL > 0 {
+		var err error
+		if c, err = cache.New(cacheTTL); err != nil {
+			log.Printf("Cache disabled: %v", err)
+		} else if set, ok := c.Get(cache.Key(onf.Backend(), pivot)); ok {
+			log.Printf("Using cached results for %s", pivot)
+			return set, nil
+		}
+	}
+
+	set, err := onf.FetchContext(runCtx, pivot)
+	if err != nil {
+		// Partial when aborted by "--timeout".
+		return set, err
+	}
+	if c != nil {
+		// Stored under the backend that listed the results, which
+		// is not the one looked up when it fell back to another.
+		if err := c.Put(cache.Key(onf.Backend(), pivot), set); err != nil {
+			log.Printf("Unable to cache results: %v", err)
+		}
+	}
+	return set, nil
+}
+
 type Encoder interface {
 	Encode([]onf.ONF) error
 }
 
 func newEncoder(w io.Writer, format string) (Encoder, error) {
+	raw := encOpts
+	if fields != "" {
+		raw = append(raw[:len(raw):len(raw)], "ndjson.fields="+fields)
+	}
+	return newEncoderOpts(w, format, raw)
+}
+
+// newEncoderOpts returns the encoder selected with `format`, configured
+// with `raw`, a list of "<format>.<key>=<value>" assignments.
+func newEncoderOpts(w io.Writer, format string, raw []string) (Encoder, error) {
+	opts, err := encoderOptions(format, raw)
+	if err != nil {
+		return nil, err
+	}
 	switch strings.ToLower(format) {
 	case "csv":
-		return csv.NewEncoder(w), nil
+		return csv.NewEncoderOptions(w, opts)
 	case "bpf":
-		return bpf.NewEncoder(w), nil
+		return bpf.NewEncoderOptions(w, opts)
+	case "ndjson":
+		return ndjson.NewEncoderOptions(w, opts)
+	case "firewalld":
+		return firewalld.NewEncoderOptions(w, opts)
+	case "ufw":
+		return ufw.NewEncoderOptions(w, opts)
+	case "matrix":
+		return matrix.NewEncoderOptions(w, opts)
+	case "iptables":
+		return iptables.NewEncoderOptions(w, opts)
+	case "nftables":
+		return nftables.NewEncoderOptions(w, opts)
+	case "pf":
+		return pf.NewEncoderOptions(w, opts)
+	case "zeek":
+		return zeek.NewEncoderOptions(w, opts)
+	}
+	if len(opts) > 0 {
+		return nil, fmt.Errorf("format %s does not support options", format)
+	}
+	switch strings.ToLower(format) {
+	case "mermaid":
+		return mermaid.NewEncoder(w), nil
+	case "pcapng":
+		return pcapng.NewEncoder(w), nil
+	case "oneline":
+		return oneline.NewEncoder(w, tmpl)
+	case "top":
+		return top.NewEncoder(w, topN), nil
+	case "addrs":
+		n, err := notation.Parse(addrNotation)
+		if err != nil {
+			return nil, err
+		}
+		return addrs.NewEncoderNotation(w, hostsOnly, n), nil
+	case "suricata":
+		return suricata.NewEncoder(w), nil
+	case "long":
+		return long.NewEncoder(w), nil
+	case "binaries":
+		return binaries.NewEncoder(w, processTree), nil
 	default:
 		return nil, fmt.Errorf("unrecognised format option %s", format)
 	}
 }
 
+// processTree returns the process tree of the open network files of
+// `set`, used by the "binaries" format.
+func processTree(set []onf.ONF) map[int]aggr.Proc {
+	procs, err := onf.DefaultRuntime.Processes()
+	if err != nil {
+		log.Printf("Unable to list running processes: %v", err)
+	}
+	return exe.Tree(runCtx, set, procs)
+}
+
+// encoderOptions parses `raw`, a list of "<format>.<key>=<value>"
+// assignments, returning the options of `format`. Options meant
+// for other formats are reported as errors.
+func encoderOptions(format string, raw []string) (map[string]string, error) {
+	opts := make(map[string]string)
+	for _, v := range raw {
+		i := strings.Index(v, "=")
+		j := strings.Index(v, ".")
+		if i < 0 || j < 0 || j > i {
+			return nil, fmt.Errorf("invalid option %q: expected <format>.<key>=<value>", v)
+		}
+		if !strings.EqualFold(v[:j], format) {
+			return nil, fmt.Errorf("option %q does not apply to format %s", v, format)
+		}
+		opts[v[j+1:i]] = v[i+1:]
+	}
+	return opts, nil
+}
+
+// parsesAddrs reports whether the encoder selected with `format`
+// parses the addresses of the open network files, to produce filters,
+// firewall rules or packets, or to group them by host: addresses in
+// alternative notations cannot be parsed, and would be silently
+// dropped. The addrs encoder applies the notation itself.
+func parsesAddrs(format string) bool {
+	switch strings.ToLower(format) {
+	case "bpf", "pcapng", "firewalld", "ufw", "iptables", "nftables", "pf", "suricata", "zeek",
+		"top", "matrix", "mermaid", "oneline", "binaries":
+		return true
+	default:
+		return false
+	}
+}
+
+// contentType returns the media type of the output produced
+// by the encoder selected with `format`.
+func contentType(format string) string {
+	switch strings.ToLower(format) {
+	case "csv", "matrix":
+		return "text/csv"
+	case "pcapng":
+		return "application/octet-stream"
+	case "ndjson":
+		return "application/x-ndjson"
+	default:
+		return "text/plain"
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -118,15 +1241,379 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Increment logger verbosity.")
+	rootCmd.PersistentFlags().BoolVarP(&listAll, "all", "", false, "List every open network file, without any filter and without limiting the lines printed on a terminal.")
 	rootCmd.PersistentFlags().BoolVarP(&version, "version", "", false, "Print build information such as version, commit and build time.")
-	rootCmd.PersistentFlags().StringVarP(&format, "format", "f", "csv", "Choose output format.")
+	rootCmd.PersistentFlags().StringVarP(&format, "format", "f", "csv", fmt.Sprintf("Choose output format (%s).", strings.Join(Formats, ", ")))
+	rootCmd.PersistentFlags().BoolVarP(&longView, "long", "l", false, "Mirror the columns of lsof, including fd, type, device and node. Same as \"--format long\".")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "-", "Output destination: \"-\" for stdout, a file path, \"unix:<path>\" or an http(s) URL.")
+	rootCmd.PersistentFlags().StringVarP(&tmpl, "template", "", "", "Go template used by the \"oneline\" format.")
+	rootCmd.PersistentFlags().StringArrayVarP(&encOpts, "opt", "", nil, "Option of the output format, as <format>.<key>=<value> (e.g. bpf.direction=dst). May be repeated.")
+	rootCmd.PersistentFlags().StringVarP(&fields, "fields", "", "", "Comma separated JSON pointers selecting the values written by the \"ndjson\" format (e.g. /cmd,/dst/addr). Same as --opt ndjson.fields=...")
+	rootCmd.PersistentFlags().BoolVarP(&hostsOnly, "hosts-only", "", false, "Print destination hosts without port, using the \"addrs\" format.")
+	rootCmd.PersistentFlags().IntVarP(&topN, "top", "", top.DefaultN, "Number of destinations listed by the \"top\" format.")
+	rootCmd.PersistentFlags().BoolVarP(&nice, "nice", "", false, "Run external tools with reduced CPU and IO priority.")
+	rootCmd.PersistentFlags().StringVarP(&backend, "backend", "", "auto", fmt.Sprintf("Source of the open network files: auto or one of %s.", strings.Join(onf.Runtimes(), ", ")))
+	rootCmd.PersistentFlags().BoolVarP(&elevateSelf, "elevate", "", false, "When not running with administrative privileges, run again through sudo (unix) or a UAC prompt (windows).")
+	rootCmd.PersistentFlags().BoolVarP(&hardened, "hardened", "", false, "Refuse to execute external tools, unless enabled with \"--allow-exec\".")
+	rootCmd.PersistentFlags().IntVarP(&maxExec, "max-exec", "", 0, "Maximum number of external tools executed concurrently. Unlimited when zero.")
+	rootCmd.PersistentFlags().IntVarP(&maxExecCmd, "max-exec-per-command", "", 0, "Maximum number of concurrent executions of the same external tool (i.e. lsof). Unlimited when zero.")
+	rootCmd.PersistentFlags().StringArrayVarP(&allowExec, "allow-exec", "", nil, "External tool enabled in hardened mode, as <name>=<absolute path> (e.g. lsof=/usr/sbin/lsof). May be repeated.")
+	rootCmd.PersistentFlags().StringVarP(&addrNotation, "notation", "", "default", "Address notation used in the output: default, padded, int, hex or arpa.")
+	rootCmd.PersistentFlags().BoolVarP(&allApps, "all-apps", "", false, "List the open network files of every running GUI application, grouped by application (macOS only).")
+	rootCmd.PersistentFlags().BoolVarP(&listenHealth, "listen-health", "", false, "Keep only listening TCP sockets, reporting their backlog and accept queue length (linux only).")
+	rootCmd.PersistentFlags().BoolVarP(&buffers, "buffers", "", false, "Report the bytes waiting in the send and receive queues of connected sockets (linux only).")
+	rootCmd.PersistentFlags().StringVarP(&sortBy, "sort", "", "", "Sort open network files by \"bufsize\" (largest socket queues first) instead of command, pid and addresses.")
+	rootCmd.PersistentFlags().BoolVarP(&includeTimeWait, "include-timewait", "", false, "Include TIME_WAIT and FIN_WAIT2 sockets no longer owned by any process, with their remaining timer (linux only).")
+	rootCmd.PersistentFlags().StringVarP(&service, "service", "", "", "Keep only the open network files of the processes running the service with this display or service name (windows only).")
+	rootCmd.PersistentFlags().StringVarP(&window, "window", "", "", "Keep only the open network files of the processes owning a window whose title contains this text (windows only).")
+	rootCmd.PersistentFlags().IntVarP(&pgid, "pgid", "", 0, "Keep only the open network files of the processes in this process group (unix only).")
+	rootCmd.PersistentFlags().IntVarP(&sid, "sid", "", 0, "Keep only the open network files of the processes in this session (login session on windows).")
+	rootCmd.PersistentFlags().StringVarP(&proto, "proto", "", "", "Keep only the open network files using these comma separated transport protocols (tcp, udp).")
+	rootCmd.PersistentFlags().BoolVarP(&tcpOnly, "tcp", "", false, "Keep only TCP open network files. Same as \"--proto tcp\".")
+	rootCmd.PersistentFlags().BoolVarP(&udpOnly, "udp", "", false, "Keep only UDP open network files. Same as \"--proto udp\".")
+	rootCmd.PersistentFlags().StringVarP(&state, "state", "", "", "Keep only the open network files in these comma separated connection states (e.g. listen,established).")
+	rootCmd.PersistentFlags().StringArrayVarP(&dstNet, "dst-net", "", nil, "Keep only the connections to these comma separated networks, in CIDR notation (e.g. 10.0.0.0/8). May be repeated.")
+	rootCmd.PersistentFlags().StringArrayVarP(&notDstNet, "not-dst-net", "", nil, "Drop the connections to these comma separated networks, in CIDR notation (e.g. 10.0.0.0/8). May be repeated.")
+	rootCmd.PersistentFlags().BoolVarP(&ipv4Only, "ipv4", "4", false, "Keep only the open network files using IPv4 addresses.")
+	rootCmd.PersistentFlags().BoolVarP(&ipv6Only, "ipv6", "6", false, "Keep only the open network files using IPv6 addresses.")
+	rootCmd.PersistentFlags().BoolVarP(&noLoopback, "no-loopback", "", false, "Drop the open network files whose endpoints are both loopback or link-local addresses.")
+	rootCmd.PersistentFlags().StringVarP(&to, "to", "", "", "Keep only the connections to host[:port], matching every address the host resolves to (e.g. db.internal:5432).")
+	rootCmd.PersistentFlags().StringVarP(&where, "where", "", "", "Keep only the open network files matching the expression, such as 'dst.port == 443 && command.startsWith(\"Chrome\")'.")
+	rootCmd.PersistentFlags().BoolVarP(&stableSrc, "stable-src", "", false, "Report the interface and stable address of temporary (privacy) IPv6 source addresses.")
+	rootCmd.PersistentFlags().BoolVarP(&inspectExes, "exe", "", false, "Report the path, SHA-256 and code-signing identity (macOS and windows only) of each process executable.")
+	rootCmd.PersistentFlags().BoolVarP(&resolveDsts, "resolve", "", false, "Resolve the names of the destination addresses with reverse DNS lookups.")
+	rootCmd.PersistentFlags().BoolVarP(&resolveSrcs, "resolve-src", "", false, "Resolve the names of the source addresses with reverse DNS lookups.")
+	rootCmd.PersistentFlags().StringVarP(&dnsServer, "dns", "", "", "DNS server used by \"--resolve\" and \"--resolve-src\" instead of the system resolver (e.g. 1.1.1.1).")
+	rootCmd.PersistentFlags().StringVarP(&dnsDoH, "doh", "", "", "DNS over HTTPS endpoint used by \"--resolve\" and \"--resolve-src\" instead of the system resolver (e.g. https://cloudflare-dns.com/dns-query).")
+	rootCmd.PersistentFlags().IntVarP(&dnsRate, "dns-rate", "", resolve.DefaultOptions.Rate, "Maximum number of reverse DNS lookups started per second.")
+	rootCmd.PersistentFlags().DurationVarP(&dnsTimeout, "dns-timeout", "", resolve.DefaultOptions.Timeout, "Timeout of each reverse DNS lookup.")
+	rootCmd.PersistentFlags().StringVarP(&geoipPaths, "geoip", "", "", "Comma separated paths of MaxMind databases used to locate the destinations (e.g. GeoLite2-City.mmdb,GeoLite2-ASN.mmdb).")
+	rootCmd.Flags().StringVarP(&dstCountry, "dst-country", "", "", "Keep only the connections to these comma separated countries, located with \"--geoip\" (e.g. CN,RU).")
+	rootCmd.Flags().StringVarP(&dstASN, "dst-asn", "", "", "Keep only the connections to these comma separated autonomous systems, located with \"--geoip\" (e.g. 16509).")
+	rootCmd.PersistentFlags().BoolVarP(&annotateVMs, "vm", "", false, "Attribute the open network files of hypervisors (qemu, VirtualBox, VMware) to the virtual machines they run, grouping them by name.")
+	rootCmd.PersistentFlags().BoolVarP(&probeDsts, "probe", "", false, "Probe each unique TCP destination with a connect call, reporting reachability and latency.")
+	rootCmd.PersistentFlags().DurationVarP(&probeTimeout, "probe-timeout", "", probe.DefaultOptions.Timeout, "Timeout of each probe.")
+	rootCmd.PersistentFlags().IntVarP(&probeConcurrency, "probe-concurrency", "", probe.DefaultOptions.Concurrency, "Maximum number of probes in flight.")
+	rootCmd.PersistentFlags().BoolVarP(&tlsPeek, "tls-peek", "", false, "Perform a TLS handshake with destinations on port 443, reporting the certificate they present.")
+	rootCmd.PersistentFlags().IntVarP(&tlsPeekRate, "tls-peek-rate", "", tlspeek.DefaultOptions.Rate, "Maximum number of TLS handshakes started per second.")
+	rootCmd.PersistentFlags().BoolVarP(&tagProxies, "proxies", "", false, "Report the connections to the proxies configured through the environment or the system settings.")
+	rootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep looking up open network files, printing the ones opened (+) and closed (-) since the previous lookup.")
+	rootCmd.PersistentFlags().DurationVarP(&watchInterval, "interval", "", 2*time.Second, "Time between two lookups in watch mode.")
+	rootCmd.Flags().StringVarP(&stateDir, "state-dir", "", "", "Directory where the state of the watch is saved, resuming it after a restart.")
+	rootCmd.PersistentFlags().StringVarP(&recordPath, "record", "", "", "Append a snapshot to this file every \"--interval\", storing only the differences from the previous one.")
+	rootCmd.PersistentFlags().IntVarP(&keyframe, "keyframe", "", record.DefaultKeyframe, "Number of snapshots between two full snapshots written by \"--record\".")
+	rootCmd.Flags().DurationVarP(&rollup, "rollup", "", 0, "Period of the rollups written by \"--record\" (e.g. 1m), none by default.")
+	rootCmd.PersistentFlags().BoolVarP(&verifyBackends, "verify", "", false, "Cross-check the results of lsof with the /proc/net tables, reporting discrepancies (linux only).")
+	rootCmd.PersistentFlags().DurationVarP(&heartbeatInterval, "heartbeat", "", 0, "Print a JSON progress line on stderr at this interval (e.g. 10s). Disabled when zero.")
+	rootCmd.PersistentFlags().DurationVarP(&runTimeout, "timeout", "", 0, "Bound the whole invocation to this long (e.g. 30s), printing the results collected so far when it expires. Disabled when zero.")
+	rootCmd.PersistentFlags().DurationVarP(&cacheTTL, "cache-ttl", "", 0, "Reuse results cached on disk for up to this long (e.g. 10s). Disabled when zero.")
 }
 
 const usage = `List open network connections. Results can be filtered passing a raw regular expression as argument (check out https://golang.org/pkg/regexp/ to learn how to properly format your regex).
+On macOS, the argument may also be the path of an application bundle (i.e. /Applications/Spotify.app):
+in that case only the open network files of the processes running the bundle's executable are kept,
+even when the bundle is a symbolic link, or it is run from a translocated location or a disk image.
+Several arguments may be provided, such as "lsaddr Spotify Dropbox /Applications/Slack.app": the open
+network files matching any of them are listed together, so that formats such as "bpf" produce a
+single expression covering them all.
+Without an argument, or using the "--all" flag, every open network file of the system is listed.
+When printed to a terminal without "--all", the listing is limited to its first 100 lines, and a
+warning reports how many were left out. Empty arguments are refused, instead of matching everything.
 
 Using the "--format" or "-f" flag, it is possible to decide the format/encoding of the output produced. Possible values are:
 - "bpf": produces a Berkley Packet Filter expression, which, if given to a tool that supports
 bpfs, will make it capture only the packets headed to/coming from the destination addresses
 of the open network files collected.
-- "csv": produces a CSV encoded table of the open network files collected.
+- "csv": produces a CSV encoded table of the open network files collected. The user and file
+descriptor owning each of them, and its connection state, are reported in the "USER", "FD" and
+"STATE" columns when the backend provides them.
+- "mermaid": produces a Mermaid flowchart linking each process to the destination hosts it
+is connected to, ready to be pasted into Markdown documents.
+- "pcapng": produces a pcapng file containing no packets, but comments describing the open network
+files collected and name resolution records for the destinations with a resolved host name. Merge
+it with an actual capture (i.e. using mergecap) to have Wireshark display them.
+- "oneline": produces a single summary line, such as "Spotify: 12 conns (3 hosts)", suitable for
+status bars. The line can be customised with the "--template" flag, which accepts a Go template
+executed against the summary (fields: Name, Cmds, Pids, Hosts, Addrs, Files, Conns).
+- "top": produces a report of the destinations contacted by the largest number of distinct commands
+of the whole system (see "--top"), which helps identifying shared infrastructure such as DNS servers,
+proxies and telemetry sinks at a glance. It cannot be used together with a filter.
+- "addrs": produces the distinct destination addresses (ip:port), one per line and without any
+decoration, ready to be piped to xargs, nmap or curl. Using the "--hosts-only" flag, the distinct
+destination hosts are printed instead, without port.
+- "suricata": produces a Suricata dataset of type ip, listing each destination address once, so that
+the endpoints discovered can be monitored by existing IDS deployments.
+- "zeek": produces a Zeek intel framework file, with an Intel::ADDR indicator for each destination
+address, and optionally an Intel::DOMAIN one for each resolved destination host name (see "zeek.domains").
+- "long" (or the "--long" flag): produces a table mirroring the columns of "lsof -i", with the
+file descriptor, type, device and node of each open network file (not reported on windows).
+- "binaries": produces a pprof-like report of the connections of each executable, merging the
+processes running the same binary (i.e. the workers of a daemon): the "FLAT" column counts the
+connections of its processes, "CUM" those of their descendants too.
+- "firewalld": produces a shell script adding a permanent firewalld rich rule for each destination
+address and port, commented with the commands connected to it.
+- "ufw": produces a shell script of "ufw allow out" commands, one for each destination address and
+port, commented with the commands connected to it.
+- "iptables": produces a shell script of "iptables -A OUTPUT ... -j ACCEPT" rules (ip6tables for IPv6
+destinations), one for each destination address and port, commented with the commands connected to it.
+- "nftables": produces an nft script defining a table with a set of the destination addresses for each
+address family, commented with the commands connected to them, and an output chain accepting the
+traffic headed to them.
+- "pf": produces a pf.conf fragment defining a persistent table of the destination addresses, preceded
+by comments listing the commands connected to them, and a "pass out quick" rule for the traffic headed
+to them. Load it with "pfctl -a <anchor> -f <file>".
+- "matrix": produces a CSV matrix with a row for each command and a column for each destination host,
+counting the connections between them, hosts shared by the most commands first. Passing several
+filters (i.e. "lsaddr --format matrix Spotify Slack zoom"), it shows which applications share the same
+endpoints, such as third-party services.
+- "ndjson": produces newline-delimited JSON, one object per open network file. Unless flags that need
+the whole set of results are used (enrichers such as "--resolve" or "--exe", "--sort", "--cache-ttl",
+...), each line is written as soon as it is decoded, without holding the results in memory. Each
+object reports the version of its representation in the "schema_version" field (see "lsaddr version
+--json"), which is only incremented when fields are renamed or removed.
+
+Using the "--opt" flag, which may be repeated, options are passed to the selected format as
+"<format>.<key>=<value>" assignments. Supported options are:
+- "bpf.direction": "src" or "dst" restricts the expression to the packets coming from or headed to
+the addresses collected, "both" (the default) matches packets in both directions.
+- "bpf.stable": "true" leaves out the addresses with an ephemeral port, such as the source port of
+outgoing connections, which is soon reused by other applications: captures started later do not pick
+up unrelated traffic. Without it, a warning reports how many ephemeral ports the expression uses.
+- "bpf.ephemeral": the ephemeral port range, as "<lo>-<hi>", of the host the expression is used on.
+Defaults to the local one (ip_local_port_range on linux, 49152-65535 elsewhere).
+- "csv.header": "false" omits the header line.
+- "csv.separator": the character used to separate fields, instead of ",".
+- "firewalld.zone": the zone rules are added to, instead of the default one.
+- "firewalld.action": "accept" (the default), "reject" or "drop".
+- "iptables.chain": the chain rules are appended to, instead of "OUTPUT".
+- "iptables.verdict": "ACCEPT" (the default), "DROP" or "REJECT".
+- "iptables.ipset": collects the destinations into the ipset with the name provided ("<name>6" for IPv6
+ones), created by the script, and matches it with a single rule instead of one rule per destination.
+- "nftables.table": the name of the table, instead of "lsaddr".
+- "nftables.set": the name of the set of IPv4 addresses, instead of "dsts" ("<name>6" for IPv6 ones).
+- "nftables.verdict": "accept" (the default), "drop" or "reject".
+- "pf.table": the name of the table, instead of "lsaddr".
+- "pf.action": "pass" (the default), "block" or "block-return".
+- "zeek.domains": "true" adds an Intel::DOMAIN indicator for the name of each destination resolved with
+"--resolve". Names come from PTR records, chosen by the owner of the address: use it only when they can
+be trusted, as the IDS would flag any domain they claim.
+- "matrix.shared": "true" keeps only the hosts connected to by at least two commands.
+- "ndjson.flatten": "true" removes nested objects, joining their keys with "_", and splits addresses
+into ip and port (i.e. "dst_ip" and "dst_port" instead of a "dst" object), for consumers with rigid
+schemas.
+- "ndjson.fields": comma separated list of JSON pointers selecting the values written, such as
+"/cmd,/dst/addr", or "/cmd,/dst_ip" when flattened. The "--fields" flag is a shorthand for it.
+- "ndjson.schema_version": the version of the representation written, defaulting to the latest one,
+so that consumers can pin the version they were written against while new ones are rolled out.
+- "ufw.action": "allow" (the default), "deny" or "reject".
+
+Open network files are always listed ordered by command, pid, source and destination address (ips
+and ports are compared numerically), regardless of the order used by the underlying tool, so that
+outputs produced on different machines can be compared.
+
+Using the "--output" or "-o" flag, it is possible to decide where the output is delivered: "-" (the
+default) writes to stdout, "unix:<path>" to a unix socket, an http(s) URL makes lsaddr POST the output
+to it (retrying failed requests with exponential backoff), and anything else is used as a file path.
+
+Using the "--proxies" flag, connections to the proxies configured through the environment (HTTP_PROXY,
+HTTPS_PROXY, ALL_PROXY) or, on macOS, the system settings are reported in the "PROXY" column: their real
+destination is not the one listed. Proxy host names are resolved, and credentials are never reported.
+
+Using the "--notation" flag, addresses are printed in an alternative notation: "padded" (zero-padded
+IPv4, fully expanded IPv6), "int" (decimal integer), "hex" (hexadecimal integer) or "arpa" (reverse
+DNS name, such as 4.3.2.1.in-addr.arpa, without port). With the "addrs" format, the notation is applied
+to the distinct destinations, i.e. to collect their reverse DNS names into a DNS RPZ zone. Not supported
+by the formats that parse the addresses to produce filters, firewall rules or packets, or to group them
+by host: "bpf", "pcapng", "firewalld", "ufw", "iptables", "nftables", "pf", "suricata", "zeek", "top",
+"matrix", "mermaid", "oneline" and "binaries".
+
+Using the "--all-apps" flag (macOS only), the open network files of every running GUI application
+are collected with a single lookup and grouped by application, which is reported in the "APP" column.
+
+Using the "--listen-health" flag (linux only), only listening TCP sockets are kept, and their
+backlog and current accept queue length, read from /proc/net, are reported in the "BACKLOG" and
+"ACCEPT_QUEUE" columns. An accept queue close to the backlog indicates an overloaded service.
+
+Using the "--buffers" flag (linux only), the bytes waiting in the send and receive queues of connected
+sockets, read from /proc/net, are reported in the "SEND_Q" and "RECV_Q" columns. A growing receive queue
+indicates a slow consumer, a growing send queue a slow or unreachable peer. Using "--sort bufsize", which
+implies "--buffers", the sockets with the largest queues are listed first.
+
+Using the "--include-timewait" flag (linux only), TIME_WAIT and FIN_WAIT2 sockets which are no longer
+owned by any process are included, together with the remaining time of their kernel timer (reported in
+the "STATE" and "TIMER" columns). As they do not belong to any process, they are listed regardless of the
+filter provided.
+
+Using the "--where" flag, only the open network files matching the expression provided are kept,
+such as 'dst.port == 443 && command.startsWith("Chrome")'. Expressions support the "&&", "||" and "!"
+logical operators, the "==", "!=", "<", "<=", ">" and ">=" comparison operators, string and integer
+literals, parentheses and the startsWith, endsWith, contains and matches (regular expression) string
+methods. Available fields are: command, pid, net, state, app, proxy, src, src.ip, src.port, src.name,
+dst, dst.ip, dst.port, dst.name, dst.country and dst.asn (see "--geoip"). The expression is evaluated
+after every other enrichment.
+
+Using the "--exe" flag, the executable of each process is inspected, and its path, SHA-256 and, on
+macOS and windows, code-signing identity are reported in the "EXE", "SHA256" and "SIGNER" columns:
+the command name alone does not tell which binary owns a connection.
+
+Using the "--stable-src" flag, the connections whose source is a temporary (privacy) IPv6 address
+report the interface it is assigned to, and the stable address of the same interface, in the
+"SRC_IFACE" and "SRC_STABLE" columns: the report remains interpretable after the temporary address
+rotates. Temporary addresses are not told apart on windows.
+
+Using the "--resolve" flag, the names of the destination addresses are resolved with reverse DNS
+lookups and reported in the "DST_NAME" column, and using the "--resolve-src" flag the names of the
+source addresses are reported in the "SRC_NAME" column, which tells hosts apart in multi-homed or
+aggregated outputs. As the system resolver may be the very thing under investigation, lookups can
+be sent to a specific DNS server with "--dns", or to a DNS over HTTPS endpoint with "--doh". Lookups
+are rate limited (see "--dns-rate" and "--dns-timeout"), and each address is looked up once.
+
+Using the "--geoip" flag, the destination addresses are looked up in the MaxMind databases provided
+(i.e. GeoLite2-City and GeoLite2-ASN, separated by commas), and their country, city and autonomous
+system are reported in the "DST_COUNTRY", "DST_CITY", "DST_ASN" and "DST_ORG" columns, and in the
+"geo" object of the ndjson format. Each field is taken from the first database reporting it. Using
+the "--dst-country" and "--dst-asn" flags, only the connections to the comma separated countries
+(i.e. CN,RU) and autonomous systems (i.e. 16509) provided are kept: destinations that are not found
+in the databases are dropped.
+
+Using the "--vm" flag, the open network files of hypervisors (qemu, VirtualBox and VMware) are
+reported in the "VM" and "HYPERVISOR" columns, and in the "vm" object of the ndjson format, as their
+destinations may originate from the guest rather than from the host. The name of the virtual machine
+is taken from the command line of the hypervisor, and the output is grouped by it.
+
+Using the "--service" or "--window" flags (windows only), only the open network files of the processes
+running the service with the display or service name provided (i.e. "Print Spooler"), or owning a
+visible window whose title contains the text provided, are kept, as executable names such as
+svchost.exe are ambiguous. Both are case insensitive, and can be combined with a filter.
+
+Using the "--pgid" or "--sid" flags, only the open network files of the processes in the process group
+or session provided are kept, covering everything spawned by a shell script or a login session (i.e.
+"lsaddr --sid $(ps -o sid= -p $$)"). Both are resolved natively: on windows, where process groups do
+not exist, "--sid" selects a remote desktop services session.
+
+Using the "--proto" flag, only the open network files using one of the transport protocols provided
+(tcp, udp, separated by commas) are kept. "--tcp" and "--udp" are shorthands, and can be combined.
+The filter applies to every mode, including "--watch" and "--record".
+
+Using the "--state" flag, only the open network files in one of the connection states provided
+(i.e. LISTEN, ESTABLISHED, TIME_WAIT, separated by commas) are kept. States are case insensitive,
+"-" may be used in place of "_", and the names used by windows (LISTENING) and ss (ESTAB) are
+accepted. Open network files without a state, such as UDP sockets, are never kept.
+
+Using the "--dst-net" flag, which may be repeated, only the connections whose destination falls inside
+one of the networks provided (in CIDR notation, or plain addresses) are kept, while "--not-dst-net"
+drops the ones whose destination falls inside any of them. Combined, "lsaddr --all --not-dst-net
+10.0.0.0/8,192.168.0.0/16" lists every process talking outside the corporate network. Open network
+files without a destination, such as listening sockets, are only kept by "--not-dst-net".
+
+Using the "--no-loopback" flag, the open network files whose endpoints are both loopback or link-local
+addresses are dropped, removing the noise of IDEs, language servers and local databases talking to
+each other. Sockets listening on a loopback address are dropped too.
+
+Using the "-4" ("--ipv4") or "-6" ("--ipv6") flags, as with lsof and ss, only the open network files
+using IPv4 or IPv6 addresses are kept, so that the "bpf" format does not mix families. IPv4-mapped
+IPv6 addresses (i.e. ::ffff:10.0.0.2) count as IPv4, as the packets they exchange do. Providing both
+flags keeps every open network file.
+
+Using the "--to" flag, only the connections to a remote host are listed, answering questions such as
+"what still talks to the old database?". The host is resolved to all its A and AAAA records, and a
+connection matches when its destination is any of them (and the port, when provided, matches too):
+"lsaddr --to db.internal:5432" lists the local processes connected to db.internal on port 5432.
+
+Using the "--watch" or "-w" flag, the lookup is repeated every "--interval" (2s by default) until
+interrupted, and the open network files opened and closed since the previous lookup are printed, one
+per line, prefixed by the time of the lookup and "+" or "-". Open network files found by the first
+lookup are not printed. "--to" and "--where" apply, while "--format" and enrichers are not supported.
+Filters apply to each lookup: a connection reaching the state selected with "--state" is printed as
+opened, and one leaving it as closed. With an http(s) "--output", each change is POSTed as it happens.
+Application bundles are resolved to their processes again by each lookup: when the application is
+restarted or updated, a line prefixed by "~" reports the pids it was re-resolved to, and lookups
+failing while it is not running are retried.
+On windows, unless another "--backend" is chosen, each lookup reads the IP Helper tables in process,
+so watching neither executes netstat nor opens a console window every "--interval".
+
+Using the "--state-dir <dir>" flag, the state of the watch (the open network files found by the
+last lookup, and the time each of them was first seen) is saved to dir after each change, one file
+per combination of backend, filters and flags. A watch restarted with the same ones, for example
+after a reboot, resumes from it: the open network files opened and closed while it was not running
+are printed by its first lookup, instead of being taken as the new baseline.
+
+Using the "--record <path>" flag, a snapshot is appended to path every "--interval" until interrupted,
+as NDJSON: only the open network files opened and closed since the previous snapshot are written,
+except for a full snapshot every "--keyframe" ones, which keeps long recordings small. Recordings
+are read back by the "beacons" subcommand. "--to" and "--where" apply, while "--notation" and
+enrichers are not supported. Using the "--rollup <period>" flag, a rollup is also appended every
+period (i.e. 1m), reporting for each command the number of distinct destinations, and of open
+network files opened and closed, during the period: downstream storage can keep the rollups even
+when the snapshots are sampled away.
+
+Using the "--probe" flag, each unique TCP destination is probed with a connect call (see
+"--probe-timeout" and "--probe-concurrency"), and its reachability and latency are reported
+in the "REACHABLE" and "LATENCY" columns.
+
+Using the "--tls-peek" flag, a TLS handshake (without any data exchange) is performed with each
+unique destination on port 443, and the subject and names of the certificate presented are reported
+in the "CERT_SUBJECT" and "CERT_NAMES" columns. Handshakes are rate limited (see "--tls-peek-rate").
+The name of the destination is sent as server name only when known: combine it with "--resolve",
+otherwise servers hosting several names (i.e. CDNs) report their default certificate.
+
+Using the "--cache-ttl" flag, results are cached on disk (in the user's cache directory) and reused
+by subsequent invocations with the same filter, as long as they are not older than the duration provided.
+
+Using the "--heartbeat" flag, a progress line is printed on stderr at the interval provided, as a
+JSON object such as {"type":"heartbeat","time":"...","elapsed_ms":10000,"phase":"lookup","files":0},
+so that wrappers running lsaddr under orchestration can tell a long lookup on a busy host from a hung
+one. Phases are start, lookup, enrich, encode, watch and record, and a last line in phase done is
+printed on exit. "files" counts the open network files processed so far.
+
+Every flag can also be configured through an environment variable, named after the flag with the
+"LSADDR_" prefix (i.e. LSADDR_FORMAT for "--format", LSADDR_PROBE_TIMEOUT for "--probe-timeout"), or
+through a configuration file containing one "flag = value" assignment per line, found at the path in
+LSADDR_CONFIG or at "lsaddr/config" under the user's configuration directory. Flags provided on the
+command line take precedence over environment variables, which take precedence over the file.
+
+Using the "--verify" flag (linux only), no output is produced: the sockets reported by lsof are instead
+compared with the ones listed in the /proc/net tables, and each socket found by only one of them is
+printed. The exit status is 1 when discrepancies are found. Note that they may be caused by connections
+opened or closed between the two reads.
+
+Using the "--backend" flag, it is possible to choose where the open network files are read from: "lsof"
+(the default on linux and macOS), "proc", which reads the /proc/net tables and attributes sockets to
+processes through /proc/<pid>/fd, without executing any tool (linux only), "ss", which parses the
+output of "ss -tunap", available on distributions that do not ship lsof (linux only), "sockstat"
+(the default on FreeBSD), which parses the output of "sockstat -46 -s", "fstat" (the default on
+OpenBSD), which parses the output of fstat, reading TCP states from netstat, "libproc", which
+enumerates sockets with proc_pidinfo, much faster than lsof on busy machines (macOS only, requires a
+build with cgo), "iphlpapi" (the default on windows), which uses the IP Helper API, or "netstat",
+which parses the output of netstat instead ("netstat -anvW" on macOS, naming processes with ps when
+it does not).
+On linux, "auto" (the default) falls back to "proc" when lsof is not installed, or not enabled in
+hardened mode. On macOS, it falls back to "netstat" when lsof fails, as it happens when it is not
+installed or times out on busy machines.
+
+Using the "--elevate" flag, lsaddr runs itself again with the same arguments (plus the values configured
+through the environment and the configuration file, which the elevated process would not find) and
+administrative privileges when it lacks them, as the open network files of other users' processes are otherwise
+not listed: through sudo on unix, which may prompt for a password, and through a UAC prompt on
+windows, where the results of the elevated process are copied to the standard output (its standard
+error is not shown). It cannot be used in hardened mode.
+
+Using the "--hardened" flag, lsaddr refuses to execute any external tool (lsof, netstat, ps, ...)
+unless it is enabled with "--allow-exec <name>=<path>". Enabled tools are executed by the absolute
+path provided, which must point to an executable that is not writable by group or others, and PATH
+is never looked up. Features relying on tools that are not enabled fail, and native backends are preferred (see "--backend").
+
+Using the "--max-exec" and "--max-exec-per-command" flags, the number of external tools executed
+concurrently is limited, in total and per tool: commands exceeding the limits wait for a running one
+to exit. "--max-exec 1" performs one execution at a time, for constrained hosts.
+
+When a filter selects no open network file, lsaddr tells apart the case in which no running process
+matches it (exit status 2, likely a typo) from the one in which the matching processes have no open
+network files (exit status 3), reporting how many processes matched. Other errors exit with status 1.
+
+Using the "--timeout" flag, the whole invocation (running the backend, decoding its output, enriching
+and delivering the results) is bounded to the duration provided, so that a stalled backend, DNS server or
+collector cannot hang it. When it expires, the results collected so far are printed, a warning reports the phase
+that did not complete and the exit status is 4. In watch and record mode, it bounds the session. It
+applies to the subcommands too.
 `
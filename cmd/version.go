@@ -0,0 +1,79 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/spf13/cobra"
+)
+
+// Formats lists the values accepted by the "--format" flag.
+var Formats = []string{"csv", "bpf", "mermaid", "pcapng", "oneline", "top", "suricata", "zeek", "long", "binaries", "ndjson", "firewalld", "ufw", "addrs", "matrix", "iptables", "nftables", "pf"}
+
+var versionJSON bool
+
+// versionInfo is the machine readable output of the version command.
+type versionInfo struct {
+	Version       string   `json:"version"`
+	Commit        string   `json:"commit"`
+	BuildTime     string   `json:"build_time"`
+	GOOS          string   `json:"goos"`
+	GOARCH        string   `json:"goarch"`
+	Backends      []string `json:"backends"`
+	Formats       []string `json:"formats"`
+	SchemaVersion int      `json:"schema_version"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print build information and capabilities.",
+	Long: `Print build information such as version, commit and build time. Using the "--json" flag,
+the output is a JSON object which also reports the backends supported on this platform, the output
+formats and the version of the JSON schema used to represent open network files, so that tools can
+verify compatibility before parsing lsaddr's output.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !versionJSON {
+			fmt.Printf("Version: %s, Commit: %s, Built at: %s\n", Version, Commit, BuildTime)
+			return
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(versionInfo{
+			Version:       Version,
+			Commit:        Commit,
+			BuildTime:     BuildTime,
+			GOOS:          runtime.GOOS,
+			GOARCH:        runtime.GOARCH,
+			Backends:      onf.Runtimes(),
+			Formats:       Formats,
+			SchemaVersion: onf.SchemaVersion,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	versionCmd.Flags().BoolVarP(&versionJSON, "json", "", false, "Print a JSON object instead.")
+	rootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,200 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package config resolves the value of the command line flags that
+// were not set explicitly, from the environment and from a
+// configuration file. Precedence is: flag > environment > file.
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/spf13/pflag"
+)
+
+// Prefix is prepended to the name of the environment variables
+// that configure flags, i.e. LSADDR_FORMAT configures "--format".
+const Prefix = "LSADDR_"
+
+// Source provides the configured value of a flag, if any.
+type Source interface {
+	Lookup(flag string) (string, bool)
+}
+
+// Env is a Source reading environment variables. Flag names are
+// upper cased, dashes replaced by underscores, and Prefix is
+// prepended: "--probe-timeout" is configured by LSADDR_PROBE_TIMEOUT.
+type Env struct{}
+
+func (Env) Lookup(flag string) (string, bool) {
+	return os.LookupEnv(EnvName(flag))
+}
+
+// EnvName returns the name of the environment variable configuring `flag`.
+func EnvName(flag string) string {
+	return Prefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// File is a Source containing the values read from a configuration
+// file.
+type File map[string]string
+
+func (f File) Lookup(flag string) (string, bool) {
+	v, ok := f[flag]
+	return v, ok
+}
+
+// ParseFile expects "r" to contain a configuration file, made of
+// one ``flag = value'' assignment per line. Empty lines and lines
+// starting with "#" are ignored, and values may be quoted.
+//
+// "line" examples:
+// "format = oneline"
+// "template = \"{{.Name}}: {{.Conns}}\""
+func ParseFile(r io.Reader) (File, error) {
+	f := make(File)
+	n := 0
+	err := internal.ScanLines(r, func(line string) error {
+		n++
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			return nil
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return fmt.Errorf("line %d: expected \"flag = value\", found \"%s\"", n, line)
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(line[:i]), "--")
+		value := strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		f[key] = value
+		return nil
+	})
+	return f, err
+}
+
+// Path returns the location of the configuration file: the value of
+// LSADDR_CONFIG if set, "lsaddr/config" under the user's configuration
+// directory otherwise.
+func Path() (string, error) {
+	if path, ok := os.LookupEnv(Prefix + "CONFIG"); ok {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lsaddr", "config"), nil
+}
+
+// Load reads the configuration file found at Path. A missing file is
+// not an error, and produces an empty File.
+func Load() (File, error) {
+	path, err := Path()
+	if err != nil {
+		return File{}, nil
+	}
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := ParseFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Annotation is the key of the flag annotation recording that the
+// value of a flag was set by Apply, rather than on the command line.
+// The annotation holds the value set.
+const Annotation = "lsaddr_config"
+
+// Apply sets each flag of `fs` that was not set on the command line
+// to the value provided by the first source of `sources` that has
+// one, annotating it with Annotation (see FromCommandLine). Keys of
+// File sources that do not match any flag are reported as errors, as
+// they are likely typos.
+func Apply(fs *pflag.FlagSet, sources ...Source) error {
+	var err error
+	known := make(map[string]bool)
+	fs.VisitAll(func(f *pflag.Flag) {
+		known[f.Name] = true
+		if f.Changed || err != nil {
+			return
+		}
+		for _, s := range sources {
+			v, ok := s.Lookup(f.Name)
+			if !ok {
+				continue
+			}
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid value %q for flag --%s: %w", v, f.Name, serr)
+				return
+			}
+			err = fs.SetAnnotation(f.Name, Annotation, []string{v})
+			return
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range sources {
+		file, ok := s.(File)
+		if !ok {
+			continue
+		}
+		for k := range file {
+			if !known[k] {
+				return fmt.Errorf("unknown flag %q in configuration file", k)
+			}
+		}
+	}
+	return nil
+}
+
+// FromCommandLine reports whether flag `name` of `fs` was set on the
+// command line. Flags set by Apply are marked as changed too, but the
+// values of the environment and of the configuration file are defaults
+// chosen by the user: they should not conflict with explicit flags.
+func FromCommandLine(fs *pflag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	return f != nil && f.Changed && len(f.Annotations[Annotation]) == 0
+}
+
+// Args returns the flags of `fs` set by Apply as command line
+// arguments, i.e. "--format=ndjson", sorted by name. Processes started
+// with a different environment or user, which would not find the same
+// configuration, can be given the values in effect explicitly.
+func Args(fs *pflag.FlagSet) []string {
+	var acc []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		if v := f.Annotations[Annotation]; len(v) > 0 {
+			acc = append(acc, "--"+f.Name+"="+v[0])
+		}
+	})
+	return acc
+}
@@ -0,0 +1,109 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/config"
+	"github.com/spf13/pflag"
+)
+
+func TestParseFile(t *testing.T) {
+	t.Parallel()
+	f, err := config.ParseFile(strings.NewReader(`
+# comment
+format = oneline
+--probe-timeout=1s
+template = "{{.Name}}: {{.Conns}}"
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"format":        "oneline",
+		"probe-timeout": "1s",
+		"template":      "{{.Name}}: {{.Conns}}",
+	}
+	if len(f) != len(want) {
+		t.Fatalf("Unexpected file: %v", f)
+	}
+	for k, v := range want {
+		if f[k] != v {
+			t.Fatalf("Unexpected value of %s: wanted %q, found %q", k, v, f[k])
+		}
+	}
+	if _, err := config.ParseFile(strings.NewReader("format")); err == nil {
+		t.Fatalf("Expected an error for a line without assignment")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	t.Parallel()
+	if name := config.EnvName("probe-timeout"); name != "LSADDR_PROBE_TIMEOUT" {
+		t.Fatalf("Unexpected name: %s", name)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Not parallel: modifies the environment.
+	var format, output string
+	var timeout time.Duration
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.StringVar(&format, "format", "csv", "")
+	fs.StringVar(&output, "output", "-", "")
+	fs.DurationVar(&timeout, "probe-timeout", time.Second, "")
+	if err := fs.Parse([]string{"--output", "out.csv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LSADDR_FORMAT", "bpf")
+	os.Setenv("LSADDR_OUTPUT", "env.csv")
+	defer os.Unsetenv("LSADDR_FORMAT")
+	defer os.Unsetenv("LSADDR_OUTPUT")
+	file := config.File{"format": "mermaid", "probe-timeout": "3s"}
+
+	if err := config.Apply(fs, config.Env{}, file); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output != "out.csv" {
+		t.Fatalf("Expected flag to take precedence, found output %s", output)
+	}
+	if format != "bpf" {
+		t.Fatalf("Expected environment to take precedence over file, found format %s", format)
+	}
+	if timeout != 3*time.Second {
+		t.Fatalf("Expected file value to be used, found timeout %v", timeout)
+	}
+	for _, v := range []struct {
+		name string
+		want bool
+	}{{"output", true}, {"format", false}, {"probe-timeout", false}} {
+		if ok := config.FromCommandLine(fs, v.name); ok != v.want {
+			t.Fatalf("Unexpected command line flag %s: wanted %v, found %v", v.name, v.want, ok)
+		}
+	}
+	if args, want := config.Args(fs), []string{"--format=bpf", "--probe-timeout=3s"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("Unexpected configured arguments: wanted %q, found %q", want, args)
+	}
+	if err := config.Apply(fs, config.File{"fromat": "csv"}); err == nil {
+		t.Fatalf("Expected an error for an unknown flag")
+	}
+}
@@ -16,16 +16,243 @@ package csv
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
+	"net"
 	"strconv"
+	"strings"
 
 	"github.com/jecoz/lsaddr/onf"
 )
 
+// Field describes a column of the CSV output.
+type Field struct {
+	Name  string
+	Value func(onf.ONF) string
+}
+
+// DefaultFields are the columns always present in the output.
+var DefaultFields = []Field{
+	{"PID", func(f onf.ONF) string { return strconv.Itoa(f.Pid) }},
+	{"CMD", func(f onf.ONF) string { return f.Cmd }},
+	{"NET", func(f onf.ONF) string { return network(f.Src) }},
+	{"SRC", func(f onf.ONF) string { return str(f.Src) }},
+	{"DST", func(f onf.ONF) string { return str(f.Dst) }},
+}
+
+// NameFields are appended to DefaultFields when at least one of the
+// open network files has a resolved host name. Addresses are kept
+// in their own columns, so that consumers can still match on them.
+var NameFields = []Field{
+	{"SRC_NAME", func(f onf.ONF) string { return f.SrcName }},
+	{"DST_NAME", func(f onf.ONF) string { return f.DstName }},
+}
+
+// AppFields are appended to the output when at least one of the
+// open network files is associated with a GUI application.
+var AppFields = []Field{
+	{"APP", func(f onf.ONF) string { return f.App }},
+}
+
+// ProbeFields are appended to the output when at least one of the
+// open network files has been probed.
+var ProbeFields = []Field{
+	{"REACHABLE", func(f onf.ONF) string {
+		if f.Probe == nil {
+			return ""
+		}
+		return strconv.FormatBool(f.Probe.Reachable)
+	}},
+	{"LATENCY", func(f onf.ONF) string {
+		if f.Probe == nil || !f.Probe.Reachable {
+			return ""
+		}
+		return f.Probe.Latency.String()
+	}},
+}
+
+// CertFields are appended to the output when at least one of the
+// open network files has a peeked TLS certificate.
+var CertFields = []Field{
+	{"CERT_SUBJECT", func(f onf.ONF) string {
+		if f.Cert == nil {
+			return ""
+		}
+		return f.Cert.Subject
+	}},
+	{"CERT_NAMES", func(f onf.ONF) string {
+		if f.Cert == nil {
+			return ""
+		}
+		return strings.Join(f.Cert.DNSNames, " ")
+	}},
+}
+
+// ListenFields are appended to the output when at least one of the
+// open network files carries accept queue information.
+var ListenFields = []Field{
+	{"BACKLOG", func(f onf.ONF) string {
+		if f.Listen == nil {
+			return ""
+		}
+		return strconv.FormatUint(f.Listen.Backlog, 10)
+	}},
+	{"ACCEPT_QUEUE", func(f onf.ONF) string {
+		if f.Listen == nil {
+			return ""
+		}
+		return strconv.FormatUint(f.Listen.Queue, 10)
+	}},
+}
+
+// BufferFields are appended to the output when at least one of the
+// open network files carries socket queues information.
+var BufferFields = []Field{
+	{"SEND_Q", func(f onf.ONF) string {
+		if f.Buffers == nil {
+			return ""
+		}
+		return strconv.FormatUint(f.Buffers.Send, 10)
+	}},
+	{"RECV_Q", func(f onf.ONF) string {
+		if f.Buffers == nil {
+			return ""
+		}
+		return strconv.FormatUint(f.Buffers.Recv, 10)
+	}},
+}
+
+// ProxyFields are appended to the output when at least one of the
+// open network files points to a configured proxy.
+var ProxyFields = []Field{
+	{"PROXY", func(f onf.ONF) string { return f.Proxy }},
+}
+
+// TimerFields are appended to the output when at least one of the
+// open network files reports a kernel socket timer. The state of the
+// socket is reported by OwnerFields.
+var TimerFields = []Field{
+	{"TIMER", func(f onf.ONF) string {
+		if f.Timer == 0 {
+			return ""
+		}
+		return f.Timer.String()
+	}},
+}
+
+// ExeFields are appended to the output when at least one of the
+// open network files carries information about its executable.
+var ExeFields = []Field{
+	{"EXE", func(f onf.ONF) string {
+		if f.Exe == nil {
+			return ""
+		}
+		return f.Exe.Path
+	}},
+	{"SHA256", func(f onf.ONF) string {
+		if f.Exe == nil {
+			return ""
+		}
+		return f.Exe.SHA256
+	}},
+	{"SIGNER", func(f onf.ONF) string {
+		if f.Exe == nil {
+			return ""
+		}
+		return f.Exe.Signer
+	}},
+}
+
+// IfaceFields are appended to the output when at least one of the
+// open network files has a temporary IPv6 source address annotated
+// with its interface.
+var IfaceFields = []Field{
+	{"SRC_IFACE", func(f onf.ONF) string {
+		if f.Iface == nil {
+			return ""
+		}
+		return f.Iface.Name
+	}},
+	{"SRC_STABLE", func(f onf.ONF) string {
+		if f.Iface == nil {
+			return ""
+		}
+		return f.Iface.Stable
+	}},
+}
+
+// GeoFields are appended to the output when at least one of the open
+// network files has a destination found in a GeoIP database.
+var GeoFields = []Field{
+	{"DST_COUNTRY", func(f onf.ONF) string {
+		if f.Geo == nil {
+			return ""
+		}
+		return f.Geo.Country
+	}},
+	{"DST_CITY", func(f onf.ONF) string {
+		if f.Geo == nil {
+			return ""
+		}
+		return f.Geo.City
+	}},
+	{"DST_ASN", func(f onf.ONF) string {
+		if f.Geo == nil || f.Geo.ASN == 0 {
+			return ""
+		}
+		return strconv.Itoa(f.Geo.ASN)
+	}},
+	{"DST_ORG", func(f onf.ONF) string {
+		if f.Geo == nil {
+			return ""
+		}
+		return f.Geo.Org
+	}},
+}
+
+// VMFields are appended to the output when at least one of the open
+// network files is owned by a hypervisor, whose destinations may
+// originate from the guest rather than from the host.
+var VMFields = []Field{
+	{"VM", func(f onf.ONF) string {
+		if f.VM == nil {
+			return ""
+		}
+		return f.VM.Name
+	}},
+	{"HYPERVISOR", func(f onf.ONF) string {
+		if f.VM == nil {
+			return ""
+		}
+		return f.VM.Hypervisor
+	}},
+}
+
+// OwnerFields are appended to the output when at least one of the
+// open network files reports the user and file descriptor owning it,
+// or its connection state, so that rows can be told apart even when a
+// process holds several connections to the same destination.
+var OwnerFields = []Field{
+	{"USER", func(f onf.ONF) string {
+		if f.File == nil {
+			return ""
+		}
+		return f.File.User
+	}},
+	{"FD", func(f onf.ONF) string {
+		if f.File == nil {
+			return ""
+		}
+		return f.File.Fd
+	}},
+	{"STATE", func(f onf.ONF) string { return f.State }},
+}
+
 // Encoder returns an Encoder which encodes a list
 // of NetFile into CSV format.
 type Encoder struct {
-	w *csv.Writer
+	w        *csv.Writer
+	noHeader bool
 }
 
 func NewEncoder(w io.Writer) *Encoder {
@@ -34,21 +261,92 @@ func NewEncoder(w io.Writer) *Encoder {
 	}
 }
 
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "header": "false" omits the header line.
+// - "separator": the single character used to separate fields,
+// instead of ",".
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "header":
+			header, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid header option %q: %w", v, err)
+			}
+			e.noHeader = !header
+		case "separator":
+			r := []rune(v)
+			if len(r) != 1 {
+				return nil, fmt.Errorf("invalid separator %q: expected a single character", v)
+			}
+			e.w.Comma = r[0]
+		default:
+			return nil, fmt.Errorf("unknown csv option %q", k)
+		}
+	}
+	return e, nil
+}
+
 // Encode writes `l` into encoder's writer in CSV format. Some data may have been
 // written to the writer even upon error.
 func (e *Encoder) Encode(l []onf.ONF) error {
-	header := []string{"PID", "CMD", "NET", "SRC", "DST"}
-	if err := e.w.Write(header); err != nil {
-		return err
+	fields := DefaultFields
+	if hasNames(l) {
+		fields = append(fields[:len(fields):len(fields)], NameFields...)
+	}
+	if hasApps(l) {
+		fields = append(fields[:len(fields):len(fields)], AppFields...)
+	}
+	if hasProbes(l) {
+		fields = append(fields[:len(fields):len(fields)], ProbeFields...)
+	}
+	if hasCerts(l) {
+		fields = append(fields[:len(fields):len(fields)], CertFields...)
+	}
+	if hasListen(l) {
+		fields = append(fields[:len(fields):len(fields)], ListenFields...)
+	}
+	if hasBuffers(l) {
+		fields = append(fields[:len(fields):len(fields)], BufferFields...)
+	}
+	if hasProxies(l) {
+		fields = append(fields[:len(fields):len(fields)], ProxyFields...)
+	}
+	if hasTimers(l) {
+		fields = append(fields[:len(fields):len(fields)], TimerFields...)
+	}
+	if hasExes(l) {
+		fields = append(fields[:len(fields):len(fields)], ExeFields...)
+	}
+	if hasIfaces(l) {
+		fields = append(fields[:len(fields):len(fields)], IfaceFields...)
+	}
+	if hasGeos(l) {
+		fields = append(fields[:len(fields):len(fields)], GeoFields...)
+	}
+	if hasVMs(l) {
+		fields = append(fields[:len(fields):len(fields)], VMFields...)
+	}
+	if hasOwners(l) {
+		fields = append(fields[:len(fields):len(fields)], OwnerFields...)
+	}
+
+	if !e.noHeader {
+		header := make([]string, len(fields))
+		for i, v := range fields {
+			header[i] = v.Name
+		}
+		if err := e.w.Write(header); err != nil {
+			return err
+		}
 	}
 
 	for _, v := range l {
-		record := []string{
-			strconv.Itoa(v.Pid),
-			v.Cmd,
-			v.Src.Network(),
-			v.Src.String(),
-			v.Dst.String(),
+		record := make([]string, len(fields))
+		for i, f := range fields {
+			record[i] = f.Value(v)
 		}
 		if err := e.w.Write(record); err != nil {
 			return err
@@ -58,3 +356,134 @@ func (e *Encoder) Encode(l []onf.ONF) error {
 	e.w.Flush()
 	return e.w.Error()
 }
+
+func hasNames(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.SrcName != "" || v.DstName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasApps(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.App != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasProbes(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Probe != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCerts(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Cert != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasListen(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Listen != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBuffers(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Buffers != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasProxies(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Proxy != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTimers(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Timer != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExes(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Exe != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIfaces(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Iface != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGeos(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.Geo != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVMs(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.VM != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOwners(l []onf.ONF) bool {
+	for _, v := range l {
+		if v.File != nil || v.State != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func network(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.Network()
+}
+
+func str(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
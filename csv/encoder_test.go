@@ -20,8 +20,8 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/booster-proj/lsaddr/csv"
-	"github.com/booster-proj/lsaddr/lookup"
+	"github.com/jecoz/lsaddr/csv"
+	"github.com/jecoz/lsaddr/onf"
 )
 
 func TestEncode_CSV(t *testing.T) {
@@ -41,9 +41,68 @@ func TestEncode_CSV(t *testing.T) {
 	}
 }
 
-var netFiles0 = []lookup.NetFile{
-	{"foo", 101, newUDPAddr("192.168.0.61:54104"), newUDPAddr("52.94.218.7:443")},
-	{"", 102, newUDPAddr("[::1]:60051"), newUDPAddr("[::1]:60052")},
+func TestEncode_CSVNames(t *testing.T) {
+	t.Parallel()
+	l := []onf.ONF{netFiles0[0], netFiles0[1]}
+	l[0].DstName = "example.com"
+	var w strings.Builder
+	if err := csv.NewEncoder(&w).Encode(l); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expOut := `PID,CMD,NET,SRC,DST,SRC_NAME,DST_NAME
+101,foo,udp,192.168.0.61:54104,52.94.218.7:443,,example.com
+102,,udp,[::1]:60051,[::1]:60052,,
+`
+	if expOut != w.String() {
+		t.Fatalf("Unexpected output: wanted\n\"%s\",\nfound\n\"%s\"", expOut, w.String())
+	}
+}
+
+func TestEncode_CSVOwners(t *testing.T) {
+	t.Parallel()
+	l := []onf.ONF{netFiles0[0], netFiles0[1]}
+	l[0].File = &onf.File{User: "dan", Fd: "128u"}
+	l[1].State = "ESTABLISHED"
+	var w strings.Builder
+	if err := csv.NewEncoder(&w).Encode(l); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expOut := `PID,CMD,NET,SRC,DST,USER,FD,STATE
+101,foo,udp,192.168.0.61:54104,52.94.218.7:443,dan,128u,
+102,,udp,[::1]:60051,[::1]:60052,,,ESTABLISHED
+`
+	if expOut != w.String() {
+		t.Fatalf("Unexpected output: wanted\n\"%s\",\nfound\n\"%s\"", expOut, w.String())
+	}
+}
+
+func TestEncode_CSVOptions(t *testing.T) {
+	t.Parallel()
+	var w strings.Builder
+	enc, err := csv.NewEncoderOptions(&w, map[string]string{"header": "false", "separator": ";"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := enc.Encode(netFiles0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expOut := `101;foo;udp;192.168.0.61:54104;52.94.218.7:443
+102;;udp;[::1]:60051;[::1]:60052
+`
+	if expOut != w.String() {
+		t.Fatalf("Unexpected output: wanted\n\"%s\",\nfound\n\"%s\"", expOut, w.String())
+	}
+	if _, err := csv.NewEncoderOptions(&w, map[string]string{"colour": "red"}); err == nil {
+		t.Fatalf("Expected an error for an unknown option")
+	}
+}
+
+var netFiles0 = []onf.ONF{
+	{Cmd: "foo", Pid: 101, Src: newUDPAddr("192.168.0.61:54104"), Dst: newUDPAddr("52.94.218.7:443")},
+	{Cmd: "", Pid: 102, Src: newUDPAddr("[::1]:60051"), Dst: newUDPAddr("[::1]:60052")},
 }
 
 func newUDPAddr(address string) net.Addr {
@@ -0,0 +1,38 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package elevate re-executes lsaddr with administrative privileges,
+// through sudo on unix and a UAC prompt on windows, as the open
+// network files of other users' processes are only visible to
+// privileged users.
+package elevate
+
+import "strings"
+
+// Args returns `args` without the "--elevate" flag, which would
+// otherwise be inherited by the elevated process.
+func Args(args []string) []string {
+	acc := make([]string, 0, len(args))
+	for i, v := range args {
+		if v == "--" {
+			return append(acc, args[i:]...)
+		}
+		if v == "--elevate" || strings.HasPrefix(v, "--elevate=") {
+			continue
+		}
+		acc = append(acc, v)
+	}
+	return acc
+}
@@ -0,0 +1,38 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package elevate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in, out []string
+	}{
+		{[]string{"--elevate", "Spotify"}, []string{"Spotify"}},
+		{[]string{"-f", "ndjson", "--elevate=true", "--to", "db:5432"}, []string{"-f", "ndjson", "--to", "db:5432"}},
+		{[]string{"--", "--elevate"}, []string{"--", "--elevate"}},
+		{[]string{}, []string{}},
+	}
+	for i, v := range tt {
+		if out := Args(v.in); !reflect.DeepEqual(out, v.out) {
+			t.Fatalf("%d: Unexpected args: wanted %q, found %q", i, v.out, out)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package elevate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Elevated reports whether the process runs as root.
+func Elevated() bool {
+	return os.Geteuid() == 0
+}
+
+// Run executes the current executable with `args` through sudo, which
+// prompts for a password on the terminal when needed. The standard
+// streams are inherited, so that results are printed as they would be
+// by the current process. Returns the exit status of the elevated
+// process.
+func Run(args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 1, fmt.Errorf("unable to find the current executable: %w", err)
+	}
+	cmd := exec.Command("sudo", append([]string{exe}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, fmt.Errorf("unable to run sudo: %w", err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,151 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows
+
+package elevate
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	shell32            = syscall.NewLazyDLL("shell32.dll")
+	procShellExecuteEx = shell32.NewProc("ShellExecuteExW")
+)
+
+const (
+	tokenElevation = 20 // TOKEN_INFORMATION_CLASS TokenElevation
+
+	seeMaskNoCloseProcess = 0x00000040
+	seeMaskNoAsync        = 0x00000100
+	swHide                = 0
+)
+
+// shellExecuteInfo mirrors SHELLEXECUTEINFOW.
+type shellExecuteInfo struct {
+	size       uint32
+	mask       uint32
+	hwnd       uintptr
+	verb       *uint16
+	file       *uint16
+	parameters *uint16
+	directory  *uint16
+	show       int32
+	instApp    uintptr
+	idList     uintptr
+	class      *uint16
+	keyClass   uintptr
+	hotKey     uint32
+	icon       uintptr
+	process    syscall.Handle
+}
+
+// Elevated reports whether the process token is elevated.
+func Elevated() bool {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return false
+	}
+	var t syscall.Token
+	if err := syscall.OpenProcessToken(p, syscall.TOKEN_QUERY, &t); err != nil {
+		return false
+	}
+	defer t.Close()
+	var elevated, n uint32
+	err = syscall.GetTokenInformation(t, tokenElevation, (*byte)(unsafe.Pointer(&elevated)), uint32(unsafe.Sizeof(elevated)), &n)
+	return err == nil && elevated != 0
+}
+
+// Run executes the current executable with `args` through a UAC
+// prompt. The elevated process runs in its own hidden console, hence
+// its results are written to a temporary file (see the "--output"
+// flag), which is then copied to the standard output, unless `args`
+// already select an output. Its standard error is not shown. Returns
+// the exit status of the elevated process.
+func Run(args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 1, fmt.Errorf("unable to find the current executable: %w", err)
+	}
+	var path string
+	if !hasOutput(args) {
+		f, err := ioutil.TempFile("", "lsaddr-elevated-")
+		if err != nil {
+			return 1, fmt.Errorf("unable to create output file: %w", err)
+		}
+		path = f.Name()
+		f.Close()
+		defer os.Remove(path)
+		args = append(args[:len(args):len(args)], "--output", path)
+	}
+
+	params := make([]string, 0, len(args))
+	for _, v := range args {
+		params = append(params, syscall.EscapeArg(v))
+	}
+	info := shellExecuteInfo{
+		mask:       seeMaskNoCloseProcess | seeMaskNoAsync,
+		verb:       syscall.StringToUTF16Ptr("runas"),
+		file:       syscall.StringToUTF16Ptr(exe),
+		parameters: syscall.StringToUTF16Ptr(strings.Join(params, " ")),
+		show:       swHide,
+	}
+	info.size = uint32(unsafe.Sizeof(info))
+	if ret, _, err := procShellExecuteEx.Call(uintptr(unsafe.Pointer(&info))); ret == 0 {
+		// Also returned when the user declines the prompt.
+		return 1, fmt.Errorf("unable to run elevated: %w", err)
+	}
+	defer syscall.CloseHandle(info.process)
+	if _, err := syscall.WaitForSingleObject(info.process, syscall.INFINITE); err != nil {
+		return 1, fmt.Errorf("unable to wait for the elevated process: %w", err)
+	}
+	var code uint32
+	if err := syscall.GetExitCodeProcess(info.process, &code); err != nil {
+		return 1, fmt.Errorf("unable to read the exit status of the elevated process: %w", err)
+	}
+
+	if path == "" {
+		return int(code), nil
+	}
+	out, err := os.Open(path)
+	if err != nil {
+		return 1, fmt.Errorf("unable to read the results of the elevated process: %w", err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(os.Stdout, out); err != nil {
+		return 1, err
+	}
+	return int(code), nil
+}
+
+// hasOutput reports whether `args` provide the "--output" flag.
+func hasOutput(args []string) bool {
+	for _, v := range args {
+		if v == "--" {
+			return false
+		}
+		if strings.HasPrefix(v, "--output") || (strings.HasPrefix(v, "-o") && !strings.HasPrefix(v, "--")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package exe identifies the executables owning the open network
+// files, by hash and, where the platform supports it, code-signing
+// identity. Knowing the command name is not enough during an incident:
+// what matters is which binary is connected.
+package exe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Timeout bounds the time spent inspecting each executable.
+var Timeout = 5 * time.Second
+
+// Run fills the Exe field of each open network file of `set`. Each
+// process is inspected only once. Processes that cannot be inspected
+// (i.e. owned by other users, or already gone) are only logged.
+func Run(ctx context.Context, set []onf.ONF) {
+	exes := make(map[int]*onf.Exe)
+	for i, v := range set {
+		if v.Pid <= 0 {
+			continue
+		}
+		e, ok := exes[v.Pid]
+		if !ok {
+			e = inspect(ctx, v.Pid)
+			exes[v.Pid] = e
+		}
+		set[i].Exe = e
+	}
+}
+
+// Path returns the path of the executable run by `pid`.
+func Path(ctx context.Context, pid int) (string, error) {
+	path, err := executable(ctx, pid)
+	if err == nil && path == "" {
+		err = errors.New("no path reported")
+	}
+	return path, err
+}
+
+// Tree returns the processes owning the open network files of `set`,
+// together with their ancestors, mapped to their parent and executable
+// path, as expected by aggr.Binaries. Parents are looked up in `procs`,
+// while executables already inspected by Run are reused.
+func Tree(ctx context.Context, set []onf.ONF, procs []onf.Process) map[int]aggr.Proc {
+	parents := make(map[int]int, len(procs))
+	for _, v := range procs {
+		parents[v.Pid] = v.Ppid
+	}
+	tree := make(map[int]aggr.Proc)
+	for _, v := range set {
+		if v.Pid > 0 && v.Exe != nil {
+			tree[v.Pid] = aggr.Proc{Ppid: parents[v.Pid], Path: v.Exe.Path}
+		}
+	}
+	for _, v := range set {
+		for pid := v.Pid; pid > 0; pid = parents[pid] {
+			if _, ok := tree[pid]; ok {
+				break
+			}
+			tree[pid] = aggr.Proc{Ppid: parents[pid], Path: lookPath(ctx, pid)}
+		}
+	}
+	return tree
+}
+
+func lookPath(ctx context.Context, pid int) string {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	path, err := Path(ctx, pid)
+	if err != nil {
+		log.Printf("Unable to find executable of pid %d: %v", pid, err)
+	}
+	return path
+}
+
+func inspect(ctx context.Context, pid int) *onf.Exe {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	path, err := Path(ctx, pid)
+	if err != nil {
+		log.Printf("Unable to find executable of pid %d: %v", pid, err)
+		return nil
+	}
+	e := &onf.Exe{Path: path}
+	if e.SHA256, err = Hash(path); err != nil {
+		log.Printf("Unable to hash %s: %v", path, err)
+	}
+	if e.Signer, err = signer(ctx, path); err != nil {
+		log.Printf("Unable to read code signature of %s: %v", path, err)
+	}
+	return e
+}
+
+// Hash returns the hex encoded SHA-256 of the file at `path`.
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseCodesign expects "r" to contain the output of a
+// ``codesign -dv --verbose=2 <path>'' call, and returns the signing
+// identity found, that is the first (leaf) authority. Ad-hoc signed
+// executables are reported as "adhoc", while an empty string is
+// returned when no signature is found.
+//
+// "line" examples:
+// "Authority=Developer ID Application: Spotify (2FNC3A47ZF)"
+// "Signature=adhoc"
+func ParseCodesign(r io.Reader) (string, error) {
+	var signer string
+	err := internal.ScanLines(r, func(line string) error {
+		line = strings.TrimSpace(line)
+		switch {
+		case signer != "":
+		case strings.HasPrefix(line, "Authority="):
+			signer = strings.TrimPrefix(line, "Authority=")
+		case line == "Signature=adhoc":
+			signer = "adhoc"
+		}
+		return nil
+	})
+	return signer, err
+}
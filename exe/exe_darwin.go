@@ -0,0 +1,50 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func executable(ctx context.Context, pid int) (string, error) {
+	log.Printf("Executing: ps -o comm= -p %d", pid)
+	out, _, err := runner.Default.Run(ctx, "ps", "-o", "comm=", "-p", strconv.Itoa(pid))
+	if err != nil {
+		return "", fmt.Errorf("unable to run ps: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func signer(ctx context.Context, path string) (string, error) {
+	log.Printf("Executing: codesign -dv --verbose=2 %s", path)
+	// codesign writes the signature information to stderr, and
+	// fails when the executable is not signed.
+	_, out, err := runner.Default.Run(ctx, "codesign", "-dv", "--verbose=2", path)
+	if err != nil {
+		if bytes.Contains(out, []byte("not signed")) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to run codesign: %w", err)
+	}
+	return ParseCodesign(bytes.NewBuffer(out))
+}
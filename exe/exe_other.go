@@ -0,0 +1,32 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux,!darwin,!windows
+
+package exe
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func executable(ctx context.Context, pid int) (string, error) {
+	return "", fmt.Errorf("finding the executable of a process is not supported on %s", runtime.GOOS)
+}
+
+func signer(ctx context.Context, path string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exe_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/exe"
+)
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bin")
+	if err := ioutil.WriteFile(path, []byte("abc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := exe.Hash(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; sum != want {
+		t.Fatalf("Unexpected hash: wanted %s, found %s", want, sum)
+	}
+}
+
+const codesignOutput = `Executable=/Applications/Spotify.app/Contents/MacOS/Spotify
+Identifier=com.spotify.client
+Format=app bundle with Mach-O thin (x86_64)
+CodeDirectory v=20500 size=1092 flags=0x10000(runtime) hashes=23+5 location=embedded
+Signature size=9046
+Authority=Developer ID Application: Spotify (2FNC3A47ZF)
+Authority=Developer ID Certification Authority
+Authority=Apple Root CA
+Timestamp=3 Dec 2019 at 10:12:44
+TeamIdentifier=2FNC3A47ZF
+`
+
+func TestParseCodesign(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		out    string
+		signer string
+	}{
+		{out: codesignOutput, signer: "Developer ID Application: Spotify (2FNC3A47ZF)"},
+		{out: "Executable=/usr/local/bin/tool\nSignature=adhoc\nTeamIdentifier=not set\n", signer: "adhoc"},
+		{out: "", signer: ""},
+	}
+	for i, v := range tt {
+		signer, err := exe.ParseCodesign(strings.NewReader(v.out))
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if signer != v.signer {
+			t.Fatalf("%d: Unexpected signer: wanted %q, found %q", i, v.signer, signer)
+		}
+	}
+}
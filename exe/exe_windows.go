@@ -0,0 +1,60 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package exe
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func executable(ctx context.Context, pid int) (string, error) {
+	return powershell(ctx, fmt.Sprintf("(Get-Process -Id %d).Path", pid))
+}
+
+// signer returns the subject of the certificate that signed the
+// executable at `path`. The path reaches powershell base64 encoded, so
+// that it is decoded as data and never parsed as part of the script.
+func signer(ctx context.Context, path string) (string, error) {
+	decode := fmt.Sprintf("[Text.Encoding]::Unicode.GetString([Convert]::FromBase64String('%s'))", encodeUTF16(path))
+	return powershell(ctx, fmt.Sprintf("(Get-AuthenticodeSignature -LiteralPath %s).SignerCertificate.Subject", decode))
+}
+
+// encodeUTF16 returns the base64 encoding of `s` as UTF-16LE, the
+// encoding of [Text.Encoding]::Unicode.
+func encodeUTF16(s string) string {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, v := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func powershell(ctx context.Context, cmd string) (string, error) {
+	log.Printf("Executing: powershell %s", cmd)
+	out, _, err := runner.Default.Run(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", cmd)
+	if err != nil {
+		return "", fmt.Errorf("unable to run powershell: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,548 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package expr implements a small expression language used to filter
+// open network files, such as
+// ``dst.port == 443 && command.startsWith("Chrome")''.
+//
+// Supported are the logical operators ``&&'', ``||'' and ``!'', the
+// comparison operators ``=='', ``!='', ``<'', ``<='', ``>'' and ``>='',
+// string and integer literals, parentheses and the string methods
+// startsWith, endsWith, contains and matches (regular expression).
+// See Fields for the fields available.
+package expr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Fields maps the name of each field that can be referenced in an
+// expression to the function extracting it from an open network file.
+// Values are either strings or int64s.
+var Fields = map[string]func(onf.ONF) interface{}{
+	"command":     func(f onf.ONF) interface{} { return f.Cmd },
+	"pid":         func(f onf.ONF) interface{} { return int64(f.Pid) },
+	"net":         func(f onf.ONF) interface{} { return network(f) },
+	"state":       func(f onf.ONF) interface{} { return f.State },
+	"app":         func(f onf.ONF) interface{} { return f.App },
+	"proxy":       func(f onf.ONF) interface{} { return f.Proxy },
+	"src":         func(f onf.ONF) interface{} { return addr(f.Src) },
+	"src.ip":      func(f onf.ONF) interface{} { return host(f.Src) },
+	"src.port":    func(f onf.ONF) interface{} { return port(f.Src) },
+	"src.name":    func(f onf.ONF) interface{} { return f.SrcName },
+	"dst":         func(f onf.ONF) interface{} { return addr(f.Dst) },
+	"dst.ip":      func(f onf.ONF) interface{} { return host(f.Dst) },
+	"dst.port":    func(f onf.ONF) interface{} { return port(f.Dst) },
+	"dst.name":    func(f onf.ONF) interface{} { return f.DstName },
+	"dst.country": func(f onf.ONF) interface{} { return country(f) },
+	"dst.asn":     func(f onf.ONF) interface{} { return asn(f) },
+}
+
+func network(f onf.ONF) string {
+	if f.Src == nil {
+		return ""
+	}
+	return f.Src.Network()
+}
+
+// country returns the country of the destination of `f`, or an empty
+// string when it was not looked up.
+func country(f onf.ONF) string {
+	if f.Geo == nil {
+		return ""
+	}
+	return f.Geo.Country
+}
+
+// asn returns the autonomous system of the destination of `f`, or 0
+// when it was not looked up.
+func asn(f onf.ONF) int64 {
+	if f.Geo == nil {
+		return 0
+	}
+	return int64(f.Geo.ASN)
+}
+
+func addr(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
+
+func host(a net.Addr) string {
+	h, _, err := net.SplitHostPort(addr(a))
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+// port returns the port of `a`, or -1 when it is missing or not
+// a number (i.e. ``*'').
+func port(a net.Addr) int64 {
+	_, p, err := net.SplitHostPort(addr(a))
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.ParseInt(p, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// node evaluates a (sub)expression against an open network file.
+type node func(onf.ONF) (interface{}, error)
+
+// Expr is a compiled expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Compile parses `s`, returning an error if it is not a valid
+// expression.
+func Compile(s string) (*Expr, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return &Expr{src: s, root: root}, nil
+}
+
+// Match evaluates the expression against `f`. The expression must
+// evaluate to a boolean.
+func (e *Expr) Match(f onf.ONF) (bool, error) {
+	v, err := e.root(f)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q does not evaluate to a boolean", e.src)
+	}
+	return b, nil
+}
+
+// Filter returns the open network files of `set` matching `e`.
+func Filter(set []onf.ONF, e *Expr) ([]onf.ONF, error) {
+	acc := make([]onf.ONF, 0, len(set))
+	for _, v := range set {
+		ok, err := e.Match(v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			acc = append(acc, v)
+		}
+	}
+	return acc, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text := s[i : j+1]
+			if c == '\'' {
+				text = `"` + strings.Replace(text[1:len(text)-1], `"`, `\"`, -1) + `"`
+			}
+			unquoted, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			toks = append(toks, token{kind: tokString, text: unquoted, pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			toks = append(toks, token{kind: tokInt, text: s[i:j], pos: i})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, v := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ".", ","} {
+				if strings.HasPrefix(s[i:], v) {
+					op = v
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at offset %d", op, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, false)
+	}
+	return left, nil
+}
+
+// logical combines `left` and `right` with ``||'' when `or` is true,
+// ``&&'' otherwise. Evaluation short-circuits.
+func logical(left, right node, or bool) node {
+	return func(f onf.ONF) (interface{}, error) {
+		l, err := boolean(left, f)
+		if err != nil {
+			return nil, err
+		}
+		if l == or {
+			return l, nil
+		}
+		return boolean(right, f)
+	}
+}
+
+func boolean(n node, f onf.ONF) (bool, error) {
+	v, err := n(f)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, found %v", v)
+	}
+	return b, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(f onf.ONF) (interface{}, error) {
+			b, err := boolean(n, f)
+			return !b, err
+		}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *parser) parseCmp() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := t.text
+	return func(f onf.ONF) (interface{}, error) {
+		l, err := left(f)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(f)
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, l, r)
+	}, nil
+}
+
+func compare(op string, l, r interface{}) (bool, error) {
+	var c int
+	switch lv := l.(type) {
+	case int64:
+		rv, ok := r.(int64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %d with %v", lv, r)
+		}
+		switch {
+		case lv < rv:
+			c = -1
+		case lv > rv:
+			c = 1
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %q with %v", lv, r)
+		}
+		c = strings.Compare(lv, rv)
+	case bool:
+		rv, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false, fmt.Errorf("cannot compare %v with %v using %s", lv, r, op)
+		}
+		if lv != rv {
+			c = 1
+		}
+	default:
+		return false, fmt.Errorf("cannot compare %v", l)
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	var n node
+	switch t.kind {
+	case tokString:
+		v := t.text
+		n = func(onf.ONF) (interface{}, error) { return v, nil }
+	case tokInt:
+		v, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer at offset %d: %w", t.pos, err)
+		}
+		n = func(onf.ONF) (interface{}, error) { return v, nil }
+	case tokIdent:
+		var err error
+		if n, err = p.parseField(t); err != nil {
+			return nil, err
+		}
+	case tokOp:
+		if t.text != "(" {
+			return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+		}
+		var err error
+		if n, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return p.parseMethods(n)
+}
+
+// parseField parses a boolean literal or a, possibly dotted, field name.
+func (p *parser) parseField(t token) (node, error) {
+	switch t.text {
+	case "true", "false":
+		v := t.text == "true"
+		return func(onf.ONF) (interface{}, error) { return v, nil }, nil
+	}
+	name := t.text
+	for p.peek().kind == tokOp && p.peek().text == "." {
+		// Stop at method calls.
+		if p.toks[p.i+1].kind == tokIdent && p.toks[p.i+2].kind == tokOp && p.toks[p.i+2].text == "(" {
+			break
+		}
+		p.next()
+		id := p.next()
+		if id.kind != tokIdent {
+			return nil, fmt.Errorf("expected a field name at offset %d", id.pos)
+		}
+		name += "." + id.text
+	}
+	get, ok := Fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at offset %d", name, t.pos)
+	}
+	return func(f onf.ONF) (interface{}, error) { return get(f), nil }, nil
+}
+
+func (p *parser) parseMethods(n node) (node, error) {
+	for p.accept(".") {
+		t := p.next()
+		if t.kind != tokIdent {
+			return nil, fmt.Errorf("expected a method name at offset %d", t.pos)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg := p.next()
+		if arg.kind != tokString {
+			return nil, fmt.Errorf("method %s expects a string argument at offset %d", t.text, arg.pos)
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		m, err := method(t.text, arg.text)
+		if err != nil {
+			return nil, fmt.Errorf("%v at offset %d", err, t.pos)
+		}
+		recv := n
+		n = func(f onf.ONF) (interface{}, error) {
+			v, err := recv(f)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("method %s called on non string value %v", t.text, v)
+			}
+			return m(s), nil
+		}
+	}
+	return n, nil
+}
+
+func method(name, arg string) (func(string) bool, error) {
+	switch name {
+	case "startsWith":
+		return func(s string) bool { return strings.HasPrefix(s, arg) }, nil
+	case "endsWith":
+		return func(s string) bool { return strings.HasSuffix(s, arg) }, nil
+	case "contains":
+		return func(s string) bool { return strings.Contains(s, arg) }, nil
+	case "matches":
+		rgx, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return rgx.MatchString, nil
+	default:
+		return nil, fmt.Errorf("unknown method %q", name)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/expr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	f := onf.ONF{
+		Cmd:     "Google Chrome",
+		Pid:     42,
+		Src:     internal.NewAddr("tcp", "10.0.0.2:5000"),
+		Dst:     internal.NewAddr("tcp", "[2001:db8::1]:443"),
+		DstName: "www.google.com",
+		State:   "ESTABLISHED",
+	}
+	tt := []struct {
+		expr  string
+		match bool
+	}{
+		{expr: `dst.port == 443 && command.startsWith("Chrome")`, match: false},
+		{expr: `dst.port == 443 && command.startsWith("Google")`, match: true},
+		{expr: `dst.port != 443 || pid >= 40`, match: true},
+		{expr: `!(net == "udp") && state == 'ESTABLISHED'`, match: true},
+		{expr: `dst.ip == "2001:db8::1" && src.port < 1024`, match: false},
+		{expr: `dst.name.endsWith(".google.com") && src.ip.matches("^10\\.")`, match: true},
+		{expr: `dst.contains("db8") == true`, match: true},
+		{expr: `app == ""`, match: true},
+	}
+	for i, v := range tt {
+		e, err := expr.Compile(v.expr)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		match, err := e.Match(f)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if match != v.match {
+			t.Fatalf("%d: Unexpected match result of %s: wanted %v, found %v", i, v.expr, v.match, match)
+		}
+	}
+}
+
+func TestCompile_Error(t *testing.T) {
+	t.Parallel()
+	tt := []string{
+		`dst.port ==`,
+		`unknown == 1`,
+		`command.startsWith(1)`,
+		`command.explode("x")`,
+		`(pid == 1`,
+		`pid == 1 pid`,
+		`command == "unterminated`,
+		`src.ip.matches("(")`,
+	}
+	for i, v := range tt {
+		if _, err := expr.Compile(v); err == nil {
+			t.Fatalf("%d: Expected %s not to compile", i, v)
+		}
+	}
+}
+
+func TestMatch_Error(t *testing.T) {
+	t.Parallel()
+	tt := []string{
+		`pid == "42"`,
+		`pid`,
+		`pid.startsWith("4")`,
+		`pid && true`,
+	}
+	for i, v := range tt {
+		e, err := expr.Compile(v)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if _, err := e.Match(onf.ONF{Pid: 42}); err == nil {
+			t.Fatalf("%d: Expected %s to fail", i, v)
+		}
+	}
+}
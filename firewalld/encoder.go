@@ -0,0 +1,118 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package firewalld encodes the destinations of open network files into
+// a shell script adding a firewalld rich rule for each of them, so that
+// the traffic of an application can be allowed, or blocked, on hosts
+// running a restrictive zone.
+package firewalld
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes one ``firewall-cmd --add-rich-rule'' invocation per
+// destination, preceded by a comment listing the commands connected to
+// it. Rules are permanent: the script reloads firewalld at the end.
+type Encoder struct {
+	w      io.Writer
+	zone   string
+	action string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, action: "accept"}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "zone": the zone rules are added to, instead of the default one.
+// - "action": "accept" (the default), "reject" or "drop".
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "zone":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid zone %q", v)
+			}
+			e.zone = v
+		case "action":
+			switch v {
+			case "accept", "reject", "drop":
+				e.action = v
+			default:
+				return nil, fmt.Errorf("invalid action %q: expected accept, reject or drop", v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown firewalld option %q", k)
+		}
+	}
+	return e, nil
+}
+
+// validName reports whether `s` can be used as a zone name without
+// quoting: it is written as is in the script.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "#!/bin/sh")
+	cmd := "firewall-cmd --permanent"
+	if e.zone != "" {
+		cmd += " --zone=" + e.zone
+	}
+	for _, v := range aggr.Endpoints(set) {
+		if len(v.Cmds) > 0 {
+			fmt.Fprintf(w, "# %s\n", strings.Join(v.Cmds, ", "))
+		}
+		fmt.Fprintf(w, "%s --add-rich-rule='%s'\n", cmd, e.rule(v))
+	}
+	fmt.Fprintln(w, "firewall-cmd --reload")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// rule returns the rich rule matching the traffic headed to `dst`.
+func (e *Encoder) rule(dst aggr.Endpoint) string {
+	family := "ipv4"
+	if dst.IPv6() {
+		family = "ipv6"
+	}
+	rule := fmt.Sprintf("rule family=%q destination address=%q", family, dst.IP)
+	if dst.Port != "" {
+		rule += fmt.Sprintf(" port port=%q protocol=%q", dst.Port, dst.Proto)
+	}
+	return rule + " " + e.action
+}
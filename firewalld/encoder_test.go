@@ -0,0 +1,68 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package firewalld_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/firewalld"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Cmd: "systemd-resolved", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+		// Command names are chosen by the processes.
+		{Cmd: "x\nfirewall-cmd --panic-on", Src: internal.NewAddr("udp6", "[::1]:5354"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+	}
+	var b bytes.Buffer
+	e, err := firewalld.NewEncoderOptions(&b, map[string]string{"zone": "drop", "action": "accept"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := e.Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `#!/bin/sh
+# Spotify
+firewall-cmd --permanent --zone=drop --add-rich-rule='rule family="ipv4" destination address="35.186.224.47" port port="443" protocol="tcp" accept'
+# systemd-resolved, x?firewall-cmd --panic-on
+firewall-cmd --permanent --zone=drop --add-rich-rule='rule family="ipv6" destination address="2001:db8::1" port port="53" protocol="udp" accept'
+firewall-cmd --reload
+`
+	if b.String() != want {
+		t.Fatalf("Unexpected output: wanted %q, found %q", want, b.String())
+	}
+	invalid := []map[string]string{
+		{"action": "allow"},
+		{"zone": ""},
+		{"zone": "public;reboot"},
+		{"zone": "$(reboot)"},
+		{"zone": "`reboot`"},
+		{"zone": "public|reboot"},
+		{"zone": "public\nreboot"},
+	}
+	for i, v := range invalid {
+		if _, err := firewalld.NewEncoderOptions(&bytes.Buffer{}, v); err == nil {
+			t.Fatalf("%d: Unexpected nil error with options %v", i, v)
+		}
+	}
+}
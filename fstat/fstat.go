@@ -0,0 +1,230 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fstat decodes the output of fstat, the OpenBSD tool listing
+// the files opened by processes, together with the one of ``netstat
+// -an -p tcp'', which reports the state of TCP connections that fstat
+// does not print.
+package fstat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+type Socket struct {
+	Raw     string
+	User    string
+	Command string
+	Pid     int
+	Fd      int
+	IPv6    bool     // domain is internet6
+	SrcAddr net.Addr // network is tcp or udp
+	DstAddr net.Addr // empty for listening and unconnected sockets
+	State   string   // TCP state (i.e. ESTABLISHED), if reported by netstat
+}
+
+// ScanWith executes ``netstat -an -p tcp'' and fstat using "r",
+// calling `fn` with each internet socket listed by fstat for which
+// `match` returns true, as soon as it is decoded (see ScanOutput).
+// When netstat fails, the error is logged and states are not reported.
+func ScanWith(r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	return ScanWithContext(context.Background(), r, match, fn)
+}
+
+// ScanWithContext is the same as ScanWith, but the execution is
+// aborted when `ctx` is done.
+func ScanWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	l := internal.LoggerFrom(ctx)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+
+	l.Printf("Executing: netstat -an -p tcp")
+	var states map[string]string
+	if out, _, err := r.Run(ctx, "netstat", "-an", "-p", "tcp"); err != nil {
+		l.Printf("unable to run netstat, TCP states will not be reported: %v", err)
+	} else if states, err = ParseStates(bytes.NewReader(out)); err != nil {
+		l.Printf("unable to parse netstat output, TCP states will not be reported: %v", err)
+	}
+
+	l.Printf("Executing: fstat")
+	out, _, err := r.Run(ctx, "fstat")
+	if err != nil {
+		return fmt.Errorf("unable to run fstat: %w", err)
+	}
+	return scanOutput(l, bytes.NewBuffer(out), match, func(s Socket) error {
+		if s.SrcAddr.Network() == "tcp" {
+			s.State = states[key(s.SrcAddr, s.DstAddr)]
+		}
+		return fn(s)
+	})
+}
+
+// ParseOutput expects "r" to contain the output of a fstat call,
+// returning the internet sockets it lists. Other files, and lines that
+// cannot be decoded, are skipped.
+func ParseOutput(r io.Reader) ([]Socket, error) {
+	set := []Socket{}
+	err := ScanOutput(r, nil, func(v Socket) error {
+		set = append(set, v)
+		return nil
+	})
+	return set, err
+}
+
+// ScanOutput is the same as ParseOutput, but lines for which `match`
+// returns false are skipped before being decoded, and each decoded
+// line is passed to `fn` instead of being accumulated. A nil `match`
+// accepts every line. Scanning stops at the first error returned by
+// `fn`.
+func ScanOutput(r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return scanOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return internal.ScanLines(r, func(line string) error {
+		if !strings.Contains(line, "* internet") {
+			return nil
+		}
+		if match != nil && !match(line) {
+			return nil
+		}
+		s, err := ParseSocket(line)
+		if err != nil {
+			l.Printf("skipping fstat socket \"%s\": %v", line, err)
+			return nil
+		}
+		return fn(*s)
+	})
+}
+
+// ParseSocket expects "line" to be a single line of the output of a
+// fstat call, describing an internet socket. The kernel address of the
+// protocol control block, printed by fstat for TCP sockets, is
+// ignored. The State of the socket is not reported by fstat.
+//
+// "line" examples:
+// "root     sshd       68766    3* internet stream tcp 0x0 *:22"
+// "dan      firefox    12345   48* internet stream tcp 0x0 10.0.0.2:41234 <-> 1.2.3.4:443"
+// "_ntp     ntpd       53822    5* internet6 dgram udp [fe80::1%lo0]:123"
+func ParseSocket(line string) (*Socket, error) {
+	chunks, err := internal.ChunkLine(line, " ", 8)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{Raw: line, User: chunks[0], Command: chunks[1]}
+	if s.Pid, err = strconv.Atoi(chunks[2]); err != nil {
+		return nil, fmt.Errorf("error parsing pid: %w", err)
+	}
+	if s.Fd, err = strconv.Atoi(strings.TrimSuffix(chunks[3], "*")); err != nil {
+		return nil, fmt.Errorf("error parsing fd: %w", err)
+	}
+	switch chunks[4] {
+	case "internet":
+	case "internet6":
+		s.IPv6 = true
+	default:
+		return nil, fmt.Errorf("unsupported socket domain %s", chunks[4])
+	}
+	network := chunks[6]
+	if network != "tcp" && network != "udp" {
+		return nil, fmt.Errorf("unsupported protocol %s", network)
+	}
+
+	addrs := chunks[7:]
+	if strings.HasPrefix(addrs[0], "0x") {
+		addrs = addrs[1:]
+	}
+	if len(addrs) != 1 && len(addrs) != 3 {
+		return nil, fmt.Errorf("unexpected addresses %s", strings.Join(addrs, " "))
+	}
+	if s.SrcAddr, err = parseAddr(network, addrs[0], ":"); err != nil {
+		return nil, fmt.Errorf("error parsing local address: %w", err)
+	}
+	s.DstAddr = internal.NewAddr(network, "")
+	if len(addrs) == 3 {
+		if s.DstAddr, err = parseAddr(network, addrs[2], ":"); err != nil {
+			return nil, fmt.Errorf("error parsing foreign address: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// ParseStates expects "r" to contain the output of a ``netstat -an -p
+// tcp'' call, returning the states of the connections it lists, keyed
+// by their addresses. Lines that cannot be decoded, such as the
+// headers, are skipped.
+//
+// Lines examples:
+// "tcp          0      0  10.0.0.2.41234         1.2.3.4.443            ESTABLISHED"
+// "tcp6         0      0  *.22                   *.*                    LISTEN"
+func ParseStates(r io.Reader) (map[string]string, error) {
+	states := make(map[string]string)
+	err := internal.ScanLines(r, func(line string) error {
+		chunks, err := internal.ChunkLine(line, " ", 6)
+		if err != nil || !strings.HasPrefix(chunks[0], "tcp") {
+			return nil
+		}
+		src, err := parseAddr("tcp", chunks[3], ".")
+		if err != nil {
+			return nil
+		}
+		dst, err := parseAddr("tcp", chunks[4], ".")
+		if err != nil {
+			return nil
+		}
+		states[key(src, dst)] = chunks[5]
+		return nil
+	})
+	return states, err
+}
+
+// key identifies a connection by its addresses, as printed by both
+// fstat and netstat.
+func key(src, dst net.Addr) string {
+	return src.String() + "->" + dst.String()
+}
+
+// parseAddr parses an address whose port follows the last occurrence
+// of `sep`: fstat uses ":", enclosing IPv6 addresses in brackets,
+// while netstat uses ".". Unspecified hosts are printed as "*", zones
+// are dropped, and wildcard foreign addresses ("*.*") are returned as
+// empty addresses.
+func parseAddr(network, addr, sep string) (net.Addr, error) {
+	i := strings.LastIndex(addr, sep)
+	if i < 0 {
+		return nil, fmt.Errorf("missing port in address %s", addr)
+	}
+	host, port := strings.Trim(addr[:i], "[]"), addr[i+1:]
+	if port == "*" {
+		return internal.NewAddr(network, ""), nil
+	}
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j]
+	}
+	if host == "*" {
+		return internal.ParseNetAddr(network, "*:"+port)
+	}
+	return internal.ParseNetAddr(network, net.JoinHostPort(host, port))
+}
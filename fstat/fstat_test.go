@@ -0,0 +1,115 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package fstat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+const fstatExample = `USER     CMD          PID   FD MOUNT        INUM  MODE         R/W    SZ|DV
+root     sshd       68766   wd /            2 drwxr-xr-x     r      512
+root     sshd       68766    3* internet stream tcp 0x0 *:22
+root     sshd       68766    4* internet6 stream tcp 0x0 [*]:22
+dan      firefox    12345   48* internet stream tcp 0x0 10.0.0.2:41234 <-> 1.2.3.4:443
+_ntp     ntpd       53822    5* internet6 dgram udp [fe80::1%lo0]:123
+_syslogd syslogd    20433    6* unix dgram 0x0 /dev/log
+_unbound unbound    31200    7* internet dgram udp 127.0.0.1:53
+`
+
+const netstatExample = `Active Internet connections (including servers)
+Proto   Recv-Q Send-Q  Local Address          Foreign Address        TCP-State
+tcp          0      0  10.0.0.2.41234         1.2.3.4.443            ESTABLISHED
+tcp          0      0  *.22                   *.*                    LISTEN
+tcp6         0      0  *.22                   *.*                    LISTEN
+`
+
+func TestParseOutput(t *testing.T) {
+	t.Parallel()
+	set, err := ParseOutput(strings.NewReader(fstatExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tt := []struct {
+		cmd      string
+		pid, fd  int
+		ipv6     bool
+		net      string
+		src, dst string
+	}{
+		{"sshd", 68766, 3, false, "tcp", "*:22", ""},
+		{"sshd", 68766, 4, true, "tcp", "*:22", ""},
+		{"firefox", 12345, 48, false, "tcp", "10.0.0.2:41234", "1.2.3.4:443"},
+		{"ntpd", 53822, 5, true, "udp", "[fe80::1]:123", ""},
+		{"unbound", 31200, 7, false, "udp", "127.0.0.1:53", ""},
+	}
+	if len(set) != len(tt) {
+		t.Fatalf("Unexpected set length: wanted %d, found %d: %v", len(tt), len(set), set)
+	}
+	for i, v := range tt {
+		s := set[i]
+		if s.Command != v.cmd || s.Pid != v.pid || s.Fd != v.fd || s.IPv6 != v.ipv6 || s.SrcAddr.Network() != v.net {
+			t.Fatalf("%d: Unexpected socket: %+v", i, s)
+		}
+		if s.SrcAddr.String() != v.src || s.DstAddr.String() != v.dst {
+			t.Fatalf("%d: Unexpected socket: %s->%s", i, s.SrcAddr, s.DstAddr)
+		}
+	}
+}
+
+func TestParseSocket_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{
+		"root sshd 68766 3* internet stream",
+		"root sshd pid 3* internet stream tcp 0x0 *:22",
+		"root sshd 68766 3* internet stream tcp 0x0 localhost:22",
+		"root sshd 68766 3* internet raw icmp 0x0 *:0",
+		"root sshd 68766 3* internet stream tcp 0x0 *:22 <->",
+	} {
+		if _, err := ParseSocket(v); err == nil {
+			t.Fatalf("Unexpected nil error parsing %q", v)
+		}
+	}
+}
+
+func TestScanWith(t *testing.T) {
+	t.Parallel()
+	r := runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		switch name {
+		case "fstat":
+			return []byte(fstatExample), nil, nil
+		case "netstat":
+			return []byte(netstatExample), nil, nil
+		default:
+			return nil, nil, fmt.Errorf("unexpected command: %s", name)
+		}
+	})
+	var states []string
+	err := ScanWith(r, nil, func(s Socket) error {
+		states = append(states, s.State)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(states, ",") != "LISTEN,LISTEN,ESTABLISHED,," {
+		t.Fatalf("Unexpected states: %q", states)
+	}
+}
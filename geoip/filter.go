@@ -0,0 +1,116 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Filter selects open network files by the location of their
+// destination, as set by Annotate. Empty fields select every location.
+type Filter struct {
+	Countries []string // ISO 3166-1 alpha-2 codes, upper case
+	ASNs      []int
+}
+
+// ParseFilter returns the Filter selecting the comma separated
+// `countries` (i.e. "CN,RU") and autonomous systems `asns` (i.e.
+// "16509,AS15169").
+func ParseFilter(countries, asns string) (Filter, error) {
+	var f Filter
+	for _, v := range strings.Split(countries, ",") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if len(v) != 2 || strings.Trim(v, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return f, fmt.Errorf("invalid country %s: use ISO 3166-1 alpha-2 codes (i.e. US)", v)
+		}
+		f.Countries = append(f.Countries, v)
+	}
+	for _, v := range strings.Split(asns, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(v), "AS"))
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("invalid autonomous system number %s", v)
+		}
+		f.ASNs = append(f.ASNs, n)
+	}
+	return f, nil
+}
+
+// Empty reports whether `f` selects every location.
+func (f Filter) Empty() bool {
+	return len(f.Countries) == 0 && len(f.ASNs) == 0
+}
+
+// Match reports whether the destination of `o` is located in one of
+// the countries and one of the autonomous systems of `f`. Open network
+// files whose destination was not located only match an empty Filter.
+func (f Filter) Match(o onf.ONF) bool {
+	if f.Empty() {
+		return true
+	}
+	if o.Geo == nil {
+		return false
+	}
+	return matchString(f.Countries, o.Geo.Country) && matchInt(f.ASNs, o.Geo.ASN)
+}
+
+// Select returns the open network files of `set` matching `f`.
+func Select(set []onf.ONF, f Filter) []onf.ONF {
+	if f.Empty() {
+		return set
+	}
+	acc := make([]onf.ONF, 0, len(set))
+	for _, v := range set {
+		if f.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+func matchString(set []string, s string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, v := range set {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchInt(set []int, n int) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, v := range set {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
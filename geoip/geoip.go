@@ -0,0 +1,105 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package geoip annotates the destinations of open network files with
+// their country, city and autonomous system, as found in MaxMind
+// databases (i.e. GeoLite2-City and GeoLite2-ASN).
+package geoip
+
+import (
+	"context"
+	"net"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Location returns the location of `ip` found in `dbs`. Each field is
+// taken from the first database reporting it, so that country and
+// city databases can be combined with ASN ones. Returns false when no
+// database has a record for `ip`. Failed lookups are logged to the
+// logger of `ctx`, and skipped.
+func Location(ctx context.Context, dbs []*DB, ip net.IP) (onf.Geo, bool) {
+	var g onf.Geo
+	var found bool
+	for _, db := range dbs {
+		v, ok, err := db.Lookup(ip)
+		if err != nil {
+			internal.LoggerFrom(ctx).Printf("GeoIP lookup of %v in %s failed: %v", ip, db.Type, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		rec, _ := v.(map[string]interface{})
+		if g.Country == "" {
+			g.Country = str(rec, "country", "iso_code")
+		}
+		if g.City == "" {
+			g.City = str(rec, "city", "names", "en")
+		}
+		if g.ASN == 0 {
+			g.ASN = int(uintOf(rec["autonomous_system_number"]))
+		}
+		if g.Org == "" {
+			g.Org = str(rec, "autonomous_system_organization")
+		}
+	}
+	return g, found
+}
+
+// Annotate sets the Geo field of the open network files of `set`
+// whose destination is found in `dbs`. Each destination is looked up
+// once, as described by Location.
+func Annotate(ctx context.Context, set []onf.ONF, dbs []*DB) {
+	cache := make(map[string]*onf.Geo)
+	for i, v := range set {
+		if v.Dst == nil {
+			continue
+		}
+		host, _, err := net.SplitHostPort(v.Dst.String())
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		g, ok := cache[host]
+		if !ok {
+			if loc, found := Location(ctx, dbs, ip); found {
+				g = &loc
+			}
+			cache[host] = g
+		}
+		set[i].Geo = g
+	}
+}
+
+// str returns the string found following `path` in the nested maps of
+// `rec`, or an empty string.
+func str(rec map[string]interface{}, path ...string) string {
+	var v interface{} = rec
+	for _, k := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,320 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// trie is a node of the search tree built by build.
+type trie struct {
+	child [2]*trie
+	data  [2]int // index of the record + 1, 0 when empty
+	index int
+}
+
+// build returns an IPv6 MaxMind DB with `recordSize` bit records,
+// mapping each network of `records` (in CIDR notation) to its record.
+func build(t *testing.T, recordSize int, records map[string]interface{}) []byte {
+	root := &trie{}
+	var data bytes.Buffer
+	var offsets []int
+	cidrs := make([]string, 0, len(records))
+	for k := range records {
+		cidrs = append(cidrs, k)
+	}
+	sort.Strings(cidrs)
+	for _, k := range cidrs {
+		_, ipnet, err := net.ParseCIDR(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if ipnet.IP.To4() != nil {
+			ip = append(make(net.IP, 12), ipnet.IP.To4()...)
+			ones += 96
+		}
+		offsets = append(offsets, data.Len())
+		data.Write(encode(records[k]))
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == ones-1 {
+				n.data[bit] = len(offsets)
+				break
+			}
+			if n.child[bit] == nil {
+				n.child[bit] = &trie{}
+			}
+			n = n.child[bit]
+		}
+	}
+
+	var nodes []*trie
+	var walk func(*trie)
+	walk = func(n *trie) {
+		n.index = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.child {
+			if c != nil {
+				walk(c)
+			}
+		}
+	}
+	walk(root)
+
+	var buf bytes.Buffer
+	count := len(nodes)
+	for _, n := range nodes {
+		var rec [2]uint32
+		for i := range rec {
+			switch {
+			case n.child[i] != nil:
+				rec[i] = uint32(n.child[i].index)
+			case n.data[i] != 0:
+				rec[i] = uint32(count + 16 + offsets[n.data[i]-1])
+			default:
+				rec[i] = uint32(count)
+			}
+		}
+		switch recordSize {
+		case 24:
+			buf.Write([]byte{byte(rec[0] >> 16), byte(rec[0] >> 8), byte(rec[0]), byte(rec[1] >> 16), byte(rec[1] >> 8), byte(rec[1])})
+		case 28:
+			buf.Write([]byte{byte(rec[0] >> 16), byte(rec[0] >> 8), byte(rec[0]), byte(rec[0]>>24)<<4 | byte(rec[1]>>24), byte(rec[1] >> 16), byte(rec[1] >> 8), byte(rec[1])})
+		default:
+			buf.Write([]byte{byte(rec[0] >> 24), byte(rec[0] >> 16), byte(rec[0] >> 8), byte(rec[0]), byte(rec[1] >> 24), byte(rec[1] >> 16), byte(rec[1] >> 8), byte(rec[1])})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.Write(metadataMarker)
+	buf.Write(encode(map[string]interface{}{
+		"node_count":    uint64(count),
+		"record_size":   uint64(recordSize),
+		"ip_version":    uint64(6),
+		"database_type": "Test",
+	}))
+	return buf.Bytes()
+}
+
+// encode encodes `v` as a data section field.
+func encode(v interface{}) []byte {
+	ctrl := func(typ, size int) []byte {
+		var ext []byte
+		if size >= 29 {
+			// Sizes up to 284 only.
+			ext, size = []byte{byte(size - 29)}, 29
+		}
+		b := []byte{byte(typ<<5 | size)}
+		if typ > 7 {
+			b = []byte{byte(size), byte(typ - 7)}
+		}
+		return append(b, ext...)
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(typeString, len(v)), v...)
+	case uint64:
+		var b []byte
+		for ; v > 0; v >>= 8 {
+			b = append([]byte{byte(v)}, b...)
+		}
+		return append(ctrl(typeUint32, len(b)), b...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := ctrl(typeMap, len(v))
+		for _, k := range keys {
+			b = append(b, encode(k)...)
+			b = append(b, encode(v[k])...)
+		}
+		return b
+	default:
+		panic("unsupported type")
+	}
+}
+
+var cityRecords = map[string]interface{}{
+	"1.2.0.0/16": map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "IT"},
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": "Rome"}},
+	},
+	"2001:db8::/32": map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "NL"},
+	},
+}
+
+var asnRecords = map[string]interface{}{
+	"1.0.0.0/8": map[string]interface{}{
+		"autonomous_system_number":       uint64(64500),
+		"autonomous_system_organization": "EXAMPLE",
+	},
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+	for _, size := range []int{24, 28, 32} {
+		db, err := NewDB(build(t, size, cityRecords))
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", size, err)
+		}
+		if db.Type != "Test" {
+			t.Fatalf("%d: Unexpected database type: %s", size, db.Type)
+		}
+		for _, v := range []struct {
+			ip      string
+			country string
+		}{
+			{"1.2.3.4", "IT"},
+			{"2001:db8::1", "NL"},
+			{"1.3.0.1", ""},
+			{"::1", ""},
+		} {
+			g, found := Location(context.Background(), []*DB{db}, net.ParseIP(v.ip))
+			if found != (v.country != "") || g.Country != v.country {
+				t.Fatalf("%d: Unexpected location of %s: %+v (found: %v)", size, v.ip, g, found)
+			}
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Parallel()
+	city, err := NewDB(build(t, 24, cityRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asn, err := NewDB(build(t, 24, asnRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := []onf.ONF{
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.2.3.4:443")},
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "8.8.8.8:443")},
+		{Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "")},
+	}
+	Annotate(context.Background(), set, []*DB{city, asn})
+	if g := set[0].Geo; g == nil || *g != (onf.Geo{Country: "IT", City: "Rome", ASN: 64500, Org: "EXAMPLE"}) {
+		t.Fatalf("Unexpected location: %+v", g)
+	}
+	if set[1].Geo != nil || set[2].Geo != nil {
+		t.Fatalf("Unexpected locations: %+v, %+v", set[1].Geo, set[2].Geo)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Pid: 1, Geo: &onf.Geo{Country: "CN", ASN: 4134}},
+		{Pid: 2, Geo: &onf.Geo{Country: "RU", ASN: 12389}},
+		{Pid: 3, Geo: &onf.Geo{Country: "US", ASN: 16509}},
+		{Pid: 4, Geo: &onf.Geo{ASN: 16509}},
+		{Pid: 5},
+	}
+	tt := []struct {
+		countries, asns string
+		pids            []int
+	}{
+		{"", "", []int{1, 2, 3, 4, 5}},
+		{"cn, RU", "", []int{1, 2}},
+		{"", "16509", []int{3, 4}},
+		{"", "as4134,AS12389", []int{1, 2}},
+		{"US", "16509", []int{3}},
+		{"CN", "16509", nil},
+	}
+	for i, v := range tt {
+		f, err := ParseFilter(v.countries, v.asns)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		acc := Select(set, f)
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+		}
+		for j, o := range acc {
+			if o.Pid != v.pids[j] {
+				t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+			}
+		}
+	}
+	for i, v := range [][2]string{{"CHN", ""}, {"C1", ""}, {"", "AS"}, {"", "-1"}, {"", "amazon"}} {
+		if _, err := ParseFilter(v[0], v[1]); err == nil {
+			t.Fatalf("%d: Unexpected nil error", i)
+		}
+	}
+}
+
+func TestNewDB_Invalid(t *testing.T) {
+	t.Parallel()
+	valid := build(t, 24, cityRecords)
+	for i, v := range [][]byte{
+		[]byte("not a database"),
+		valid[len(valid)-60:],
+		append(append([]byte{}, metadataMarker...), encode("metadata")...),
+	} {
+		if _, err := NewDB(v); err == nil {
+			t.Fatalf("%d: Unexpected nil error", i)
+		}
+	}
+}
+
+func TestDecode_Pointer(t *testing.T) {
+	t.Parallel()
+	// "IT", then a pointer to it, then a map whose value points to it.
+	buf := encode("IT")
+	buf = append(buf, typePointer<<5, 0)
+	buf = append(buf, typeMap<<5|1)
+	buf = append(buf, encode("iso_code")...)
+	buf = append(buf, typePointer<<5, 0)
+	d := decoder{buf: buf}
+	if v, next, err := d.decode(3); err != nil || v != "IT" || next != 5 {
+		t.Fatalf("Unexpected pointer decoding: %v, %d, %v", v, next, err)
+	}
+	v, _, err := d.decode(5)
+	if m, ok := v.(map[string]interface{}); err != nil || !ok || m["iso_code"] != "IT" {
+		t.Fatalf("Unexpected map decoding: %v, %v", v, err)
+	}
+}
+
+func TestDecode_Cycles(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		name string
+		buf  []byte
+	}{
+		// A pointer to itself.
+		{"pointer", []byte{typePointer << 5, 0}},
+		// A map whose value points to the map.
+		{"map", append(append([]byte{typeMap<<5 | 1}, encode("a")...), typePointer<<5, 0)},
+	}
+	for _, v := range tt {
+		if x, _, err := (decoder{buf: v.buf}).decode(0); err == nil {
+			t.Fatalf("%s: Unexpected nil error, decoded %v", v.name, x)
+		}
+	}
+}
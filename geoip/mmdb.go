@@ -0,0 +1,361 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// metadataMarker precedes the metadata section, at the end of the
+// database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// DB is a MaxMind DB file (i.e. GeoLite2-City.mmdb), decoded as
+// described by the MaxMind DB File Format Specification 2.0. The
+// whole file is held in memory.
+type DB struct {
+	Type string // database_type found in the metadata (i.e. GeoLite2-ASN)
+
+	buf        []byte
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node where the IPv4 subtree starts in IPv6 databases
+}
+
+// Open reads the MaxMind DB at `path`.
+func Open(path string) (*DB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read GeoIP database: %w", err)
+	}
+	db, err := NewDB(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// NewDB decodes the MaxMind DB contained in `buf`.
+func NewDB(buf []byte) (*DB, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB: metadata not found")
+	}
+	v, _, err := decoder{buf: buf[i+len(metadataMarker):]}.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid metadata: not a map")
+	}
+	db := &DB{
+		buf:        buf,
+		nodeCount:  uint(uintOf(meta["node_count"])),
+		recordSize: uint(uintOf(meta["record_size"])),
+		ipVersion:  uint(uintOf(meta["ip_version"])),
+	}
+	db.Type, _ = meta["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("search tree exceeds the database size")
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+16 : i]
+
+	if db.ipVersion == 6 {
+		// IPv4 addresses are stored as ::a.b.c.d, that is after 96
+		// zero bits.
+		node := uint(0)
+		for j := 0; j < 96 && node < db.nodeCount; j++ {
+			if node, err = db.record(node, 0); err != nil {
+				return nil, err
+			}
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Lookup returns the record associated with `ip`, decoded as maps,
+// slices, strings, numbers and booleans. Returns false when the
+// database has no record for it.
+func (db *DB) Lookup(ip net.IP) (interface{}, bool, error) {
+	addr := ip.To4()
+	node := uint(0)
+	if addr == nil {
+		if db.ipVersion == 4 {
+			return nil, false, nil
+		}
+		addr = ip.To16()
+	} else if db.ipVersion == 6 {
+		node = db.ipv4Start
+	}
+	if addr == nil {
+		return nil, false, fmt.Errorf("invalid ip address %v", ip)
+	}
+
+	for i := 0; i < len(addr)*8 && node < db.nodeCount; i++ {
+		bit := uint(addr[i/8]>>(7-uint(i%8))) & 1
+		var err error
+		if node, err = db.record(node, bit); err != nil {
+			return nil, false, err
+		}
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, false, nil
+	case node < db.nodeCount:
+		return nil, false, errors.New("search tree is deeper than the address")
+	}
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, false, fmt.Errorf("record pointer %d out of the data section", offset)
+	}
+	v, _, err := decoder{buf: db.data}.decode(offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid record: %w", err)
+	}
+	return v, true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of `node`.
+func (db *DB) record(node, bit uint) (uint, error) {
+	size := db.recordSize / 4
+	off := node * size
+	if off+size > uint(len(db.tree)) {
+		return 0, fmt.Errorf("node %d out of the search tree", node)
+	}
+	b := db.tree[off : off+size]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// Data field types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEnd
+	typeBool
+	typeFloat
+)
+
+// maxDepth is the maximum nesting of the fields of a data section,
+// pointers included, protecting the decoder from pointer cycles.
+const maxDepth = 512
+
+// decoder decodes the fields of a data section.
+type decoder struct {
+	buf   []byte
+	depth int // of the field being decoded
+}
+
+// decode returns the field at `offset`, and the offset following it.
+func (d decoder) decode(offset uint) (interface{}, uint, error) {
+	if d.depth++; d.depth > maxDepth {
+		return nil, 0, fmt.Errorf("fields nested deeper than %d levels", maxDepth)
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer {
+		ptr, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ, _, _, err := d.control(ptr); err == nil && typ == typePointer {
+			return nil, 0, fmt.Errorf("invalid pointer to the pointer at %d", ptr)
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			if k, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key %v is not a string", k)
+			}
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var v interface{}
+			if v, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("field of %d bytes at %d exceeds the data section", size, offset)
+	}
+	b, next := d.buf[offset:offset+size], offset+size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128, typeInt32:
+		if size > 8 {
+			// Only used for ranges of IPv6 addresses, which
+			// lsaddr does not need.
+			return append([]byte(nil), b...), next, nil
+		}
+		var n uint64
+		for _, v := range b {
+			n = n<<8 | uint64(v)
+		}
+		if typ == typeInt32 {
+			return int64(int32(n)), next, nil
+		}
+		return n, next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported field type %d", typ)
+	}
+}
+
+// control decodes the control byte(s) at `offset`, returning the type
+// and size of the field, and the offset of its payload.
+func (d decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("offset %d exceeds the data section", offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errors.New("truncated extended type")
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if typ == typePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, errors.New("truncated field size")
+	}
+	var ext uint
+	for _, v := range d.buf[offset : offset+n] {
+		ext = ext<<8 | uint(v)
+	}
+	switch size {
+	case 29:
+		size = 29 + ext
+	case 30:
+		size = 285 + ext
+	default:
+		size = 65821 + ext
+	}
+	return typ, size, offset + n, nil
+}
+
+// pointer decodes the pointer whose control byte has size bits
+// `size`, and whose payload is at `offset`. Returns the offset pointed
+// to, and the one following the pointer.
+func (d decoder) pointer(size, offset uint) (uint, uint, error) {
+	n := (size>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errors.New("truncated pointer")
+	}
+	var ptr uint
+	for _, v := range d.buf[offset : offset+n] {
+		ptr = ptr<<8 | uint(v)
+	}
+	vvv := size & 0x7
+	switch n {
+	case 1:
+		ptr |= vvv << 8
+	case 2:
+		ptr = (ptr | vvv<<16) + 2048
+	case 3:
+		ptr = (ptr | vvv<<24) + 526336
+	}
+	return ptr, offset + n, nil
+}
+
+// uintOf returns `v` as an unsigned integer, or 0 if it is not one.
+func uintOf(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
@@ -3,8 +3,7 @@ module github.com/jecoz/lsaddr
 go 1.12
 
 require (
-	github.com/booster-proj/lsaddr v0.5.1
 	github.com/spf13/cobra v0.0.5
-	gopkg.in/pipe.v2 v2.0.0-20140414041502-3c2ca4d52544
+	github.com/spf13/pflag v1.0.3
 	howett.net/plist v0.0.0-20181124034731-591f970eefbb
 )
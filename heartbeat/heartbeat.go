@@ -0,0 +1,122 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package heartbeat periodically prints machine readable progress
+// lines, so that wrappers running lsaddr under orchestration (i.e.
+// Ansible, Rundeck) can tell a long lookup on a busy host from a hung
+// one, and pick sensible timeouts.
+package heartbeat
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Beat is a progress line, encoded as a single JSON object.
+type Beat struct {
+	Type      string    `json:"type"` // always "heartbeat"
+	Time      time.Time `json:"time"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+	Phase     string    `json:"phase"`
+	Files     int       `json:"files"` // open network files processed so far
+}
+
+// Heartbeat writes a Beat at regular intervals until stopped. The
+// methods of a nil Heartbeat do nothing, so that callers do not need
+// to check whether heartbeats are enabled.
+type Heartbeat struct {
+	w     io.Writer
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu    sync.Mutex
+	phase string
+	files int
+}
+
+// Start writes a Beat to `w` every `interval`, starting in phase
+// "start". The writes of `w` are never concurrent.
+func Start(w io.Writer, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{
+		w:     w,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		phase: "start",
+	}
+	go func() {
+		defer close(h.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case now := <-t.C:
+				h.beat(now)
+			}
+		}
+	}()
+	return h
+}
+
+// Phase records that the phase `name` (i.e. "lookup", "enrich",
+// "encode") started.
+func (h *Heartbeat) Phase(name string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.phase = name
+	h.mu.Unlock()
+}
+
+// Add records that `n` more open network files were processed.
+func (h *Heartbeat) Add(n int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.files += n
+	h.mu.Unlock()
+}
+
+// Stop stops the heartbeat, writing a last Beat in phase "done".
+func (h *Heartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+	h.Phase("done")
+	h.beat(time.Now())
+}
+
+func (h *Heartbeat) beat(now time.Time) {
+	h.mu.Lock()
+	b := Beat{
+		Type:      "heartbeat",
+		Time:      now,
+		ElapsedMs: int64(now.Sub(h.start) / time.Millisecond),
+		Phase:     h.phase,
+		Files:     h.files,
+	}
+	h.mu.Unlock()
+	data, _ := json.Marshal(b)
+	h.w.Write(append(data, '\n'))
+}
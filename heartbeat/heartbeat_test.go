@@ -0,0 +1,77 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package heartbeat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+	var buf syncBuffer
+	h := Start(&buf, time.Millisecond)
+	h.Phase("lookup")
+	h.Add(2)
+	time.Sleep(10 * time.Millisecond)
+	h.Add(3)
+	h.Stop()
+
+	var beats []Beat
+	sc := bufio.NewScanner(&buf.b)
+	for sc.Scan() {
+		var b Beat
+		if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		beats = append(beats, b)
+	}
+	if len(beats) < 2 {
+		t.Fatalf("Unexpected number of beats: %d", len(beats))
+	}
+	for _, b := range beats[:len(beats)-1] {
+		if b.Type != "heartbeat" || (b.Phase != "start" && b.Phase != "lookup") {
+			t.Fatalf("Unexpected beat: %+v", b)
+		}
+	}
+	if b := beats[len(beats)-1]; b.Phase != "done" || b.Files != 5 || b.ElapsedMs < 10 {
+		t.Fatalf("Unexpected last beat: %+v", b)
+	}
+}
+
+func TestHeartbeat_Nil(t *testing.T) {
+	t.Parallel()
+	var h *Heartbeat
+	h.Phase("lookup")
+	h.Add(1)
+	h.Stop()
+}
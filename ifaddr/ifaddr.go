@@ -0,0 +1,169 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ifaddr correlates temporary (privacy) IPv6 source addresses
+// with the interface they are assigned to and its stable address, so
+// that reports remain interpretable after temporary addresses rotate.
+package ifaddr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Addr is an address assigned to a network interface.
+type Addr struct {
+	Iface     string
+	IP        net.IP
+	Temporary bool // temporary (privacy) address, see RFC 4941
+}
+
+// Annotate sets the Iface field of the open network files of `set`
+// whose source is one of the temporary addresses of `addrs`. The
+// stable address reported is a non temporary, global address of the
+// same interface, preferably in the same /64 prefix.
+func Annotate(set []onf.ONF, addrs []Addr) {
+	temp := make(map[string]Addr)
+	for _, v := range addrs {
+		if v.Temporary {
+			temp[v.IP.String()] = v
+		}
+	}
+	if len(temp) == 0 {
+		return
+	}
+	for i, v := range set {
+		if v.Src == nil {
+			continue
+		}
+		host, _, err := net.SplitHostPort(v.Src.String())
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		a, ok := temp[ip.String()]
+		if !ok {
+			continue
+		}
+		set[i].Iface = &onf.Iface{Name: a.Iface, Stable: stable(a, addrs)}
+	}
+}
+
+// stable returns the stable address of the interface of `temp`.
+func stable(temp Addr, addrs []Addr) string {
+	var found string
+	prefix := net.CIDRMask(64, 128)
+	for _, v := range addrs {
+		if v.Temporary || v.Iface != temp.Iface || v.IP.To4() != nil || !v.IP.IsGlobalUnicast() {
+			continue
+		}
+		if v.IP.Mask(prefix).Equal(temp.IP.Mask(prefix)) {
+			return v.IP.String()
+		}
+		if found == "" {
+			found = v.IP.String()
+		}
+	}
+	return found
+}
+
+// ifaTemporary is the IFA_F_TEMPORARY flag of linux.
+const ifaTemporary = 0x01
+
+// ParseIfInet6 expects "r" to contain the linux /proc/net/if_inet6
+// file, that lists one IPv6 address per line, followed by interface
+// index, prefix length, scope, flags and interface name.
+//
+// "line" example:
+// "20010db8000000001c2e3f4a5b6c7d8e 02 40 00 01     eth0"
+func ParseIfInet6(r io.Reader) ([]Addr, error) {
+	var acc []Addr
+	err := internal.ScanLines(r, func(line string) error {
+		chunks := strings.Fields(line)
+		if len(chunks) < 6 {
+			return nil
+		}
+		ip, err := hex.DecodeString(chunks[0])
+		if err != nil || len(ip) != net.IPv6len {
+			return fmt.Errorf("unable to parse address %s", chunks[0])
+		}
+		flags, err := strconv.ParseUint(chunks[4], 16, 32)
+		if err != nil {
+			return fmt.Errorf("unable to parse flags of %s: %w", chunks[0], err)
+		}
+		acc = append(acc, Addr{
+			Iface:     chunks[5],
+			IP:        net.IP(ip),
+			Temporary: flags&ifaTemporary != 0,
+		})
+		return nil
+	})
+	return acc, err
+}
+
+// ParseIfconfig expects "r" to contain the output of an ``ifconfig''
+// call on BSD systems and macOS, returning the IPv6 addresses listed,
+// which are marked "temporary" when they are privacy addresses.
+//
+// "line" examples:
+// "en0: flags=8863<UP,BROADCAST,SMART,RUNNING,SIMPLEX,MULTICAST> mtu 1500"
+// "	inet6 2001:db8::1c2e:3f4a:5b6c:7d8e prefixlen 64 autoconf temporary"
+// "	inet6 fe80::1%lo0 prefixlen 64 scopeid 0x1"
+func ParseIfconfig(r io.Reader) ([]Addr, error) {
+	var (
+		acc   []Addr
+		iface string
+	)
+	err := internal.ScanLines(r, func(line string) error {
+		if line == "" {
+			return nil
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			if i := strings.Index(line, ":"); i > 0 {
+				iface = line[:i]
+			}
+			return nil
+		}
+		chunks := strings.Fields(line)
+		if len(chunks) < 2 || chunks[0] != "inet6" {
+			return nil
+		}
+		host := chunks[1]
+		if i := strings.Index(host, "%"); i >= 0 {
+			host = host[:i]
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("unable to parse address %s", chunks[1])
+		}
+		a := Addr{Iface: iface, IP: ip}
+		for _, v := range chunks[2:] {
+			a.Temporary = a.Temporary || v == "temporary"
+		}
+		acc = append(acc, a)
+		return nil
+	})
+	return acc, err
+}
@@ -0,0 +1,32 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ifaddr
+
+import (
+	"fmt"
+	"os"
+)
+
+// List returns the IPv6 addresses of the interfaces of the system,
+// read from /proc/net/if_inet6.
+func List() ([]Addr, error) {
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list interface addresses: %w", err)
+	}
+	defer f.Close()
+	return ParseIfInet6(f)
+}
@@ -0,0 +1,46 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux,!darwin,!freebsd,!openbsd
+
+package ifaddr
+
+import (
+	"fmt"
+	"net"
+)
+
+// List returns the IPv6 addresses of the interfaces of the system.
+// Temporary addresses cannot be told apart on this platform, hence
+// Annotate has no effect with them.
+func List() ([]Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list interface addresses: %w", err)
+	}
+	var acc []Addr
+	for _, v := range ifaces {
+		addrs, err := v.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil {
+				acc = append(acc, Addr{Iface: v.Name, IP: n.IP})
+			}
+		}
+	}
+	return acc, nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ifaddr_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/ifaddr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+const ifInet6Example = `00000000000000000000000000000001 01 80 10 80       lo
+20010db8000000001c2e3f4a5b6c7d8e 02 40 00 01     eth0
+20010db8000000000211223344556677 02 40 00 00     eth0
+fe800000000000000211223344556677 02 40 20 80     eth0
+`
+
+const ifconfigExample = `lo0: flags=8049<UP,LOOPBACK,RUNNING,MULTICAST> mtu 16384
+	inet 127.0.0.1 netmask 0xff000000
+	inet6 ::1 prefixlen 128
+	inet6 fe80::1%lo0 prefixlen 64 scopeid 0x1
+en0: flags=8863<UP,BROADCAST,SMART,RUNNING,SIMPLEX,MULTICAST> mtu 1500
+	ether 8c:85:90:aa:bb:cc
+	inet6 fe80::1c9d:2f3a:8b4e:1234%en0 prefixlen 64 secured scopeid 0x6
+	inet6 2001:db8::211:2233:4455:6677 prefixlen 64 autoconf secured
+	inet6 2001:db8::1c2e:3f4a:5b6c:7d8e prefixlen 64 autoconf temporary
+	status: active
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	linux, err := ifaddr.ParseIfInet6(strings.NewReader(ifInet6Example))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bsd, err := ifaddr.ParseIfconfig(strings.NewReader(ifconfigExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, v := range [][]ifaddr.Addr{linux, bsd} {
+		if len(v) != 4+i {
+			t.Fatalf("Unexpected addresses: %v", v)
+		}
+		var temp []ifaddr.Addr
+		for _, a := range v {
+			if a.Temporary {
+				temp = append(temp, a)
+			}
+		}
+		if len(temp) != 1 || !temp[0].IP.Equal(net.ParseIP("2001:db8::1c2e:3f4a:5b6c:7d8e")) {
+			t.Fatalf("Unexpected temporary addresses: %v", temp)
+		}
+	}
+	if linux[1].Iface != "eth0" || bsd[4].Iface != "en0" {
+		t.Fatalf("Unexpected interfaces: %s, %s", linux[1].Iface, bsd[4].Iface)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Parallel()
+	addrs, _ := ifaddr.ParseIfInet6(strings.NewReader(ifInet6Example))
+	set := []onf.ONF{
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "[2001:db8::1c2e:3f4a:5b6c:7d8e]:50000"), Dst: internal.NewAddr("tcp", "[2001:db8:1::1]:443")},
+		{Cmd: "sshd", Src: internal.NewAddr("tcp", "[2001:db8::211:2233:4455:6677]:22"), Dst: internal.NewAddr("tcp", "[2001:db8:1::2]:50000")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:50001")},
+	}
+	ifaddr.Annotate(set, addrs)
+	if i := set[0].Iface; i == nil || i.Name != "eth0" || i.Stable != "2001:db8::211:2233:4455:6677" {
+		t.Fatalf("Unexpected interface: %+v", i)
+	}
+	if set[1].Iface != nil || set[2].Iface != nil {
+		t.Fatalf("Unexpected annotation of stable addresses: %+v, %+v", set[1].Iface, set[2].Iface)
+	}
+}
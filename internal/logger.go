@@ -0,0 +1,68 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Logger is the destination of the diagnostic messages produced while
+// looking up open network files, such as the commands executed or the
+// lines that could not be decoded. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type stdLogger struct{}
+
+// Printf writes to the standard logger of package log, reporting the
+// caller of Printf as the source of the message.
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+var (
+	// StdLogger writes to the standard logger of package log.
+	StdLogger Logger = stdLogger{}
+	// Discard drops every message.
+	Discard Logger = discardLogger{}
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of `ctx` carrying `l`, which is then
+// returned by LoggerFrom. A nil `l` discards every message.
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	if l == nil {
+		l = Discard
+	}
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFrom returns the Logger carried by `ctx`, or StdLogger when
+// there is none.
+func LoggerFrom(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return StdLogger
+}
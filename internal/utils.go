@@ -40,17 +40,37 @@ func ChunkLine(line string, sep string, min int) ([]string, error) {
 	return chunks, nil
 }
 
+// DefaultScanBufferSize is the initial size of the buffer used by
+// ScanLines.
+const DefaultScanBufferSize = 64 * 1024
+
+// ScanLines calls `f` with each line read from `r`, without its
+// line terminator. Lines of any length are supported.
 func ScanLines(r io.Reader, f func(string) error) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.Trim(line, "\n")
-		line = strings.Trim(line, "\r")
-		if err := f(line); err != nil {
+	return ScanLinesSize(r, DefaultScanBufferSize, f)
+}
+
+// ScanLinesSize is the same as ScanLines, but uses a buffer of `size`
+// bytes. Lines that do not fit in the buffer are still returned whole,
+// as opposed to what bufio.Scanner does: they just need more memory.
+func ScanLinesSize(r io.Reader, size int, f func(string) error) error {
+	br := bufio.NewReaderSize(r, size)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.Trim(line, "\n")
+			line = strings.Trim(line, "\r")
+			if err := f(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
 			return err
 		}
 	}
-	return scanner.Err()
 }
 
 type uncheckedAddr struct {
@@ -60,13 +80,23 @@ type uncheckedAddr struct {
 func (a uncheckedAddr) Network() string { return a.net }
 func (a uncheckedAddr) String() string  { return a.addr }
 
+// NewAddr returns a net.Addr that reports "network" and "addr" as they
+// are, without any validation.
+func NewAddr(network, addr string) net.Addr {
+	return uncheckedAddr{
+		net:  network,
+		addr: addr,
+	}
+}
+
 func ParseNetAddr(network, addr string) (net.Addr, error) {
 	network = strings.ToLower(network)
 	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	if ip := net.ParseIP(host); ip == nil {
+	// "*" is used by lsof and netstat for wildcard addresses.
+	if ip := net.ParseIP(host); ip == nil && host != "*" {
 		return nil, fmt.Errorf("%v is not a valid ip address", host)
 	}
 	return uncheckedAddr{
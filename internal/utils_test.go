@@ -0,0 +1,88 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package internal_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestScanLines(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in    string
+		lines []string
+	}{
+		{in: "", lines: nil},
+		{in: "a", lines: []string{"a"}},
+		{in: "a\n", lines: []string{"a"}},
+		{in: "a\r\nb\n\nc", lines: []string{"a", "b", "", "c"}},
+	}
+	for i, v := range tt {
+		var lines []string
+		err := internal.ScanLines(strings.NewReader(v.in), func(line string) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(lines, v.lines) {
+			t.Fatalf("%d: Unexpected lines: wanted %q, found %q", i, v.lines, lines)
+		}
+	}
+}
+
+func TestScanLines_Long(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("x", 4<<20) // 4MB
+	in := "first\n" + long + "\nlast\n"
+	var lines []string
+	err := internal.ScanLinesSize(strings.NewReader(in), 16, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(lines) != 3 || lines[0] != "first" || lines[1] != long || lines[2] != "last" {
+		t.Fatalf("Unexpected lines: found %d lines", len(lines))
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestScanLines_Errors(t *testing.T) {
+	t.Parallel()
+	if err := internal.ScanLines(failingReader{}, func(string) error { return nil }); err == nil {
+		t.Fatalf("Expected read error to be returned")
+	}
+	stop := errors.New("stop")
+	n := 0
+	err := internal.ScanLines(strings.NewReader("a\nb\n"), func(string) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("Expected scan to stop at the first error, found %v after %d lines", err, n)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package iphlp lists the sockets of a windows machine, and the
+// processes owning them, using the IP Helper API (GetExtendedTcpTable
+// and GetExtendedUdpTable) instead of parsing the localized output of
+// netstat. The tables are decoded by platform independent functions.
+package iphlp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// Row is a socket, as found in one of the tables.
+type Row struct {
+	Proto   string // TCP or UDP
+	SrcAddr net.Addr
+	DstAddr net.Addr
+	State   string // named as netstat does (LISTENING, ESTABLISHED, ...), TCP only
+	Pid     int
+}
+
+// String formats `r` as a line of the output of ``netstat -nao''.
+func (r Row) String() string {
+	return fmt.Sprintf("  %s    %s    %s    %s    %d", r.Proto, r.SrcAddr, r.DstAddr, r.State, r.Pid)
+}
+
+// states maps the MIB_TCP_STATE values to the names used by netstat.
+var states = map[uint32]string{
+	1:  "CLOSED",
+	2:  "LISTENING",
+	3:  "SYN_SENT",
+	4:  "SYN_RECEIVED",
+	5:  "ESTABLISHED",
+	6:  "FIN_WAIT_1",
+	7:  "FIN_WAIT_2",
+	8:  "CLOSE_WAIT",
+	9:  "CLOSING",
+	10: "LAST_ACK",
+	11: "TIME_WAIT",
+	12: "DELETE_TCB",
+}
+
+// Sizes of the rows of each table, in bytes.
+const (
+	tcpRowSize  = 24 // MIB_TCPROW_OWNER_PID
+	tcp6RowSize = 56 // MIB_TCP6ROW_OWNER_PID
+	udpRowSize  = 12 // MIB_UDPROW_OWNER_PID
+	udp6RowSize = 28 // MIB_UDP6ROW_OWNER_PID
+)
+
+// ParseTCPTable decodes a MIB_TCPTABLE_OWNER_PID.
+func ParseTCPTable(b []byte) ([]Row, error) {
+	return parseTable(b, tcpRowSize, func(r []byte) Row {
+		return Row{
+			Proto:   "TCP",
+			SrcAddr: addr("tcp", net.IP(r[4:8]), r[8:12]),
+			DstAddr: addr("tcp", net.IP(r[12:16]), r[16:20]),
+			State:   state(r[0:4]),
+			Pid:     int(binary.LittleEndian.Uint32(r[20:24])),
+		}
+	})
+}
+
+// ParseTCP6Table decodes a MIB_TCP6TABLE_OWNER_PID.
+func ParseTCP6Table(b []byte) ([]Row, error) {
+	return parseTable(b, tcp6RowSize, func(r []byte) Row {
+		return Row{
+			Proto:   "TCP",
+			SrcAddr: addr("tcp", net.IP(r[0:16]), r[20:24]),
+			DstAddr: addr("tcp", net.IP(r[24:40]), r[44:48]),
+			State:   state(r[48:52]),
+			Pid:     int(binary.LittleEndian.Uint32(r[52:56])),
+		}
+	})
+}
+
+// ParseUDPTable decodes a MIB_UDPTABLE_OWNER_PID.
+func ParseUDPTable(b []byte) ([]Row, error) {
+	return parseTable(b, udpRowSize, func(r []byte) Row {
+		return Row{
+			Proto:   "UDP",
+			SrcAddr: addr("udp", net.IP(r[0:4]), r[4:8]),
+			DstAddr: internal.NewAddr("udp", "*:*"),
+			Pid:     int(binary.LittleEndian.Uint32(r[8:12])),
+		}
+	})
+}
+
+// ParseUDP6Table decodes a MIB_UDP6TABLE_OWNER_PID.
+func ParseUDP6Table(b []byte) ([]Row, error) {
+	return parseTable(b, udp6RowSize, func(r []byte) Row {
+		return Row{
+			Proto:   "UDP",
+			SrcAddr: addr("udp", net.IP(r[0:16]), r[20:24]),
+			DstAddr: internal.NewAddr("udp", "*:*"),
+			Pid:     int(binary.LittleEndian.Uint32(r[24:28])),
+		}
+	})
+}
+
+// parseTable decodes a table made of a DWORD counting the rows,
+// followed by the rows, each of `size` bytes.
+func parseTable(b []byte, size int, row func([]byte) Row) ([]Row, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("table too short: %d bytes", len(b))
+	}
+	n := int(binary.LittleEndian.Uint32(b[0:4]))
+	if len(b) < 4+n*size {
+		return nil, fmt.Errorf("table too short: %d rows need %d bytes, found %d", n, 4+n*size, len(b))
+	}
+	acc := make([]Row, n)
+	for i := range acc {
+		off := 4 + i*size
+		acc[i] = row(b[off : off+size])
+	}
+	return acc, nil
+}
+
+// addr returns the address made of `ip` and `port`, a DWORD whose
+// first two bytes are the port in network byte order.
+func addr(network string, ip net.IP, port []byte) net.Addr {
+	p := int(binary.BigEndian.Uint16(port[0:2]))
+	return internal.NewAddr(network, net.JoinHostPort(ip.String(), strconv.Itoa(p)))
+}
+
+func state(b []byte) string {
+	s, ok := states[binary.LittleEndian.Uint32(b)]
+	if !ok {
+		return "UNKNOWN"
+	}
+	return s
+}
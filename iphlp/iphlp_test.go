@@ -0,0 +1,112 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iphlp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// encodeTable builds a table with `rows`, each already encoded.
+func encodeTable(rows ...[]byte) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(len(rows)))
+	for _, v := range rows {
+		b = append(b, v...)
+	}
+	return b
+}
+
+func dword(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// port encodes `p` as stored in the tables: network byte order, in
+// the first two bytes of a DWORD.
+func port(p uint16) []byte {
+	return []byte{byte(p >> 8), byte(p), 0, 0}
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, v := range parts {
+		b = append(b, v...)
+	}
+	return b
+}
+
+func TestParseTCPTable(t *testing.T) {
+	t.Parallel()
+	b := encodeTable(
+		concat(dword(5), net.IPv4(192, 168, 0, 61).To4(), port(51291), net.IPv4(35, 186, 224, 47).To4(), port(443), dword(11200)),
+		concat(dword(2), net.IPv4zero.To4(), port(135), net.IPv4zero.To4(), port(0), dword(748)),
+	)
+	rows, err := ParseTCPTable(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+	assert(t, "  TCP    192.168.0.61:51291    35.186.224.47:443    ESTABLISHED    11200", rows[0].String())
+	assert(t, "  TCP    0.0.0.0:135    0.0.0.0:0    LISTENING    748", rows[1].String())
+
+	if _, err := ParseTCPTable(b[:len(b)-1]); err == nil {
+		t.Fatalf("Expected an error decoding a truncated table")
+	}
+}
+
+func TestParseTCP6Table(t *testing.T) {
+	t.Parallel()
+	b := encodeTable(concat(
+		net.ParseIP("2001:db8::1"), dword(0), port(50000),
+		net.ParseIP("2001:db8::2"), dword(0), port(443),
+		dword(8), dword(4242),
+	))
+	rows, err := ParseTCP6Table(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, "[2001:db8::1]:50000", rows[0].SrcAddr.String())
+	assert(t, "[2001:db8::2]:443", rows[0].DstAddr.String())
+	assert(t, "CLOSE_WAIT", rows[0].State)
+	assert(t, 4242, rows[0].Pid)
+}
+
+func TestParseUDPTables(t *testing.T) {
+	t.Parallel()
+	rows, err := ParseUDPTable(encodeTable(concat(net.IPv4zero.To4(), port(5353), dword(1036))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, "  UDP    0.0.0.0:5353    *:*        1036", rows[0].String())
+
+	rows, err = ParseUDP6Table(encodeTable(concat(net.IPv6loopback, dword(0), port(62261), dword(1036))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, "[::1]:62261", rows[0].SrcAddr.String())
+	assert(t, "udp", rows[0].SrcAddr.Network())
+}
+
+func assert(t *testing.T, exp, x interface{}) {
+	if exp != x {
+		t.Fatalf("Assert failed: expected %v, found %v", exp, x)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows
+
+package iphlp
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi                = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+	procGetExtendedUdpTable = iphlpapi.NewProc("GetExtendedUdpTable")
+)
+
+const (
+	afInet  = 2
+	afInet6 = 23
+
+	tcpTableOwnerPidAll = 5 // TCP_TABLE_OWNER_PID_ALL
+	udpTableOwnerPid    = 1 // UDP_TABLE_OWNER_PID
+
+	errorInsufficientBuffer = 122
+)
+
+// Read returns the rows of the TCP and UDP tables, for both IPv4 and
+// IPv6.
+func Read() ([]Row, error) {
+	tables := []struct {
+		proc  *syscall.LazyProc
+		af    uintptr
+		class uintptr
+		parse func([]byte) ([]Row, error)
+	}{
+		{procGetExtendedTcpTable, afInet, tcpTableOwnerPidAll, ParseTCPTable},
+		{procGetExtendedTcpTable, afInet6, tcpTableOwnerPidAll, ParseTCP6Table},
+		{procGetExtendedUdpTable, afInet, udpTableOwnerPid, ParseUDPTable},
+		{procGetExtendedUdpTable, afInet6, udpTableOwnerPid, ParseUDP6Table},
+	}
+	var acc []Row
+	for _, v := range tables {
+		b, err := table(v.proc, v.af, v.class)
+		if err != nil {
+			return acc, err
+		}
+		rows, err := v.parse(b)
+		if err != nil {
+			return acc, fmt.Errorf("unable to decode %s table: %w", v.proc.Name, err)
+		}
+		acc = append(acc, rows...)
+	}
+	return acc, nil
+}
+
+// table calls `proc` until the buffer provided is large enough to
+// hold the table, which may grow between calls.
+func table(proc *syscall.LazyProc, af, class uintptr) ([]byte, error) {
+	size := uint32(16 * 1024)
+	for {
+		b := make([]byte, size)
+		ret, _, _ := proc.Call(
+			uintptr(unsafe.Pointer(&b[0])),
+			uintptr(unsafe.Pointer(&size)),
+			0, // unsorted
+			af,
+			class,
+			0,
+		)
+		switch ret {
+		case 0:
+			return b[:size], nil
+		case errorInsufficientBuffer:
+			continue
+		default:
+			return nil, fmt.Errorf("%s failed: %w", proc.Name, syscall.Errno(ret))
+		}
+	}
+}
+
+// Processes maps the pid of each running process to the name of its
+// executable, using a toolhelp snapshot.
+func Processes() (map[int]string, error) {
+	snap, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list processes: %w", err)
+	}
+	defer syscall.CloseHandle(snap)
+
+	acc := make(map[int]string)
+	var e syscall.ProcessEntry32
+	e.Size = uint32(unsafe.Sizeof(e))
+	for err = syscall.Process32First(snap, &e); err == nil; err = syscall.Process32Next(snap, &e) {
+		acc[int(e.ProcessID)] = syscall.UTF16ToString(e.ExeFile[:])
+	}
+	return acc, nil
+}
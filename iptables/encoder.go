@@ -0,0 +1,154 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package iptables encodes the destinations of open network files into
+// a shell script of iptables (and ip6tables) rules, so that the
+// outgoing traffic of an application can be allowed, or blocked,
+// without converting lsaddr's output by hand. Large destination sets
+// can be collected into ipsets, matched by a single rule each.
+package iptables
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes one ``iptables -A'' command per destination, preceded
+// by a comment listing the commands connected to it, or the ipset
+// commands collecting the destinations followed by the rules matching
+// the sets.
+type Encoder struct {
+	w       io.Writer
+	chain   string
+	verdict string
+	ipset   string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, chain: "OUTPUT", verdict: "ACCEPT"}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "chain": the chain rules are appended to, "OUTPUT" by default.
+// - "verdict": "ACCEPT" (the default), "DROP" or "REJECT".
+// - "ipset": name of the ipset collecting the destinations, matched
+// by a single rule ("<name>6" for IPv6 destinations). Destinations
+// without a port are still matched by a rule each.
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "chain":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid chain %q", v)
+			}
+			e.chain = v
+		case "verdict":
+			switch v = strings.ToUpper(v); v {
+			case "ACCEPT", "DROP", "REJECT":
+				e.verdict = v
+			default:
+				return nil, fmt.Errorf("invalid verdict %q: expected ACCEPT, DROP or REJECT", v)
+			}
+		case "ipset":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid ipset name %q", v)
+			}
+			e.ipset = v
+		default:
+			return nil, fmt.Errorf("unknown iptables option %q", k)
+		}
+	}
+	return e, nil
+}
+
+// validName reports whether `s` can be used as a chain or set name
+// without quoting.
+func validName(s string) bool {
+	return s != "" && len(s) <= 28 && !strings.ContainsAny(s, " \t'\"\\$`;&|<>()")
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "#!/bin/sh")
+	dsts := aggr.Endpoints(set)
+	if e.ipset != "" {
+		dsts = e.encodeSets(w, dsts)
+	}
+	for _, v := range dsts {
+		if len(v.Cmds) > 0 {
+			fmt.Fprintf(w, "# %s\n", strings.Join(v.Cmds, ", "))
+		}
+		fmt.Fprintf(w, "%s -A %s -d %s -p %s", command(v.IPv6()), e.chain, v.IP, v.Proto)
+		if v.Port != "" {
+			fmt.Fprintf(w, " --dport %s", v.Port)
+		}
+		fmt.Fprintf(w, " -j %s\n", e.verdict)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// encodeSets writes the ipsets collecting the destinations of `dsts`
+// with a port, one for each address family, and the rules matching
+// them. Returns the destinations left out.
+func (e *Encoder) encodeSets(w io.Writer, dsts []aggr.Endpoint) []aggr.Endpoint {
+	var rest []aggr.Endpoint
+	var rules []string
+	for _, ipv6 := range []bool{false, true} {
+		name, family := e.ipset, "inet"
+		if ipv6 {
+			name, family = e.ipset+"6", "inet6"
+		}
+		var created bool
+		for _, v := range dsts {
+			if v.IPv6() != ipv6 {
+				continue
+			}
+			if v.Port == "" {
+				rest = append(rest, v)
+				continue
+			}
+			if !created {
+				fmt.Fprintf(w, "ipset create %s hash:ip,port family %s -exist\n", name, family)
+				rules = append(rules, fmt.Sprintf("%s -A %s -m set --match-set %s dst,dst -j %s", command(ipv6), e.chain, name, e.verdict))
+				created = true
+			}
+			if len(v.Cmds) > 0 {
+				fmt.Fprintf(w, "# %s\n", strings.Join(v.Cmds, ", "))
+			}
+			fmt.Fprintf(w, "ipset add %s %s,%s:%s -exist\n", name, v.IP, v.Proto, v.Port)
+		}
+	}
+	for _, v := range rules {
+		fmt.Fprintln(w, v)
+	}
+	return rest
+}
+
+// command returns the tool managing the rules of the address family.
+func command(ipv6 bool) string {
+	if ipv6 {
+		return "ip6tables"
+	}
+	return "iptables"
+}
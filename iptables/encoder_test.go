@@ -0,0 +1,87 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package iptables_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/iptables"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Cmd: "dig", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+		{Cmd: "ping", Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "10.0.0.1:*")},
+		// Command names are chosen by the processes.
+		{Cmd: "x\ntouch /tmp/pwned", Src: internal.NewAddr("tcp", "10.0.0.2:5003"), Dst: internal.NewAddr("tcp", "10.0.0.1:*")},
+	}
+	tt := []struct {
+		opts map[string]string
+		want string
+	}{
+		{nil, `#!/bin/sh
+# Spotify, curl
+iptables -A OUTPUT -d 35.186.224.47 -p tcp --dport 443 -j ACCEPT
+# dig
+ip6tables -A OUTPUT -d 2001:db8::1 -p udp --dport 53 -j ACCEPT
+# ping, x?touch /tmp/pwned
+iptables -A OUTPUT -d 10.0.0.1 -p tcp -j ACCEPT
+`},
+		{map[string]string{"chain": "lsaddr", "verdict": "drop", "ipset": "spotify"}, `#!/bin/sh
+ipset create spotify hash:ip,port family inet -exist
+# Spotify, curl
+ipset add spotify 35.186.224.47,tcp:443 -exist
+ipset create spotify6 hash:ip,port family inet6 -exist
+# dig
+ipset add spotify6 2001:db8::1,udp:53 -exist
+iptables -A lsaddr -m set --match-set spotify dst,dst -j DROP
+ip6tables -A lsaddr -m set --match-set spotify6 dst,dst -j DROP
+# ping, x?touch /tmp/pwned
+iptables -A lsaddr -d 10.0.0.1 -p tcp -j DROP
+`},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		e, err := iptables.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := e.Encode(set); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("%d: Unexpected output: wanted %q, found %q", i, v.want, b.String())
+		}
+	}
+
+	invalid := []map[string]string{
+		{"verdict": "allow"},
+		{"chain": "OUTPUT; rm -rf /"},
+		{"ipset": ""},
+		{"table": "nat"},
+	}
+	for i, v := range invalid {
+		if _, err := iptables.NewEncoderOptions(&bytes.Buffer{}, v); err == nil {
+			t.Fatalf("%d: Unexpected nil error with options %v", i, v)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package long encodes open network files into a table mirroring
+// the columns of ``lsof -i -n -P''.
+package long
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes one line for each open network file, with the
+// COMMAND, PID, USER, FD, TYPE, DEVICE, SIZE/OFF, NODE and NAME
+// columns. The low-level details (see onf.File) are printed as "-"
+// when the backend does not report them, as it happens on windows.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	tw := tabwriter.NewWriter(e.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMMAND\tPID\tUSER\tFD\tTYPE\tDEVICE\tSIZE/OFF\tNODE\tNAME")
+	for _, v := range set {
+		f := onf.File{}
+		if v.File != nil {
+			f = *v.File
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			dash(v.Cmd),
+			dash(strconv.Itoa(v.Pid)),
+			dash(f.User),
+			dash(f.Fd),
+			dash(f.Type),
+			dash(f.Device),
+			dash(f.SizeOff),
+			dash(f.Node),
+			name(v),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// name formats the addresses of `f` as lsof does in its NAME column.
+func name(f onf.ONF) string {
+	var s string
+	if f.Src != nil {
+		s = f.Src.String()
+	}
+	if f.Dst != nil && f.Dst.String() != "" {
+		s += "->" + f.Dst.String()
+	}
+	if f.State != "" {
+		s += " (" + f.State + ")"
+	}
+	return dash(s)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package long_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/long"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{
+			Cmd:   "Spotify",
+			Pid:   11778,
+			Src:   internal.NewAddr("tcp", "192.168.0.61:51291"),
+			Dst:   internal.NewAddr("tcp", "35.186.224.47:443"),
+			State: "ESTABLISHED",
+			File: &onf.File{
+				User:    "jecoz",
+				Fd:      "128u",
+				Type:    "IPv4",
+				Device:  "0x25c5bf09993eff03",
+				SizeOff: "0t0",
+				Node:    "TCP",
+			},
+		},
+		{
+			Pid: 812,
+			Src: internal.NewAddr("udp", "0.0.0.0:5353"),
+		},
+	}
+	var b bytes.Buffer
+	if err := long.NewEncoder(&b).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `COMMAND  PID    USER   FD    TYPE  DEVICE              SIZE/OFF  NODE  NAME
+Spotify  11778  jecoz  128u  IPv4  0x25c5bf09993eff03  0t0       TCP   192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)
+-        812    -      -     -     -                   -         -     0.0.0.0:5353
+`
+	if b.String() != want {
+		t.Fatalf("Unexpected output: wanted\n%s\nfound\n%s", want, b.String())
+	}
+}
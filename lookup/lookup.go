@@ -0,0 +1,233 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package lookup is the entry point for programs embedding lsaddr: it
+// lists the open network files matching a pivot, as the lsaddr command
+// does, configured through functional options instead of flags.
+package lookup
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/resolve"
+
+	// Registers the "proc" backend on linux.
+	_ "github.com/jecoz/lsaddr/procnet"
+)
+
+type options struct {
+	ctx     context.Context
+	runtime onf.Runtime
+	backend string
+	protos  []string
+	states  []string
+	resolve *resolve.Options
+	logger  Logger
+}
+
+// Option configures OpenNetFiles, Stream and Watch.
+type Option func(*options)
+
+// WithContext aborts the lookup as soon as `ctx` is done, returning
+// its error. Stream and Watch take their context as argument instead.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) { o.ctx = ctx }
+}
+
+// WithProtocol keeps only the open network files using one of
+// `protos`, either "tcp" or "udp".
+func WithProtocol(protos ...string) Option {
+	return func(o *options) { o.protos = append(o.protos, protos...) }
+}
+
+// WithStates keeps only the open network files in one of `states`
+// (i.e. "LISTEN", "established"), compared as onf.ParseStates does.
+func WithStates(states ...string) Option {
+	return func(o *options) { o.states = append(o.states, states...) }
+}
+
+// WithResolve resolves the names of the destination addresses with
+// reverse DNS lookups, configured by `opts`. The zero Options use the
+// system resolver.
+func WithResolve(opts resolve.Options) Option {
+	return func(o *options) { o.resolve = &opts }
+}
+
+// WithBackend lists the open network files using the runtime
+// registered under `name` (see onf.Runtimes), instead of
+// onf.DefaultRuntime. An empty name or "auto" selects the default.
+func WithBackend(name string) Option {
+	return func(o *options) { o.backend = name }
+}
+
+// WithRuntime lists the open network files using `r`, taking
+// precedence over WithBackend.
+func WithRuntime(r onf.Runtime) Option {
+	return func(o *options) { o.runtime = r }
+}
+
+// Logger receives the diagnostic messages of a lookup, such as the
+// external commands executed and the lines of their output that could
+// not be decoded. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger writes the diagnostic messages of the lookup to `l`,
+// which must be safe for concurrent use when shared by parallel
+// lookups. By default they are discarded, leaving the standard logger
+// of package log untouched.
+func WithLogger(l Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// query is the result of applying the options, validated.
+type query struct {
+	ctx      context.Context
+	runtime  onf.Runtime
+	protos   onf.Protos
+	states   onf.States
+	resolver *resolve.Resolver
+}
+
+func newQuery(opts []Option) (query, error) {
+	o := options{ctx: context.Background()}
+	for _, v := range opts {
+		v(&o)
+	}
+	q := query{ctx: internal.WithLogger(o.ctx, o.logger), runtime: o.runtime}
+	var err error
+	if q.protos, err = onf.ParseProtos(strings.Join(o.protos, ",")); err != nil {
+		return q, err
+	}
+	q.states = onf.ParseStates(strings.Join(o.states, ","))
+	if q.runtime == nil {
+		if q.runtime, err = runtimeByName(o.backend); err != nil {
+			return q, err
+		}
+	}
+	if o.resolve != nil {
+		if q.resolver, err = resolve.New(*o.resolve); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+func (q query) match(f onf.ONF) bool {
+	return q.protos.Match(f) && q.states.Match(f)
+}
+
+// OpenNetFiles returns the open network files matching `s`, a pivot
+// as accepted by onf.Fetch (combine several with onf.Any), configured
+// by `opts`. The result is ordered as described by onf.Sort. The
+// global state of package onf, such as onf.DefaultRuntime, is never
+// modified.
+func OpenNetFiles(s string, opts ...Option) ([]onf.ONF, error) {
+	q, err := newQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+	set, err := onf.FetchWith(q.ctx, q.runtime, s)
+	if err != nil {
+		return nil, err
+	}
+	set = onf.FilterStates(onf.FilterProtos(set, q.protos), q.states)
+	if q.resolver != nil {
+		resolve.Run(q.ctx, set, q.resolver)
+		if err := q.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Stream is the same as OpenNetFiles, but the open network files are
+// sent on the returned channel as soon as they are decoded, unordered,
+// instead of being collected first: consumers can start working before
+// the external tool is done listing tens of thousands of sockets. Both
+// channels are closed when the lookup ends; the error channel receives
+// at most one error, the one that stopped it (that of `ctx`, when done).
+// Consumers must drain the first channel or cancel `ctx`.
+func Stream(ctx context.Context, s string, opts ...Option) (<-chan onf.ONF, <-chan error) {
+	files := make(chan onf.ONF)
+	errc := make(chan error, 1)
+	q, err := newQuery(append(opts[:len(opts):len(opts)], WithContext(ctx)))
+	if err != nil {
+		errc <- err
+		close(files)
+		close(errc)
+		return files, errc
+	}
+	go func() {
+		defer close(errc)
+		defer close(files)
+		err := onf.EachWith(q.ctx, q.runtime, s, func(f onf.ONF) error {
+			if !q.match(f) {
+				return nil
+			}
+			if q.resolver != nil {
+				set := []onf.ONF{f}
+				resolve.Run(q.ctx, set, q.resolver)
+				f = set[0]
+			}
+			select {
+			case files <- f:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return files, errc
+}
+
+// Watch repeats the lookup of `s` every `interval`, configured by
+// `opts`, until `ctx` is done, calling `fn` with the open network files
+// opened and closed since the previous lookup, as onf.Watch does. The
+// lookups are filtered by the options before being compared: a
+// connection reaching one of the states selected is reported as opened,
+// and one leaving them as closed. The error returned is the one of
+// onf.Watch; the options are validated before the first lookup.
+func Watch(ctx context.Context, s string, interval time.Duration, fn func(onf.Change) error, opts ...Option) error {
+	q, err := newQuery(append(opts[:len(opts):len(opts)], WithContext(ctx)))
+	if err != nil {
+		return err
+	}
+	filter := func(set []onf.ONF) ([]onf.ONF, error) {
+		return onf.FilterStates(onf.FilterProtos(set, q.protos), q.states), nil
+	}
+	return onf.WatchWith(q.ctx, q.runtime, s, interval, filter, func(c onf.Change) error {
+		if q.resolver != nil {
+			resolve.Run(q.ctx, c.Opened, q.resolver)
+			resolve.Run(q.ctx, c.Closed, q.resolver)
+		}
+		return fn(c)
+	})
+}
+
+func runtimeByName(name string) (onf.Runtime, error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "auto" {
+		return onf.DefaultRuntime, nil
+	}
+	return onf.RuntimeByName(name)
+}
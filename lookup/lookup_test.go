@@ -0,0 +1,241 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package lookup_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/lookup"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+const lsofExample = `COMMAND     PID            USER   FD   TYPE             DEVICE SIZE/OFF NODE NAME
+Spotify   11778 danielmorandini  128u  IPv4 0x25c5bf09993eff03      0t0  TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)
+Spotify   11778 danielmorandini  129u  IPv4 0x25c5bf09993eff04      0t0  TCP *:57621 (LISTEN)
+Spotify   11778 danielmorandini  130u  IPv4 0x25c5bf09993eff05      0t0  UDP *:57621
+postgres    676 danielmorandini   10u  IPv6 0x25c5bf0997ca88e3      0t0  UDP [::1]:60051->[::1]:60051
+`
+
+func fixture() onf.Runtime {
+	return fixtureOutput(lsofExample)
+}
+
+func fixtureOutput(out string) onf.Runtime {
+	return onf.LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		return []byte(out), nil, nil
+	})}
+}
+
+func TestOpenNetFiles(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		pivot string
+		opts  []lookup.Option
+		n     int
+	}{
+		{onf.All, nil, 4},
+		{"Spotify", nil, 3},
+		{"Spotify", []lookup.Option{lookup.WithProtocol("tcp")}, 2},
+		{"Spotify", []lookup.Option{lookup.WithProtocol("tcp"), lookup.WithStates("listen")}, 1},
+		{onf.All, []lookup.Option{lookup.WithProtocol("udp")}, 2},
+		{onf.All, []lookup.Option{lookup.WithStates("established", "LISTEN")}, 2},
+	}
+	for i, v := range tt {
+		set, err := lookup.OpenNetFiles(v.pivot, append(v.opts, lookup.WithRuntime(fixture()))...)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if len(set) != v.n {
+			t.Fatalf("%d: Unexpected set length: wanted %d, found %d: %v", i, v.n, len(set), set)
+		}
+	}
+}
+
+func TestOpenNetFilesErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := lookup.OpenNetFiles(onf.All, lookup.WithProtocol("sctp"), lookup.WithRuntime(fixture())); err == nil {
+		t.Fatalf("Unexpected nil error with an unknown protocol")
+	}
+	if _, err := lookup.OpenNetFiles(onf.All, lookup.WithBackend("nope")); err == nil {
+		t.Fatalf("Unexpected nil error with an unknown backend")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := lookup.OpenNetFiles(onf.All, lookup.WithContext(ctx), lookup.WithRuntime(fixture())); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.Canceled, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+	files, errc := lookup.Stream(context.Background(), "Spotify", lookup.WithProtocol("tcp"), lookup.WithRuntime(fixture()))
+	var n int
+	for f := range files {
+		if f.Cmd != "Spotify" {
+			t.Fatalf("Unexpected open network file: %v", f)
+		}
+		n++
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("Unexpected number of open network files: wanted 2, found %d", n)
+	}
+
+	// Consumers giving up cancel the lookup.
+	ctx, cancel := context.WithCancel(context.Background())
+	files, errc = lookup.Stream(ctx, onf.All, lookup.WithRuntime(fixture()))
+	<-files
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.Canceled, err)
+	}
+
+	files, errc = lookup.Stream(context.Background(), onf.All, lookup.WithBackend("nope"))
+	if f, ok := <-files; ok {
+		t.Fatalf("Unexpected open network file with an unknown backend: %v", f)
+	}
+	if err := <-errc; err == nil {
+		t.Fatalf("Unexpected nil error with an unknown backend")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	lines := strings.Split(lsofExample, "\n")
+	outputs := []string{
+		lsofExample,
+		// The LISTEN and UDP sockets of Spotify are closed, the postgres
+		// one is left, and a connection is being established.
+		lines[0] + "\n" + lines[1] + "\n" + lines[4] + "\nSpotify   11778 danielmorandini  131u  IPv4 0x25c5bf09993eff06      0t0  TCP 192.168.0.61:51292->35.186.224.47:443 (SYN_SENT)\n",
+		lines[0] + "\n" + lines[1] + "\n" + lines[4] + "\nSpotify   11778 danielmorandini  131u  IPv4 0x25c5bf09993eff06      0t0  TCP 192.168.0.61:51292->35.186.224.47:443 (ESTABLISHED)\n",
+	}
+	var calls int
+	r := onf.LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		out := outputs[len(outputs)-1]
+		if calls < len(outputs) {
+			out = outputs[calls]
+		}
+		calls++
+		return []byte(out), nil, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var changes []onf.Change
+	err := lookup.Watch(ctx, "Spotify", time.Millisecond, func(c onf.Change) error {
+		changes = append(changes, c)
+		cancel()
+		return nil
+	}, lookup.WithStates("established"), lookup.WithRuntime(r))
+	if err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The closed sockets are not ESTABLISHED: the first change is not
+	// reported, the connection is once it reaches the state.
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	c := changes[0]
+	if len(c.Opened) != 1 || c.Opened[0].Src.String() != "192.168.0.61:51292" {
+		t.Fatalf("Unexpected opened files: %v", c.Opened)
+	}
+	if len(c.Closed) != 0 {
+		t.Fatalf("Unexpected closed files: %v", c.Closed)
+	}
+
+	err = lookup.Watch(context.Background(), onf.All, time.Millisecond, func(onf.Change) error {
+		t.Fatalf("Unexpected change with an unknown backend")
+		return nil
+	}, lookup.WithBackend("nope"))
+	if err == nil {
+		t.Fatalf("Unexpected nil error with an unknown backend")
+	}
+}
+
+// Not parallel, as it replaces the output of the standard logger.
+func TestParallelLookups(t *testing.T) {
+	var std bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+
+	const n = 32
+	logs := make([]bytes.Buffer, n)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// A line that cannot be decoded, logged as skipped.
+			bogus := fmt.Sprintf("bogus-%d\n", i)
+			opts := []lookup.Option{
+				lookup.WithRuntime(fixtureOutput(lsofExample + bogus)),
+				lookup.WithLogger(log.New(&logs[i], "", 0)),
+			}
+			if i%2 == 0 {
+				set, err := lookup.OpenNetFiles("Spotify|bogus", opts...)
+				if err == nil && len(set) != 3 {
+					err = fmt.Errorf("wanted 3 open network files, found %d", len(set))
+				}
+				errs <- err
+				return
+			}
+			files, errc := lookup.Stream(context.Background(), "Spotify|bogus", opts...)
+			var m int
+			for range files {
+				m++
+			}
+			err := <-errc
+			if err == nil && m != 3 {
+				err = fmt.Errorf("wanted 3 open network files, found %d", m)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := range logs {
+		out := logs[i].String()
+		if !strings.Contains(out, "Executing: lsof") || !strings.Contains(out, fmt.Sprintf("bogus-%d\"", i)) {
+			t.Fatalf("%d: Unexpected log: %q", i, out)
+		}
+		if c := strings.Count(out, "skipping"); c != 1 {
+			t.Fatalf("%d: Unexpected log, containing messages of other lookups: %q", i, out)
+		}
+	}
+	if std.Len() != 0 {
+		t.Fatalf("Unexpected output on the standard logger: %q", std.String())
+	}
+}
@@ -15,18 +15,17 @@
 package lsof
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jecoz/lsaddr/internal"
-	"gopkg.in/pipe.v2"
+	"github.com/jecoz/lsaddr/runner"
 )
 
 type OpenFile struct {
@@ -37,22 +36,55 @@ type OpenFile struct {
 	Fd      string
 	Type    string
 	Device  string
-	State   string   // (ENSTABLISHED), (LISTEN), ...
+	SizeOff string   // empty when lsof omits the SIZE/OFF column
+	Node    string   // protocol of the socket (TCP, UDP)
+	State   State    // ESTABLISHED, LISTEN, ... or NoState
 	SrcAddr net.Addr // Source address
 	DstAddr net.Addr // Destination address
 }
 
+// Run executes ``lsof -i -n -P'' using runner.Default, and parses
+// its output.
 func Run() ([]OpenFile, error) {
-	log.Printf("Executing: lsof -i -n -P")
-	p := pipe.Exec("lsof", "-i", "-n", "-P")
+	return RunWith(runner.Default)
+}
+
+// RunWith is the same as Run, but executes lsof using "r".
+func RunWith(r runner.Runner) ([]OpenFile, error) {
+	return RunMatchWith(r, nil)
+}
 
+// RunMatchWith is the same as RunWith, but only the lines for which
+// `match` returns true are decoded (see ParseOutputMatch).
+func RunMatchWith(r runner.Runner, match func(string) bool) ([]OpenFile, error) {
 	acc := []OpenFile{}
-	out, err := pipe.OutputTimeout(p, time.Millisecond*100)
+	err := ScanWith(r, match, func(v OpenFile) error {
+		acc = append(acc, v)
+		return nil
+	})
+	return acc, err
+}
+
+// ScanWith executes lsof using "r", calling `fn` with each line of
+// its output for which `match` returns true, as soon as it is decoded
+// (see ScanOutput).
+func ScanWith(r runner.Runner, match func(string) bool, fn func(OpenFile) error) error {
+	return ScanWithContext(context.Background(), r, match, fn)
+}
+
+// ScanWithContext is the same as ScanWith, but the execution is
+// aborted when `ctx` is done.
+func ScanWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(OpenFile) error) error {
+	l := internal.LoggerFrom(ctx)
+	l.Printf("Executing: lsof -i -n -P")
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+
+	out, _, err := r.Run(ctx, "lsof", "-i", "-n", "-P")
 	if err != nil {
-		return acc, fmt.Errorf("unable to run lsof: %w", err)
+		return fmt.Errorf("unable to run lsof: %w", err)
 	}
-	buf := bytes.NewBuffer(out)
-	return ParseOutput(buf)
+	return scanOutput(l, bytes.NewBuffer(out), match, fn)
 }
 
 // ParseOutput expects "r" to contain the output of
@@ -62,43 +94,69 @@ func Run() ([]OpenFile, error) {
 // Returns an error only if reading from "r" produces an error
 // different from ``io.EOF''.
 func ParseOutput(r io.Reader) ([]OpenFile, error) {
+	return ParseOutputMatch(r, nil)
+}
+
+// ParseOutputMatch is the same as ParseOutput, but lines for which
+// `match` returns false are skipped before being decoded, which saves
+// both time and memory when only a few lines are needed. A nil `match`
+// accepts every line.
+func ParseOutputMatch(r io.Reader, match func(string) bool) ([]OpenFile, error) {
 	set := []OpenFile{}
-	err := scanLines(r, func(line string) error {
-		of, err := ParseOpenFile(line)
-		if err != nil {
-			log.Printf("skipping open file \"%s\": %v", line, err)
-			return nil
-		}
-		set = append(set, *of)
+	err := ScanOutput(r, match, func(v OpenFile) error {
+		set = append(set, v)
 		return nil
 	})
 	return set, err
 }
 
-func scanLines(r io.Reader, f func(string) error) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.Trim(line, "\n")
-		line = strings.Trim(line, "\r")
-		if err := f(line); err != nil {
-			return err
+// ScanOutput is the same as ParseOutputMatch, but instead of being
+// accumulated, each decoded line is passed to `fn`, so that callers
+// processing one line at a time never hold the whole result in memory.
+// Scanning stops at the first error returned by `fn`.
+func ScanOutput(r io.Reader, match func(string) bool, fn func(OpenFile) error) error {
+	return scanOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(OpenFile) error) error {
+	return internal.ScanLines(r, func(line string) error {
+		if match != nil && !match(line) {
+			return nil
 		}
-	}
-	return scanner.Err()
+		of, err := ParseOpenFile(line)
+		if err != nil {
+			l.Printf("skipping open file \"%s\": %v", line, err)
+			return nil
+		}
+		return fn(*of)
+	})
 }
 
+// State is the state of a connection, as reported by lsof
+// without the surrounding parenthesis (i.e. ESTABLISHED, LISTEN).
+type State string
+
+// NoState is the State of the open files that do not report one,
+// such as UDP sockets.
+const NoState State = ""
+
 // ParseOpenFile expectes "line" to be a single line output from
 // ``lsof -i -n -P'' call. The line is unmarshaled into an ``OpenFile''
-// only if is splittable by " " into a slice of at least 9 items. "line" should
+// only if is splittable by " " into a slice of at least 8 items. "line" should
 // not end with a "\n" delimitator, otherwise it will end up in the last
 // unmarshaled item.
 //
+// The SIZE/OFF column is not always present, and neither is the
+// trailing STATE column (UDP sockets do not have one): fields are
+// located starting from the end of the line, and the state is recognised
+// by its surrounding parenthesis, so that a missing column never
+// shifts the others.
+//
 // "line" examples:
 // "postgres    676 danielmorandini   10u  IPv6 0x25c5bf0997ca88e3      0t0  UDP [::1]:60051->[::1]:60051"
 // "Dropbox     614 danielmorandini  247u  IPv4 0x25c5bf09a393d583      0t0  TCP 192.168.0.61:58282->162.125.18.133:https (ESTABLISHED)"
 func ParseOpenFile(line string) (*OpenFile, error) {
-	chunks, err := internal.ChunkLine(line, " ", 9)
+	chunks, err := internal.ChunkLine(line, " ", 8)
 	if err != nil {
 		return nil, err
 	}
@@ -115,16 +173,26 @@ func ParseOpenFile(line string) (*OpenFile, error) {
 		Fd:      chunks[3],
 		Type:    chunks[4],
 		Device:  chunks[5],
+		State:   NoState,
 	}
-	src, dst, err := ParseName(chunks[7], chunks[8])
+	n := len(chunks)
+	if last := chunks[n-1]; strings.HasPrefix(last, "(") && strings.HasSuffix(last, ")") {
+		of.State = State(strings.Trim(last, "()"))
+		n--
+	}
+	if n < 8 {
+		return nil, fmt.Errorf("unable to parse open file: expected at least 8 items before state, found %d", n)
+	}
+	src, dst, err := ParseName(chunks[n-2], chunks[n-1])
 	if err != nil {
 		return nil, fmt.Errorf("error parsing name: %w", err)
 	}
+	of.Node = chunks[n-2]
+	if n > 8 {
+		of.SizeOff = chunks[6]
+	}
 	of.SrcAddr = src
 	of.DstAddr = dst
-	if len(chunks) >= 10 {
-		of.State = chunks[9]
-	}
 
 	return of, nil
 }
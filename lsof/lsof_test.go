@@ -16,7 +16,11 @@ package lsof
 
 import (
 	"bytes"
+	"context"
+	"strings"
 	"testing"
+
+	"github.com/jecoz/lsaddr/runner"
 )
 
 func TestParseOpenFile(t *testing.T) {
@@ -34,9 +38,55 @@ func TestParseOpenFile(t *testing.T) {
 	assert(t, "128u", of.Fd)
 	assert(t, "IPv4", of.Type)
 	assert(t, "0x25c5bf09993eff03", of.Device)
+	assert(t, "0t0", of.SizeOff)
+	assert(t, "TCP", of.Node)
 	assert(t, "192.168.0.61:51291", of.SrcAddr.String())
 	assert(t, "35.186.224.47:443", of.DstAddr.String())
-	assert(t, "(ESTABLISHED)", of.State)
+	assert(t, State("ESTABLISHED"), of.State)
+}
+
+func TestParseOpenFile_Columns(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		line  string
+		node  string
+		src   string
+		dst   string
+		state State
+	}{
+		// 8 columns: no SIZE/OFF, no STATE.
+		{"rpcbind     1 root 6u IPv4 17000 UDP *:111", "udp", "*:111", "", NoState},
+		// 9 columns: no STATE.
+		{"postgres    676 danielmorandini   10u  IPv6 0x25c5bf0997ca88e3      0t0  UDP [::1]:60051->[::1]:60051", "udp", "[::1]:60051", "[::1]:60051", NoState},
+		// 9 columns: no SIZE/OFF.
+		{"sshd 812 root 3u IPv4 21450 TCP *:22 (LISTEN)", "tcp", "*:22", "", State("LISTEN")},
+		// 10 columns.
+		{"Dropbox     614 danielmorandini  247u  IPv4 0x25c5bf09a393d583      0t0  TCP 192.168.0.61:58282->162.125.18.133:443 (ESTABLISHED)", "tcp", "192.168.0.61:58282", "162.125.18.133:443", State("ESTABLISHED")},
+		{"nginx 1020 www 6u IPv6 0xabcdef 0t0 TCP [::1]:8080->[::1]:51000 (CLOSE_WAIT)", "tcp", "[::1]:8080", "[::1]:51000", State("CLOSE_WAIT")},
+	}
+
+	for i, v := range tt {
+		of, err := ParseOpenFile(v.line)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		assert(t, v.node, of.SrcAddr.Network())
+		assert(t, v.src, of.SrcAddr.String())
+		assert(t, v.dst, of.DstAddr.String())
+		assert(t, v.state, of.State)
+	}
+
+	invalid := []string{
+		"COMMAND     PID            USER   FD   TYPE             DEVICE SIZE/OFF NODE NAME",
+		"sshd 812 root 3u IPv4 TCP (LISTEN)",
+		"sshd 812 root 3u IPv4 21450 TCP *:22 (LISTEN) (LISTEN)",
+	}
+	for i, v := range invalid {
+		if _, err := ParseOpenFile(v); err == nil {
+			t.Fatalf("%d: expected an error parsing \"%s\"", i, v)
+		}
+	}
 }
 
 func assert(t *testing.T, exp, x interface{}) {
@@ -63,6 +113,37 @@ func TestParseOutput(t *testing.T) {
 	}
 }
 
+func TestParseOutputMatch(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(lsofExample)
+	onfset, err := ParseOutputMatch(buf, func(line string) bool {
+		return strings.HasPrefix(line, "postgres")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(onfset) != 1 || onfset[0].Command != "postgres" {
+		t.Fatalf("Unexpected onfset: %v", onfset)
+	}
+}
+
+func TestRunWith(t *testing.T) {
+	t.Parallel()
+
+	var cmd string
+	r := runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		cmd = strings.Join(append([]string{name}, args...), " ")
+		return []byte(lsofExample), nil, nil
+	})
+	set, err := RunWith(r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, "lsof -i -n -P", cmd)
+	assert(t, 3, len(set))
+}
+
 func TestParseName(t *testing.T) {
 	t.Parallel()
 
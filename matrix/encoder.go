@@ -0,0 +1,99 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package matrix encodes open network files as a command × destination
+// host matrix in CSV format, showing which applications share the same
+// endpoints, such as third-party services common to a portfolio.
+package matrix
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes a header with the destination hosts, followed by one
+// row per command counting its connections to each of them.
+type Encoder struct {
+	w      io.Writer
+	shared bool
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "shared": "true" keeps only the hosts connected to by at least
+// two commands.
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "shared":
+			shared, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid shared option %q: %w", v, err)
+			}
+			e.shared = shared
+		default:
+			return nil, fmt.Errorf("unknown matrix option %q", k)
+		}
+	}
+	return e, nil
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	m := aggr.NewMatrix(set)
+	var cols []int
+	for j := range m.Hosts {
+		if !e.shared || m.Shared(j) > 1 {
+			cols = append(cols, j)
+		}
+	}
+
+	w := csv.NewWriter(e.w)
+	header := []string{"CMD"}
+	for _, j := range cols {
+		header = append(header, m.Hosts[j])
+	}
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	for i, cmd := range m.Cmds {
+		row := []string{cmd}
+		var n int
+		for _, j := range cols {
+			row = append(row, strconv.Itoa(m.Conns[i][j]))
+			n += m.Conns[i][j]
+		}
+		if n == 0 {
+			// Commands connected to none of the hosts kept.
+			continue
+		}
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("unable to encode open network files: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package matrix_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/matrix"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "104.199.65.124:4070")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "ssh", Src: internal.NewAddr("tcp", "10.0.0.2:5003"), Dst: internal.NewAddr("tcp", "192.168.0.1:22")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+	}
+	tt := []struct {
+		opts map[string]string
+		want string
+	}{
+		{nil, "CMD,35.186.224.47,104.199.65.124,192.168.0.1\nSpotify,1,1,0\ncurl,1,0,0\nssh,0,0,1\n"},
+		{map[string]string{"shared": "true"}, "CMD,35.186.224.47\nSpotify,1\ncurl,1\n"},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		e, err := matrix.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := e.Encode(set); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("%d: Unexpected output: wanted %q, found %q", i, v.want, b.String())
+		}
+	}
+	if _, err := matrix.NewEncoderOptions(&bytes.Buffer{}, map[string]string{"shared": "maybe"}); err == nil {
+		t.Fatalf("Unexpected nil error with an invalid option")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mermaid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder encodes a list of open network files into a Mermaid
+// flowchart, linking each process to the destination hosts it is
+// connected to.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "flowchart LR")
+
+	procs := make(map[int]bool)
+	hosts := make(map[string]string) // host -> node id
+	edges := make(map[string]bool)
+	for _, v := range set {
+		host, ok := aggr.DstHost(v)
+		if !ok {
+			continue
+		}
+		pid := "p" + strconv.Itoa(v.Pid)
+		if !procs[v.Pid] {
+			procs[v.Pid] = true
+			fmt.Fprintf(w, "    %s[\"%s\"]\n", pid, escape(procLabel(v)))
+		}
+		dst, ok := hosts[host]
+		if !ok {
+			dst = "h" + strconv.Itoa(len(hosts))
+			hosts[host] = dst
+			fmt.Fprintf(w, "    %s[\"%s\"]\n", dst, escape(hostLabel(host, v.DstName)))
+		}
+		if edge := pid + " --> " + dst; !edges[edge] {
+			edges[edge] = true
+			fmt.Fprintf(w, "    %s\n", edge)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+func procLabel(f onf.ONF) string {
+	if f.Cmd == "" {
+		return "pid " + strconv.Itoa(f.Pid)
+	}
+	return fmt.Sprintf("%s (%d)", f.Cmd, f.Pid)
+}
+
+func hostLabel(host, name string) string {
+	if name == "" {
+		return host
+	}
+	return fmt.Sprintf("%s (%s)", name, host)
+}
+
+// escape replaces the characters that would break a quoted
+// Mermaid label with their entity codes.
+func escape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;").Replace(s)
+}
@@ -0,0 +1,51 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package mermaid_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/mermaid"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:80")},
+		{Cmd: "", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "sshd", Pid: 3, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "")},
+	}
+	set[0].DstName = "spotify.com"
+
+	var w strings.Builder
+	if err := mermaid.NewEncoder(&w).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exp := `flowchart LR
+    p1["Spotify (1)"]
+    h0["spotify.com (35.186.224.47)"]
+    p1 --> h0
+    p2["pid 2"]
+    p2 --> h0
+`
+	if w.String() != exp {
+		t.Fatalf("Unexpected output: wanted\n\"%s\",\nfound\n\"%s\"", exp, w.String())
+	}
+}
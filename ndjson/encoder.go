@@ -0,0 +1,143 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ndjson encodes open network files as newline-delimited
+// JSON, one object per line, as expected by most log-shipping
+// pipelines. Objects follow the representation of onf.ONF.MarshalJSON,
+// unless they are flattened or projected (see NewEncoderOptions), and
+// report the version of that representation in their "schema_version"
+// field.
+package ndjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes each open network file on its own line. It does not
+// buffer: each line is written to the underlying writer as soon as it
+// is encoded.
+type Encoder struct {
+	w       io.Writer
+	enc     *json.Encoder
+	version int
+	flatten bool
+	fields  []Pointer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, enc: json.NewEncoder(w), version: onf.SchemaVersion}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`, meant
+// for consumers with rigid schemas. Supported options are:
+// - "flatten": "true" removes nested objects, joining their keys with
+// "_" (i.e. "dst_ip" and "dst_port" instead of a "dst" object).
+// - "fields": comma separated list of JSON pointers (i.e. "/cmd,/dst/addr",
+// or "/cmd,/dst_ip" when flattened) selecting the values written.
+// - "schema_version": version of the representation written, between 1
+// and onf.SchemaVersion (the default), so that consumers can pin the
+// one they were written against while fields are renamed (see
+// onf.SchemaChanges).
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "flatten":
+			flatten, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid flatten option %q: %w", v, err)
+			}
+			e.flatten = flatten
+		case "fields":
+			for _, s := range strings.Split(v, ",") {
+				p, err := ParsePointer(strings.TrimSpace(s))
+				if err != nil {
+					return nil, err
+				}
+				e.fields = append(e.fields, p)
+			}
+		case "schema_version":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > onf.SchemaVersion {
+				return nil, fmt.Errorf("unsupported schema version %q (available: 1 to %d)", v, onf.SchemaVersion)
+			}
+			e.version = n
+		default:
+			return nil, fmt.Errorf("unknown ndjson option %q", k)
+		}
+	}
+	return e, nil
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	for _, v := range set {
+		if err := e.EncodeONF(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeONF writes a single open network file, so that results can be
+// encoded while they are still being collected (see onf.Each).
+func (e *Encoder) EncodeONF(f onf.ONF) error {
+	if !e.flatten && len(e.fields) == 0 {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("unable to encode open network file: %w", err)
+		}
+		// The version is spliced in as the first field, preserving
+		// the order of the others.
+		line := fmt.Sprintf("{\"schema_version\":%d,%s\n", e.version, data[1:])
+		if _, err := io.WriteString(e.w, line); err != nil {
+			return fmt.Errorf("unable to encode open network file: %w", err)
+		}
+		return nil
+	}
+	doc, err := document(f)
+	if err != nil {
+		return fmt.Errorf("unable to encode open network file: %w", err)
+	}
+	doc["schema_version"] = e.version
+	if e.flatten {
+		doc = flatten(doc)
+	}
+	if len(e.fields) > 0 {
+		doc = project(doc, e.fields)
+	}
+	if err := e.enc.Encode(doc); err != nil {
+		return fmt.Errorf("unable to encode open network file: %w", err)
+	}
+	return nil
+}
+
+// document returns the JSON representation of `f` as a generic object.
+func document(f onf.ONF) (map[string]interface{}, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,108 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ndjson_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/ndjson"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	set := []onf.ONF{
+		{Raw: "Spotify 11778 jecoz 128u IPv4 0x1 0t0 TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)", Cmd: "Spotify", Pid: 11778, Src: internal.NewAddr("tcp", "192.168.0.61:51291"), Dst: internal.NewAddr("tcp", "35.186.224.47:443"), State: "ESTABLISHED", CreatedAt: now},
+		{Cmd: "mDNSResponder", Pid: 188, Src: internal.NewAddr("udp", "*:5353"), CreatedAt: now},
+	}
+	var b bytes.Buffer
+	if err := ndjson.NewEncoder(&b).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	s := bufio.NewScanner(&b)
+	var i int
+	for ; s.Scan(); i++ {
+		var f onf.ONF
+		if err := json.Unmarshal(s.Bytes(), &f); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if f.String() != set[i].String() || f.Raw != set[i].Raw {
+			t.Fatalf("%d: unexpected open network file: wanted %v, found %v", i, set[i], f)
+		}
+		var envelope struct {
+			SchemaVersion int `json:"schema_version"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &envelope); err != nil || envelope.SchemaVersion != onf.SchemaVersion {
+			t.Fatalf("%d: unexpected schema version: wanted %d, found %d (%v)", i, onf.SchemaVersion, envelope.SchemaVersion, err)
+		}
+	}
+	if i != len(set) {
+		t.Fatalf("Unexpected number of lines: wanted %d, found %d", len(set), i)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	t.Parallel()
+	f := onf.ONF{
+		Cmd:   "Spotify",
+		Pid:   11778,
+		Src:   internal.NewAddr("tcp", "192.168.0.61:51291"),
+		Dst:   internal.NewAddr("tcp", "35.186.224.47:443"),
+		State: "ESTABLISHED",
+	}
+	tt := []struct {
+		opts map[string]string
+		want string
+	}{
+		{map[string]string{"fields": "/cmd,/dst/addr,/missing"}, `{"cmd":"Spotify","dst":{"addr":"35.186.224.47:443"}}`},
+		{map[string]string{"flatten": "true", "fields": "/pid, /dst_ip,/dst_port"}, `{"dst_ip":"35.186.224.47","dst_port":443,"pid":11778}`},
+		{map[string]string{"flatten": "true", "fields": "/src_net,/src_port,/state"}, `{"src_net":"tcp","src_port":51291,"state":"ESTABLISHED"}`},
+		{map[string]string{"schema_version": "1", "fields": "/schema_version,/pid"}, `{"pid":11778,"schema_version":1}`},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		enc, err := ndjson.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if err := enc.EncodeONF(f); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if b.String() != v.want+"\n" {
+			t.Fatalf("%d: unexpected output: wanted %s, found %s", i, v.want, b.String())
+		}
+	}
+
+	invalid := []map[string]string{
+		{"flatten": "maybe"},
+		{"fields": "cmd"},
+		{"indent": "2"},
+		{"schema_version": "0"},
+		{"schema_version": "latest"},
+	}
+	for i, v := range invalid {
+		if _, err := ndjson.NewEncoderOptions(&bytes.Buffer{}, v); err == nil {
+			t.Fatalf("%d: expected an error with options %v", i, v)
+		}
+	}
+}
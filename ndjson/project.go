@@ -0,0 +1,136 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ndjson
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Pointer is a parsed JSON pointer (RFC 6901), such as "/dst/addr".
+type Pointer []string
+
+// ParsePointer parses `s`, which must either be empty (the whole
+// document) or start with "/".
+func ParsePointer(s string) (Pointer, error) {
+	if s == "" {
+		return Pointer{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must start with \"/\"", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, v := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(v)
+	}
+	return Pointer(tokens), nil
+}
+
+// get returns the value `p` points to in `doc`.
+func (p Pointer) get(doc map[string]interface{}) (interface{}, bool) {
+	var v interface{} = doc
+	for _, t := range p {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[t]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// set stores `v` at the location `p` points to in `doc`, creating the
+// intermediate objects.
+func (p Pointer) set(doc map[string]interface{}, v interface{}) {
+	m := doc
+	for _, t := range p[:len(p)-1] {
+		next, ok := m[t].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[t] = next
+		}
+		m = next
+	}
+	m[p[len(p)-1]] = v
+}
+
+// project returns a document containing only the values of `doc`
+// pointed to by `fields`, at the same location. Pointers to missing
+// values are ignored.
+func project(doc map[string]interface{}, fields []Pointer) map[string]interface{} {
+	acc := make(map[string]interface{})
+	for _, p := range fields {
+		if len(p) == 0 {
+			return doc
+		}
+		if v, ok := p.get(doc); ok {
+			p.set(acc, v)
+		}
+	}
+	return acc
+}
+
+// flatten returns a document without nested objects: the keys of
+// nested values are joined with "_". Address objects ("src" and "dst")
+// have their "addr" split into "ip" and "port", so that they become,
+// for example, "dst_ip" and "dst_port".
+func flatten(doc map[string]interface{}) map[string]interface{} {
+	acc := make(map[string]interface{})
+	for _, k := range []string{"src", "dst"} {
+		if m, ok := doc[k].(map[string]interface{}); ok {
+			splitAddr(m)
+		}
+	}
+	flattenInto(acc, "", doc)
+	return acc
+}
+
+func flattenInto(acc map[string]interface{}, prefix string, doc map[string]interface{}) {
+	for k, v := range doc {
+		if prefix != "" {
+			k = prefix + "_" + k
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenInto(acc, k, m)
+			continue
+		}
+		acc[k] = v
+	}
+}
+
+// splitAddr replaces the "addr" key of `m` with "ip" and "port". The
+// port is a number, unless it is a wildcard.
+func splitAddr(m map[string]interface{}) {
+	addr, ok := m["addr"].(string)
+	if !ok {
+		return
+	}
+	delete(m, "addr")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	m["ip"] = host
+	if n, err := strconv.Atoi(port); err == nil {
+		m["port"] = n
+	} else {
+		m["port"] = port
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ndjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in   string
+		want Pointer
+	}{
+		{"", Pointer{}},
+		{"/dst/addr", Pointer{"dst", "addr"}},
+		{"/a~1b/c~0d", Pointer{"a/b", "c~d"}},
+	}
+	for i, v := range tt {
+		p, err := ParsePointer(v.in)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(v.want, p) {
+			t.Fatalf("%d: unexpected pointer: wanted %v, found %v", i, v.want, p)
+		}
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	doc := map[string]interface{}{
+		"cmd": "sshd",
+		"src": map[string]interface{}{"net": "tcp", "addr": "*:22"},
+		"dst": map[string]interface{}{"net": "tcp", "addr": ""},
+		"exe": map[string]interface{}{"path": "/usr/sbin/sshd"},
+	}
+	want := map[string]interface{}{
+		"cmd":      "sshd",
+		"src_net":  "tcp",
+		"src_ip":   "*",
+		"src_port": 22,
+		"dst_net":  "tcp",
+		"exe_path": "/usr/sbin/sshd",
+	}
+	if found := flatten(doc); !reflect.DeepEqual(want, found) {
+		t.Fatalf("Unexpected document: wanted %v, found %v", want, found)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package netstat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// ScanDarwinWith executes ``netstat -anvW'', the macOS flavour of
+// netstat which reports the pid owning each socket, using "r", calling
+// `fn` with each internet socket of its output whose line is accepted
+// by `match`, as soon as it is decoded (see ScanDarwinOutput).
+func ScanDarwinWith(r runner.Runner, match func(string) bool, fn func(ActiveConnection) error) error {
+	return ScanDarwinWithContext(context.Background(), r, match, fn)
+}
+
+// ScanDarwinWithContext is the same as ScanDarwinWith, but the
+// execution is aborted when `ctx` is done.
+func ScanDarwinWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(ActiveConnection) error) error {
+	l := internal.LoggerFrom(ctx)
+	l.Printf("Executing: netstat -anvW")
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	out, _, err := r.Run(ctx, "netstat", "-anvW")
+	if err != nil {
+		return fmt.Errorf("unable to run netstat: %w", err)
+	}
+	return scanDarwinOutput(l, bytes.NewBuffer(out), match, fn)
+}
+
+// ParseDarwinOutput expects "r" to contain the output of a ``netstat
+// -anvW'' call on macOS, returning the internet sockets it lists. The
+// other lines, such as headers and unix domain sockets, are skipped.
+func ParseDarwinOutput(r io.Reader) ([]ActiveConnection, error) {
+	set := []ActiveConnection{}
+	err := ScanDarwinOutput(r, nil, func(v ActiveConnection) error {
+		set = append(set, v)
+		return nil
+	})
+	return set, err
+}
+
+// ScanDarwinOutput is the same as ParseDarwinOutput, but lines for
+// which `match` returns false are skipped before being decoded, and
+// each decoded line is passed to `fn` instead of being accumulated. A
+// nil `match` accepts every line. Scanning stops at the first error
+// returned by `fn`.
+//
+// The columns following the state depend on the version of macOS: the
+// pid is found using the header, and recent versions report it
+// together with the process name ("process:pid").
+func ScanDarwinOutput(r io.Reader, match func(string) bool, fn func(ActiveConnection) error) error {
+	return scanDarwinOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanDarwinOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(ActiveConnection) error) error {
+	// Index of the pid in the columns following the state, as
+	// reported by versions of macOS printing no byte counters.
+	pidCol := 2
+	return internal.ScanLines(r, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil
+		}
+		if fields[0] == "Proto" {
+			if i := darwinPidColumn(fields); i >= 0 {
+				pidCol = i
+			}
+			return nil
+		}
+		if !strings.HasPrefix(fields[0], "tcp") && !strings.HasPrefix(fields[0], "udp") {
+			return nil
+		}
+		if match != nil && !match(line) {
+			return nil
+		}
+		ac, err := parseDarwinSocket(line, fields, pidCol)
+		if err != nil {
+			l.Printf("skipping netstat socket \"%s\": %v", line, err)
+			return nil
+		}
+		return fn(*ac)
+	})
+}
+
+// darwinPidColumn returns the index of the pid among the columns of
+// header `fields` following "(state)", or -1.
+func darwinPidColumn(fields []string) int {
+	state := -1
+	for i, v := range fields {
+		switch {
+		case v == "(state)":
+			state = i
+		case state >= 0 && (v == "pid" || v == "process:pid"):
+			return i - state - 1
+		}
+	}
+	return -1
+}
+
+// parseDarwinSocket decodes `line`, split into `fields`. UDP sockets
+// have no state, hence their columns are shifted.
+//
+// "line" examples:
+// "tcp4       0      0  192.168.0.61.51291     35.186.224.47.443      ESTABLISHED 131072 131768  11778      0 0x0102 0x00000008"
+// "udp4       0      0  *.57621                *.*                                786896   9216  11778      0 0x0000 0x00000000"
+func parseDarwinSocket(line string, fields []string, pidCol int) (*ActiveConnection, error) {
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("unable to decode line: expected at least 5 columns, found %d", len(fields))
+	}
+	ac := &ActiveConnection{Raw: line, Proto: fields[0]}
+	rest := fields[5:]
+	if strings.HasPrefix(ac.Proto, "tcp") {
+		if len(rest) == 0 {
+			return nil, fmt.Errorf("missing state")
+		}
+		ac.State, rest = rest[0], rest[1:]
+	}
+	if pidCol >= len(rest) {
+		return nil, fmt.Errorf("missing pid")
+	}
+	// Process names may contain spaces, spanning several columns
+	// up to the one ending with ":<pid>".
+	pid := rest[pidCol]
+	for i := pidCol; i < len(rest); i++ {
+		if j := strings.LastIndex(rest[i], ":"); j >= 0 {
+			name := strings.Join(rest[pidCol:i+1], " ")
+			ac.Command, pid = name[:len(name)-len(rest[i])+j], rest[i][j+1:]
+			break
+		}
+		if _, err := strconv.Atoi(rest[i]); err == nil {
+			break
+		}
+	}
+	var err error
+	if ac.Pid, err = strconv.Atoi(pid); err != nil {
+		return nil, fmt.Errorf("error parsing pid: %w", err)
+	}
+	network := strings.TrimRight(ac.Proto, "46")
+	if ac.SrcAddr, err = parseDarwinAddr(network, fields[3]); err != nil {
+		return nil, fmt.Errorf("error parsing local address: %w", err)
+	}
+	if ac.DstAddr, err = parseDarwinAddr(network, fields[4]); err != nil {
+		return nil, fmt.Errorf("error parsing foreign address: %w", err)
+	}
+	return ac, nil
+}
+
+// parseDarwinAddr parses an address as printed by macOS netstat, that
+// separates the port with a dot (i.e. "192.168.0.61.51291",
+// "fe80::1%lo0.5353"). Wildcard foreign addresses ("*.*") are returned
+// as empty addresses.
+func parseDarwinAddr(network, addr string) (net.Addr, error) {
+	i := strings.LastIndex(addr, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("missing port in address %s", addr)
+	}
+	host, port := addr[:i], addr[i+1:]
+	if port == "*" {
+		return internal.NewAddr(network, ""), nil
+	}
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j]
+	}
+	if host == "*" {
+		return internal.ParseNetAddr(network, "*:"+port)
+	}
+	return internal.ParseNetAddr(network, net.JoinHostPort(host, port))
+}
@@ -16,15 +16,15 @@ package netstat
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"strconv"
 	"time"
 
 	"github.com/jecoz/lsaddr/internal"
-	"gopkg.in/pipe.v2"
+	"github.com/jecoz/lsaddr/runner"
 )
 
 type ActiveConnection struct {
@@ -34,19 +34,51 @@ type ActiveConnection struct {
 	DstAddr net.Addr
 	State   string
 	Pid     int
+	Command string // only reported by recent versions of macOS
 }
 
+// Run executes ``netstat -nao'' using runner.Default, and parses
+// its output.
 func Run() ([]ActiveConnection, error) {
-	log.Printf("Executing: netstat -nao")
-	p := pipe.Exec("netstat", "-nao")
+	return RunWith(runner.Default)
+}
+
+// RunWith is the same as Run, but executes netstat using "r".
+func RunWith(r runner.Runner) ([]ActiveConnection, error) {
+	return RunMatchWith(r, nil)
+}
 
+// RunMatchWith is the same as RunWith, but only the lines for which
+// `match` returns true are decoded (see ParseOutputMatch).
+func RunMatchWith(r runner.Runner, match func(string) bool) ([]ActiveConnection, error) {
 	acc := []ActiveConnection{}
-	out, err := pipe.OutputTimeout(p, time.Millisecond*100)
+	err := ScanWith(r, match, func(v ActiveConnection) error {
+		acc = append(acc, v)
+		return nil
+	})
+	return acc, err
+}
+
+// ScanWith executes netstat using "r", calling `fn` with each line of
+// its output for which `match` returns true, as soon as it is decoded
+// (see ScanOutput).
+func ScanWith(r runner.Runner, match func(string) bool, fn func(ActiveConnection) error) error {
+	return ScanWithContext(context.Background(), r, match, fn)
+}
+
+// ScanWithContext is the same as ScanWith, but the execution is
+// aborted when `ctx` is done.
+func ScanWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(ActiveConnection) error) error {
+	l := internal.LoggerFrom(ctx)
+	l.Printf("Executing: netstat -nao")
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+
+	out, _, err := r.Run(ctx, "netstat", "-nao")
 	if err != nil {
-		return acc, fmt.Errorf("unable to run netstat: %w", err)
+		return fmt.Errorf("unable to run netstat: %w", err)
 	}
-	buf := bytes.NewBuffer(out)
-	return ParseOutput(buf)
+	return scanOutput(l, bytes.NewBuffer(out), match, fn)
 }
 
 // ParseOutput expects "r" to contain the output of
@@ -56,17 +88,41 @@ func Run() ([]ActiveConnection, error) {
 // Returns an error only if reading from "r" produces an error
 // different from ``io.EOF''.
 func ParseOutput(r io.Reader) ([]ActiveConnection, error) {
+	return ParseOutputMatch(r, nil)
+}
+
+// ParseOutputMatch is the same as ParseOutput, but lines for which
+// `match` returns false are skipped before being decoded. A nil
+// `match` accepts every line.
+func ParseOutputMatch(r io.Reader, match func(string) bool) ([]ActiveConnection, error) {
 	set := []ActiveConnection{}
-	err := internal.ScanLines(r, func(line string) error {
+	err := ScanOutput(r, match, func(v ActiveConnection) error {
+		set = append(set, v)
+		return nil
+	})
+	return set, err
+}
+
+// ScanOutput is the same as ParseOutputMatch, but instead of being
+// accumulated, each decoded line is passed to `fn`, so that callers
+// processing one line at a time never hold the whole result in memory.
+// Scanning stops at the first error returned by `fn`.
+func ScanOutput(r io.Reader, match func(string) bool, fn func(ActiveConnection) error) error {
+	return scanOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(ActiveConnection) error) error {
+	return internal.ScanLines(r, func(line string) error {
+		if match != nil && !match(line) {
+			return nil
+		}
 		af, err := ParseActiveConnection(line)
 		if err != nil {
-			log.Printf("skipping netstat active connection \"%s\": %v", line, err)
+			l.Printf("skipping netstat active connection \"%s\": %v", line, err)
 			return nil
 		}
-		set = append(set, *af)
-		return nil
+		return fn(*af)
 	})
-	return set, err
 }
 
 // ParseActiveConnection expectes "line" to be a single line output from
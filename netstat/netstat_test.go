@@ -67,3 +67,52 @@ func assert(t *testing.T, exp, x interface{}) {
 		t.Fatalf("Assert failed: expected %v, found %v", exp, x)
 	}
 }
+
+const darwinExample = `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)     rhiwat shiwat    pid   epid  state    options
+tcp4       0      0  192.168.0.61.51291     35.186.224.47.443      ESTABLISHED 131072 131768  11778      0 0x0102 0x00000008
+tcp46      0      0  *.57621                *.*                    LISTEN      131072 131072  11778      0 0x0100 0x00000006
+udp4       0      0  *.57621                *.*                                786896   9216  11778      0 0x0000 0x00000000
+Active LOCAL (UNIX) domain sockets
+Address          Type   Recv-Q Send-Q            Inode             Conn             Refs          Nextref Addr
+ffffff8012345678 stream      0      0                0 ffffff8012345679                0                0
+`
+
+const darwinProcessExample = `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)       rxbytes      txbytes  rhiwat  shiwat    process:pid   state  options           gencnt    flags   flags1 usscnt rtncnt fltrs
+tcp6       0      0  fe80::1%lo0.49152      fe80::1%lo0.631        ESTABLISHED      1423         5231  131072  131768  Google Chrome H:4312 00102 00000008 000000000008d6f5 00000080 01000900      1      0 000001
+udp4       0      0  *.5353                 *.*                                  12345            0  786896    9216  mDNSResponder:188 00000 00000000 000000000000001a 00000000 00000800      1      0 000000
+`
+
+func TestParseDarwinOutput(t *testing.T) {
+	t.Parallel()
+	ll, err := ParseDarwinOutput(bytes.NewBufferString(darwinExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ll) != 3 {
+		t.Fatalf("Unexpected ll length: wanted 3, found %d: %v", len(ll), ll)
+	}
+	assert(t, "192.168.0.61:51291", ll[0].SrcAddr.String())
+	assert(t, "35.186.224.47:443", ll[0].DstAddr.String())
+	assert(t, "ESTABLISHED", ll[0].State)
+	assert(t, 11778, ll[0].Pid)
+	assert(t, "*:57621", ll[1].SrcAddr.String())
+	assert(t, "", ll[1].DstAddr.String())
+	assert(t, "", ll[2].State)
+	assert(t, 11778, ll[2].Pid)
+	assert(t, "udp", ll[2].SrcAddr.Network())
+
+	ll, err = ParseDarwinOutput(bytes.NewBufferString(darwinProcessExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ll) != 2 {
+		t.Fatalf("Unexpected ll length: wanted 2, found %d: %v", len(ll), ll)
+	}
+	assert(t, "[fe80::1]:49152", ll[0].SrcAddr.String())
+	assert(t, "Google Chrome H", ll[0].Command)
+	assert(t, 4312, ll[0].Pid)
+	assert(t, "mDNSResponder", ll[1].Command)
+	assert(t, 188, ll[1].Pid)
+}
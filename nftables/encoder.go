@@ -0,0 +1,149 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package nftables encodes the destinations of open network files into
+// an nft script, defining a named set of destination addresses and a
+// rule matching it, so that the traffic of an application can be
+// allowed, or blocked, with the modern Linux firewall.
+package nftables
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes a table containing the destination addresses, one set
+// for each address family, and an output chain applying the verdict to
+// the traffic headed to them. Each address is commented with the
+// commands connected to it.
+type Encoder struct {
+	w       io.Writer
+	table   string
+	set     string
+	verdict string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, table: "lsaddr", set: "dsts", verdict: "accept"}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "table": name of the table, "lsaddr" by default.
+// - "set": name of the set of IPv4 addresses, "dsts" by default. IPv6
+// addresses are collected in "<set>6".
+// - "verdict": "accept" (the default), "drop" or "reject".
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "table":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid table %q", v)
+			}
+			e.table = v
+		case "set":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid set %q", v)
+			}
+			e.set = v
+		case "verdict":
+			switch v = strings.ToLower(v); v {
+			case "accept", "drop", "reject":
+				e.verdict = v
+			default:
+				return nil, fmt.Errorf("invalid verdict %q: expected accept, drop or reject", v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown nftables option %q", k)
+		}
+	}
+	return e, nil
+}
+
+// validName reports whether `s` is a valid nft identifier.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_' || r == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	var v4, v6 []aggr.Host
+	for _, v := range aggr.Hosts(set) {
+		if v.IPv6() {
+			v6 = append(v6, v)
+		} else {
+			v4 = append(v4, v)
+		}
+	}
+
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "#!/usr/sbin/nft -f")
+	fmt.Fprintf(w, "table inet %s {\n", e.table)
+	writeSet(w, e.set, "ipv4_addr", v4)
+	writeSet(w, e.set+"6", "ipv6_addr", v6)
+	fmt.Fprintln(w, "\tchain output {")
+	fmt.Fprintln(w, "\t\ttype filter hook output priority 0; policy accept;")
+	if len(v4) > 0 {
+		fmt.Fprintf(w, "\t\tip daddr @%s %s\n", e.set, e.verdict)
+	}
+	if len(v6) > 0 {
+		fmt.Fprintf(w, "\t\tip6 daddr @%s6 %s\n", e.set, e.verdict)
+	}
+	fmt.Fprintln(w, "\t}")
+	fmt.Fprintln(w, "}")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// writeSet writes the definition of set `name`, of `typ`, containing
+// `hosts`. Nothing is written when `hosts` is empty.
+func writeSet(w io.Writer, name, typ string, hosts []aggr.Host) {
+	if len(hosts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\tset %s {\n", name)
+	fmt.Fprintf(w, "\t\ttype %s\n", typ)
+	fmt.Fprintln(w, "\t\telements = {")
+	for i, v := range hosts {
+		sep := ","
+		if i == len(hosts)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(w, "\t\t\t%s%s", v.IP, sep)
+		if len(v.Cmds) > 0 {
+			fmt.Fprintf(w, " # %s", strings.Join(v.Cmds, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "\t\t}")
+	fmt.Fprintln(w, "\t}")
+}
@@ -0,0 +1,111 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package nftables_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/nftables"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:80")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Cmd: "ping", Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "10.0.0.1:*")},
+		{Cmd: "dig", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+		// Command names are chosen by the processes.
+		{Cmd: "x\nflush ruleset", Src: internal.NewAddr("udp6", "[::1]:5354"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+	}
+	tt := []struct {
+		opts map[string]string
+		want string
+	}{
+		{nil, `#!/usr/sbin/nft -f
+table inet lsaddr {
+	set dsts {
+		type ipv4_addr
+		elements = {
+			35.186.224.47, # Spotify, curl
+			10.0.0.1 # ping
+		}
+	}
+	set dsts6 {
+		type ipv6_addr
+		elements = {
+			2001:db8::1 # dig, x?flush ruleset
+		}
+	}
+	chain output {
+		type filter hook output priority 0; policy accept;
+		ip daddr @dsts accept
+		ip6 daddr @dsts6 accept
+	}
+}
+`},
+		{map[string]string{"table": "filter", "set": "spotify", "verdict": "DROP"}, `#!/usr/sbin/nft -f
+table inet filter {
+	set spotify {
+		type ipv4_addr
+		elements = {
+			35.186.224.47, # Spotify, curl
+			10.0.0.1 # ping
+		}
+	}
+	set spotify6 {
+		type ipv6_addr
+		elements = {
+			2001:db8::1 # dig, x?flush ruleset
+		}
+	}
+	chain output {
+		type filter hook output priority 0; policy accept;
+		ip daddr @spotify drop
+		ip6 daddr @spotify6 drop
+	}
+}
+`},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		e, err := nftables.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := e.Encode(set); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("%d: Unexpected output: wanted %q, found %q", i, v.want, b.String())
+		}
+	}
+
+	invalid := []map[string]string{
+		{"verdict": "allow"},
+		{"table": "my table"},
+		{"set": "1dsts"},
+		{"family": "ip"},
+	}
+	for i, v := range invalid {
+		if _, err := nftables.NewEncoderOptions(&bytes.Buffer{}, v); err == nil {
+			t.Fatalf("%d: Unexpected nil error with options %v", i, v)
+		}
+	}
+}
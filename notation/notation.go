@@ -0,0 +1,139 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package notation formats addresses in alternative notations, for
+// integration with systems that ingest unusual formats (DNS RPZ
+// generators, legacy databases).
+package notation
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Notation identifies an address notation.
+type Notation string
+
+// Supported notations.
+const (
+	Default Notation = ""       // as reported by the backend
+	Padded  Notation = "padded" // zero-padded, i.e. 010.000.000.001 or fully expanded IPv6
+	Int     Notation = "int"    // decimal integer
+	Hex     Notation = "hex"    // hexadecimal integer, 0x prefixed
+	Arpa    Notation = "arpa"   // reverse DNS name, ports are dropped
+)
+
+// Parse returns the Notation identified by `s`.
+func Parse(s string) (Notation, error) {
+	switch n := Notation(strings.ToLower(s)); n {
+	case Default, "default":
+		return Default, nil
+	case Padded, Int, Hex, Arpa:
+		return n, nil
+	default:
+		return Default, fmt.Errorf("unrecognised address notation %s", s)
+	}
+}
+
+// FormatIP returns `ip` in notation `n`.
+func FormatIP(ip net.IP, n Notation) string {
+	v4 := ip.To4()
+	switch n {
+	case Padded:
+		if v4 != nil {
+			return fmt.Sprintf("%03d.%03d.%03d.%03d", v4[0], v4[1], v4[2], v4[3])
+		}
+		groups := make([]string, 0, 8)
+		for i := 0; i < net.IPv6len; i += 2 {
+			groups = append(groups, hex.EncodeToString(ip[i:i+2]))
+		}
+		return strings.Join(groups, ":")
+	case Int:
+		if v4 != nil {
+			ip = v4
+		}
+		return new(big.Int).SetBytes(ip).String()
+	case Hex:
+		if v4 != nil {
+			ip = v4
+		}
+		return "0x" + hex.EncodeToString(ip)
+	case Arpa:
+		if v4 != nil {
+			return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+		}
+		digits := hex.EncodeToString(ip.To16())
+		labels := make([]string, 0, len(digits))
+		for i := len(digits) - 1; i >= 0; i-- {
+			labels = append(labels, digits[i:i+1])
+		}
+		return strings.Join(labels, ".") + ".ip6.arpa"
+	default:
+		return ip.String()
+	}
+}
+
+// FormatAddr returns the "host:port" address `addr` in notation `n`.
+// Addresses whose host is not an IP address are returned unmodified.
+func FormatAddr(addr string, n Notation) string {
+	if n == Default {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return addr
+	}
+	s := FormatIP(ip, n)
+	switch {
+	case port == "" || n == Arpa:
+		return s
+	case n == Padded && ip.To4() == nil:
+		return "[" + s + "]:" + port
+	default:
+		return s + ":" + port
+	}
+}
+
+// Apply returns a copy of `set` where the addresses are
+// reported in notation `n`.
+func Apply(set []onf.ONF, n Notation) []onf.ONF {
+	if n == Default {
+		return set
+	}
+	acc := make([]onf.ONF, len(set))
+	for i, v := range set {
+		v.Src = formatNetAddr(v.Src, n)
+		v.Dst = formatNetAddr(v.Dst, n)
+		acc[i] = v
+	}
+	return acc
+}
+
+func formatNetAddr(addr net.Addr, n Notation) net.Addr {
+	if addr == nil {
+		return nil
+	}
+	return internal.NewAddr(addr.Network(), FormatAddr(addr.String(), n))
+}
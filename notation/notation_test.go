@@ -0,0 +1,52 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package notation_test
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/notation"
+)
+
+func TestFormatAddr(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		addr string
+		n    notation.Notation
+		out  string
+	}{
+		// #0
+		{"10.0.0.1:443", notation.Default, "10.0.0.1:443"},
+		{"10.0.0.1:443", notation.Padded, "010.000.000.001:443"},
+		// #2
+		{"1.2.3.4:443", notation.Int, "16909060:443"},
+		{"1.2.3.4:443", notation.Hex, "0x01020304:443"},
+		// #4
+		{"1.2.3.4:443", notation.Arpa, "4.3.2.1.in-addr.arpa"},
+		{"[2001:db8::1]:53", notation.Padded, "[2001:0db8:0000:0000:0000:0000:0000:0001]:53"},
+		// #6
+		{"[::1]:53", notation.Int, "1:53"},
+		{"[2001:db8::1]:53", notation.Arpa, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+		// #8
+		{"*:22", notation.Hex, "*:22"},
+		{"", notation.Int, ""},
+	}
+	for i, v := range tt {
+		if out := notation.FormatAddr(v.addr, v.n); out != v.out {
+			t.Fatalf("%d: expected \"%v\", found \"%v\"", i, v.out, out)
+		}
+	}
+}
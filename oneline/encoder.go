@@ -0,0 +1,57 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oneline
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// DefaultTemplate produces lines like "Spotify: 12 conns (3 hosts)".
+const DefaultTemplate = `{{.Name}}: {{.Conns}} conns ({{len .Hosts}} hosts)`
+
+// Encoder encodes a list of open network files into a single
+// summary line, suitable for status bars.
+type Encoder struct {
+	w    io.Writer
+	tmpl *template.Template
+}
+
+// NewEncoder returns an Encoder that executes `text` against
+// the aggr.Summary of the set. If `text` is empty,
+// DefaultTemplate is used.
+func NewEncoder(w io.Writer, text string) (*Encoder, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("oneline").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template: %w", err)
+	}
+	return &Encoder{w: w, tmpl: tmpl}, nil
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	if err := e.tmpl.Execute(e.w, aggr.Summarize(set)); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oneline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/oneline"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+	}
+	tt := []struct {
+		tmpl string
+		out  string
+	}{
+		{"", "Spotify: 2 conns (1 hosts)\n"},
+		{"{{len .Pids}} {{.Files}}", "1 2\n"},
+	}
+	for i, v := range tt {
+		var w strings.Builder
+		enc, err := oneline.NewEncoder(&w, v.tmpl)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if err := enc.Encode(set); err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if w.String() != v.out {
+			t.Fatalf("%d: unexpected output: wanted \"%s\", found \"%s\"", i, v.out, w.String())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// App is a running GUI application.
+type App struct {
+	Name   string // display name, i.e. "Spotify"
+	Bundle string // path of the .app bundle
+	Pid    int
+}
+
+// RunningApps returns the list of GUI applications currently running.
+// It is only supported on macOS, where it uses `lsappinfo`.
+func RunningApps() ([]App, error) {
+	return DefaultRuntime.RunningApps()
+}
+
+var (
+	lsappinfoNameRgx   = regexp.MustCompile(`^\s*\d+\) "(.*)" ASN:`)
+	lsappinfoBundleRgx = regexp.MustCompile(`^\s*bundle path="(.*)"`)
+	lsappinfoPidRgx    = regexp.MustCompile(`^\s*pid = (\d+)`)
+)
+
+// ParseLsappinfo expects "r" to contain the output of an
+// ``lsappinfo list'' call. Each application block that reports a pid
+// is appended to the final output.
+func ParseLsappinfo(r io.Reader) ([]App, error) {
+	var apps []App
+	var cur *App
+	flush := func() {
+		if cur != nil && cur.Pid != 0 {
+			apps = append(apps, *cur)
+		}
+		cur = nil
+	}
+	err := internal.ScanLines(r, func(line string) error {
+		if m := lsappinfoNameRgx.FindStringSubmatch(line); m != nil {
+			flush()
+			cur = &App{Name: m[1]}
+			return nil
+		}
+		if cur == nil {
+			return nil
+		}
+		if m := lsappinfoBundleRgx.FindStringSubmatch(line); m != nil {
+			cur.Bundle = m[1]
+		}
+		if m := lsappinfoPidRgx.FindStringSubmatch(line); m != nil {
+			cur.Pid, _ = strconv.Atoi(m[1])
+		}
+		return nil
+	})
+	flush()
+	return apps, err
+}
+
+// GroupByApp keeps only the open network files owned by one of `apps`,
+// filling their App field. The output is sorted by application name,
+// preserving the original order inside each application.
+func GroupByApp(set []ONF, apps []App) []ONF {
+	names := make(map[int]string, len(apps))
+	for _, v := range apps {
+		names[v.Pid] = v.Name
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		name, ok := names[v.Pid]
+		if !ok {
+			continue
+		}
+		v.App = name
+		acc = append(acc, v)
+	}
+	SortByApp(acc)
+	return acc
+}
+
+// SortByApp sorts `set` by application name, preserving the order of
+// the open network files of each application: sorting the output of
+// GroupByApp again (see Sort) does not undo the grouping.
+func SortByApp(set []ONF) {
+	sort.SliceStable(set, func(i, j int) bool {
+		return set[i].App < set[j].App
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"strings"
+	"testing"
+)
+
+const lsappinfoExample = `
+ 1) "Finder" ASN:0x0-0x1001:
+    bundleID="com.apple.finder"
+    bundle path="/System/Library/CoreServices/Finder.app"
+    executable path="/System/Library/CoreServices/Finder.app/Contents/MacOS/Finder"
+    pid = 457 type="Foreground" flavor=3 Version="10.14.5" fileType="FNDR" creator="MACS" Arch=x86_64
+ 2) "Spotify" ASN:0x0-0x2002:
+    bundleID="com.spotify.client"
+    bundle path="/Applications/Spotify.app"
+    executable path="/Applications/Spotify.app/Contents/MacOS/Spotify"
+    pid = 11778 type="Foreground" flavor=3 Version="1.1.10" fileType="APPL" creator="????" Arch=x86_64
+ 3) "Dead" ASN:0x0-0x3003:
+    bundle path="/Applications/Dead.app"
+`
+
+func TestParseLsappinfo(t *testing.T) {
+	t.Parallel()
+	apps, err := ParseLsappinfo(strings.NewReader(lsappinfoExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("Unexpected apps length: wanted 2, found %d: %v", len(apps), apps)
+	}
+	exp := App{Name: "Spotify", Bundle: "/Applications/Spotify.app", Pid: 11778}
+	if apps[1] != exp {
+		t.Fatalf("Unexpected app: wanted %v, found %v", exp, apps[1])
+	}
+
+	set := []ONF{{Pid: 11778}, {Pid: 1}, {Pid: 457}}
+	grouped := GroupByApp(set, apps)
+	if len(grouped) != 2 || grouped[0].App != "Finder" || grouped[1].App != "Spotify" {
+		t.Fatalf("Unexpected grouped set: %v", grouped)
+	}
+
+	// Sorting by command and pid, then by app, keeps the files of
+	// each app together, in order.
+	set = []ONF{{Cmd: "b", Pid: 3, App: "Z"}, {Cmd: "c", Pid: 2, App: "A"}, {Cmd: "a", Pid: 1, App: "Z"}}
+	Sort(set)
+	SortByApp(set)
+	if set[0].Cmd != "c" || set[1].Cmd != "a" || set[2].Cmd != "b" {
+		t.Fatalf("Unexpected sorted set: %v", set)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+	"howett.net/plist"
+)
+
+// isBundle reports whether `pivot` is the path of a macOS
+// application bundle.
+func isBundle(pivot string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(pivot, "/"), ".app")
+}
+
+// BundleExecutable returns the name of the executable of the .app bundle
+// at `path`, as reported by the CFBundleExecutable key of its Info.plist.
+// Symbolic links, such as /Applications entries pointing to a different
+// volume, are followed.
+func BundleExecutable(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(strings.TrimSuffix(path, "/"))
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve bundle %s: %w", path, err)
+	}
+	f, err := os.Open(filepath.Join(real, "Contents", "Info.plist"))
+	if err != nil {
+		return "", fmt.Errorf("unable to open bundle %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var info struct {
+		Executable string `plist:"CFBundleExecutable"`
+	}
+	if err := plist.NewDecoder(f).Decode(&info); err != nil {
+		return "", fmt.Errorf("unable to decode Info.plist of %s: %w", path, err)
+	}
+	if info.Executable == "" {
+		return "", fmt.Errorf("bundle %s does not declare an executable", path)
+	}
+	return info.Executable, nil
+}
+
+// bundleProcessExpr returns the pattern matching the command line of
+// the processes running the executable of the bundle at `path`.
+// Only the tail of the path (Name.app/Contents/MacOS/exe) is matched,
+// so that the same bundle is found when it is run from a translocated
+// location (Gatekeeper's AppTranslocation) or from a mounted disk image.
+func bundleProcessExpr(path, exe string) string {
+	name := filepath.Base(strings.TrimSuffix(path, "/"))
+	return regexp.QuoteMeta(filepath.Join(name, "Contents", "MacOS", exe))
+}
+
+// Pids describes the processes a bundle has been resolved to.
+type Pids struct {
+	Used  []int // pids of the running processes, sorted and deduplicated
+	Stale []int // pids reported by pgrep that no longer exist
+}
+
+// BundlePids returns the pids of the processes running the bundle at
+// `path`, using `pgrep`. Duplicates are removed, and each pid is
+// checked to still exist, as the process may have exited in the
+// meantime: its pid could then be reused by an unrelated process.
+func BundlePids(path string) (Pids, error) {
+	return bundlePids(context.Background(), path)
+}
+
+// bundlePids is the same as BundlePids, but pgrep is killed as soon as
+// `ctx` is done, and its execution is logged to the logger carried by
+// `ctx`.
+func bundlePids(ctx context.Context, path string) (Pids, error) {
+	exe, err := BundleExecutable(path)
+	if err != nil {
+		return Pids{}, err
+	}
+	expr := bundleProcessExpr(path, exe)
+	internal.LoggerFrom(ctx).Printf("Executing: pgrep -f %s", expr)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	out, _, err := runner.Default.Run(ctx, "pgrep", "-f", expr)
+	if err != nil && len(out) == 0 {
+		// pgrep exits with status 1 when no process matches.
+		return Pids{}, &NoProcessError{Pivot: path}
+	}
+	pids, err := ParsePgrep(strings.NewReader(string(out)))
+	if err != nil {
+		return Pids{}, err
+	}
+	p := checkPids(pids, processExists)
+	if len(p.Used) == 0 {
+		return p, &NoProcessError{Pivot: path}
+	}
+	return p, nil
+}
+
+// ParsePgrep expects "r" to contain the output of a ``pgrep'' call,
+// that is one pid per line.
+func ParsePgrep(r io.Reader) ([]int, error) {
+	var pids []int
+	err := internal.ScanLines(r, func(line string) error {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return nil
+		}
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return fmt.Errorf("unable to parse pgrep output: %w", err)
+		}
+		pids = append(pids, pid)
+		return nil
+	})
+	return pids, err
+}
+
+// checkPids deduplicates and sorts `pids`, splitting them into the
+// ones for which `exists` holds and the stale ones.
+func checkPids(pids []int, exists func(int) bool) Pids {
+	var p Pids
+	seen := make(map[int]bool, len(pids))
+	for _, v := range pids {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if exists(v) {
+			p.Used = append(p.Used, v)
+		} else {
+			p.Stale = append(p.Stale, v)
+		}
+	}
+	sort.Ints(p.Used)
+	sort.Ints(p.Stale)
+	return p
+}
+
+// FilterPids returns the open network files of `set` owned by one of
+// the processes in `pids`.
+func FilterPids(set []ONF, pids []int) []ONF {
+	keep := make(map[int]bool, len(pids))
+	for _, v := range pids {
+		keep[v] = true
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if keep[v.Pid] {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
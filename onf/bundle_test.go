@@ -0,0 +1,118 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const infoPlistExample = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>Spotify</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.spotify.client</string>
+</dict>
+</plist>
+`
+
+func TestBundleExecutable(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "Volume", "Spotify.app")
+	if err := os.MkdirAll(filepath.Join(bundle, "Contents"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, "Contents", "Info.plist"), []byte(infoPlistExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "Spotify.app")
+	if err := os.Symlink(bundle, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{bundle, link, link + "/"} {
+		exe, err := BundleExecutable(v)
+		if err != nil {
+			t.Fatalf("Unexpected error resolving %s: %v", v, err)
+		}
+		if exe != "Spotify" {
+			t.Fatalf("Unexpected executable of %s: %s", v, exe)
+		}
+	}
+}
+
+func TestBundleProcessExpr(t *testing.T) {
+	t.Parallel()
+	rgx := regexp.MustCompile(bundleProcessExpr("/Applications/Spotify.app", "Spotify"))
+	for _, v := range []string{
+		"/Applications/Spotify.app/Contents/MacOS/Spotify",
+		"/private/var/folders/x1/T/AppTranslocation/8E0C2B1A/d/Spotify.app/Contents/MacOS/Spotify",
+		"/Volumes/Spotify/Spotify.app/Contents/MacOS/Spotify",
+	} {
+		if !rgx.MatchString(v) {
+			t.Fatalf("Expected %s to match %v", v, rgx)
+		}
+	}
+}
+
+func TestParsePgrep(t *testing.T) {
+	t.Parallel()
+	pids, err := ParsePgrep(strings.NewReader("614\n11778\n\n614\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pids, []int{614, 11778, 614}) {
+		t.Fatalf("Unexpected pids: %v", pids)
+	}
+	if _, err := ParsePgrep(strings.NewReader("pgrep: invalid option")); err == nil {
+		t.Fatalf("Expected an error for invalid pgrep output")
+	}
+}
+
+func TestCheckPids(t *testing.T) {
+	t.Parallel()
+	exists := func(pid int) bool { return pid != 42 }
+	p := checkPids([]int{11778, 614, 42, 614, 42}, exists)
+	if !reflect.DeepEqual(p.Used, []int{614, 11778}) {
+		t.Fatalf("Unexpected used pids: %v", p.Used)
+	}
+	if !reflect.DeepEqual(p.Stale, []int{42}) {
+		t.Fatalf("Unexpected stale pids: %v", p.Stale)
+	}
+}
+
+func TestFilterPids(t *testing.T) {
+	t.Parallel()
+	set := []ONF{{Pid: 614}, {Pid: 1177}, {Pid: 11778}}
+	acc := FilterPids(set, []int{614, 11778})
+	if len(acc) != 2 || acc[0].Pid != 614 || acc[1].Pid != 11778 {
+		t.Fatalf("Unexpected filtered set: %v", acc)
+	}
+}
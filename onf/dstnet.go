@@ -0,0 +1,126 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DstNets selects the open network files by destination network: the
+// ones whose destination falls inside one of the In networks, when
+// there are any, and outside all of the Out networks are kept. The
+// zero value matches every open network file.
+type DstNets struct {
+	In  []*net.IPNet
+	Out []*net.IPNet
+}
+
+// ParseNets parses `l`, a list of networks in CIDR notation (i.e.
+// 10.0.0.0/8), each item possibly holding several of them separated by
+// commas. Plain addresses are accepted as single host networks.
+func ParseNets(l []string) ([]*net.IPNet, error) {
+	var acc []*net.IPNet
+	for _, s := range l {
+		for _, v := range strings.Split(s, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if !strings.Contains(v, "/") {
+				ip := net.ParseIP(v)
+				if ip == nil {
+					return nil, fmt.Errorf("invalid network %s: expected an address or CIDR notation", v)
+				}
+				bits := 8 * net.IPv6len
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 8*net.IPv4len
+				}
+				acc = append(acc, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			_, n, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %s: %w", v, err)
+			}
+			acc = append(acc, n)
+		}
+	}
+	return acc, nil
+}
+
+// Match reports whether the destination of `f` is selected by `n`.
+// Open network files without a destination address, such as listening
+// sockets, only match when `n` has no In networks.
+func (n DstNets) Match(f ONF) bool {
+	if len(n.In) == 0 && len(n.Out) == 0 {
+		return true
+	}
+	ip := dstIP(f)
+	if ip == nil {
+		return len(n.In) == 0
+	}
+	if len(n.In) > 0 && !containsIP(n.In, ip) {
+		return false
+	}
+	return !containsIP(n.Out, ip)
+}
+
+// FilterDstNets returns the open network files of `set` selected by `n`.
+func FilterDstNets(set []ONF, n DstNets) []ONF {
+	if len(n.In) == 0 && len(n.Out) == 0 {
+		return set
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if n.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// dstIP returns the destination address of `f`, or nil when it has
+// none or it is unspecified.
+func dstIP(f ONF) net.IP {
+	return addrIP(f.Dst)
+}
+
+// addrIP returns the ip of `addr`, or nil when `addr` is nil, is a
+// wildcard or is unspecified.
+func addrIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	return ip
+}
+
+func containsIP(l []*net.IPNet, ip net.IP) bool {
+	for _, v := range l {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestFilterDstNets(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1, Dst: internal.NewAddr("tcp", "10.1.2.3:443")},
+		{Pid: 2, Dst: internal.NewAddr("tcp", "192.168.0.1:53")},
+		{Pid: 3, Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Pid: 4, Dst: internal.NewAddr("tcp6", "[2001:db8::1]:443")},
+		{Pid: 5, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "*:*")},
+	}
+	tt := []struct {
+		in, out []string
+		pids    []int
+	}{
+		{nil, nil, []int{1, 2, 3, 4, 5}},
+		{[]string{"10.0.0.0/8"}, nil, []int{1}},
+		{[]string{"10.0.0.0/8,192.168.0.0/16", "2001:db8::/32"}, nil, []int{1, 2, 4}},
+		{nil, []string{"10.0.0.0/8", "192.168.0.0/16"}, []int{3, 4, 5}},
+		{[]string{"0.0.0.0/0"}, []string{"35.186.224.47"}, []int{1, 2}},
+	}
+	for i, v := range tt {
+		var n DstNets
+		var err error
+		if n.In, err = ParseNets(v.in); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if n.Out, err = ParseNets(v.out); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		acc := FilterDstNets(set, n)
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+		}
+		for j, f := range acc {
+			if f.Pid != v.pids[j] {
+				t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+			}
+		}
+	}
+	if _, err := ParseNets([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("Expected an error parsing an invalid network")
+	}
+}
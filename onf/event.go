@@ -0,0 +1,104 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"time"
+)
+
+// EventType tells what happened to the open network file of an Event.
+type EventType int
+
+const (
+	Opened           EventType = iota // a connection was opened
+	Closed                            // a connection was closed
+	StartedListening                  // a listening socket was opened
+	StoppedListening                  // a listening socket was closed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Opened:
+		return "opened"
+	case Closed:
+		return "closed"
+	case StartedListening:
+		return "started-listening"
+	case StoppedListening:
+		return "stopped-listening"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports an open network file that appeared or disappeared
+// between two lookups.
+type Event struct {
+	Type EventType
+	File ONF
+	Time time.Time // time of the lookup that noticed the change
+}
+
+// Events watches the open network files matching `pivot` (see Watch),
+// delivering an Event for each one opened or closed on the returned
+// channel, which is closed when `ctx` is done. Listening sockets are
+// reported as StartedListening and StoppedListening instead of Opened
+// and Closed, so that services going up and down can be told apart
+// from the connections they serve. Lookup errors are only logged.
+func Events(ctx context.Context, pivot string, interval time.Duration) <-chan Event {
+	c := make(chan Event)
+	go func() {
+		defer close(c)
+		Watch(ctx, pivot, interval, func(ch Change) error {
+			for _, v := range ChangeEvents(ch) {
+				select {
+				case c <- v:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}()
+	return c
+}
+
+// ChangeEvents converts `c` into events, opened files first.
+func ChangeEvents(c Change) []Event {
+	acc := make([]Event, 0, len(c.Opened)+len(c.Closed))
+	for _, v := range c.Opened {
+		t := Opened
+		if isListening(v) {
+			t = StartedListening
+		}
+		acc = append(acc, Event{Type: t, File: v, Time: c.Time})
+	}
+	for _, v := range c.Closed {
+		t := Closed
+		if isListening(v) {
+			t = StoppedListening
+		}
+		acc = append(acc, Event{Type: t, File: v, Time: c.Time})
+	}
+	return acc
+}
+
+// isListening reports whether `f` is a listening socket. Windows
+// reports them as "LISTENING".
+func isListening(f ONF) bool {
+	return f.State == "LISTEN" || f.State == "LISTENING"
+}
@@ -0,0 +1,88 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func TestChangeEvents(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c := Change{
+		Opened: []ONF{
+			{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.1.1.1:443"), State: "ESTABLISHED"},
+			{Cmd: "nginx", Pid: 3, Src: internal.NewAddr("tcp", "*:80"), State: "LISTEN"},
+		},
+		Closed: []ONF{
+			{Cmd: "svchost.exe", Pid: 4, Src: internal.NewAddr("tcp", "0.0.0.0:135"), State: "LISTENING"},
+			{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")},
+		},
+		Time: now,
+	}
+	want := []EventType{Opened, StartedListening, StoppedListening, Closed}
+	events := ChangeEvents(c)
+	if len(events) != len(want) {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+	for i, v := range events {
+		if v.Type != want[i] || !v.Time.Equal(now) {
+			t.Fatalf("%d: Unexpected event: wanted %v, found %v at %v", i, want[i], v.Type, v.Time)
+		}
+	}
+	if s := StoppedListening.String(); s != "stopped-listening" {
+		t.Fatalf("Unexpected event type name: %s", s)
+	}
+}
+
+// TestEvents replaces DefaultRuntime, hence it must not run in
+// parallel with other tests.
+func TestEvents(t *testing.T) {
+	defer func(r Runtime) { DefaultRuntime = r }(DefaultRuntime)
+	outputs := []string{netstatExample, ""}
+	var calls int
+	DefaultRuntime = NetstatRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		out := outputs[len(outputs)-1]
+		if calls < len(outputs) {
+			out = outputs[calls]
+		}
+		calls++
+		return []byte(out), nil, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []Event
+	for v := range Events(ctx, "*", time.Millisecond) {
+		events = append(events, v)
+		if len(events) == 2 {
+			cancel()
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("Unexpected events: %v", events)
+	}
+	for _, v := range events {
+		if v.Type != Closed && v.Type != StoppedListening {
+			t.Fatalf("Unexpected event: %v", v)
+		}
+	}
+}
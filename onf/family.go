@@ -0,0 +1,110 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"net"
+	"strings"
+)
+
+// Family is an address family, used to keep only the open network
+// files using it.
+type Family int
+
+// Supported address families.
+const (
+	AnyFamily Family = iota
+	IPv4
+	IPv6
+)
+
+func (f Family) String() string {
+	switch f {
+	case IPv4:
+		return "IPv4"
+	case IPv6:
+		return "IPv6"
+	default:
+		return "any"
+	}
+}
+
+// Match reports whether `o` uses the address family `f`, which is
+// always the case for AnyFamily. The family is taken from the source
+// address, falling back to the destination one, the network name (i.e.
+// tcp6) and the type reported by the backend, when the addresses are
+// wildcards. IPv4-mapped IPv6 addresses are reported as IPv4, as the
+// packets they exchange are.
+func (f Family) Match(o ONF) bool {
+	if f == AnyFamily {
+		return true
+	}
+	return family(o) == f
+}
+
+// FilterFamily returns the open network files of `set` using the
+// address family `f`.
+func FilterFamily(set []ONF, f Family) []ONF {
+	if f == AnyFamily {
+		return set
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if f.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// family returns the address family of `o`, or AnyFamily when it
+// cannot be told.
+func family(o ONF) Family {
+	for _, addr := range []net.Addr{o.Src, o.Dst} {
+		if addr == nil {
+			continue
+		}
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			if ip.To4() != nil {
+				return IPv4
+			}
+			return IPv6
+		}
+	}
+	for _, addr := range []net.Addr{o.Src, o.Dst} {
+		if addr == nil {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(addr.Network(), "4"):
+			return IPv4
+		case strings.HasSuffix(addr.Network(), "6"):
+			return IPv6
+		}
+	}
+	if o.File != nil {
+		switch o.File.Type {
+		case "IPv4":
+			return IPv4
+		case "IPv6":
+			return IPv6
+		}
+	}
+	return AnyFamily
+}
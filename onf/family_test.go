@@ -0,0 +1,52 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestFilterFamily(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Pid: 2, Src: internal.NewAddr("tcp6", "[2001:db8::2]:5000"), Dst: internal.NewAddr("tcp6", "[2001:db8::1]:443")},
+		{Pid: 3, Src: internal.NewAddr("tcp6", "[::ffff:10.0.0.2]:5000"), Dst: internal.NewAddr("tcp6", "[::ffff:10.0.0.7]:80")},
+		{Pid: 4, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "*:*"), File: &File{Type: "IPv6"}},
+		{Pid: 5, Src: internal.NewAddr("udp4", "*:53"), Dst: internal.NewAddr("udp4", "*:*")},
+		{Pid: 6, Src: internal.NewAddr("tcp", "[::]:80")},
+	}
+	tt := []struct {
+		family Family
+		pids   []int
+	}{
+		{AnyFamily, []int{1, 2, 3, 4, 5, 6}},
+		{IPv4, []int{1, 3, 5}},
+		{IPv6, []int{2, 4, 6}},
+	}
+	for _, v := range tt {
+		acc := FilterFamily(set, v.family)
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%v: Unexpected open network files: %v", v.family, acc)
+		}
+		for j, f := range acc {
+			if f.Pid != v.pids[j] {
+				t.Fatalf("%v: Unexpected open network files: %v", v.family, acc)
+			}
+		}
+	}
+}
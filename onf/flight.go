@@ -0,0 +1,58 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import "sync"
+
+// flight coalesces concurrent executions of the same function: callers
+// that arrive while an execution is in progress wait for it and share
+// its result, instead of starting a new one.
+type flight struct {
+	mu   sync.Mutex
+	call *call
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	set []ONF
+	err error
+}
+
+// Do executes `f`, unless an execution is already in progress. Each
+// caller receives its own copy of the resulting slice.
+func (g *flight) Do(f func() ([]ONF, error)) ([]ONF, error) {
+	g.mu.Lock()
+	c := g.call
+	if c == nil {
+		c = &call{}
+		c.wg.Add(1)
+		g.call = c
+		g.mu.Unlock()
+
+		c.set, c.err = f()
+		g.mu.Lock()
+		g.call = nil
+		g.mu.Unlock()
+		c.wg.Done()
+	} else {
+		g.mu.Unlock()
+		c.wg.Wait()
+	}
+
+	set := make([]ONF, len(c.set))
+	copy(set, c.set)
+	return set, c.err
+}
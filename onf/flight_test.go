@@ -0,0 +1,68 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlight(t *testing.T) {
+	t.Parallel()
+	var g flight
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	f := func() ([]ONF, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return []ONF{{Pid: 1}}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([][]ONF, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _ = g.Do(f)
+	}()
+	<-started
+	for i := 1; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.Do(f)
+		}(i)
+	}
+	// Give the other callers the chance to join the flight.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("Unexpected number of executions: wanted 1, found %d", n)
+	}
+	results[0][0].Pid = 2
+	for i := 1; i < len(results); i++ {
+		if results[i][0].Pid != 1 {
+			t.Fatalf("%d: callers should receive their own copy of the result", i)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// SchemaVersion is the version of the JSON representation of ONF
+// produced by MarshalJSON. It is incremented on incompatible changes,
+// such as fields renamed or removed, while additions keep it.
+const SchemaVersion = 1
+
+// SchemaChanges is the changelog of the JSON representation of ONF:
+// the entry at index i describes what version i+1 changed, so that
+// consumers know what to adapt before requesting it. Incrementing
+// SchemaVersion without documenting it here fails the tests.
+var SchemaChanges = []string{
+	"initial version",
+}
+
+type jsonAddr struct {
+	Net  string `json:"net"`
+	Addr string `json:"addr"`
+	Name string `json:"name,omitempty"`
+}
+
+type jsonProbe struct {
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+type jsonCert struct {
+	Subject  string   `json:"subject"`
+	DNSNames []string `json:"dns_names,omitempty"`
+}
+
+type jsonListen struct {
+	Backlog uint64 `json:"backlog"`
+	Queue   uint64 `json:"queue"`
+}
+
+type jsonBuffers struct {
+	Send uint64 `json:"send"`
+	Recv uint64 `json:"recv"`
+}
+
+type jsonExe struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	Signer string `json:"signer,omitempty"`
+}
+
+type jsonFile struct {
+	User    string `json:"user"`
+	Fd      string `json:"fd"`
+	Type    string `json:"type"`
+	Device  string `json:"device"`
+	SizeOff string `json:"size_off,omitempty"`
+	Node    string `json:"node"`
+}
+
+type jsonIface struct {
+	Name   string `json:"name"`
+	Stable string `json:"stable,omitempty"`
+}
+
+type jsonGeo struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	ASN     int    `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+type jsonVM struct {
+	Hypervisor string `json:"hypervisor"`
+	Name       string `json:"name,omitempty"`
+}
+
+type jsonONF struct {
+	Raw       string       `json:"raw"`
+	Cmd       string       `json:"cmd"`
+	Pid       int          `json:"pid"`
+	App       string       `json:"app,omitempty"`
+	Src       *jsonAddr    `json:"src"`
+	Dst       *jsonAddr    `json:"dst"`
+	State     string       `json:"state,omitempty"`
+	TimerMs   int64        `json:"timer_ms,omitempty"`
+	Probe     *jsonProbe   `json:"probe,omitempty"`
+	Cert      *jsonCert    `json:"cert,omitempty"`
+	Listen    *jsonListen  `json:"listen,omitempty"`
+	Buffers   *jsonBuffers `json:"buffers,omitempty"`
+	Proxy     string       `json:"proxy,omitempty"`
+	Exe       *jsonExe     `json:"exe,omitempty"`
+	File      *jsonFile    `json:"file,omitempty"`
+	Iface     *jsonIface   `json:"iface,omitempty"`
+	Geo       *jsonGeo     `json:"geo,omitempty"`
+	VM        *jsonVM      `json:"vm,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func toJSONAddr(addr net.Addr, name string) *jsonAddr {
+	if addr == nil {
+		return nil
+	}
+	return &jsonAddr{Net: addr.Network(), Addr: addr.String(), Name: name}
+}
+
+func toJSONProbe(p *Probe) *jsonProbe {
+	if p == nil {
+		return nil
+	}
+	return &jsonProbe{
+		Reachable: p.Reachable,
+		LatencyMs: float64(p.Latency) / float64(time.Millisecond),
+	}
+}
+
+func fromJSONProbe(p *jsonProbe) *Probe {
+	if p == nil {
+		return nil
+	}
+	return &Probe{
+		Reachable: p.Reachable,
+		Latency:   time.Duration(p.LatencyMs * float64(time.Millisecond)),
+	}
+}
+
+func toJSONCert(c *Cert) *jsonCert {
+	if c == nil {
+		return nil
+	}
+	return &jsonCert{Subject: c.Subject, DNSNames: c.DNSNames}
+}
+
+func fromJSONCert(c *jsonCert) *Cert {
+	if c == nil {
+		return nil
+	}
+	return &Cert{Subject: c.Subject, DNSNames: c.DNSNames}
+}
+
+func fromJSONAddr(addr *jsonAddr) (net.Addr, string) {
+	if addr == nil {
+		return nil, ""
+	}
+	return internal.NewAddr(addr.Net, addr.Addr), addr.Name
+}
+
+// MarshalJSON implements json.Marshaler. Addresses are encoded
+// as objects containing their network and string representation,
+// together with the resolved host name, if present.
+func (f ONF) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonONF{
+		Raw:       f.Raw,
+		Cmd:       f.Cmd,
+		Pid:       f.Pid,
+		App:       f.App,
+		Src:       toJSONAddr(f.Src, f.SrcName),
+		Dst:       toJSONAddr(f.Dst, f.DstName),
+		State:     f.State,
+		TimerMs:   int64(f.Timer / time.Millisecond),
+		Probe:     toJSONProbe(f.Probe),
+		Cert:      toJSONCert(f.Cert),
+		Listen:    (*jsonListen)(f.Listen),
+		Buffers:   (*jsonBuffers)(f.Buffers),
+		Proxy:     f.Proxy,
+		Exe:       (*jsonExe)(f.Exe),
+		File:      (*jsonFile)(f.File),
+		Iface:     (*jsonIface)(f.Iface),
+		Geo:       (*jsonGeo)(f.Geo),
+		VM:        (*jsonVM)(f.VM),
+		CreatedAt: f.CreatedAt,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, and is the inverse
+// of MarshalJSON.
+func (f *ONF) UnmarshalJSON(data []byte) error {
+	var v jsonONF
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = ONF{
+		Raw:       v.Raw,
+		Cmd:       v.Cmd,
+		Pid:       v.Pid,
+		App:       v.App,
+		State:     v.State,
+		Timer:     time.Duration(v.TimerMs) * time.Millisecond,
+		Probe:     fromJSONProbe(v.Probe),
+		Cert:      fromJSONCert(v.Cert),
+		Listen:    (*Listen)(v.Listen),
+		Buffers:   (*Buffers)(v.Buffers),
+		Proxy:     v.Proxy,
+		Exe:       (*Exe)(v.Exe),
+		File:      (*File)(v.File),
+		Iface:     (*Iface)(v.Iface),
+		Geo:       (*Geo)(v.Geo),
+		VM:        (*VM)(v.VM),
+		CreatedAt: v.CreatedAt,
+	}
+	f.Src, f.SrcName = fromJSONAddr(v.Src)
+	f.Dst, f.DstName = fromJSONAddr(v.Dst)
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import "testing"
+
+func TestSchemaChanges(t *testing.T) {
+	t.Parallel()
+	if len(SchemaChanges) != SchemaVersion {
+		t.Fatalf("Unexpected schema changelog: version %d has %d entries, document the changes of each version", SchemaVersion, len(SchemaChanges))
+	}
+	for i, v := range SchemaChanges {
+		if v == "" {
+			t.Fatalf("Unexpected empty changelog entry for schema version %d", i+1)
+		}
+	}
+}
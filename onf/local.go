@@ -0,0 +1,46 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import "net"
+
+// IsLocal reports whether both endpoints of `f` are loopback or
+// link-local addresses, as it happens for the connections between
+// IDEs, language servers and local databases. Open network files
+// without a destination are local when their source is.
+func IsLocal(f ONF) bool {
+	src := addrIP(f.Src)
+	if !isLocalIP(src) {
+		return false
+	}
+	dst := addrIP(f.Dst)
+	return dst == nil || isLocalIP(dst)
+}
+
+// FilterLocal returns the open network files of `set` that are not
+// local (see IsLocal).
+func FilterLocal(set []ONF) []ONF {
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if !IsLocal(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+func isLocalIP(ip net.IP) bool {
+	return ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast())
+}
@@ -0,0 +1,43 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestFilterLocal(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1, Src: internal.NewAddr("tcp", "127.0.0.1:51000"), Dst: internal.NewAddr("tcp", "127.0.0.1:5432")},
+		{Pid: 2, Src: internal.NewAddr("tcp6", "[::1]:6000"), Dst: internal.NewAddr("tcp6", "[fe80::1]:80")},
+		{Pid: 3, Src: internal.NewAddr("tcp", "127.0.0.1:5432"), Dst: internal.NewAddr("tcp", "*:*")},
+		{Pid: 4, Src: internal.NewAddr("tcp", "10.0.0.2:51000"), Dst: internal.NewAddr("tcp", "127.0.0.1:80")},
+		{Pid: 5, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "*:*")},
+		{Pid: 6, Src: internal.NewAddr("tcp", "10.0.0.2:51001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+	}
+	acc := FilterLocal(set)
+	want := []int{4, 5, 6}
+	if len(acc) != len(want) {
+		t.Fatalf("Unexpected open network files: %v", acc)
+	}
+	for i, v := range acc {
+		if v.Pid != want[i] {
+			t.Fatalf("Unexpected open network files: %v", acc)
+		}
+	}
+}
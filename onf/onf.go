@@ -16,56 +16,335 @@
 package onf
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net"
 	"regexp"
 	"time"
+
+	"github.com/jecoz/lsaddr/internal"
 )
 
 // ONF represents an open network file.
 type ONF struct {
-	Raw       string   // raw string that produced this result
-	Cmd       string   // command associated with Pid
-	Pid       int      // pid of the owner
-	Src       net.Addr // source address
-	Dst       net.Addr // destination address
+	Raw       string        // raw string that produced this result
+	Cmd       string        // command associated with Pid
+	Pid       int           // pid of the owner
+	Src       net.Addr      // source address
+	Dst       net.Addr      // destination address
+	State     string        // connection state (ESTABLISHED, LISTEN, ...), if any
+	Timer     time.Duration // remaining time of the kernel socket timer (i.e. TIME_WAIT), if known
+	SrcName   string        // resolved host name of Src, if any
+	DstName   string        // resolved host name of Dst, if any
+	App       string        // GUI application owning Pid, if known
+	Probe     *Probe        // reachability of Dst, if probed
+	Cert      *Cert         // certificate presented by Dst, if peeked
+	Listen    *Listen       // accept queue information, for listening sockets
+	Buffers   *Buffers      // socket queues usage, for connected sockets
+	Proxy     string        // URL of the proxy Dst points to, if any
+	Exe       *Exe          // executable of Pid, if inspected
+	File      *File         // low-level details, when reported by the backend
+	Iface     *Iface        // interface Src is assigned to, if annotated
+	Geo       *Geo          // location of Dst, if found in a GeoIP database
+	VM        *VM           // virtual machine run by Pid, when it is a hypervisor
 	CreatedAt time.Time
 }
 
+// File holds the low-level details of an open network file, as
+// reported by lsof.
+type File struct {
+	User    string
+	Fd      string // file descriptor number and access mode (i.e. 128u)
+	Type    string // IPv4, IPv6
+	Device  string
+	SizeOff string
+	Node    string // TCP, UDP
+}
+
+// Iface identifies the interface a temporary (privacy) IPv6 source
+// address is assigned to, and the stable address of the same interface
+// and prefix, which outlives the rotation of temporary addresses.
+type Iface struct {
+	Name   string
+	Stable string // empty when the interface has no stable address
+}
+
+// Geo is the location of an address, as found in GeoIP databases.
+// Fields not reported by the databases are left empty.
+type Geo struct {
+	Country string // ISO 3166-1 alpha-2 code (i.e. US)
+	City    string // english name
+	ASN     int    // autonomous system number
+	Org     string // organization owning the autonomous system
+}
+
+// VM identifies the virtual machine run by a hypervisor process: the
+// connections of the process may originate from the guest rather than
+// from the hypervisor itself.
+type VM struct {
+	Hypervisor string // qemu, virtualbox, vmware
+	Name       string // empty when it cannot be told from the command line
+}
+
+// Exe identifies the executable a process is running.
+type Exe struct {
+	Path   string
+	SHA256 string // hex encoded
+	Signer string // code-signing identity, if signed (macOS and windows only)
+}
+
+// Listen describes the accept queue of a listening socket.
+type Listen struct {
+	Backlog uint64 // maximum length of the accept queue
+	Queue   uint64 // connections waiting to be accepted
+}
+
+// Buffers describes the usage of the queues of a connected socket.
+// Growing values indicate a slow consumer (Recv) or a slow or
+// unreachable peer (Send).
+type Buffers struct {
+	Send uint64 // bytes not yet acknowledged by the peer
+	Recv uint64 // bytes not yet read by the process
+}
+
+// Cert describes the leaf certificate presented by a TLS server.
+type Cert struct {
+	Subject  string   // common name of the subject
+	DNSNames []string // subject alternative names
+}
+
+// Probe is the result of a reachability probe.
+type Probe struct {
+	Reachable bool
+	Latency   time.Duration
+}
+
 func (f ONF) String() string {
 	return fmt.Sprintf("{Cmd: %s, Pid: %d, Conn: %v->%v}", f.Cmd, f.Pid, f.Src, f.Dst)
 }
 
+// All is the pivot selecting every open network file. An empty pivot
+// selects them all too, but callers should be explicit: see Fetch.
+const All = "*"
+
+// selectsAll reports whether `pivot` selects every open network file.
+func selectsAll(pivot string) bool {
+	return pivot == "" || pivot == All
+}
+
+var fetchFlight flight
+
 // FetchAll retrieves the complete list of open network files. It does
-// so using an external tool, `netstat` for windows and `lsof` for unix
-// based systems.
+// so using DefaultRuntime, that is an external tool, `netstat` for windows
+// and `lsof` for unix based systems. Concurrent calls share the same
+// execution of the tool.
+// The result is ordered as described by Sort.
 func FetchAll() ([]ONF, error) {
-	// fetchAll implementations may be found insiede the
-	// runtime_*.go files.
-	return fetchAll()
+	set, err := fetchFlight.Do(fetchAll)
+	Sort(set)
+	return set, err
+}
+
+// Fetch returns the open network files matching `pivot`, as FetchAll
+// followed by Filter would, but the filter runs while the output of
+// the external tool is scanned: lines that do not match are never
+// decoded, which saves time and memory on systems with many sockets
+// when the filter is narrow. Calls are not coalesced, unless `pivot`
+// selects every open network file (it is All, or empty) or contains an
+// application bundle.
+func Fetch(pivot string) ([]ONF, error) {
+	if selectsAll(pivot) || hasBundle(pivot) {
+		set, err := FetchAll()
+		if err != nil {
+			return set, err
+		}
+		return Filter(set, pivot)
+	}
+	return FetchContext(context.Background(), pivot)
+}
+
+// FetchContext is the same as Fetch, but the lookup is aborted as soon
+// as `ctx` is done, returning its error: external tools stalling, as
+// lsof does on unreachable network mounts, can be cancelled or timed
+// out. The open network files decoded until then are returned with it,
+// when they can still be filtered by `pivot`. Calls are never
+// coalesced.
+func FetchContext(ctx context.Context, pivot string) ([]ONF, error) {
+	return FetchWith(ctx, DefaultRuntime, pivot)
+}
+
+// FetchWith is the same as FetchContext, but the open network files
+// are listed by `r` instead of DefaultRuntime, which is left untouched:
+// callers can use different runtimes concurrently.
+func FetchWith(ctx context.Context, r Runtime, pivot string) ([]ONF, error) {
+	set, _, err := fetchWith(ctx, r, pivot)
+	return set, err
+}
+
+// fetchWith is the same as FetchWith, but also returns the pids the
+// application bundles of `pivot` were resolved to, sorted, which are
+// nil when it has none.
+func fetchWith(ctx context.Context, r Runtime, pivot string) ([]ONF, []int, error) {
+	var match func(string) bool
+	if !selectsAll(pivot) && !hasBundle(pivot) {
+		s, err := compileSelector(ctx, pivot)
+		if err != nil {
+			return []ONF{}, nil, err
+		}
+		match = s.line()
+	}
+	set, err := fetch(ctx, r, match)
+	var pids []int
+	switch {
+	case err == nil && match == nil:
+		var s selector
+		if set, s, err = filterSelector(ctx, set, pivot); err != nil {
+			return []ONF{}, nil, err
+		}
+		pids = s.bundlePids()
+	case err != nil && (ctx.Err() == nil || (match == nil && !selectsAll(pivot))):
+		// Failed, or aborted before the app bundle pids needed
+		// to filter the results could be looked up.
+		return []ONF{}, nil, err
+	}
+	Sort(set)
+	return set, pids, err
+}
+
+// Each calls `fn` with each open network file matching `pivot` (see
+// Filter), as soon as it is decoded from the output of the external
+// tool, instead of collecting them first: memory usage does not grow
+// with the number of open network files. Results are not sorted, and
+// calls are never coalesced. Iteration stops at the first error
+// returned by `fn`, which is returned.
+func Each(pivot string, fn func(ONF) error) error {
+	return EachContext(context.Background(), pivot, fn)
+}
+
+// EachContext is the same as Each, but iteration is aborted as soon as
+// `ctx` is done, returning its error.
+func EachContext(ctx context.Context, pivot string, fn func(ONF) error) error {
+	return EachWith(ctx, DefaultRuntime, pivot, fn)
+}
+
+// EachWith is the same as EachContext, but the open network files are
+// listed by `r` instead of DefaultRuntime (see FetchWith).
+func EachWith(ctx context.Context, r Runtime, pivot string, fn func(ONF) error) error {
+	if selectsAll(pivot) {
+		return each(ctx, r, nil, fn)
+	}
+	s, err := compileSelector(ctx, pivot)
+	if err != nil {
+		return err
+	}
+	if match := s.line(); match != nil {
+		return each(ctx, r, match, fn)
+	}
+	return each(ctx, r, nil, func(f ONF) error {
+		if !s.match(f) {
+			return nil
+		}
+		return fn(f)
+	})
+}
+
+func fetchAll() ([]ONF, error) {
+	return fetch(context.Background(), DefaultRuntime, nil)
+}
+
+// each runs `r`, calling `fn` with each line accepted by
+// `match`, as soon as it is decoded. Runtimes that do not implement
+// ContextRuntime cannot be interrupted: `ctx` is checked before each
+// call to `fn` instead.
+func each(ctx context.Context, r Runtime, match func(string) bool, fn func(ONF) error) error {
+	if r, ok := r.(ContextRuntime); ok {
+		return r.EachContext(ctx, match, fn)
+	}
+	if ctx.Done() == nil {
+		return r.Each(match, fn)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.Each(match, func(f ONF) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(f)
+	})
+}
+
+// fetch collects the open network files accepted by `match`. When
+// `ctx` is done, the ones collected until then are returned with its
+// error.
+func fetch(ctx context.Context, r Runtime, match func(string) bool) ([]ONF, error) {
+	set := []ONF{}
+	err := each(ctx, r, match, func(f ONF) error {
+		set = append(set, f)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return []ONF{}, err
+	}
+	return set, err
+}
+
+func compilePivot(l internal.Logger, pivot string) (*regexp.Regexp, error) {
+	l.Printf("Building regex from: %v", pivot)
+	rgx, err := regexp.Compile(pivot)
+	if err != nil {
+		return nil, fmt.Errorf("unable to filter open network file set: %w", err)
+	}
+	return rgx, nil
+}
+
+// Partial reports whether FetchAll may be missing the open network files
+// of other users' processes, as it happens on unix systems when lsof is
+// not run as root (on macOS, System Integrity Protection hides them even
+// to lsof). When true, the returned string explains why.
+func Partial() (bool, string) {
+	return DefaultRuntime.Partial()
+}
+
+// Backend returns the name of the external tool used by FetchAll
+// to retrieve the open network files on this platform.
+func Backend() string {
+	return DefaultRuntime.Backend()
 }
 
 // Filter takes `pivot` and creates a compiled regex out of it. It then uses
 // it to filter `set`, removing every open network file that do not match.
+// If `pivot` is the path of a .app bundle, only the open network files of
+// the processes running the bundle's executable are kept instead (see
+// BundlePids). Pivots combined by Any keep the open network files
+// matching any of them.
 // If an error occurs, it is returned together with the original list.
 func Filter(set []ONF, pivot string) ([]ONF, error) {
-	if pivot == "" || pivot == "*" {
-		return set, nil
-	}
+	return filter(context.Background(), set, pivot)
+}
 
-	log.Printf("Building regex from: %v", pivot)
-	rgx, err := regexp.Compile(pivot)
+func filter(ctx context.Context, set []ONF, pivot string) ([]ONF, error) {
+	set, _, err := filterSelector(ctx, set, pivot)
+	return set, err
+}
+
+// filterSelector is the same as filter, but also returns the selector
+// compiled from `pivot`.
+func filterSelector(ctx context.Context, set []ONF, pivot string) ([]ONF, selector, error) {
+	if selectsAll(pivot) {
+		return set, selector{}, nil
+	}
+	s, err := compileSelector(ctx, pivot)
 	if err != nil {
-		return set, fmt.Errorf("unable to filter open network file set: %w", err)
+		return set, s, err
 	}
 	acc := make([]ONF, 0, len(set))
 	for _, v := range set {
-		if !rgx.MatchString(v.Raw) {
-			log.Printf("Filtering open network file: %v", v)
+		if !s.match(v) {
+			internal.LoggerFrom(ctx).Printf("Filtering open network file: %v", v)
 			continue
 		}
 		acc = append(acc, v)
 	}
-	return acc, nil
+	return acc, s, nil
 }
@@ -0,0 +1,132 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// pivotSep separates the pivots combined by Any. Neither regular
+// expressions nor application bundle paths contain it in practice.
+const pivotSep = "\n"
+
+// Any returns a pivot selecting the open network files matching any of
+// `pivots`, which may mix regular expressions and application bundles:
+// the result can be used wherever a single pivot is accepted. All is
+// returned when no pivot is provided, or when one of them selects
+// every open network file.
+func Any(pivots ...string) string {
+	for _, v := range pivots {
+		if selectsAll(v) {
+			return All
+		}
+	}
+	return strings.Join(pivots, pivotSep)
+}
+
+// splitPivot returns the pivots combined in `pivot` by Any.
+func splitPivot(pivot string) []string {
+	return strings.Split(pivot, pivotSep)
+}
+
+// hasBundle reports whether any of the pivots combined in `pivot` is
+// an application bundle.
+func hasBundle(pivot string) bool {
+	for _, v := range splitPivot(pivot) {
+		if isBundle(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// selector matches open network files against the pivots combined in
+// a pivot: their raw line against the regular expressions, their pid
+// against the processes running the application bundles.
+type selector struct {
+	rgx  *regexp.Regexp // nil without regular expressions
+	pids map[int]bool   // nil without application bundles
+}
+
+func compileSelector(ctx context.Context, pivot string) (selector, error) {
+	l := internal.LoggerFrom(ctx)
+	var s selector
+	var exprs []string
+	for _, v := range splitPivot(pivot) {
+		if !isBundle(v) {
+			// Compiled alone first, so that errors point to the
+			// culprit.
+			if _, err := compilePivot(l, v); err != nil {
+				return s, err
+			}
+			exprs = append(exprs, v)
+			continue
+		}
+		pids, err := bundlePids(ctx, v)
+		if err != nil {
+			return s, fmt.Errorf("unable to filter open network file set: %w", err)
+		}
+		l.Printf("Filtering by pids %v (stale: %v)", pids.Used, pids.Stale)
+		if s.pids == nil {
+			s.pids = make(map[int]bool)
+		}
+		for _, p := range pids.Used {
+			s.pids[p] = true
+		}
+	}
+	switch len(exprs) {
+	case 0:
+	case 1:
+		s.rgx = regexp.MustCompile(exprs[0])
+	default:
+		s.rgx = regexp.MustCompile("(?:" + strings.Join(exprs, ")|(?:") + ")")
+	}
+	return s, nil
+}
+
+// line returns a function reporting whether a raw line may belong to a
+// selected open network file, used to skip lines before decoding them.
+// It returns nil when lines cannot be told apart before decoding, as
+// it happens with application bundles.
+func (s selector) line() func(string) bool {
+	if s.pids != nil || s.rgx == nil {
+		return nil
+	}
+	return s.rgx.MatchString
+}
+
+// bundlePids returns the pids the application bundles of `s` were
+// resolved to, sorted, or nil when it has none.
+func (s selector) bundlePids() []int {
+	if s.pids == nil {
+		return nil
+	}
+	acc := make([]int, 0, len(s.pids))
+	for v := range s.pids {
+		acc = append(acc, v)
+	}
+	sort.Ints(acc)
+	return acc
+}
+
+func (s selector) match(f ONF) bool {
+	return (s.rgx != nil && s.rgx.MatchString(f.Raw)) || s.pids[f.Pid]
+}
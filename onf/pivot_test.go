@@ -0,0 +1,53 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import "testing"
+
+func TestAny(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Raw: "Spotify   11778 dan  128u  IPv4 TCP 192.168.0.61:51291->35.186.224.47:443", Pid: 11778},
+		{Raw: "Dropbox   676   dan  10u   IPv4 TCP 192.168.0.61:51292->162.125.19.131:443", Pid: 676},
+		{Raw: "postgres  677   dan  10u   IPv6 UDP [::1]:60051->[::1]:60051", Pid: 677},
+	}
+	tt := []struct {
+		pivots []string
+		pids   []int
+	}{
+		{[]string{"Spotify"}, []int{11778}},
+		{[]string{"Spotify", "Dropbox"}, []int{11778, 676}},
+		{[]string{"Spotify", "443"}, []int{11778, 676}},
+		{[]string{"Spotify", All}, []int{11778, 676, 677}},
+		{nil, []int{11778, 676, 677}},
+	}
+	for i, v := range tt {
+		acc, err := Filter(set, Any(v.pivots...))
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+		}
+		for j, f := range acc {
+			if f.Pid != v.pids[j] {
+				t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+			}
+		}
+	}
+	if _, err := Filter(set, Any("Spotify", "Drop(box")); err == nil {
+		t.Fatalf("Expected an error with an invalid regular expression")
+	}
+}
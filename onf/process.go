@@ -0,0 +1,172 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// NoProcessError is returned by Diagnose when no running process
+// matches the filter, which usually means that it contains a typo.
+type NoProcessError struct {
+	Pivot string
+}
+
+func (e *NoProcessError) Error() string {
+	return fmt.Sprintf("no running process matches %q", e.Pivot)
+}
+
+// NoConnectionsError is returned by Diagnose when some running
+// processes match the filter, but none of them has open network files.
+type NoConnectionsError struct {
+	Pivot string
+	Pids  []int // pids of the matching processes
+}
+
+func (e *NoConnectionsError) Error() string {
+	return fmt.Sprintf("%d running processes match %q, but they have no open network files", len(e.Pids), e.Pivot)
+}
+
+// Process is a running process, as listed by ``ps'' (or ``tasklist''
+// on windows).
+type Process struct {
+	Pid  int
+	Ppid int    // parent pid, 0 when unknown
+	Line string // command line, or image name on windows
+}
+
+// Diagnose explains why Fetch returned no open network files for
+// `pivot`, returning either a *NoProcessError or a *NoConnectionsError.
+// Regular expressions are matched against the command line of the
+// running processes, application bundles are resolved with BundlePids.
+// Other errors are returned when the processes cannot be listed.
+func Diagnose(pivot string) error {
+	var pids []int
+	var procs []Process
+	for _, v := range splitPivot(pivot) {
+		if isBundle(v) {
+			p, err := BundlePids(v)
+			if err != nil {
+				return err
+			}
+			pids = append(pids, p.Used...)
+			continue
+		}
+		rgx, err := compilePivot(internal.StdLogger, v)
+		if err != nil {
+			return err
+		}
+		if procs == nil {
+			if procs, err = DefaultRuntime.Processes(); err != nil {
+				return fmt.Errorf("unable to list running processes: %w", err)
+			}
+		}
+		self := os.Getpid()
+		for _, p := range procs {
+			// lsaddr's own command line contains the filter.
+			if p.Pid != self && rgx.MatchString(p.Line) {
+				pids = append(pids, p.Pid)
+			}
+		}
+	}
+	// Pivots combined by Any are reported as a list.
+	pivot = strings.Join(splitPivot(pivot), ", ")
+	if len(pids) == 0 {
+		return &NoProcessError{Pivot: pivot}
+	}
+	return &NoConnectionsError{Pivot: pivot, Pids: dedupPids(pids)}
+}
+
+// dedupPids removes the duplicates of `pids`, keeping their order, as
+// a process may match several of the pivots combined by Any.
+func dedupPids(pids []int) []int {
+	seen := make(map[int]bool, len(pids))
+	acc := pids[:0]
+	for _, v := range pids {
+		if !seen[v] {
+			seen[v] = true
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// ParsePs expects "r" to contain the output of a ``ps -axo
+// pid=,ppid=,command='' call, that is one process per line, starting
+// with its pid and the pid of its parent.
+func ParsePs(r io.Reader) ([]Process, error) {
+	var acc []Process
+	err := internal.ScanLines(r, func(line string) error {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return nil
+		}
+		field, rest := cutField(line)
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("unable to parse ps output: %w", err)
+		}
+		field, rest = cutField(rest)
+		ppid, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("unable to parse ps output: %w", err)
+		}
+		acc = append(acc, Process{Pid: pid, Ppid: ppid, Line: strings.TrimSpace(rest)})
+		return nil
+	})
+	return acc, err
+}
+
+// cutField splits `s` at its first space, returning the first field
+// and the rest of `s`, without leading spaces.
+func cutField(s string) (string, string) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " ")
+}
+
+// ParseTasklist expects "r" to contain the output of a ``tasklist
+// /fo csv /nh'' call, that is one quoted record per process, with the
+// image name and the pid as first fields.
+func ParseTasklist(r io.Reader) ([]Process, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse tasklist output: %w", err)
+	}
+	acc := make([]Process, 0, len(records))
+	for _, v := range records {
+		if len(v) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(v[1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse tasklist output: %w", err)
+		}
+		acc = append(acc, Process{Pid: pid, Line: v[0]})
+	}
+	return acc, nil
+}
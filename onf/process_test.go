@@ -0,0 +1,65 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePs(t *testing.T) {
+	t.Parallel()
+	out := `    1     0 /sbin/launchd
+  381     1 /Applications/Spotify.app/Contents/MacOS/Spotify --autostart
+ 4062   381 
+`
+	procs, err := ParsePs(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []Process{
+		{Pid: 1, Line: "/sbin/launchd"},
+		{Pid: 381, Ppid: 1, Line: "/Applications/Spotify.app/Contents/MacOS/Spotify --autostart"},
+		{Pid: 4062, Ppid: 381},
+	}
+	if !reflect.DeepEqual(want, procs) {
+		t.Fatalf("Unexpected processes: wanted %v, found %v", want, procs)
+	}
+	for _, v := range []string{"launchd 1\n", "1 launchd\n"} {
+		if _, err := ParsePs(strings.NewReader(v)); err == nil {
+			t.Fatalf("Unexpected nil error parsing %q", v)
+		}
+	}
+}
+
+func TestParseTasklist(t *testing.T) {
+	t.Parallel()
+	out := `"System Idle Process","0","Services","0","8 K"
+"Spotify.exe","11200","Console","1","120,440 K"
+`
+	procs, err := ParseTasklist(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []Process{
+		{Pid: 0, Line: "System Idle Process"},
+		{Pid: 11200, Line: "Spotify.exe"},
+	}
+	if !reflect.DeepEqual(want, procs) {
+		t.Fatalf("Unexpected processes: wanted %v, found %v", want, procs)
+	}
+}
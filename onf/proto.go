@@ -0,0 +1,76 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Protos is a set of transport protocols (tcp, udp), used to keep only
+// the open network files using one of them. An empty set matches every
+// open network file.
+type Protos []string
+
+// ParseProtos parses `s`, a comma separated list of transport
+// protocols, ignoring case. An empty `s` returns an empty set.
+func ParseProtos(s string) (Protos, error) {
+	var p Protos
+	for _, v := range strings.Split(s, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		switch v {
+		case "":
+		case "tcp", "udp":
+			p = append(p, v)
+		default:
+			return nil, fmt.Errorf("unrecognised protocol %s (available: tcp, udp)", v)
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether `f` uses one of the protocols of `p`, or `p`
+// is empty.
+func (p Protos) Match(f ONF) bool {
+	if len(p) == 0 {
+		return true
+	}
+	if f.Src == nil {
+		return false
+	}
+	network := strings.TrimRight(strings.ToLower(f.Src.Network()), "46")
+	for _, v := range p {
+		if v == network {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterProtos returns the open network files of `set` using one of
+// the protocols of `p`.
+func FilterProtos(set []ONF, p Protos) []ONF {
+	if len(p) == 0 {
+		return set
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if p.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,58 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestParseProtos(t *testing.T) {
+	t.Parallel()
+	p, err := ParseProtos("TCP, udp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(p) != 2 || p[0] != "tcp" || p[1] != "udp" {
+		t.Fatalf("Unexpected protocols: %v", p)
+	}
+	if p, err := ParseProtos(""); err != nil || len(p) != 0 {
+		t.Fatalf("Unexpected protocols: %v, %v", p, err)
+	}
+	if _, err := ParseProtos("tcp,sctp"); err == nil {
+		t.Fatalf("Unexpected nil error parsing an unsupported protocol")
+	}
+}
+
+func TestFilterProtos(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000")},
+		{Pid: 2, Src: internal.NewAddr("udp", "*:53")},
+		{Pid: 3, Src: internal.NewAddr("tcp6", "[::1]:22")},
+		{Pid: 4},
+	}
+	if acc := FilterProtos(set, Protos{"tcp"}); len(acc) != 2 || acc[0].Pid != 1 || acc[1].Pid != 3 {
+		t.Fatalf("Unexpected tcp open network files: %v", acc)
+	}
+	if acc := FilterProtos(set, Protos{"udp"}); len(acc) != 1 || acc[0].Pid != 2 {
+		t.Fatalf("Unexpected udp open network files: %v", acc)
+	}
+	if acc := FilterProtos(set, nil); len(acc) != len(set) {
+		t.Fatalf("Unexpected open network files: %v", acc)
+	}
+}
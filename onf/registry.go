@@ -0,0 +1,91 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var registry = struct {
+	sync.Mutex
+	runtimes map[string]Runtime
+}{runtimes: make(map[string]Runtime)}
+
+func init() {
+	Register("lsof", LsofRuntime{Apps: runtime.GOOS == "darwin"})
+	var netstat Runtime = NetstatRuntime{}
+	if runtime.GOOS == "darwin" {
+		netstat = DarwinNetstatRuntime{}
+	}
+	Register("netstat", netstat)
+	switch runtime.GOOS {
+	case "darwin":
+		Register("libproc", LibprocRuntime{LsofRuntime: LsofRuntime{Apps: true}})
+	case "linux":
+		Register("ss", SsRuntime{})
+	case "freebsd":
+		Register("sockstat", SockstatRuntime{})
+	case "openbsd":
+		Register("fstat", FstatRuntime{})
+	case "windows":
+		Register("iphlpapi", IPHelperRuntime{})
+	}
+}
+
+// Register makes `r` available under `name`, so that it can be
+// selected with RuntimeByName, as the "--backend" flag does. The
+// runtimes supported by the platform are registered at init. Register
+// panics when `name` is empty or already registered, and it is meant
+// to be called from init functions.
+func Register(name string, r Runtime) {
+	registry.Lock()
+	defer registry.Unlock()
+	if name == "" || r == nil {
+		panic("onf: Register called with an empty name or a nil runtime")
+	}
+	if _, ok := registry.runtimes[name]; ok {
+		panic("onf: Register called twice for runtime " + name)
+	}
+	registry.runtimes[name] = r
+}
+
+// Runtimes returns the names of the registered runtimes, sorted.
+func Runtimes() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.runtimes))
+	for k := range registry.runtimes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RuntimeByName returns the runtime registered under `name`. To use
+// it, assign it to DefaultRuntime.
+func RuntimeByName(name string) (Runtime, error) {
+	registry.Lock()
+	r, ok := registry.runtimes[name]
+	registry.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unrecognised backend %s (available: %s)", name, strings.Join(Runtimes(), ", "))
+	}
+	return r, nil
+}
@@ -0,0 +1,48 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import "testing"
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+	fake := NetstatRuntime{Runner: fixtures(map[string]string{"netstat": netstatExample})}
+	Register("test-fake", fake)
+	r, err := RuntimeByName("test-fake")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if set := collect(t, r, nil); len(set) != 2 {
+		t.Fatalf("Unexpected set: %v", set)
+	}
+	var found bool
+	for _, v := range Runtimes() {
+		found = found || v == "test-fake"
+	}
+	if !found {
+		t.Fatalf("Registered runtime not listed: %v", Runtimes())
+	}
+	if _, err := RuntimeByName("missing"); err == nil {
+		t.Fatalf("Expected an error looking up an unregistered runtime")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected a panic registering a runtime twice")
+		}
+	}()
+	Register("test-fake", fake)
+}
@@ -0,0 +1,85 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// Runtime abstracts the platform specific parts of this package: how
+// open network files, processes and applications are listed. The
+// implementations do not depend on the platform they are compiled for,
+// as they only execute external tools through a runner.Runner, hence
+// the logic of every platform can be tested on any machine, using a
+// runner.Func replaying recorded outputs.
+type Runtime interface {
+	// Backend returns the name of the external tool listing the
+	// open network files.
+	Backend() string
+	// Each calls `fn` with each open network file whose line is
+	// accepted by `match` (nil accepts every line), as soon as
+	// it is decoded.
+	Each(match func(string) bool, fn func(ONF) error) error
+	// Partial reports whether the open network files of other
+	// users' processes may be missing, and why.
+	Partial() (bool, string)
+	// Processes lists the running processes.
+	Processes() ([]Process, error)
+	// RunningApps lists the running GUI applications.
+	RunningApps() ([]App, error)
+}
+
+// ContextRuntime is implemented by the Runtimes able to abort the
+// execution of their external tool when a context is done, which
+// EachContext and FetchContext rely on.
+type ContextRuntime interface {
+	Runtime
+	// EachContext is the same as Each, but returns the error of
+	// `ctx` as soon as it is done.
+	EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error
+}
+
+// DefaultRuntime is the Runtime used by the functions of this package.
+// It is selected at init for the platform lsaddr is running on, and may
+// be replaced before any function of this package is called (tests,
+// embedders), either with a custom implementation or with one of the
+// registered runtimes (see Register).
+var DefaultRuntime Runtime = newRuntime()
+
+func pickRunner(r runner.Runner) runner.Runner {
+	if r == nil {
+		// Resolved at each call, as runner.Default may be
+		// replaced after init.
+		return runner.Default
+	}
+	return r
+}
+
+// runTool executes `name` with `args` using `r`, with a timeout of
+// a few seconds.
+func runTool(r runner.Runner, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, _, err := pickRunner(r).Run(ctx, name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to run %s: %w", name, err)
+	}
+	return out, nil
+}
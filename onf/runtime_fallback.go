@@ -0,0 +1,126 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// FallbackRuntime chains Runtimes: open network files are listed by
+// the first one succeeding. When a runtime fails before decoding any
+// open network file, as it happens when its tool is not installed or
+// times out, the next one is tried. Processes and applications are
+// listed in the same way. As it records which runtime listed the last
+// open network files, it must be used through a pointer.
+type FallbackRuntime struct {
+	Runtimes []Runtime
+
+	mu   sync.Mutex
+	used int // index of the runtime that listed the last results
+}
+
+// last returns the runtime that listed the last open network files,
+// the first one of the chain before any lookup.
+func (f *FallbackRuntime) last() (Runtime, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Runtimes[f.used], f.used
+}
+
+// Backend returns the name of the runtime that listed the last open
+// network files, the first one of the chain before any lookup.
+func (f *FallbackRuntime) Backend() string {
+	if len(f.Runtimes) == 0 {
+		return ""
+	}
+	r, _ := f.last()
+	return r.Backend()
+}
+
+func (f *FallbackRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return f.EachContext(context.Background(), match, fn)
+}
+
+func (f *FallbackRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	err := errors.New("no runtime configured")
+	for i, r := range f.Runtimes {
+		var decoded bool
+		var fnErr error
+		err = each(ctx, r, match, func(v ONF) error {
+			decoded = true
+			fnErr = fn(v)
+			return fnErr
+		})
+		if err == nil || decoded || fnErr != nil || ctx.Err() != nil {
+			if err == nil || decoded {
+				f.mu.Lock()
+				f.used = i
+				f.mu.Unlock()
+			}
+			return err
+		}
+		if i+1 < len(f.Runtimes) {
+			internal.LoggerFrom(ctx).Printf("%s failed (%v), falling back to %s", r.Backend(), err, f.Runtimes[i+1].Backend())
+		}
+	}
+	return err
+}
+
+// Partial reports whether the runtime that listed the last open
+// network files may miss some. Results listed by a fallback runtime
+// are always reported as partial, as it is used in place of a more
+// detailed one.
+func (f *FallbackRuntime) Partial() (bool, string) {
+	if len(f.Runtimes) == 0 {
+		return false, ""
+	}
+	r, i := f.last()
+	ok, reason := r.Partial()
+	if i == 0 {
+		return ok, reason
+	}
+	msg := fmt.Sprintf("%s failed, the open network files were listed by %s", f.Runtimes[0].Backend(), r.Backend())
+	if ok {
+		msg += ", " + reason
+	}
+	return true, msg
+}
+
+func (f *FallbackRuntime) Processes() ([]Process, error) {
+	err := errors.New("no runtime configured")
+	for _, r := range f.Runtimes {
+		var procs []Process
+		if procs, err = r.Processes(); err == nil {
+			return procs, nil
+		}
+	}
+	return nil, err
+}
+
+func (f *FallbackRuntime) RunningApps() ([]App, error) {
+	err := errors.New("no runtime configured")
+	for _, r := range f.Runtimes {
+		var apps []App
+		if apps, err = r.RunningApps(); err == nil {
+			return apps, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,89 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jecoz/lsaddr/iphlp"
+)
+
+// IPHelperRuntime is the Runtime of windows, based on the IP Helper
+// API: it does not execute any external tool, does not depend on the
+// language of the system, and attributes each socket to the name of
+// its process. Windows only.
+type IPHelperRuntime struct{}
+
+func (IPHelperRuntime) Backend() string {
+	return "iphlpapi"
+}
+
+// Each calls `fn` with each socket. Sockets are matched against a line
+// made of the name of the owning process followed by the line netstat
+// would print, such as "Spotify.exe   TCP    192.168.0.61:51291    35.186.224.47:443    ESTABLISHED    11200",
+// which is also used as Raw.
+func (IPHelperRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	rows, err := iphlp.Read()
+	if err != nil {
+		return err
+	}
+	names, err := iphlp.Processes()
+	if err != nil {
+		return err
+	}
+	for _, v := range rows {
+		raw := fmt.Sprintf("%s %s", names[v.Pid], v)
+		if match != nil && !match(raw) {
+			continue
+		}
+		err := fn(ONF{
+			Raw:       raw,
+			Cmd:       names[v.Pid],
+			Pid:       v.Pid,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     v.State,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (IPHelperRuntime) Partial() (bool, string) {
+	return false, ""
+}
+
+func (IPHelperRuntime) Processes() ([]Process, error) {
+	names, err := iphlp.Processes()
+	if err != nil {
+		return nil, err
+	}
+	acc := make([]Process, 0, len(names))
+	for pid, name := range names {
+		acc = append(acc, Process{Pid: pid, Line: name})
+	}
+	sort.Slice(acc, func(i, j int) bool { return acc[i].Pid < acc[j].Pid })
+	return acc, nil
+}
+
+func (IPHelperRuntime) RunningApps() ([]App, error) {
+	return nil, fmt.Errorf("listing running applications is not supported on windows")
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// LibprocRuntime is the Runtime of macOS based on libproc: sockets are
+// enumerated with proc_pidinfo and proc_pidfdinfo instead of executing
+// lsof, which may take seconds on busy machines. It requires cgo, and
+// it is only available on macOS. Applications are listed as
+// LsofRuntime does, using lsappinfo.
+type LibprocRuntime struct {
+	LsofRuntime
+}
+
+func (LibprocRuntime) Backend() string {
+	return "libproc"
+}
+
+// Each calls `fn` with each socket. Sockets are matched against a line
+// mirroring the format of lsof, such as
+// "Spotify 11778 - 128u IPv4 - TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)",
+// which is also used as Raw.
+func (LibprocRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	socks, err := libprocSockets()
+	if err != nil {
+		return err
+	}
+	for _, v := range socks {
+		f := v.onf()
+		if match != nil && !match(f.Raw) {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Processes lists the running processes, identified by the path of
+// their executable.
+func (LibprocRuntime) Processes() ([]Process, error) {
+	return libprocProcesses()
+}
+
+// libprocSocket is a socket, as decoded from a socket_fdinfo.
+type libprocSocket struct {
+	Pid   int
+	Cmd   string
+	Fd    int
+	IPv6  bool
+	TCP   bool
+	Src   net.IP
+	Sport int
+	Dst   net.IP
+	Dport int
+	State int // tcpsi_state, TCP only
+}
+
+// libprocStates maps the TSI_S_* states to the names used by lsof.
+var libprocStates = []string{
+	"CLOSED",
+	"LISTEN",
+	"SYN_SENT",
+	"SYN_RECEIVED",
+	"ESTABLISHED",
+	"CLOSE_WAIT",
+	"FIN_WAIT_1",
+	"CLOSING",
+	"LAST_ACK",
+	"FIN_WAIT_2",
+	"TIME_WAIT",
+}
+
+func (s libprocSocket) onf() ONF {
+	network, node, typ := "udp", "UDP", "IPv4"
+	if s.TCP {
+		network, node = "tcp", "TCP"
+	}
+	if s.IPv6 {
+		typ = "IPv6"
+	}
+	var state string
+	if s.TCP && s.State >= 0 && s.State < len(libprocStates) {
+		state = libprocStates[s.State]
+	}
+	src := libprocAddr(s.Src, s.Sport)
+	dst := ""
+	if s.Dport != 0 {
+		dst = libprocAddr(s.Dst, s.Dport)
+	}
+	name := src
+	if dst != "" {
+		name += "->" + dst
+	}
+	fd := strconv.Itoa(s.Fd) + "u"
+	raw := fmt.Sprintf("%s %d - %s %s - %s %s", s.Cmd, s.Pid, fd, typ, node, name)
+	if state != "" {
+		raw += " (" + state + ")"
+	}
+	return ONF{
+		Raw:       raw,
+		Cmd:       s.Cmd,
+		Pid:       s.Pid,
+		Src:       internal.NewAddr(network, src),
+		Dst:       internal.NewAddr(network, dst),
+		State:     state,
+		CreatedAt: time.Now(),
+		File:      &File{Fd: fd, Type: typ, Node: node},
+	}
+}
+
+// libprocAddr formats an address as lsof does, using "*" for
+// unspecified addresses and ports.
+func libprocAddr(ip net.IP, port int) string {
+	host := "*"
+	if ip != nil && !ip.IsUnspecified() {
+		host = ip.String()
+	}
+	p := "*"
+	if port != 0 {
+		p = strconv.Itoa(port)
+	}
+	return net.JoinHostPort(host, p)
+}
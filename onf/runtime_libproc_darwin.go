@@ -0,0 +1,205 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build darwin,cgo
+
+package onf
+
+/*
+#include <errno.h>
+#include <string.h>
+#include <libproc.h>
+#include <sys/proc_info.h>
+#include <netinet/in.h>
+
+// lsaddr_socket mirrors libprocSocket.
+typedef struct {
+	int ipv6;
+	int tcp;
+	unsigned char laddr[16];
+	unsigned char faddr[16];
+	int lport;
+	int fport;
+	int state;
+} lsaddr_socket;
+
+// lsaddr_sockinfo decodes the socket referred to by `fd` of `pid`.
+// Returns 1 when it is an IPv4 or IPv6, TCP or UDP socket, 0 when it
+// is not, and -1 on error.
+static int lsaddr_sockinfo(int pid, int fd, lsaddr_socket *out) {
+	struct socket_fdinfo si;
+	int n = proc_pidfdinfo(pid, fd, PROC_PIDFDSOCKETINFO, &si, sizeof(si));
+	if (n < (int)sizeof(si)) {
+		return -1;
+	}
+	int family = si.psi.soi_family;
+	if (family != AF_INET && family != AF_INET6) {
+		return 0;
+	}
+	struct in_sockinfo *ini;
+	switch (si.psi.soi_kind) {
+	case SOCKINFO_TCP:
+		out->tcp = 1;
+		out->state = si.psi.soi_proto.pri_tcp.tcpsi_state;
+		ini = &si.psi.soi_proto.pri_tcp.tcpsi_ini;
+		break;
+	case SOCKINFO_IN:
+		out->tcp = 0;
+		out->state = -1;
+		ini = &si.psi.soi_proto.pri_in;
+		break;
+	default:
+		return 0;
+	}
+	memset(out->laddr, 0, 16);
+	memset(out->faddr, 0, 16);
+	if (ini->insi_vflag & INI_IPV4) {
+		out->ipv6 = 0;
+		memcpy(out->laddr, &ini->insi_laddr.ina_46.i46a_addr4, 4);
+		memcpy(out->faddr, &ini->insi_faddr.ina_46.i46a_addr4, 4);
+	} else {
+		out->ipv6 = 1;
+		memcpy(out->laddr, &ini->insi_laddr.ina_6, 16);
+		memcpy(out->faddr, &ini->insi_faddr.ina_6, 16);
+	}
+	out->lport = ntohs((unsigned short)ini->insi_lport);
+	out->fport = ntohs((unsigned short)ini->insi_fport);
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"net"
+	"unsafe"
+)
+
+// libprocPids returns the pids of the running processes.
+func libprocPids() ([]C.int, error) {
+	n, err := C.proc_listallpids(nil, 0)
+	if n <= 0 {
+		return nil, fmt.Errorf("unable to list processes: %v", err)
+	}
+	// Leave room for the processes started in the meantime.
+	pids := make([]C.int, n+64)
+	n, err = C.proc_listallpids(unsafe.Pointer(&pids[0]), C.int(len(pids))*C.int(unsafe.Sizeof(pids[0])))
+	if n <= 0 {
+		return nil, fmt.Errorf("unable to list processes: %v", err)
+	}
+	return pids[:n], nil
+}
+
+// libprocFds returns the file descriptors of `pid` referring to a
+// socket. Processes that cannot be inspected are skipped.
+func libprocFds(pid C.int) []C.int32_t {
+	size := C.proc_pidinfo(pid, C.PROC_PIDLISTFDS, 0, nil, 0)
+	if size <= 0 {
+		return nil
+	}
+	fdsize := int(unsafe.Sizeof(C.struct_proc_fdinfo{}))
+	fds := make([]C.struct_proc_fdinfo, int(size)/fdsize)
+	if len(fds) == 0 {
+		return nil
+	}
+	size = C.proc_pidinfo(pid, C.PROC_PIDLISTFDS, 0, unsafe.Pointer(&fds[0]), size)
+	if size <= 0 {
+		return nil
+	}
+	var acc []C.int32_t
+	for _, v := range fds[:int(size)/fdsize] {
+		if v.proc_fdtype == C.PROX_FDTYPE_SOCKET {
+			acc = append(acc, v.proc_fd)
+		}
+	}
+	return acc
+}
+
+func libprocName(pid C.int) string {
+	buf := make([]byte, 256)
+	n := C.proc_name(pid, unsafe.Pointer(&buf[0]), C.uint32_t(len(buf)))
+	if n <= 0 {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+// libprocPpid returns the parent pid of `pid`, or 0 when it cannot be
+// inspected.
+func libprocPpid(pid C.int) int {
+	var info C.struct_proc_bsdinfo
+	size := C.int(unsafe.Sizeof(info))
+	if C.proc_pidinfo(pid, C.PROC_PIDTBSDINFO, 0, unsafe.Pointer(&info), size) != size {
+		return 0
+	}
+	return int(info.pbi_ppid)
+}
+
+func libprocSockets() ([]libprocSocket, error) {
+	pids, err := libprocPids()
+	if err != nil {
+		return nil, err
+	}
+	var acc []libprocSocket
+	for _, pid := range pids {
+		fds := libprocFds(pid)
+		if len(fds) == 0 {
+			continue
+		}
+		cmd := libprocName(pid)
+		for _, fd := range fds {
+			var s C.lsaddr_socket
+			if C.lsaddr_sockinfo(pid, C.int(fd), &s) != 1 {
+				continue
+			}
+			size := net.IPv4len
+			if s.ipv6 != 0 {
+				size = net.IPv6len
+			}
+			acc = append(acc, libprocSocket{
+				Pid:   int(pid),
+				Cmd:   cmd,
+				Fd:    int(fd),
+				IPv6:  s.ipv6 != 0,
+				TCP:   s.tcp != 0,
+				Src:   net.IP(C.GoBytes(unsafe.Pointer(&s.laddr[0]), C.int(size))),
+				Sport: int(s.lport),
+				Dst:   net.IP(C.GoBytes(unsafe.Pointer(&s.faddr[0]), C.int(size))),
+				Dport: int(s.fport),
+				State: int(s.state),
+			})
+		}
+	}
+	return acc, nil
+}
+
+func libprocProcesses() ([]Process, error) {
+	pids, err := libprocPids()
+	if err != nil {
+		return nil, err
+	}
+	acc := make([]Process, 0, len(pids))
+	buf := make([]byte, C.PROC_PIDPATHINFO_MAXSIZE)
+	for _, pid := range pids {
+		p := Process{Pid: int(pid), Ppid: libprocPpid(pid)}
+		if n := C.proc_pidpath(pid, unsafe.Pointer(&buf[0]), C.uint32_t(len(buf))); n > 0 {
+			p.Line = string(buf[:n])
+		} else {
+			p.Line = libprocName(pid)
+		}
+		acc = append(acc, p)
+	}
+	return acc, nil
+}
@@ -0,0 +1,31 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !darwin !cgo
+
+package onf
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func libprocSockets() ([]libprocSocket, error) {
+	return nil, fmt.Errorf("libproc is not available on %s, or lsaddr was built without cgo", runtime.GOOS)
+}
+
+func libprocProcesses() ([]Process, error) {
+	return nil, fmt.Errorf("libproc is not available on %s, or lsaddr was built without cgo", runtime.GOOS)
+}
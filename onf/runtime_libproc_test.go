@@ -0,0 +1,57 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLibprocSocket(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		sock  libprocSocket
+		raw   string
+		src   string
+		dst   string
+		state string
+	}{
+		{
+			libprocSocket{Pid: 11778, Cmd: "Spotify", Fd: 128, TCP: true, Src: net.IPv4(192, 168, 0, 61).To4(), Sport: 51291, Dst: net.IPv4(35, 186, 224, 47).To4(), Dport: 443, State: 4},
+			"Spotify 11778 - 128u IPv4 - TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)",
+			"192.168.0.61:51291", "35.186.224.47:443", "ESTABLISHED",
+		},
+		{
+			libprocSocket{Pid: 812, Cmd: "sshd", Fd: 3, TCP: true, IPv6: true, Src: net.IPv6zero, Sport: 22, Dst: net.IPv6zero, State: 1},
+			"sshd 812 - 3u IPv6 - TCP *:22 (LISTEN)",
+			"*:22", "", "LISTEN",
+		},
+		{
+			libprocSocket{Pid: 188, Cmd: "mDNSResponder", Fd: 7, Src: net.IPv4zero.To4(), Sport: 5353, Dst: net.IPv4zero.To4(), State: -1},
+			"mDNSResponder 188 - 7u IPv4 - UDP *:5353",
+			"*:5353", "", "",
+		},
+	}
+	for i, v := range tt {
+		f := v.sock.onf()
+		if f.Raw != v.raw {
+			t.Fatalf("%d: unexpected raw line: wanted %q, found %q", i, v.raw, f.Raw)
+		}
+		if f.Src.String() != v.src || f.Dst.String() != v.dst || f.State != v.state {
+			t.Fatalf("%d: unexpected open network file: %v (%s)", i, f, f.State)
+		}
+	}
+}
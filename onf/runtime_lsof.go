@@ -0,0 +1,94 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/jecoz/lsaddr/lsof"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// LsofRuntime is the Runtime of unix systems, based on lsof and ps.
+type LsofRuntime struct {
+	Runner runner.Runner // runner.Default when nil
+	// Apps enables RunningApps, which uses lsappinfo and is only
+	// available on macOS.
+	Apps bool
+}
+
+func (LsofRuntime) Backend() string {
+	return "lsof"
+}
+
+func (l LsofRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return l.EachContext(context.Background(), match, fn)
+}
+
+func (l LsofRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	return lsof.ScanWithContext(ctx, pickRunner(l.Runner), match, func(v lsof.OpenFile) error {
+		return fn(ONF{
+			Raw:       v.Raw,
+			Cmd:       v.Command,
+			Pid:       v.Pid,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     string(v.State),
+			CreatedAt: time.Now(),
+			File: &File{
+				User:    v.User,
+				Fd:      v.Fd,
+				Type:    v.Type,
+				Device:  v.Device,
+				SizeOff: v.SizeOff,
+				Node:    v.Node,
+			},
+		})
+	})
+}
+
+func (LsofRuntime) Partial() (bool, string) {
+	if os.Geteuid() == 0 {
+		return false, ""
+	}
+	return true, "not running as root, the open network files of other users' processes are not listed"
+}
+
+func (l LsofRuntime) Processes() ([]Process, error) {
+	out, err := runTool(l.Runner, "ps", "-axo", "pid=,ppid=,command=")
+	if err != nil {
+		return nil, err
+	}
+	return ParsePs(bytes.NewReader(out))
+}
+
+func (l LsofRuntime) RunningApps() ([]App, error) {
+	if !l.Apps {
+		return nil, fmt.Errorf("listing running applications is not supported on %s", runtime.GOOS)
+	}
+	log.Printf("Executing: lsappinfo list")
+	out, err := runTool(l.Runner, "lsappinfo", "list")
+	if err != nil {
+		return nil, err
+	}
+	return ParseLsappinfo(bytes.NewBuffer(out))
+}
@@ -0,0 +1,69 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jecoz/lsaddr/netstat"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// NetstatRuntime is the Runtime of windows, based on netstat and
+// tasklist.
+type NetstatRuntime struct {
+	Runner runner.Runner // runner.Default when nil
+}
+
+func (NetstatRuntime) Backend() string {
+	return "netstat"
+}
+
+func (n NetstatRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return n.EachContext(context.Background(), match, fn)
+}
+
+func (n NetstatRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	return netstat.ScanWithContext(ctx, pickRunner(n.Runner), match, func(v netstat.ActiveConnection) error {
+		return fn(ONF{
+			Raw:       v.Raw,
+			Pid:       v.Pid,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     v.State,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+func (NetstatRuntime) Partial() (bool, string) {
+	return false, ""
+}
+
+func (n NetstatRuntime) Processes() ([]Process, error) {
+	out, err := runTool(n.Runner, "tasklist", "/fo", "csv", "/nh")
+	if err != nil {
+		return nil, err
+	}
+	return ParseTasklist(bytes.NewReader(out))
+}
+
+func (NetstatRuntime) RunningApps() ([]App, error) {
+	return nil, fmt.Errorf("listing running applications is not supported on windows")
+}
@@ -0,0 +1,132 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package onf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/netstat"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// DarwinNetstatRuntime is a Runtime of macOS based on ``netstat -anvW''
+// and ps, used when lsof is not available or too slow. Versions of
+// macOS not reporting the process owning each socket have its name
+// looked up with ps. Applications are listed as LsofRuntime does.
+type DarwinNetstatRuntime struct {
+	Runner runner.Runner // runner.Default when nil
+}
+
+func (DarwinNetstatRuntime) Backend() string {
+	return "netstat"
+}
+
+func (n DarwinNetstatRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return n.EachContext(context.Background(), match, fn)
+}
+
+// EachContext calls `fn` with each socket. As the lines of netstat
+// may not report the name of the processes, sockets are matched
+// against a line mirroring the format of lsof, such as
+// "Spotify 11778 - - IPv4 - TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)",
+// which is also used as Raw.
+func (n DarwinNetstatRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	var names map[int]string
+	return netstat.ScanDarwinWithContext(ctx, pickRunner(n.Runner), nil, func(v netstat.ActiveConnection) error {
+		cmd := v.Command
+		if cmd == "" {
+			if names == nil {
+				names = n.commands()
+			}
+			cmd = names[v.Pid]
+		}
+		f := darwinNetstatONF(v, cmd)
+		if match != nil && !match(f.Raw) {
+			return nil
+		}
+		return fn(f)
+	})
+}
+
+// commands returns the names of the running processes, by pid. Errors
+// are ignored: processes are left unnamed.
+func (n DarwinNetstatRuntime) commands() map[int]string {
+	names := make(map[int]string)
+	out, err := runTool(n.Runner, "ps", "-axo", "pid=,comm=")
+	if err != nil {
+		return names
+	}
+	internal.ScanLines(bytes.NewReader(out), func(line string) error {
+		field, rest := cutField(strings.TrimSpace(line))
+		if pid, err := strconv.Atoi(field); err == nil && rest != "" {
+			names[pid] = path.Base(rest)
+		}
+		return nil
+	})
+	return names
+}
+
+func darwinNetstatONF(v netstat.ActiveConnection, cmd string) ONF {
+	network, node, typ := "udp", "UDP", "IPv4"
+	if strings.HasPrefix(v.Proto, "tcp") {
+		network, node = "tcp", "TCP"
+	}
+	if strings.HasSuffix(v.Proto, "6") {
+		typ = "IPv6"
+	}
+	name := v.SrcAddr.String()
+	if v.DstAddr.String() != "" {
+		name += "->" + v.DstAddr.String()
+	}
+	command := cmd
+	if command == "" {
+		command = "-"
+	}
+	raw := fmt.Sprintf("%s %d - - %s - %s %s", command, v.Pid, typ, node, name)
+	if v.State != "" {
+		raw += " (" + v.State + ")"
+	}
+	return ONF{
+		Raw:       raw,
+		Cmd:       cmd,
+		Pid:       v.Pid,
+		Src:       internal.NewAddr(network, v.SrcAddr.String()),
+		Dst:       internal.NewAddr(network, v.DstAddr.String()),
+		State:     v.State,
+		CreatedAt: time.Now(),
+		File:      &File{Type: typ, Node: node},
+	}
+}
+
+// Partial reports false: unlike lsof, netstat lists the sockets of
+// every user.
+func (DarwinNetstatRuntime) Partial() (bool, string) {
+	return false, ""
+}
+
+func (n DarwinNetstatRuntime) Processes() ([]Process, error) {
+	return LsofRuntime{Runner: n.Runner}.Processes()
+}
+
+func (n DarwinNetstatRuntime) RunningApps() ([]App, error) {
+	return LsofRuntime{Runner: n.Runner, Apps: true}.RunningApps()
+}
@@ -0,0 +1,84 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/runner"
+	"github.com/jecoz/lsaddr/sockstat"
+)
+
+// SockstatRuntime is the Runtime of FreeBSD, based on sockstat and ps.
+// Sockets with no known owner are skipped.
+type SockstatRuntime struct {
+	Runner runner.Runner // runner.Default when nil
+}
+
+func (SockstatRuntime) Backend() string {
+	return "sockstat"
+}
+
+func (s SockstatRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return s.EachContext(context.Background(), match, fn)
+}
+
+func (s SockstatRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	return sockstat.ScanWithContext(ctx, pickRunner(s.Runner), match, func(v sockstat.Socket) error {
+		if v.Pid == 0 {
+			return nil
+		}
+		typ := "IPv4"
+		if strings.HasSuffix(v.Proto, "6") {
+			typ = "IPv6"
+		}
+		return fn(ONF{
+			Raw:       v.Raw,
+			Cmd:       v.Command,
+			Pid:       v.Pid,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     v.State,
+			CreatedAt: time.Now(),
+			File: &File{
+				User: v.User,
+				Fd:   strconv.Itoa(v.Fd) + "u",
+				Type: typ,
+				Node: strings.ToUpper(v.SrcAddr.Network()),
+			},
+		})
+	})
+}
+
+func (SockstatRuntime) Partial() (bool, string) {
+	if os.Geteuid() == 0 {
+		return false, ""
+	}
+	return true, "not running as root, the owners of other users' sockets are not reported by sockstat"
+}
+
+func (s SockstatRuntime) Processes() ([]Process, error) {
+	return LsofRuntime{Runner: s.Runner}.Processes()
+}
+
+func (SockstatRuntime) RunningApps() ([]App, error) {
+	return nil, fmt.Errorf("listing running applications is not supported on freebsd")
+}
@@ -0,0 +1,94 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/runner"
+	"github.com/jecoz/lsaddr/ss"
+)
+
+// SsRuntime is a linux Runtime based on ss and ps, for distributions
+// that do not ship lsof. Sockets shared by many processes produce an
+// open network file for each of them, as lsof does, while sockets with
+// no visible owner are skipped.
+type SsRuntime struct {
+	Runner runner.Runner // runner.Default when nil
+}
+
+func (SsRuntime) Backend() string {
+	return "ss"
+}
+
+func (s SsRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	return s.EachContext(context.Background(), match, fn)
+}
+
+func (s SsRuntime) EachContext(ctx context.Context, match func(string) bool, fn func(ONF) error) error {
+	return ss.ScanWithContext(ctx, pickRunner(s.Runner), match, func(v ss.Socket) error {
+		for _, u := range v.Users {
+			err := fn(ONF{
+				Raw:       v.Raw,
+				Cmd:       u.Cmd,
+				Pid:       u.Pid,
+				Src:       v.SrcAddr,
+				Dst:       v.DstAddr,
+				State:     v.State,
+				CreatedAt: time.Now(),
+				File: &File{
+					Fd:   strconv.Itoa(u.Fd) + "u",
+					Type: ssType(v.SrcAddr),
+					Node: strings.ToUpper(v.Proto),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ssType returns the lsof TYPE of a socket bound to `addr`.
+func ssType(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if ip := net.ParseIP(host); err == nil && ip != nil && ip.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+func (SsRuntime) Partial() (bool, string) {
+	if os.Geteuid() == 0 {
+		return false, ""
+	}
+	return true, "not running as root, the owners of other users' sockets are not reported by ss"
+}
+
+func (s SsRuntime) Processes() ([]Process, error) {
+	return LsofRuntime{Runner: s.Runner}.Processes()
+}
+
+func (SsRuntime) RunningApps() ([]App, error) {
+	return nil, fmt.Errorf("listing running applications is not supported on linux")
+}
@@ -0,0 +1,358 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// fixtures returns a runner replaying the recorded output of each
+// command in `outputs`, indexed by command name.
+func fixtures(outputs map[string]string) runner.Func {
+	return func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		out, ok := outputs[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected command: %s %s", name, strings.Join(args, " "))
+		}
+		return []byte(out), nil, nil
+	}
+}
+
+const lsofExample = `COMMAND     PID            USER   FD   TYPE             DEVICE SIZE/OFF NODE NAME
+Spotify   11778 danielmorandini  128u  IPv4 0x25c5bf09993eff03      0t0  TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)
+postgres    676 danielmorandini   10u  IPv6 0x25c5bf0997ca88e3      0t0  UDP [::1]:60051->[::1]:60051
+`
+
+const netstatExample = `
+Active Connections
+
+  Proto  Local Address          Foreign Address        State           PID
+  TCP    0.0.0.0:135            0.0.0.0:0              LISTENING       748
+  UDP    [::1]:62261            *:*                                    1036
+`
+
+func collect(t *testing.T, r Runtime, match func(string) bool) []ONF {
+	var set []ONF
+	err := r.Each(match, func(f ONF) error {
+		set = append(set, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return set
+}
+
+func TestLsofRuntime(t *testing.T) {
+	t.Parallel()
+	r := LsofRuntime{Runner: fixtures(map[string]string{
+		"lsof":      lsofExample,
+		"ps":        "11778 1 /Applications/Spotify.app/Contents/MacOS/Spotify\n",
+		"lsappinfo": lsappinfoExample,
+	})}
+	if r.Backend() != "lsof" {
+		t.Fatalf("Unexpected backend: %s", r.Backend())
+	}
+	set := collect(t, r, nil)
+	if len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	if set[0].Cmd != "Spotify" || set[0].File == nil || set[0].File.Fd != "128u" {
+		t.Fatalf("Unexpected open network file: %+v", set[0])
+	}
+	set = collect(t, r, func(line string) bool { return strings.HasPrefix(line, "postgres") })
+	if len(set) != 1 || set[0].Pid != 676 {
+		t.Fatalf("Unexpected filtered set: %v", set)
+	}
+
+	procs, err := r.Processes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(procs) != 1 || procs[0].Pid != 11778 {
+		t.Fatalf("Unexpected processes: %v", procs)
+	}
+
+	if _, err := r.RunningApps(); err == nil {
+		t.Fatalf("Expected an error listing applications without lsappinfo")
+	}
+	r.Apps = true
+	apps, err := r.RunningApps()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("Unexpected applications: %v", apps)
+	}
+}
+
+func TestNetstatRuntime(t *testing.T) {
+	t.Parallel()
+	r := NetstatRuntime{Runner: fixtures(map[string]string{
+		"netstat":  netstatExample,
+		"tasklist": `"Spotify.exe","1036","Console","1","120,440 K"` + "\n",
+	})}
+	set := collect(t, r, nil)
+	if len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	if set[1].Pid != 1036 || set[1].File != nil {
+		t.Fatalf("Unexpected open network file: %+v", set[1])
+	}
+	if ok, _ := r.Partial(); ok {
+		t.Fatalf("Unexpected partial results")
+	}
+	procs, err := r.Processes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(procs) != 1 || procs[0].Line != "Spotify.exe" {
+		t.Fatalf("Unexpected processes: %v", procs)
+	}
+}
+
+// TestDiagnose replaces DefaultRuntime, hence it must not run in
+// parallel with other tests.
+func TestDiagnose(t *testing.T) {
+	defer func(r Runtime) { DefaultRuntime = r }(DefaultRuntime)
+	DefaultRuntime = NetstatRuntime{Runner: fixtures(map[string]string{
+		"tasklist": `"Spotify.exe","1036","Console","1","120,440 K"` + "\n" +
+			`"Spotify.exe","1040","Console","1","20,440 K"` + "\n",
+	})}
+
+	var np *NoProcessError
+	if err := Diagnose("Spotfy"); !errors.As(err, &np) {
+		t.Fatalf("Unexpected error: wanted a NoProcessError, found %v", err)
+	}
+	var nc *NoConnectionsError
+	if err := Diagnose("Spotify"); !errors.As(err, &nc) {
+		t.Fatalf("Unexpected error: wanted a NoConnectionsError, found %v", err)
+	}
+	if len(nc.Pids) != 2 {
+		t.Fatalf("Unexpected pids: %v", nc.Pids)
+	}
+}
+
+func TestSsRuntime(t *testing.T) {
+	t.Parallel()
+	r := SsRuntime{Runner: fixtures(map[string]string{
+		"ss": `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+tcp   ESTAB  0      0      192.168.0.61:51291  35.186.224.47:443 users:(("Spotify",pid=11778,fd=128),("Spotify",pid=11779,fd=5))
+tcp   LISTEN 0      128    [::]:22             [::]:*
+udp   UNCONN 0      0      [::1]:60051         [::1]:60051       users:(("postgres",pid=676,fd=10))
+`,
+	})}
+	if r.Backend() != "ss" {
+		t.Fatalf("Unexpected backend: %s", r.Backend())
+	}
+	set := collect(t, r, nil)
+	if len(set) != 3 {
+		t.Fatalf("Unexpected set length: wanted 3, found %d: %v", len(set), set)
+	}
+	if set[1].Pid != 11779 || set[1].State != "ESTABLISHED" || set[1].File.Fd != "5u" || set[1].File.Node != "TCP" {
+		t.Fatalf("Unexpected open network file: %+v", set[1])
+	}
+	if set[2].Cmd != "postgres" || set[2].File.Type != "IPv6" || set[2].Dst.String() != "[::1]:60051" {
+		t.Fatalf("Unexpected open network file: %+v", set[2])
+	}
+	if set := collect(t, r, func(line string) bool { return strings.Contains(line, "postgres") }); len(set) != 1 {
+		t.Fatalf("Unexpected filtered set: %v", set)
+	}
+}
+
+func TestSockstatRuntime(t *testing.T) {
+	t.Parallel()
+	r := SockstatRuntime{Runner: fixtures(map[string]string{
+		"sockstat": `USER     COMMAND    PID   FD PROTO  LOCAL ADDRESS         FOREIGN ADDRESS       STATE
+root     sshd       812   4  tcp6   *:22                  *:*                   LISTEN
+www      nginx      1201  6  tcp4   10.0.0.2:443          10.0.0.7:50000        ESTABLISHED
+?        ?          ?     ?  tcp4   10.0.0.2:51290        35.186.224.47:443     TIME_WAIT
+`,
+	})}
+	if r.Backend() != "sockstat" {
+		t.Fatalf("Unexpected backend: %s", r.Backend())
+	}
+	set := collect(t, r, nil)
+	if len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	if f := set[0].File; set[0].Cmd != "sshd" || f.Type != "IPv6" || f.Fd != "4u" || f.Node != "TCP" || f.User != "root" {
+		t.Fatalf("Unexpected open network file: %+v", set[0])
+	}
+	if set[1].Dst.String() != "10.0.0.7:50000" || set[1].State != "ESTABLISHED" {
+		t.Fatalf("Unexpected open network file: %+v", set[1])
+	}
+}
+
+func TestFstatRuntime(t *testing.T) {
+	t.Parallel()
+	r := FstatRuntime{Runner: fixtures(map[string]string{
+		"fstat": `USER     CMD          PID   FD MOUNT        INUM  MODE         R/W    SZ|DV
+root     sshd       68766    4* internet6 stream tcp 0x0 [*]:22
+dan      firefox    12345   48* internet stream tcp 0x0 10.0.0.2:41234 <-> 1.2.3.4:443
+`,
+		"netstat": `Proto   Recv-Q Send-Q  Local Address          Foreign Address        TCP-State
+tcp          0      0  10.0.0.2.41234         1.2.3.4.443            ESTABLISHED
+`,
+	})}
+	if r.Backend() != "fstat" {
+		t.Fatalf("Unexpected backend: %s", r.Backend())
+	}
+	set := collect(t, r, nil)
+	if len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	if f := set[0].File; set[0].Cmd != "sshd" || f.Type != "IPv6" || f.Fd != "4u" || f.Node != "TCP" || f.User != "root" {
+		t.Fatalf("Unexpected open network file: %+v", set[0])
+	}
+	if set[1].Dst.String() != "1.2.3.4:443" || set[1].State != "ESTABLISHED" {
+		t.Fatalf("Unexpected open network file: %+v", set[1])
+	}
+}
+
+const darwinNetstatExample = `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)     rhiwat shiwat    pid   epid  state    options
+tcp4       0      0  192.168.0.61.51291     35.186.224.47.443      ESTABLISHED 131072 131768  11778      0 0x0102 0x00000008
+udp4       0      0  *.5353                 *.*                                786896   9216    188      0 0x0000 0x00000000
+`
+
+func TestDarwinNetstatRuntime(t *testing.T) {
+	t.Parallel()
+	r := DarwinNetstatRuntime{Runner: fixtures(map[string]string{
+		"netstat": darwinNetstatExample,
+		"ps": "  188 /usr/sbin/mDNSResponder\n" +
+			"11778 /Applications/Spotify.app/Contents/MacOS/Spotify\n",
+	})}
+	set := collect(t, r, nil)
+	if len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	if set[0].Cmd != "Spotify" || set[0].Dst.String() != "35.186.224.47:443" || set[0].State != "ESTABLISHED" {
+		t.Fatalf("Unexpected open network file: %+v", set[0])
+	}
+	want := "mDNSResponder 188 - - IPv4 - UDP *:5353"
+	if set[1].Raw != want {
+		t.Fatalf("Unexpected raw line: wanted %q, found %q", want, set[1].Raw)
+	}
+	if set := collect(t, r, func(line string) bool { return strings.Contains(line, "Spotify") }); len(set) != 1 {
+		t.Fatalf("Unexpected filtered set: %v", set)
+	}
+}
+
+func TestFallbackRuntime(t *testing.T) {
+	t.Parallel()
+	run := fixtures(map[string]string{
+		"netstat": darwinNetstatExample,
+		"ps":      "11778 /Applications/Spotify.app/Contents/MacOS/Spotify\n",
+	})
+	r := &FallbackRuntime{Runtimes: []Runtime{LsofRuntime{Runner: run}, DarwinNetstatRuntime{Runner: run}}}
+	if r.Backend() != "lsof" {
+		t.Fatalf("Unexpected backend: %s", r.Backend())
+	}
+	if set := collect(t, r, nil); len(set) != 2 {
+		t.Fatalf("Unexpected set length: wanted 2, found %d: %v", len(set), set)
+	}
+	// The runtime that listed the results is reported.
+	if r.Backend() != "netstat" {
+		t.Fatalf("Unexpected backend after falling back: %s", r.Backend())
+	}
+	if ok, reason := r.Partial(); !ok || !strings.Contains(reason, "lsof failed") {
+		t.Fatalf("Unexpected partial report after falling back: %v %q", ok, reason)
+	}
+
+	// Errors returned by the callback do not fall back.
+	stop := errors.New("stop")
+	var n int
+	err := r.Each(nil, func(ONF) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("Unexpected error: wanted %v after one call, found %v after %d", stop, err, n)
+	}
+	if err := (&FallbackRuntime{Runtimes: []Runtime{LsofRuntime{Runner: run}}}).Each(nil, func(ONF) error { return nil }); err == nil {
+		t.Fatalf("Unexpected nil error when every runtime fails")
+	}
+}
+
+// TestFetchContext replaces DefaultRuntime, hence it must not run in
+// parallel with other tests.
+func TestFetchContext(t *testing.T) {
+	defer func(r Runtime) { DefaultRuntime = r }(DefaultRuntime)
+	stall := runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	DefaultRuntime = LsofRuntime{Runner: stall}
+	if _, err := FetchContext(ctx, "Spotify"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.Canceled, err)
+	}
+
+	// Runtimes not implementing ContextRuntime are checked between
+	// open network files.
+	DefaultRuntime = struct{ Runtime }{NetstatRuntime{Runner: fixtures(map[string]string{"netstat": netstatExample})}}
+	if err := EachContext(ctx, All, func(ONF) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.Canceled, err)
+	}
+	set, err := FetchContext(context.Background(), "1036")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(set) != 1 || set[0].Pid != 1036 {
+		t.Fatalf("Unexpected set: %v", set)
+	}
+}
+
+// abortRuntime cancels the lookup once the second open network file
+// is decoded, as a timeout expiring while the backend is listing them.
+type abortRuntime struct {
+	Runtime
+	cancel func()
+}
+
+func (r abortRuntime) Each(match func(string) bool, fn func(ONF) error) error {
+	var n int
+	return r.Runtime.Each(match, func(f ONF) error {
+		if n++; n == 2 {
+			r.cancel()
+		}
+		return fn(f)
+	})
+}
+
+func TestFetchWith_Aborted(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := abortRuntime{Runtime: NetstatRuntime{Runner: fixtures(map[string]string{"netstat": netstatExample})}, cancel: cancel}
+	set, err := FetchWith(ctx, r, All)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.Canceled, err)
+	}
+	// The open network file decoded before is returned.
+	if len(set) != 1 {
+		t.Fatalf("Unexpected set: %v", set)
+	}
+}
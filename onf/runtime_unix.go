@@ -13,31 +13,30 @@
 // You should have received a copy of the GNU Affero General Public License
 // along with this program. If not, see <http://www.gnu.org/licenses/>.
 
-// +build !windows
+// +build !windows,!freebsd,!openbsd
 
 package onf
 
 import (
-	"time"
-
-	"github.com/jecoz/lsaddr/lsof"
+	"runtime"
+	"syscall"
 )
 
-func fetchAll() ([]ONF, error) {
-	set, err := lsof.Run()
-	if err != nil {
-		return []ONF{}, err
-	}
-	mapped := make([]ONF, len(set))
-	for i, v := range set {
-		mapped[i] = ONF{
-			Raw:       v.Raw,
-			Cmd:       v.Command,
-			Pid:       v.Pid,
-			Src:       v.SrcAddr,
-			Dst:       v.DstAddr,
-			CreatedAt: time.Now(),
-		}
+// newRuntime returns LsofRuntime. On macOS, netstat is used when lsof
+// fails, as it happens when it is not installed or times out on busy
+// machines.
+func newRuntime() Runtime {
+	if runtime.GOOS == "darwin" {
+		return &FallbackRuntime{Runtimes: []Runtime{
+			LsofRuntime{Apps: true},
+			DarwinNetstatRuntime{},
+		}}
 	}
-	return mapped, nil
+	return LsofRuntime{}
+}
+
+// processExists reports whether a process with `pid` is running.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
 }
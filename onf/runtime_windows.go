@@ -17,26 +17,21 @@
 
 package onf
 
-import (
-	"time"
+import "syscall"
 
-	"github.com/jecoz/lsaddr/netstat"
-)
+func newRuntime() Runtime {
+	return IPHelperRuntime{}
+}
 
-func fetchAll() ([]ONF, error) {
-	set, err := netstat.Run()
+// processExists reports whether a process with `pid` is running.
+func processExists(pid int) bool {
+	const processQueryLimitedInformation = 0x1000
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
 	if err != nil {
-		return []ONF{}, err
-	}
-	mapped := make([]ONF, len(set))
-	for i, v := range set {
-		mapped[i] = ONF{
-			Raw:       v.Raw,
-			Pid:       v.Pid,
-			Src:       v.SrcAddr,
-			Dst:       v.DstAddr,
-			CreatedAt: time.Now(),
-		}
+		// Access is denied to processes of other users, which
+		// still exist.
+		return err == syscall.ERROR_ACCESS_DENIED
 	}
-	return mapped, nil
+	syscall.CloseHandle(h)
+	return true
 }
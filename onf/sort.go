@@ -0,0 +1,124 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Sort orders `set` by command, pid, source and destination address,
+// so that the output does not depend on the order used by the
+// backend. Addresses are compared by network first, then numerically
+// by ip and port; addresses that cannot be parsed (i.e. wildcards)
+// come first, and are compared as strings. The sort is stable.
+func Sort(set []ONF) {
+	sort.SliceStable(set, func(i, j int) bool {
+		a, b := set[i], set[j]
+		if a.Cmd != b.Cmd {
+			return a.Cmd < b.Cmd
+		}
+		if a.Pid != b.Pid {
+			return a.Pid < b.Pid
+		}
+		if c := compareAddr(a.Src, b.Src); c != 0 {
+			return c < 0
+		}
+		return compareAddr(a.Dst, b.Dst) < 0
+	})
+}
+
+// SortBuffers orders `set` by the total number of bytes waiting in the
+// socket queues, largest first. Open network files without buffers
+// information come last. The sort is stable.
+func SortBuffers(set []ONF) {
+	total := func(f ONF) uint64 {
+		if f.Buffers == nil {
+			return 0
+		}
+		return f.Buffers.Send + f.Buffers.Recv
+	}
+	sort.SliceStable(set, func(i, j int) bool {
+		a, b := set[i], set[j]
+		if (a.Buffers == nil) != (b.Buffers == nil) {
+			return b.Buffers == nil
+		}
+		return total(a) > total(b)
+	})
+}
+
+func compareAddr(a, b net.Addr) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if a.Network() != b.Network() {
+		if a.Network() < b.Network() {
+			return -1
+		}
+		return 1
+	}
+	aip, aport, aok := splitAddr(a.String())
+	bip, bport, bok := splitAddr(b.String())
+	switch {
+	case aok && bok:
+		if c := bytes.Compare(aip, bip); c != 0 {
+			return c
+		}
+		switch {
+		case aport < bport:
+			return -1
+		case aport > bport:
+			return 1
+		}
+		return 0
+	case aok:
+		return 1
+	case bok:
+		return -1
+	}
+	switch {
+	case a.String() < b.String():
+		return -1
+	case a.String() > b.String():
+		return 1
+	}
+	return 0
+}
+
+// splitAddr returns the 16 bytes representation of the ip of `addr`
+// and its port, if both can be parsed.
+func splitAddr(addr string) (net.IP, int, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, false
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, 0, false
+	}
+	return ip.To16(), n, true
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+	tcp := func(s string) ONF {
+		return ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", s)}
+	}
+	set := []ONF{
+		tcp("10.0.0.10:443"),
+		{Cmd: "curl", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:6000")},
+		tcp("10.0.0.9:443"),
+		{Cmd: "Spotify", Pid: 3, Src: internal.NewAddr("udp", "*:57621")},
+		tcp("10.0.0.9:80"),
+		{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "*:22")},
+	}
+	Sort(set)
+	want := []string{
+		"Spotify 3 *:57621 <nil>",
+		"curl 1 10.0.0.2:6000 <nil>",
+		"curl 2 *:22 <nil>",
+		"curl 2 10.0.0.2:5000 10.0.0.9:80",
+		"curl 2 10.0.0.2:5000 10.0.0.9:443",
+		"curl 2 10.0.0.2:5000 10.0.0.10:443",
+	}
+	for i, v := range set {
+		got := v.Cmd + " " + strconv.Itoa(v.Pid) + " " + str(v.Src) + " " + str(v.Dst)
+		if got != want[i] {
+			t.Fatalf("%d: Unexpected open network file: wanted %q, found %q", i, want[i], got)
+		}
+	}
+}
+
+func str(a net.Addr) string {
+	if a == nil {
+		return "<nil>"
+	}
+	return a.String()
+}
+
+func TestSortBuffers(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1},
+		{Pid: 2, Buffers: &Buffers{Send: 10}},
+		{Pid: 3, Buffers: &Buffers{Send: 100, Recv: 1}},
+		{Pid: 4, Buffers: &Buffers{}},
+	}
+	SortBuffers(set)
+	for i, pid := range []int{3, 2, 4, 1} {
+		if set[i].Pid != pid {
+			t.Fatalf("%d: Unexpected pid: wanted %d, found %d", i, pid, set[i].Pid)
+		}
+	}
+}
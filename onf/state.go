@@ -0,0 +1,87 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import "strings"
+
+// States is a set of connection states (i.e. LISTEN, ESTABLISHED),
+// used to keep only the open network files in one of them. An empty
+// set matches every open network file.
+type States []string
+
+// stateAliases maps the names used by some backends to the ones used
+// by lsof, after canonicalization.
+var stateAliases = map[string]string{
+	"LISTENING": "LISTEN",
+	"ESTAB":     "ESTABLISHED",
+	"SYNRECV":   "SYNRECEIVED",
+	"FINWAIT":   "FINWAIT1",
+}
+
+// canonicalState returns `s` in upper case without separators, with
+// aliases resolved, so that "fin-wait-1", "FIN_WAIT1" and "FIN_WAIT_1"
+// compare equal.
+func canonicalState(s string) string {
+	s = strings.ToUpper(strings.NewReplacer("_", "", "-", "").Replace(strings.TrimSpace(s)))
+	if v, ok := stateAliases[s]; ok {
+		return v
+	}
+	return s
+}
+
+// ParseStates parses `s`, a comma separated list of connection
+// states, ignoring case and separators (i.e. "listen,time-wait"). An
+// empty `s` returns an empty set.
+func ParseStates(s string) States {
+	var acc States
+	for _, v := range strings.Split(s, ",") {
+		if v = canonicalState(v); v != "" {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
+
+// Match reports whether the state of `f` is one of `s`, or `s` is
+// empty. Open network files without a state, such as UDP sockets,
+// only match an empty set.
+func (s States) Match(f ONF) bool {
+	if len(s) == 0 {
+		return true
+	}
+	state := canonicalState(f.State)
+	for _, v := range s {
+		if v == state {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterStates returns the open network files of `set` in one of the
+// states of `s`.
+func FilterStates(set []ONF, s States) []ONF {
+	if len(s) == 0 {
+		return set
+	}
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if s.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
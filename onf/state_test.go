@@ -0,0 +1,50 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import "testing"
+
+func TestFilterStates(t *testing.T) {
+	t.Parallel()
+	set := []ONF{
+		{Pid: 1, State: "LISTEN"},
+		{Pid: 2, State: "LISTENING"},
+		{Pid: 3, State: "ESTABLISHED"},
+		{Pid: 4, State: "FIN_WAIT_1"},
+		{Pid: 5},
+	}
+	tt := []struct {
+		states string
+		pids   []int
+	}{
+		{"listen", []int{1, 2}},
+		{"established,fin-wait-1", []int{3, 4}},
+		{"ESTAB", []int{3}},
+		{"", []int{1, 2, 3, 4, 5}},
+		{"time_wait", nil},
+	}
+	for i, v := range tt {
+		acc := FilterStates(set, ParseStates(v.states))
+		if len(acc) != len(v.pids) {
+			t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+		}
+		for j, f := range acc {
+			if f.Pid != v.pids[j] {
+				t.Fatalf("%d: Unexpected open network files: %v", i, acc)
+			}
+		}
+	}
+}
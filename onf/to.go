@@ -0,0 +1,108 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Target is a remote endpoint, identified by the addresses its host
+// name resolves to.
+type Target struct {
+	Host string
+	Port int // 0 matches any port
+	IPs  []net.IP
+}
+
+func (t Target) String() string {
+	if t.Port == 0 {
+		return t.Host
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// ParseTarget parses `s`, in the form "host[:port]" (use brackets for
+// IPv6 addresses with a port, as in "[::1]:5432"), and resolves host to
+// all its A and AAAA records using `r` (net.DefaultResolver when nil).
+// IP addresses are not resolved.
+func ParseTarget(ctx context.Context, s string, r *net.Resolver) (Target, error) {
+	host, port := s, ""
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host, port = h, p
+	} else if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		host = s[1 : len(s)-1]
+	}
+	if host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing host", s)
+	}
+	t := Target{Host: host}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return Target{}, fmt.Errorf("invalid target %q: invalid port %s", s, port)
+		}
+		t.Port = n
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		t.IPs = []net.IP{ip}
+		return t, nil
+	}
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return Target{}, fmt.Errorf("unable to resolve target %s: %w", host, err)
+	}
+	for _, v := range addrs {
+		t.IPs = append(t.IPs, v.IP)
+	}
+	return t, nil
+}
+
+// Match reports whether the destination of `f` is one of the
+// addresses of `t`.
+func (t Target) Match(f ONF) bool {
+	if f.Dst == nil {
+		return false
+	}
+	ip, port, ok := splitAddr(f.Dst.String())
+	if !ok || (t.Port != 0 && port != t.Port) {
+		return false
+	}
+	for _, v := range t.IPs {
+		// Equal also matches IPv4-mapped IPv6 addresses.
+		if v.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterTarget returns the open network files of `set` connected to `t`.
+func FilterTarget(set []ONF, t Target) []ONF {
+	acc := make([]ONF, 0, len(set))
+	for _, v := range set {
+		if t.Match(v) {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
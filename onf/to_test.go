@@ -0,0 +1,71 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+func TestParseTarget(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in   string
+		host string
+		port int
+	}{
+		{"10.0.0.5:5432", "10.0.0.5", 5432},
+		{"10.0.0.5", "10.0.0.5", 0},
+		{"[2001:db8::1]:5432", "2001:db8::1", 5432},
+		{"[2001:db8::1]", "2001:db8::1", 0},
+		{"2001:db8::1", "2001:db8::1", 0},
+	}
+	for i, v := range tt {
+		target, err := ParseTarget(context.Background(), v.in, nil)
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if target.Host != v.host || target.Port != v.port || len(target.IPs) != 1 {
+			t.Fatalf("%d: unexpected target: %+v", i, target)
+		}
+	}
+	for i, v := range []string{"", ":5432", "10.0.0.5:http", "10.0.0.5:70000"} {
+		if _, err := ParseTarget(context.Background(), v, nil); err == nil {
+			t.Fatalf("%d: expected an error parsing %q", i, v)
+		}
+	}
+}
+
+func TestFilterTarget(t *testing.T) {
+	t.Parallel()
+	target, _ := ParseTarget(context.Background(), "10.0.0.5:5432", nil)
+	set := []ONF{
+		{Cmd: "api", Dst: internal.NewAddr("tcp", "10.0.0.5:5432")},
+		{Cmd: "worker", Dst: internal.NewAddr("tcp", "[::ffff:10.0.0.5]:5432")},
+		{Cmd: "cache", Dst: internal.NewAddr("tcp", "10.0.0.5:6379")},
+		{Cmd: "postgres", Src: internal.NewAddr("tcp", "10.0.0.5:5432")},
+	}
+	set = FilterTarget(set, target)
+	if len(set) != 2 || set[0].Cmd != "api" || set[1].Cmd != "worker" {
+		t.Fatalf("Unexpected set: %v", set)
+	}
+	target.Port = 0
+	if !target.Match(ONF{Dst: internal.NewAddr("tcp", "10.0.0.5:6379")}) {
+		t.Fatalf("Expected a match on any port")
+	}
+}
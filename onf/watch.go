@@ -0,0 +1,203 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// Change lists the open network files opened and closed between two
+// consecutive lookups.
+type Change struct {
+	Opened []ONF
+	Closed []ONF
+	// Resolved reports that the application bundles of the pivot
+	// were resolved to processes other than the previous lookup, as
+	// it happens when the application is restarted or updated. Pids
+	// are the new ones.
+	Resolved bool
+	Pids     []int
+	Time     time.Time // time of the second lookup
+}
+
+// Watch calls FetchContext(ctx, pivot) every `interval`, until `ctx`
+// is done (aborting the lookup in progress), calling `fn` with the
+// open network files opened and closed since the previous lookup
+// (see Diff). The first lookup is the baseline:
+// the open network files it finds are not reported as opened, and
+// `fn` is only called when something changes. Application bundles
+// are resolved again by each lookup, so that the processes of a
+// restarted application are watched in place of the exited ones, and
+// reported as Resolved. Lookup errors do not stop the watch, as they
+// are usually transient, or the application is being restarted: they
+// are logged, retried at the next lookup, and the last one is
+// returned together with the context error. Errors returned by `fn`
+// stop the watch, and are returned.
+func Watch(ctx context.Context, pivot string, interval time.Duration, fn func(Change) error) error {
+	return WatchWith(ctx, DefaultRuntime, pivot, interval, nil, fn)
+}
+
+// WatchWith is the same as Watch, but the open network files are
+// listed by `r` instead of DefaultRuntime (see FetchWith), and each
+// lookup is passed through `filter`, when not nil, before being
+// compared with the previous one. Filtering the lookups, rather than
+// the changes, reports the open network files entering the filter,
+// such as connections reaching the ESTABLISHED state, as opened.
+// Errors returned by `filter` stop the watch, and are returned.
+func WatchWith(ctx context.Context, r Runtime, pivot string, interval time.Duration, filter func([]ONF) ([]ONF, error), fn func(Change) error) error {
+	return watch(ctx, r, pivot, interval, nil, false, filter, fn)
+}
+
+// Resume is the same as WatchWith, but `baseline` is used as the
+// result of the previous lookup, such as the last one of a watch that
+// was stopped: the first lookup is compared with it, reporting the
+// open network files opened and closed in between.
+func Resume(ctx context.Context, r Runtime, pivot string, interval time.Duration, baseline []ONF, filter func([]ONF) ([]ONF, error), fn func(Change) error) error {
+	return watch(ctx, r, pivot, interval, baseline, true, filter, fn)
+}
+
+func watch(ctx context.Context, r Runtime, pivot string, interval time.Duration, prev []ONF, init bool, filter func([]ONF) ([]ONF, error), fn func(Change) error) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	var (
+		last     error
+		resolved []int // pids of the application bundles, nil until known
+	)
+	for {
+		set, pids, err := fetchWith(ctx, r, pivot)
+		if err == nil && filter != nil {
+			if set, err = filter(set); err != nil {
+				return err
+			}
+		}
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// Aborted, the context error is returned below.
+		case err != nil:
+			internal.LoggerFrom(ctx).Printf("Watch lookup failed: %v", err)
+			last = err
+		case !init:
+			prev, init = set, true
+			resolved = pids
+		default:
+			c := Change{Time: time.Now()}
+			c.Opened, c.Closed = Diff(prev, set)
+			if resolved != nil && !equalPids(resolved, pids) {
+				c.Resolved, c.Pids = true, pids
+			}
+			if pids != nil {
+				resolved = pids
+			}
+			prev = set
+			if len(c.Opened) > 0 || len(c.Closed) > 0 || c.Resolved {
+				if err := fn(c); err != nil {
+					return err
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if last != nil {
+				return last
+			}
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+func equalPids(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the open network files of `next` that are not in
+// `prev` (opened), and those of `prev` that are not in `next`
+// (closed). Open network files are identified by command, pid, and
+// source and destination addresses: state changes are not reported
+// (see Changed).
+func Diff(prev, next []ONF) (opened, closed []ONF) {
+	seen := make(map[string]bool, len(prev))
+	for _, v := range prev {
+		seen[Identity(v)] = true
+	}
+	found := make(map[string]bool, len(next))
+	for _, v := range next {
+		id := Identity(v)
+		found[id] = true
+		if !seen[id] {
+			opened = append(opened, v)
+		}
+	}
+	for _, v := range prev {
+		if !found[Identity(v)] {
+			closed = append(closed, v)
+		}
+	}
+	return opened, closed
+}
+
+// Changed returns the open network files of `next` that are also in
+// `prev`, as identified by Diff, but whose other fields differ (i.e.
+// the State of a connection, or its DstName), together with their
+// versions in `prev`, in the same order. CreatedAt is ignored, as it
+// is set each time an open network file is decoded.
+func Changed(prev, next []ONF) (before, after []ONF) {
+	index := make(map[string]int, len(prev))
+	for i, v := range prev {
+		index[Identity(v)] = i
+	}
+	for _, v := range next {
+		i, ok := index[Identity(v)]
+		if !ok {
+			continue
+		}
+		a, b := prev[i], v
+		a.CreatedAt, b.CreatedAt = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(a, b) {
+			before = append(before, prev[i])
+			after = append(after, v)
+		}
+	}
+	return before, after
+}
+
+// Identity returns the key identifying `f` across lookups, made of
+// its command, pid, and source and destination addresses, as used by
+// Diff.
+func Identity(f ONF) string {
+	return f.Cmd + "\x00" + strconv.Itoa(f.Pid) + "\x00" + addrIdentity(f.Src) + "\x00" + addrIdentity(f.Dst)
+}
+
+func addrIdentity(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.Network() + "/" + addr.String()
+}
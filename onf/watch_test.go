@@ -0,0 +1,234 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package onf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	spotify := ONF{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")}
+	curl := ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")}
+	dns := ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("udp", "10.0.0.2:5001"), Dst: internal.NewAddr("udp", "1.1.1.1:443")}
+	established := spotify
+	established.State = "ESTABLISHED"
+
+	tt := []struct {
+		prev, next     []ONF
+		opened, closed int
+	}{
+		{prev: nil, next: []ONF{spotify}, opened: 1},
+		{prev: []ONF{spotify, curl}, next: []ONF{spotify}, closed: 1},
+		{prev: []ONF{spotify}, next: []ONF{established}},
+		{prev: []ONF{curl}, next: []ONF{dns}, opened: 1, closed: 1},
+	}
+	for i, v := range tt {
+		opened, closed := Diff(v.prev, v.next)
+		if len(opened) != v.opened || len(closed) != v.closed {
+			t.Fatalf("%d: Unexpected diff: opened %v, closed %v", i, opened, closed)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	t.Parallel()
+	spotify := ONF{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443"), State: "SYN_SENT"}
+	curl := ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")}
+	established := spotify
+	established.State = "ESTABLISHED"
+	later := spotify
+	later.CreatedAt = time.Now()
+
+	tt := []struct {
+		prev, next []ONF
+		changed    int
+	}{
+		{prev: nil, next: []ONF{spotify}},
+		{prev: []ONF{spotify, curl}, next: []ONF{established, curl}, changed: 1},
+		{prev: []ONF{spotify}, next: []ONF{later}},
+	}
+	for i, v := range tt {
+		before, after := Changed(v.prev, v.next)
+		if len(before) != v.changed || len(after) != v.changed {
+			t.Fatalf("%d: Unexpected changes: before %v, after %v", i, before, after)
+		}
+	}
+	before, after := Changed([]ONF{spotify}, []ONF{established})
+	if before[0].State != "SYN_SENT" || after[0].State != "ESTABLISHED" {
+		t.Fatalf("Unexpected changes: before %v, after %v", before, after)
+	}
+}
+
+// TestWatch replaces DefaultRuntime, hence it must not run in
+// parallel with other tests.
+func TestWatch(t *testing.T) {
+	defer func(r Runtime) { DefaultRuntime = r }(DefaultRuntime)
+	lines := strings.Split(lsofExample, "\n")
+	outputs := []string{
+		lsofExample,
+		lsofExample,
+		lines[0] + "\n" + lines[1] + "\nSpotify   11778 danielmorandini  130u  IPv4 0x25c5bf09993eff04      0t0  TCP 192.168.0.61:51292->35.186.224.47:443 (ESTABLISHED)\n",
+	}
+	var calls int
+	DefaultRuntime = LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		out := outputs[len(outputs)-1]
+		if calls < len(outputs) {
+			out = outputs[calls]
+		}
+		calls++
+		return []byte(out), nil, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var changes []Change
+	err := Watch(ctx, "*", time.Millisecond, func(c Change) error {
+		changes = append(changes, c)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	c := changes[0]
+	if len(c.Opened) != 1 || c.Opened[0].Src.String() != "192.168.0.61:51292" {
+		t.Fatalf("Unexpected opened files: %v", c.Opened)
+	}
+	if len(c.Closed) != 1 || c.Closed[0].Cmd != "postgres" {
+		t.Fatalf("Unexpected closed files: %v", c.Closed)
+	}
+}
+
+func TestResume(t *testing.T) {
+	t.Parallel()
+	lines := strings.Split(lsofExample, "\n")
+	next := lines[0] + "\n" + lines[1] + "\nSpotify   11778 danielmorandini  130u  IPv4 0x25c5bf09993eff04      0t0  TCP 192.168.0.61:51292->35.186.224.47:443 (ESTABLISHED)\n"
+	baseline, err := FetchWith(context.Background(), LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		return []byte(lsofExample), nil, nil
+	})}, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		return []byte(next), nil, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var changes []Change
+	err = Resume(ctx, r, "*", time.Millisecond, baseline, nil, func(c Change) error {
+		changes = append(changes, c)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The first lookup is compared with the baseline.
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	c := changes[0]
+	if len(c.Opened) != 1 || c.Opened[0].Src.String() != "192.168.0.61:51292" {
+		t.Fatalf("Unexpected opened files: %v", c.Opened)
+	}
+	if len(c.Closed) != 1 || c.Closed[0].Cmd != "postgres" {
+		t.Fatalf("Unexpected closed files: %v", c.Closed)
+	}
+}
+
+// TestWatch_Resolved replaces runner.Default, hence it must not run in
+// parallel with other tests.
+func TestWatch_Resolved(t *testing.T) {
+	defer func(r runner.Runner) { runner.Default = r }(runner.Default)
+	dir, err := ioutil.TempDir("", "lsaddr-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bundle := filepath.Join(dir, "Spotify.app")
+	if err := os.MkdirAll(filepath.Join(bundle, "Contents"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, "Contents", "Info.plist"), []byte(infoPlistExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spotify is restarted: pgrep finds the first process, then it
+	// fails while none is running, then finds the second one. Both
+	// pids must exist, as stale ones are discarded.
+	before, after := os.Getpid(), os.Getppid()
+	pgrep := []string{fmt.Sprintln(before), "", fmt.Sprintln(after)}
+	var calls int
+	runner.Default = runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		out := pgrep[len(pgrep)-1]
+		if calls < len(pgrep) {
+			out = pgrep[calls]
+		}
+		calls++
+		if out == "" {
+			return nil, nil, fmt.Errorf("exit status 1")
+		}
+		return []byte(out), nil, nil
+	})
+	lines := strings.Split(lsofExample, "\n")
+	lsof := fmt.Sprintf("%s\nSpotify   %d danielmorandini  130u  IPv4 0x25c5bf09993eff04      0t0  TCP 192.168.0.61:51291->35.186.224.47:443 (ESTABLISHED)\nSpotify   %d danielmorandini  130u  IPv4 0x25c5bf09993eff05      0t0  TCP 192.168.0.61:51292->35.186.224.47:443 (ESTABLISHED)\n", lines[0], before, after)
+	r := LsofRuntime{Runner: runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		return []byte(lsof), nil, nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var changes []Change
+	err = WatchWith(ctx, r, bundle, time.Millisecond, nil, func(c Change) error {
+		changes = append(changes, c)
+		cancel()
+		return nil
+	})
+	// The lookup failed while Spotify was not running.
+	var np *NoProcessError
+	if !errors.As(err, &np) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	c := changes[0]
+	if !c.Resolved || len(c.Pids) != 1 || c.Pids[0] != after {
+		t.Fatalf("Unexpected resolution: %v, %v", c.Resolved, c.Pids)
+	}
+	if len(c.Opened) != 1 || c.Opened[0].Pid != after {
+		t.Fatalf("Unexpected opened files: %v", c.Opened)
+	}
+	if len(c.Closed) != 1 || c.Closed[0].Pid != before {
+		t.Fatalf("Unexpected closed files: %v", c.Closed)
+	}
+}
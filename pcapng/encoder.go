@@ -0,0 +1,155 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pcapng encodes open network files into a pcapng file that
+// contains no packets, only metadata: once merged with an actual
+// capture (i.e. with mergecap), Wireshark displays the host names
+// resolved by lsaddr and the connections it found.
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Block types.
+const (
+	blockSHB = 0x0A0D0D0A // section header
+	blockNRB = 0x00000004 // name resolution
+)
+
+// Option and record codes.
+const (
+	optEnd       = 0
+	optComment   = 1
+	nrbEnd       = 0
+	nrbIPv4      = 1
+	nrbIPv6      = 2
+	byteOrder    = 0x1A2B3C4D
+	versionMajor = 1
+	versionMinor = 0
+)
+
+var order = binary.LittleEndian
+
+// Encoder writes the pcapng metadata file. Each open network file is
+// described by a comment of the section header, and each destination
+// with a resolved name by a record of a Name Resolution Block.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	var opts bytes.Buffer
+	for _, v := range set {
+		writeOption(&opts, optComment, []byte(describe(v)))
+	}
+	writeOption(&opts, optEnd, nil)
+
+	var shb bytes.Buffer
+	binary.Write(&shb, order, uint32(byteOrder))
+	binary.Write(&shb, order, uint16(versionMajor))
+	binary.Write(&shb, order, uint16(versionMinor))
+	binary.Write(&shb, order, int64(-1)) // section length not specified
+	shb.Write(opts.Bytes())
+	if err := writeBlock(e.w, blockSHB, shb.Bytes()); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+
+	var nrb bytes.Buffer
+	seen := make(map[string]bool)
+	for _, v := range set {
+		if v.Dst == nil || v.DstName == "" {
+			continue
+		}
+		host, _, err := net.SplitHostPort(v.Dst.String())
+		if err != nil || seen[host] {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		seen[host] = true
+		code, raw := uint16(nrbIPv6), []byte(ip.To16())
+		if ip4 := ip.To4(); ip4 != nil {
+			code, raw = nrbIPv4, []byte(ip4)
+		}
+		writeOption(&nrb, code, append(append(raw, v.DstName...), 0))
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	writeOption(&nrb, nrbEnd, nil)
+	if err := writeBlock(e.w, blockNRB, nrb.Bytes()); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+func describe(f onf.ONF) string {
+	s := fmt.Sprintf("lsaddr: %s[%d] %s", f.Cmd, f.Pid, network(f.Src))
+	if f.Src != nil {
+		s += " " + f.Src.String()
+	}
+	if f.Dst != nil && f.Dst.String() != "" {
+		s += "->" + f.Dst.String()
+	}
+	if f.State != "" {
+		s += " (" + f.State + ")"
+	}
+	return s
+}
+
+func network(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.Network()
+}
+
+// writeOption writes a code/length/value triple, padded to 32 bits.
+// Name resolution records share the same layout.
+func writeOption(w *bytes.Buffer, code uint16, value []byte) {
+	binary.Write(w, order, code)
+	binary.Write(w, order, uint16(len(value)))
+	w.Write(value)
+	w.Write(make([]byte, pad(len(value))))
+}
+
+func writeBlock(w io.Writer, typ uint32, body []byte) error {
+	total := uint32(12 + len(body) + pad(len(body)))
+	var b bytes.Buffer
+	binary.Write(&b, order, typ)
+	binary.Write(&b, order, total)
+	b.Write(body)
+	b.Write(make([]byte, pad(len(body))))
+	binary.Write(&b, order, total)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
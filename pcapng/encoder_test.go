@@ -0,0 +1,65 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package pcapng_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/pcapng"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443"), DstName: "spotify.com"},
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "[2001:db8::1]:443")},
+	}
+	var b bytes.Buffer
+	if err := pcapng.NewEncoder(&b).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := b.Bytes()
+	var types []uint32
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("Truncated block: %v", data)
+		}
+		typ := binary.LittleEndian.Uint32(data[0:4])
+		total := binary.LittleEndian.Uint32(data[4:8])
+		if total%4 != 0 || int(total) > len(data) {
+			t.Fatalf("Invalid block length %d", total)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[total-4 : total]); trailer != total {
+			t.Fatalf("Block lengths do not match: %d != %d", total, trailer)
+		}
+		types = append(types, typ)
+		data = data[total:]
+	}
+	if len(types) != 2 || types[0] != 0x0A0D0D0A || types[1] != 4 {
+		t.Fatalf("Unexpected blocks: %x", types)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("lsaddr: Spotify[1] tcp 10.0.0.2:5000->35.186.224.47:443")) {
+		t.Fatalf("Missing connection comment")
+	}
+	if !bytes.Contains(b.Bytes(), append([]byte{35, 186, 224, 47}, "spotify.com\x00"...)) {
+		t.Fatalf("Missing name resolution record")
+	}
+}
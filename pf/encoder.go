@@ -0,0 +1,117 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pf encodes the destinations of open network files into a
+// pf.conf fragment, defining a table of destination addresses and a
+// rule matching it, so that the traffic of an application can be
+// allowed, or blocked, with pfctl on macOS and the BSDs.
+package pf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes a persistent table containing the destination
+// addresses of both families, followed by an outbound rule applying
+// the action to the traffic headed to them. As pf.conf does not allow
+// comments inside table definitions, the commands connected to each
+// address are listed in the comments preceding it.
+type Encoder struct {
+	w      io.Writer
+	table  string
+	action string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, table: "lsaddr", action: "pass"}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "table": name of the table, "lsaddr" by default.
+// - "action": "pass" (the default), "block" or "block-return", which
+// answers with a TCP RST or ICMP unreachable instead of dropping.
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "table":
+			if !validName(v) {
+				return nil, fmt.Errorf("invalid table %q", v)
+			}
+			e.table = v
+		case "action":
+			switch v = strings.ToLower(v); v {
+			case "pass", "block", "block-return":
+				e.action = v
+			default:
+				return nil, fmt.Errorf("invalid action %q: expected pass, block or block-return", v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown pf option %q", k)
+		}
+	}
+	return e, nil
+}
+
+// validName reports whether `s` is a valid pf table name: pf accepts
+// up to 31 characters, restricted here to those that need no quoting.
+func validName(s string) bool {
+	if s == "" || len(s) > 31 {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	hosts := aggr.Hosts(set)
+	w := bufio.NewWriter(e.w)
+	for _, v := range hosts {
+		if len(v.Cmds) > 0 {
+			fmt.Fprintf(w, "# %s: %s\n", v.IP, strings.Join(v.Cmds, ", "))
+		}
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(w, "table <%s> persist\n", e.table)
+	} else {
+		fmt.Fprintf(w, "table <%s> persist { \\\n", e.table)
+		for _, v := range hosts {
+			fmt.Fprintf(w, "\t%s \\\n", v.IP)
+		}
+		fmt.Fprintln(w, "}")
+	}
+	action := e.action
+	if action == "block-return" {
+		action = "block return"
+	}
+	fmt.Fprintf(w, "%s out quick to <%s>\n", action, e.table)
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
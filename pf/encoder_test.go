@@ -0,0 +1,88 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package pf_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/pf"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:80")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Cmd: "ping", Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "10.0.0.1:*")},
+		{Cmd: "dig", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+		// Command names are chosen by the processes.
+		{Cmd: "x\npass out all", Src: internal.NewAddr("udp6", "[::1]:5354"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+	}
+	tt := []struct {
+		set  []onf.ONF
+		opts map[string]string
+		want string
+	}{
+		{set, nil, `# 35.186.224.47: Spotify, curl
+# 10.0.0.1: ping
+# 2001:db8::1: dig, x?pass out all
+table <lsaddr> persist { \
+	35.186.224.47 \
+	10.0.0.1 \
+	2001:db8::1 \
+}
+pass out quick to <lsaddr>
+`},
+		{set[:1], map[string]string{"table": "spotify", "action": "BLOCK"}, `# 35.186.224.47: Spotify
+table <spotify> persist { \
+	35.186.224.47 \
+}
+block out quick to <spotify>
+`},
+		{set[2:3], map[string]string{"action": "block-return"}, `table <lsaddr> persist
+block return out quick to <lsaddr>
+`},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		e, err := pf.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := e.Encode(v.set); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("%d: Unexpected output: wanted %q, found %q", i, v.want, b.String())
+		}
+	}
+
+	invalid := []map[string]string{
+		{"action": "drop"},
+		{"table": "my table"},
+		{"table": "a_table_name_longer_than_31_chars"},
+		{"chain": "OUTPUT"},
+	}
+	for i, v := range invalid {
+		if _, err := pf.NewEncoderOptions(&bytes.Buffer{}, v); err == nil {
+			t.Fatalf("%d: Unexpected nil error with options %v", i, v)
+		}
+	}
+}
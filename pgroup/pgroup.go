@@ -0,0 +1,93 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package pgroup selects processes by process group or session, such
+// as everything spawned by a shell script or a login session, which
+// cannot be expressed by matching command names.
+package pgroup
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned when the platform has no notion of the
+// group requested (i.e. process groups on windows).
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// Ids are the process group and session a process belongs to. Zero
+// values are unknown or, when used to select processes, ignored.
+type Ids struct {
+	Pgid int
+	Sid  int // login session id on windows
+}
+
+// Match reports whether `i` belongs to the process group and session
+// of `want`, ignoring its zero fields.
+func (i Ids) Match(want Ids) bool {
+	return (want.Pgid == 0 || i.Pgid == want.Pgid) && (want.Sid == 0 || i.Sid == want.Sid)
+}
+
+// Select returns the pids of `pids` belonging to the process group and
+// session of `want`. Processes that exited in the meantime, or that
+// cannot be inspected, are skipped.
+func Select(pids []int, want Ids) ([]int, error) {
+	if want.Pgid != 0 && !hasPgid {
+		return nil, fmt.Errorf("process groups: %w", ErrUnsupported)
+	}
+	return selectWith(pids, want, Lookup), nil
+}
+
+func selectWith(pids []int, want Ids, lookup func(int) (Ids, error)) []int {
+	var acc []int
+	seen := make(map[int]bool)
+	for _, v := range pids {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		ids, err := lookup(v)
+		if err != nil || !ids.Match(want) {
+			continue
+		}
+		acc = append(acc, v)
+	}
+	return acc
+}
+
+// ParseStat returns the process group and session of the process
+// described by `stat`, the content of /proc/<pid>/stat on linux. The
+// command name, between parentheses, may contain spaces.
+func ParseStat(stat string) (Ids, error) {
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return Ids{}, fmt.Errorf("unable to parse process stat: missing command name")
+	}
+	// state, ppid, pgrp, session
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 4 {
+		return Ids{}, fmt.Errorf("unable to parse process stat: expected at least 4 fields after the command name, found %d", len(fields))
+	}
+	pgid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return Ids{}, fmt.Errorf("unable to parse process stat: %w", err)
+	}
+	sid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return Ids{}, fmt.Errorf("unable to parse process stat: %w", err)
+	}
+	return Ids{Pgid: pgid, Sid: sid}, nil
+}
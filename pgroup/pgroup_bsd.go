@@ -0,0 +1,34 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package pgroup
+
+import "syscall"
+
+const hasPgid = true
+
+// Lookup returns the process group and session of `pid`.
+func Lookup(pid int) (Ids, error) {
+	pgid, err := syscall.Getpgid(pid)
+	if err != nil {
+		return Ids{}, err
+	}
+	sid, err := syscall.Getsid(pid)
+	if err != nil {
+		return Ids{}, err
+	}
+	return Ids{Pgid: pgid, Sid: sid}, nil
+}
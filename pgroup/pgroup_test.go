@@ -0,0 +1,67 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package pgroup
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	t.Parallel()
+	ids, err := ParseStat("4242 (tmux: server) S 1 4242 4240 0 -1 4194560 1089 0 0 0 3 1 0 0 20 0\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ids != (Ids{Pgid: 4242, Sid: 4240}) {
+		t.Fatalf("Unexpected ids: %+v", ids)
+	}
+	if _, err := ParseStat("4242 (bash"); err == nil {
+		t.Fatalf("Expected an error parsing a truncated stat")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+	table := map[int]Ids{
+		10: {Pgid: 10, Sid: 1},
+		11: {Pgid: 10, Sid: 1},
+		12: {Pgid: 12, Sid: 1},
+		20: {Pgid: 20, Sid: 2},
+	}
+	lookup := func(pid int) (Ids, error) {
+		ids, ok := table[pid]
+		if !ok {
+			return Ids{}, fmt.Errorf("no such process")
+		}
+		return ids, nil
+	}
+	pids := []int{10, 11, 11, 12, 20, 30}
+	tt := []struct {
+		want Ids
+		pids []int
+	}{
+		{Ids{Pgid: 10}, []int{10, 11}},
+		{Ids{Sid: 1}, []int{10, 11, 12}},
+		{Ids{Pgid: 20, Sid: 1}, nil},
+		{Ids{}, []int{10, 11, 12, 20}},
+	}
+	for _, v := range tt {
+		if acc := selectWith(pids, v.want, lookup); !reflect.DeepEqual(acc, v.pids) {
+			t.Fatalf("%+v: Unexpected pids: wanted %v, found %v", v.want, v.pids, acc)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package pgroup
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procProcessIdToSessionId = kernel32.NewProc("ProcessIdToSessionId")
+)
+
+// Windows has no process groups: only sessions can be selected.
+const hasPgid = false
+
+// Lookup returns the remote desktop services session of `pid`. Its
+// Pgid is always zero.
+func Lookup(pid int) (Ids, error) {
+	var sid uint32
+	r, _, err := procProcessIdToSessionId.Call(uintptr(pid), uintptr(unsafe.Pointer(&sid)))
+	if r == 0 {
+		return Ids{}, err
+	}
+	return Ids{Sid: int(sid)}, nil
+}
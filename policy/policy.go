@@ -0,0 +1,218 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package policy tracks the destinations of a set of processes as
+// network prefixes, suitable for policy routing decisions: booster, for
+// example, uses them to bind the traffic of specific applications to
+// specific interfaces.
+package policy
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Options configure a Tracker. Zero fields are filled using
+// DefaultOptions.
+type Options struct {
+	Interval time.Duration // time between two lookups
+	Linger   time.Duration // how long a prefix is kept after its last connection is gone, negative to remove it immediately
+	Bits4    int           // length of the IPv4 prefixes
+	Bits6    int           // length of the IPv6 prefixes
+
+	// Fetch returns the open network files matching the pivot,
+	// onf.Fetch when nil.
+	Fetch func(pivot string) ([]onf.ONF, error)
+}
+
+// DefaultOptions track single hosts, polling every 2 seconds.
+var DefaultOptions = Options{
+	Interval: 2 * time.Second,
+	Linger:   30 * time.Second,
+	Bits4:    32,
+	Bits6:    128,
+	Fetch:    onf.Fetch,
+}
+
+// Tracker keeps the set of destination prefixes of the processes
+// matching Pivot up to date, calling OnAdd and OnRemove each time
+// a prefix enters or leaves the set. Callbacks are called from the
+// goroutine running Update (or Run), one at a time.
+type Tracker struct {
+	Pivot    string // process filter, as accepted by onf.Fetch
+	OnAdd    func(*net.IPNet)
+	OnRemove func(*net.IPNet)
+
+	opts Options
+
+	mu       sync.Mutex
+	prefixes map[string]*net.IPNet
+	lastSeen map[string]time.Time
+}
+
+// NewTracker returns a Tracker of the destinations of the processes
+// matching `pivot`.
+func NewTracker(pivot string, opts Options) *Tracker {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultOptions.Interval
+	}
+	if opts.Linger == 0 {
+		opts.Linger = DefaultOptions.Linger
+	}
+	if opts.Linger < 0 {
+		opts.Linger = 0
+	}
+	if opts.Bits4 <= 0 || opts.Bits4 > 32 {
+		opts.Bits4 = DefaultOptions.Bits4
+	}
+	if opts.Bits6 <= 0 || opts.Bits6 > 128 {
+		opts.Bits6 = DefaultOptions.Bits6
+	}
+	if opts.Fetch == nil {
+		opts.Fetch = DefaultOptions.Fetch
+	}
+	return &Tracker{
+		Pivot:    pivot,
+		opts:     opts,
+		prefixes: make(map[string]*net.IPNet),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Run calls Update every Interval, until `ctx` is done. Lookup errors
+// do not stop the tracker, as they are usually transient: the last one
+// is returned together with the context error.
+func (t *Tracker) Run(ctx context.Context) error {
+	tick := time.NewTicker(t.opts.Interval)
+	defer tick.Stop()
+	var last error
+	for {
+		if err := t.Update(); err != nil {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			if last != nil {
+				return last
+			}
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Update performs a single lookup, updating the set of prefixes.
+func (t *Tracker) Update() error {
+	set, err := t.opts.Fetch(t.Pivot)
+	if err != nil {
+		return err
+	}
+	return t.update(set, time.Now())
+}
+
+func (t *Tracker) update(set []onf.ONF, now time.Time) error {
+	var added, removed []*net.IPNet
+	t.mu.Lock()
+	for _, v := range Prefixes(set, t.opts.Bits4, t.opts.Bits6) {
+		key := v.String()
+		if _, ok := t.prefixes[key]; !ok {
+			t.prefixes[key] = v
+			added = append(added, v)
+		}
+		t.lastSeen[key] = now
+	}
+	for key, v := range t.prefixes {
+		if now.Sub(t.lastSeen[key]) > t.opts.Linger {
+			delete(t.prefixes, key)
+			delete(t.lastSeen, key)
+			removed = append(removed, v)
+		}
+	}
+	t.mu.Unlock()
+
+	sortPrefixes(removed)
+	for _, v := range removed {
+		if t.OnRemove != nil {
+			t.OnRemove(v)
+		}
+	}
+	for _, v := range added {
+		if t.OnAdd != nil {
+			t.OnAdd(v)
+		}
+	}
+	return nil
+}
+
+// Prefixes returns a snapshot of the current set of prefixes, sorted.
+func (t *Tracker) Prefixes() []*net.IPNet {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	acc := make([]*net.IPNet, 0, len(t.prefixes))
+	for _, v := range t.prefixes {
+		acc = append(acc, v)
+	}
+	sortPrefixes(acc)
+	return acc
+}
+
+// Prefixes returns the distinct prefixes, `bits4` and `bits6` long,
+// containing the destination addresses of `set`, sorted. Loopback and
+// unspecified destinations are skipped, as they are never routed.
+func Prefixes(set []onf.ONF, bits4, bits6 int) []*net.IPNet {
+	seen := make(map[string]bool)
+	var acc []*net.IPNet
+	for _, v := range set {
+		host, ok := aggr.DstHost(v)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+			continue
+		}
+		mask := net.CIDRMask(bits6, 128)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, mask = ip4, net.CIDRMask(bits4, 32)
+		}
+		prefix := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		if key := prefix.String(); !seen[key] {
+			seen[key] = true
+			acc = append(acc, prefix)
+		}
+	}
+	sortPrefixes(acc)
+	return acc
+}
+
+func sortPrefixes(acc []*net.IPNet) {
+	sort.Slice(acc, func(i, j int) bool {
+		if len(acc[i].IP) != len(acc[j].IP) {
+			return len(acc[i].IP) < len(acc[j].IP)
+		}
+		for k := range acc[i].IP {
+			if acc[i].IP[k] != acc[j].IP[k] {
+				return acc[i].IP[k] < acc[j].IP[k]
+			}
+		}
+		return acc[i].String() < acc[j].String()
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package policy
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+func conn(dst string) onf.ONF {
+	return onf.ONF{
+		Cmd: "Spotify",
+		Src: internal.NewAddr("tcp", "10.0.0.2:5000"),
+		Dst: internal.NewAddr("tcp", dst),
+	}
+}
+
+func strs(acc []*net.IPNet) []string {
+	s := make([]string, len(acc))
+	for i, v := range acc {
+		s[i] = v.String()
+	}
+	return s
+}
+
+func TestPrefixes(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		conn("35.186.224.53:443"),
+		conn("35.186.224.47:443"),
+		conn("127.0.0.1:8080"),
+		conn("[2001:db8::1]:443"),
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "*:57621")},
+	}
+	want := []string{"35.186.224.0/24", "2001:db8::/64"}
+	if got := strs(Prefixes(set, 24, 64)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected prefixes: wanted %v, found %v", want, got)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+	var added, removed []string
+	tr := NewTracker("Spotify", Options{Linger: time.Minute})
+	tr.OnAdd = func(n *net.IPNet) { added = append(added, n.String()) }
+	tr.OnRemove = func(n *net.IPNet) { removed = append(removed, n.String()) }
+
+	now := time.Now()
+	tr.update([]onf.ONF{conn("1.1.1.1:443"), conn("8.8.8.8:443")}, now)
+	tr.update([]onf.ONF{conn("1.1.1.1:443")}, now.Add(30*time.Second))
+	if !reflect.DeepEqual(added, []string{"1.1.1.1/32", "8.8.8.8/32"}) || len(removed) != 0 {
+		t.Fatalf("Unexpected callbacks: added %v, removed %v", added, removed)
+	}
+	tr.update([]onf.ONF{conn("1.1.1.1:443")}, now.Add(2*time.Minute))
+	if !reflect.DeepEqual(removed, []string{"8.8.8.8/32"}) {
+		t.Fatalf("Expected lingering prefix to be removed, found %v", removed)
+	}
+	if got := strs(tr.Prefixes()); !reflect.DeepEqual(got, []string{"1.1.1.1/32"}) {
+		t.Fatalf("Unexpected prefixes: %v", got)
+	}
+}
+
+func TestTracker_Update(t *testing.T) {
+	t.Parallel()
+	var pivot string
+	tr := NewTracker("Spotify", Options{
+		Linger: -1,
+		Fetch: func(p string) ([]onf.ONF, error) {
+			pivot = p
+			if pivot == "" {
+				return nil, errors.New("no pivot")
+			}
+			return []onf.ONF{conn("1.1.1.1:443")}, nil
+		},
+	})
+	if err := tr.Update(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if pivot != "Spotify" || len(tr.Prefixes()) != 1 {
+		t.Fatalf("Unexpected state: pivot %s, prefixes %v", pivot, tr.Prefixes())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package probe checks whether the destinations of a set of open
+// network files are currently reachable.
+package probe
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Options configure how destinations are probed.
+type Options struct {
+	Concurrency int           // maximum number of probes in flight
+	Timeout     time.Duration // timeout of each probe
+}
+
+// DefaultOptions are used by Run when no other options are provided.
+var DefaultOptions = Options{
+	Concurrency: 16,
+	Timeout:     2 * time.Second,
+}
+
+// Run probes each unique TCP destination of `set` with a connect
+// call, and fills the Probe field of the open network files that
+// point to it. Other destinations (i.e. UDP ones, which cannot be
+// probed without sending data) are left untouched.
+func Run(ctx context.Context, set []onf.ONF, opts Options) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultOptions.Concurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions.Timeout
+	}
+
+	targets := make(map[string]bool)
+	for _, v := range set {
+		if _, ok := aggr.DstHost(v); !ok || v.Dst.Network() != "tcp" {
+			continue
+		}
+		targets[v.Dst.String()] = true
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]*onf.Probe, len(targets))
+	sem := make(chan struct{}, opts.Concurrency)
+	for addr := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(addr string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			p := probe(ctx, addr, opts.Timeout)
+			mu.Lock()
+			results[addr] = p
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
+	for i, v := range set {
+		if v.Dst == nil || v.Dst.Network() != "tcp" {
+			continue
+		}
+		if p := results[v.Dst.String()]; p != nil {
+			set[i].Probe = p
+		}
+	}
+}
+
+func probe(ctx context.Context, addr string, timeout time.Duration) *onf.Probe {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		log.Printf("Probe of %s failed: %v", addr, err)
+		return &onf.Probe{}
+	}
+	latency := time.Since(start)
+	conn.Close()
+	return &onf.Probe{Reachable: true, Latency: latency}
+}
@@ -0,0 +1,57 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package probe_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/probe"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	set := []onf.ONF{
+		{Src: internal.NewAddr("tcp", "127.0.0.1:1"), Dst: internal.NewAddr("tcp", open.Addr().String())},
+		{Src: internal.NewAddr("tcp", "127.0.0.1:2"), Dst: internal.NewAddr("tcp", closed.Addr().String())},
+		{Src: internal.NewAddr("udp", "127.0.0.1:3"), Dst: internal.NewAddr("udp", open.Addr().String())},
+	}
+	probe.Run(context.Background(), set, probe.DefaultOptions)
+
+	if set[0].Probe == nil || !set[0].Probe.Reachable {
+		t.Fatalf("Expected %v to be reachable, found %+v", set[0].Dst, set[0].Probe)
+	}
+	if set[1].Probe == nil || set[1].Probe.Reachable {
+		t.Fatalf("Expected %v to be unreachable, found %+v", set[1].Dst, set[1].Probe)
+	}
+	if set[2].Probe != nil {
+		t.Fatalf("Expected udp destinations not to be probed, found %+v", set[2].Probe)
+	}
+}
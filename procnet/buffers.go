@@ -0,0 +1,66 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"net"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Buffers fills the Buffers field of the connected sockets of `set`
+// with the usage of their send and receive queues, found in `socks`.
+// Listening sockets are left untouched: for them the kernel reports
+// the accept queue instead (see ListenHealth).
+func Buffers(set []onf.ONF, socks []Socket) {
+	queues := make(map[string]Socket)
+	for _, v := range socks {
+		if v.State == "LISTEN" || v.DstAddr == nil || v.DstAddr.String() == "" {
+			continue
+		}
+		queues[connKey(v.Net, v.SrcAddr, v.DstAddr)] = v
+	}
+	for i, v := range set {
+		if v.Src == nil || v.Dst == nil {
+			continue
+		}
+		s, ok := queues[connKey(v.Src.Network(), v.Src, v.Dst)]
+		if !ok {
+			continue
+		}
+		set[i].Buffers = &onf.Buffers{
+			Send: s.TxQueue,
+			Recv: s.RxQueue,
+		}
+	}
+}
+
+// connKey identifies a connection, regardless of whether its
+// IPv4 addresses are written as IPv4-mapped IPv6 ones.
+func connKey(network string, src, dst net.Addr) string {
+	return network + " " + unmap(src.String()) + "->" + unmap(dst.String())
+}
+
+func unmap(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"net"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// listenKey identifies a listening socket: lsof reports IPv4 and IPv6
+// sockets bound to unspecified addresses both as "*:port".
+type listenKey struct {
+	family onf.Family
+	addr   string
+}
+
+// ListenHealth keeps only the listening TCP sockets of `set`, filling
+// their Listen field with the backlog and accept queue length found
+// in `socks`. The connections accepted by them, sharing their source
+// address, are left out.
+func ListenHealth(set []onf.ONF, socks []Socket) []onf.ONF {
+	listen := make(map[listenKey]Socket)
+	for _, v := range socks {
+		if v.State == "LISTEN" {
+			f := familyOf(onf.ONF{Src: v.SrcAddr, Dst: v.DstAddr})
+			listen[listenKey{f, wildcard(v.SrcAddr.String())}] = v
+		}
+	}
+	acc := make([]onf.ONF, 0, len(set))
+	for _, v := range set {
+		if v.Src == nil || strings.TrimRight(v.Src.Network(), "46") != "tcp" {
+			continue
+		}
+		if v.State != "LISTEN" && v.Dst != nil && v.Dst.String() != "" {
+			continue
+		}
+		addr := wildcard(v.Src.String())
+		families := []onf.Family{familyOf(v)}
+		if families[0] == onf.AnyFamily {
+			families = []onf.Family{onf.IPv4, onf.IPv6}
+		}
+		var s Socket
+		var ok bool
+		for _, f := range families {
+			if s, ok = listen[listenKey{f, addr}]; ok {
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		v.Listen = &onf.Listen{
+			Backlog: s.TxQueue,
+			Queue:   s.RxQueue,
+		}
+		acc = append(acc, v)
+	}
+	return acc
+}
+
+// familyOf returns the address family of `o`, or onf.AnyFamily when
+// it cannot be told.
+func familyOf(o onf.ONF) onf.Family {
+	for _, f := range []onf.Family{onf.IPv4, onf.IPv6} {
+		if f.Match(o) {
+			return f
+		}
+	}
+	return onf.AnyFamily
+}
+
+// wildcard normalises unspecified addresses to the "*" notation
+// used by lsof.
+func wildcard(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "*"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"time"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Owned returns the sockets of `socks` that are owned by a process,
+// i.e. those that lsof is able to report too. The kernel tables do
+// not carry the owner, hence Cmd and Pid are left empty.
+func Owned(socks []Socket) []onf.ONF {
+	var acc []onf.ONF
+	now := time.Now()
+	for _, v := range socks {
+		if v.Inode == 0 {
+			continue
+		}
+		acc = append(acc, onf.ONF{
+			Raw:       v.Raw,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     v.State,
+			CreatedAt: now,
+		})
+	}
+	return acc
+}
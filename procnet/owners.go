@@ -0,0 +1,89 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Owner is the process owning a socket.
+type Owner struct {
+	Pid int
+	Cmd string // name of the command, as found in /proc/<pid>/comm
+	Fd  int    // file descriptor referring to the socket
+}
+
+// Owners maps the inode of each socket opened by the processes found
+// under `root` (usually "/proc") to its owner, reading the links in
+// /proc/<pid>/fd. Processes that cannot be inspected, as it happens
+// for the ones of other users when not running as root, or that exit
+// while they are being read, are skipped.
+func Owners(root string) (map[uint64]Owner, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	acc := make(map[uint64]Owner)
+	for _, v := range entries {
+		pid, err := strconv.Atoi(v.Name())
+		if err != nil || !v.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, v.Name())
+		fds, err := ioutil.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		var cmd string
+		if comm, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil {
+			cmd = strings.TrimSpace(string(comm))
+		}
+		for _, f := range fds {
+			fd, err := strconv.Atoi(f.Name())
+			if err != nil {
+				continue
+			}
+			link, err := os.Readlink(filepath.Join(dir, "fd", f.Name()))
+			if err != nil {
+				continue
+			}
+			inode, ok := socketInode(link)
+			if !ok {
+				continue
+			}
+			if _, ok := acc[inode]; ok {
+				// Shared with a child, keep the first owner found.
+				continue
+			}
+			acc[inode] = Owner{Pid: pid, Cmd: cmd, Fd: fd}
+		}
+	}
+	return acc, nil
+}
+
+// socketInode parses the target of a /proc/<pid>/fd link pointing to a
+// socket, in the form "socket:[inode]".
+func socketInode(link string) (uint64, bool) {
+	if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+	return inode, err == nil
+}
@@ -0,0 +1,229 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package procnet decodes the socket tables exposed by the linux
+// kernel under /proc/net.
+package procnet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// Socket is an entry of a /proc/net/{tcp,tcp6,udp,udp6} table.
+type Socket struct {
+	Raw     string
+	Net     string        // tcp or udp
+	SrcAddr net.Addr      // local address
+	DstAddr net.Addr      // remote address
+	State   string        // ESTABLISHED, LISTEN, ...
+	TxQueue uint64        // for LISTEN sockets, the maximum accept queue length (backlog)
+	RxQueue uint64        // for LISTEN sockets, the current accept queue length
+	Timer   time.Duration // remaining time of the active kernel timer, if any
+	Uid     int
+	Inode   uint64
+}
+
+// states maps the kernel's TCP states to their names.
+var states = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// Tables are the files read by Read, relative to the /proc/net directory.
+var Tables = []string{"tcp", "tcp6", "udp", "udp6"}
+
+// Read decodes every table in Tables, found under `root`/net
+// (usually root is "/proc"). Tables that do not exist are skipped.
+func Read(root string) ([]Socket, error) {
+	return read(internal.StdLogger, root)
+}
+
+func read(l internal.Logger, root string) ([]Socket, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("/proc/net tables are not available on %s", runtime.GOOS)
+	}
+	var acc []Socket
+	for _, v := range Tables {
+		f, err := os.Open(filepath.Join(root, "net", v))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return acc, err
+		}
+		set, err := parseTable(l, f, strings.TrimSuffix(v, "6"))
+		f.Close()
+		if err != nil {
+			return acc, fmt.Errorf("unable to parse %s table: %w", v, err)
+		}
+		acc = append(acc, set...)
+	}
+	return acc, nil
+}
+
+// ParseTable expects "r" to contain a /proc/net/{tcp,tcp6,udp,udp6}
+// table, where each socket belongs to `network`. Lines that cannot
+// be parsed, such as the header, are skipped.
+func ParseTable(r io.Reader, network string) ([]Socket, error) {
+	return parseTable(internal.StdLogger, r, network)
+}
+
+func parseTable(l internal.Logger, r io.Reader, network string) ([]Socket, error) {
+	set := []Socket{}
+	err := internal.ScanLines(r, func(line string) error {
+		s, err := ParseSocket(line, network)
+		if err != nil {
+			l.Printf("skipping /proc/net entry \"%s\": %v", line, err)
+			return nil
+		}
+		set = append(set, *s)
+		return nil
+	})
+	return set, err
+}
+
+// ParseSocket parses a single entry of a /proc/net table.
+//
+// "line" example:
+// "   0: 0100007F:0CEA 00000000:0000 0A 00000000:00000080 00:00000000 00000000   107        0 23423 1 0000000000000000 100 0 0 10 0"
+func ParseSocket(line, network string) (*Socket, error) {
+	chunks, err := internal.ChunkLine(line, " ", 10)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(chunks[0], ":") {
+		return nil, fmt.Errorf("unexpected slot \"%s\"", chunks[0])
+	}
+	src, err := parseAddr(network, chunks[1])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing local address: %w", err)
+	}
+	dst, err := parseAddr(network, chunks[2])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing remote address: %w", err)
+	}
+	queues := strings.Split(chunks[4], ":")
+	if len(queues) != 2 {
+		return nil, fmt.Errorf("unexpected queues \"%s\"", chunks[4])
+	}
+	tx, err := strconv.ParseUint(queues[0], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing tx queue: %w", err)
+	}
+	rx, err := strconv.ParseUint(queues[1], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rx queue: %w", err)
+	}
+	timer, err := parseTimer(chunks[5])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing timer: %w", err)
+	}
+	uid, err := strconv.Atoi(chunks[7])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing uid: %w", err)
+	}
+	inode, err := strconv.ParseUint(chunks[9], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing inode: %w", err)
+	}
+
+	s := &Socket{
+		Raw:     line,
+		Net:     network,
+		SrcAddr: src,
+		DstAddr: dst,
+		TxQueue: tx,
+		RxQueue: rx,
+		Timer:   timer,
+		Uid:     uid,
+		Inode:   inode,
+	}
+	if network == "tcp" {
+		s.State = states[chunks[3]]
+	}
+	return s, nil
+}
+
+// userHZ is the frequency of the clock ticks used by the kernel
+// to report timers.
+const userHZ = 100
+
+// parseTimer decodes a "tr:tm->when" pair, where tr is the kind of
+// the active timer (0 when none is) and tm->when its expiration, in
+// clock ticks.
+func parseTimer(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("unexpected timer \"%s\"", s)
+	}
+	if parts[0] == "00" {
+		return 0, nil
+	}
+	ticks, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ticks) * time.Second / userHZ, nil
+}
+
+// parseAddr decodes an "ADDR:PORT" pair, where ADDR is the hex
+// representation of the address as stored in memory (this package
+// assumes a little endian machine) and PORT the hex port number.
+func parseAddr(network, s string) (net.Addr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unexpected address \"%s\"", s)
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != net.IPv4len && len(raw) != net.IPv6len {
+		return nil, fmt.Errorf("unexpected address length %d", len(raw))
+	}
+	// The address is made of 32 bit words in host byte order.
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, err
+	}
+	if ip.IsUnspecified() && port == 0 {
+		return internal.NewAddr(network, ""), nil
+	}
+	return internal.NewAddr(network, net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))), nil
+}
@@ -0,0 +1,246 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+const tcpExample = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000080:00000002 00:00000000 00000000     0        0 21450 1 0000000000000000 100 0 0 10 0
+   1: 3D00A8C0:E3A4 2F18BA23:01BB 01 00000000:00000000 02:000A7F2B 00000000  1000        0 34211 1 0000000000000000 20 4 30 10 -1
+   2: 3D00A8C0:E3A6 2F18BA23:01BB 06 00000000:00000000 03:00000BB8 00000000     0        0 0 3 0000000000000000
+`
+
+const tcp6Example = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 40110 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseTable(t *testing.T) {
+	t.Parallel()
+	set, err := ParseTable(strings.NewReader(tcpExample), "tcp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(set) != 3 {
+		t.Fatalf("Unexpected set length: wanted 3, found %d: %v", len(set), set)
+	}
+	assert(t, "0.0.0.0:22", set[0].SrcAddr.String())
+	assert(t, "", set[0].DstAddr.String())
+	assert(t, "LISTEN", set[0].State)
+	assert(t, uint64(128), set[0].TxQueue)
+	assert(t, uint64(2), set[0].RxQueue)
+	assert(t, uint64(21450), set[0].Inode)
+
+	assert(t, "192.168.0.61:58276", set[1].SrcAddr.String())
+	assert(t, "35.186.24.47:443", set[1].DstAddr.String())
+	assert(t, "ESTABLISHED", set[1].State)
+	assert(t, 1000, set[1].Uid)
+	assert(t, "TIME_WAIT", set[2].State)
+	assert(t, 30*time.Second, set[2].Timer)
+
+	set, err = ParseTable(strings.NewReader(tcp6Example), "tcp")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, 1, len(set))
+	assert(t, "[::1]:8080", set[0].SrcAddr.String())
+}
+
+func TestListenHealth(t *testing.T) {
+	t.Parallel()
+	socks, _ := ParseTable(strings.NewReader(tcpExample), "tcp")
+	set := []onf.ONF{
+		{Cmd: "sshd", Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "192.168.0.61:58276"), Dst: internal.NewAddr("tcp", "35.186.24.47:443")},
+	}
+	set = ListenHealth(set, socks)
+	assert(t, 1, len(set))
+	assert(t, "sshd", set[0].Cmd)
+	assert(t, onf.Listen{Backlog: 128, Queue: 2}, *set[0].Listen)
+
+	// IPv4 and IPv6 listeners on the same port are told apart, and
+	// the connections accepted by a listener are left out.
+	socks = []Socket{
+		{Net: "tcp", SrcAddr: internal.NewAddr("tcp", "0.0.0.0:22"), DstAddr: internal.NewAddr("tcp", ""), State: "LISTEN", TxQueue: 128},
+		{Net: "tcp", SrcAddr: internal.NewAddr("tcp", "[::]:22"), DstAddr: internal.NewAddr("tcp", ""), State: "LISTEN", TxQueue: 64},
+		{Net: "tcp", SrcAddr: internal.NewAddr("tcp", "192.168.0.61:8080"), DstAddr: internal.NewAddr("tcp", ""), State: "LISTEN", TxQueue: 32},
+		{Net: "tcp", SrcAddr: internal.NewAddr("tcp", "192.168.0.61:8080"), DstAddr: internal.NewAddr("tcp", "192.168.0.7:50000"), State: "ESTABLISHED"},
+	}
+	set = []onf.ONF{
+		{Cmd: "sshd", Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", ""), State: "LISTEN", File: &onf.File{Type: "IPv4"}},
+		{Cmd: "sshd", Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", ""), State: "LISTEN", File: &onf.File{Type: "IPv6"}},
+		{Cmd: "httpd", Src: internal.NewAddr("tcp", "192.168.0.61:8080"), Dst: internal.NewAddr("tcp", ""), State: "LISTEN"},
+		{Cmd: "httpd", Src: internal.NewAddr("tcp", "192.168.0.61:8080"), Dst: internal.NewAddr("tcp", "192.168.0.7:50000"), State: "ESTABLISHED"},
+	}
+	set = ListenHealth(set, socks)
+	assert(t, 3, len(set))
+	assert(t, uint64(128), set[0].Listen.Backlog)
+	assert(t, uint64(64), set[1].Listen.Backlog)
+	assert(t, "LISTEN", set[2].State)
+	assert(t, uint64(32), set[2].Listen.Backlog)
+}
+
+func TestTimeWait(t *testing.T) {
+	t.Parallel()
+	socks, _ := ParseTable(strings.NewReader(tcpExample), "tcp")
+	set := TimeWait(socks)
+	assert(t, 1, len(set))
+	assert(t, "192.168.0.61:58278", set[0].Src.String())
+	assert(t, "TIME_WAIT", set[0].State)
+	assert(t, 30*time.Second, set[0].Timer)
+}
+
+func TestBuffers(t *testing.T) {
+	t.Parallel()
+	socks, _ := ParseTable(strings.NewReader(tcpExample), "tcp")
+	socks = append(socks, Socket{
+		Net:     "tcp",
+		SrcAddr: internal.NewAddr("tcp", "[::ffff:192.168.0.61]:58300"),
+		DstAddr: internal.NewAddr("tcp", "[::ffff:35.186.24.47]:443"),
+		State:   "ESTABLISHED",
+		TxQueue: 4096,
+		RxQueue: 512,
+	})
+	set := []onf.ONF{
+		{Cmd: "sshd", Src: internal.NewAddr("tcp", "*:22")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "192.168.0.61:58276"), Dst: internal.NewAddr("tcp", "35.186.24.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "192.168.0.61:58300"), Dst: internal.NewAddr("tcp", "35.186.24.47:443")},
+	}
+	Buffers(set, socks)
+	if set[0].Buffers != nil {
+		t.Fatalf("Unexpected buffers for listening socket: %+v", set[0].Buffers)
+	}
+	assert(t, onf.Buffers{}, *set[1].Buffers)
+	assert(t, onf.Buffers{Send: 4096, Recv: 512}, *set[2].Buffers)
+}
+
+// fakeProc populates a temporary directory with the files read by
+// Runtime, and returns its path.
+func fakeProc(t *testing.T) string {
+	root, err := ioutil.TempDir("", "lsaddr-proc")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files := map[string]string{
+		"net/tcp":       tcpExample,
+		"1/comm":        "sshd\n",
+		"1/cmdline":     "/usr/sbin/sshd\x00-D\x00",
+		"4242/comm":     "Spotify\n",
+		"4242/cmdline":  "/usr/bin/spotify\x00",
+		"4242/stat":     "4242 (Spotify (main)) S 1 4242 4242 0 -1",
+		"4243/comm":     "kworker/0:1\n",
+		"4243/cmdline":  "",
+		"self/cmdline":  "",
+		"1/fd/.keep":    "",
+		"4243/fd/.keep": "",
+	}
+	for k, v := range files {
+		path := filepath.Join(root, k)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(v), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	links := map[string]string{
+		"1/fd/3":    "socket:[21450]",
+		"1/fd/4":    "/dev/null",
+		"4242/fd/5": "socket:[34211]",
+	}
+	for k, v := range links {
+		path := filepath.Join(root, k)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.Symlink(v, path); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return root
+}
+
+func TestOwners(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links are not supported")
+	}
+	root := fakeProc(t)
+	defer os.RemoveAll(root)
+
+	owners, err := Owners(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[uint64]Owner{
+		21450: {Pid: 1, Cmd: "sshd", Fd: 3},
+		34211: {Pid: 4242, Cmd: "Spotify", Fd: 5},
+	}
+	assert(t, want, owners)
+}
+
+func TestRuntime(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc/net tables are only read on linux")
+	}
+	root := fakeProc(t)
+	defer os.RemoveAll(root)
+
+	r := Runtime{Root: root}
+	var set []onf.ONF
+	err := r.Each(func(line string) bool { return strings.Contains(line, "TCP") }, func(f onf.ONF) error {
+		set = append(set, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The TIME_WAIT socket has no owner.
+	assert(t, 2, len(set))
+	assert(t, "sshd 1 0 3u IPv4 21450 TCP 0.0.0.0:22 (LISTEN)", set[0].Raw)
+	assert(t, "Spotify", set[1].Cmd)
+	assert(t, 4242, set[1].Pid)
+	assert(t, "35.186.24.47:443", set[1].Dst.String())
+	assert(t, "5u", set[1].File.Fd)
+
+	procs, err := r.Processes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assert(t, []onf.Process{
+		{Pid: 1, Line: "/usr/sbin/sshd -D"},
+		{Pid: 4242, Ppid: 1, Line: "/usr/bin/spotify"},
+		{Pid: 4243, Line: "kworker/0:1"},
+	}, procs)
+}
+
+func assert(t *testing.T, exp, x interface{}) {
+	if !reflect.DeepEqual(exp, x) {
+		t.Fatalf("Assert failed: expected %v, found %v", exp, x)
+	}
+}
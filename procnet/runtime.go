@@ -0,0 +1,197 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Runtime is an onf.Runtime reading the /proc/net tables directly, and
+// attributing sockets to processes through /proc/<pid>/fd, instead of
+// executing lsof: it works in minimal containers where lsof is not
+// installed, and it is faster. Linux only.
+type Runtime struct {
+	Root string // "/proc" when empty
+}
+
+func init() {
+	if runtime.GOOS == "linux" {
+		onf.Register("proc", Runtime{})
+	}
+}
+
+func (r Runtime) root() string {
+	if r.Root == "" {
+		return "/proc"
+	}
+	return r.Root
+}
+
+func (Runtime) Backend() string {
+	return "procnet"
+}
+
+// Each calls `fn` with each socket owned by a process. Sockets are
+// matched against a line mirroring the format of lsof, such as
+// "Spotify 11778 1000 34u IPv4 34211 TCP 192.168.0.61:58276->35.186.24.47:443 (ESTABLISHED)",
+// which is also used as Raw.
+func (r Runtime) Each(match func(string) bool, fn func(onf.ONF) error) error {
+	return r.EachContext(context.Background(), match, fn)
+}
+
+// EachContext is the same as Each, but skipped table entries are
+// reported to the logger carried by `ctx`. The tables are read from
+// the file system, which cannot be interrupted: `ctx` is checked
+// before each call to `fn` instead.
+func (r Runtime) EachContext(ctx context.Context, match func(string) bool, fn func(onf.ONF) error) error {
+	socks, err := read(internal.LoggerFrom(ctx), r.root())
+	if err != nil {
+		return err
+	}
+	owners, err := Owners(r.root())
+	if err != nil {
+		return fmt.Errorf("unable to read processes: %w", err)
+	}
+	for _, v := range socks {
+		o, ok := owners[v.Inode]
+		if v.Inode == 0 || !ok {
+			continue
+		}
+		f := toONF(v, o)
+		if match != nil && !match(f.Raw) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toONF(s Socket, o Owner) onf.ONF {
+	file := &onf.File{
+		User:   strconv.Itoa(s.Uid),
+		Fd:     strconv.Itoa(o.Fd) + "u",
+		Type:   ipType(s.SrcAddr),
+		Device: strconv.FormatUint(s.Inode, 10),
+		Node:   strings.ToUpper(s.Net),
+	}
+	name := s.SrcAddr.String()
+	if dst := s.DstAddr.String(); dst != "" {
+		name += "->" + dst
+	}
+	raw := fmt.Sprintf("%s %d %s %s %s %s %s %s", o.Cmd, o.Pid, file.User, file.Fd, file.Type, file.Device, file.Node, name)
+	if s.State != "" {
+		raw += " (" + s.State + ")"
+	}
+	return onf.ONF{
+		Raw:       raw,
+		Cmd:       o.Cmd,
+		Pid:       o.Pid,
+		Src:       s.SrcAddr,
+		Dst:       s.DstAddr,
+		State:     s.State,
+		CreatedAt: time.Now(),
+		File:      file,
+	}
+}
+
+// ipType returns the lsof TYPE of a socket bound to `addr`.
+func ipType(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if ip := net.ParseIP(host); err == nil && ip != nil && ip.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+func (Runtime) Partial() (bool, string) {
+	if os.Geteuid() == 0 {
+		return false, ""
+	}
+	return true, "not running as root, the sockets of other users' processes cannot be attributed"
+}
+
+// Processes lists the processes found under Root, using their command
+// line or, when empty (kernel threads), their command name. Parent
+// pids are read from /proc/<pid>/stat.
+func (r Runtime) Processes() ([]onf.Process, error) {
+	entries, err := ioutil.ReadDir(r.root())
+	if err != nil {
+		return nil, err
+	}
+	var acc []onf.Process
+	for _, v := range entries {
+		pid, err := strconv.Atoi(v.Name())
+		if err != nil || !v.IsDir() {
+			continue
+		}
+		dir := filepath.Join(r.root(), v.Name())
+		cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil {
+			continue
+		}
+		line := strings.TrimSpace(string(bytes.Replace(cmdline, []byte{0}, []byte{' '}, -1)))
+		if line == "" {
+			comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+			line = strings.TrimSpace(string(comm))
+		}
+		acc = append(acc, onf.Process{Pid: pid, Ppid: parent(dir), Line: line})
+	}
+	return acc, nil
+}
+
+// parent returns the parent pid of the process whose /proc directory
+// is `dir`, or 0 when it cannot be read. The command name, second field
+// of the stat file, is enclosed in parentheses and may contain spaces:
+// the fields following the last parenthesis are the state and the
+// parent pid.
+func parent(dir string) int {
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0
+	}
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
+
+func (Runtime) RunningApps() ([]onf.App, error) {
+	return nil, fmt.Errorf("listing running applications is not supported on linux")
+}
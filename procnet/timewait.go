@@ -0,0 +1,44 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package procnet
+
+import (
+	"time"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// TimeWait returns the TIME_WAIT and FIN_WAIT2 sockets of `socks` which
+// are no longer owned by any process (and are therefore not reported
+// by lsof), together with the remaining time of their timers.
+func TimeWait(socks []Socket) []onf.ONF {
+	var acc []onf.ONF
+	now := time.Now()
+	for _, v := range socks {
+		if v.Inode != 0 || (v.State != "TIME_WAIT" && v.State != "FIN_WAIT2") {
+			continue
+		}
+		acc = append(acc, onf.ONF{
+			Raw:       v.Raw,
+			Src:       v.SrcAddr,
+			Dst:       v.DstAddr,
+			State:     v.State,
+			Timer:     v.Timer,
+			CreatedAt: now,
+		})
+	}
+	return acc
+}
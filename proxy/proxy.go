@@ -0,0 +1,129 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package proxy detects the proxies configured on the system, and tags
+// the open network files that point to them: the real destination of
+// those connections is not the one reported by the backend.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// envVars are the environment variables inspected by FromEnvironment.
+var envVars = []string{
+	"HTTP_PROXY", "http_proxy",
+	"HTTPS_PROXY", "https_proxy",
+	"ALL_PROXY", "all_proxy",
+}
+
+var defaultPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// FromEnvironment returns the proxies configured through the
+// conventional environment variables (HTTP_PROXY and friends).
+func FromEnvironment() []*url.URL {
+	var acc []*url.URL
+	for _, v := range envVars {
+		if u := Parse(os.Getenv(v)); u != nil {
+			acc = append(acc, u)
+		}
+	}
+	return acc
+}
+
+// Detect returns the proxies configured through the environment and,
+// where supported, the system settings.
+func Detect() []*url.URL {
+	return append(FromEnvironment(), system()...)
+}
+
+// Parse parses a proxy address, which may lack the scheme. Returns nil
+// when `s` is empty or invalid. As proxy addresses may contain
+// credentials, invalid ones are not logged.
+func Parse(s string) *url.URL {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		reason := errors.New("missing host")
+		if err != nil {
+			// The url.Error wrapping it contains the address.
+			reason = errors.Unwrap(err)
+		}
+		log.Printf("Ignoring invalid proxy address: %v", reason)
+		return nil
+	}
+	return u
+}
+
+// Tag fills the Proxy field of the open network files of `set` whose
+// destination is one of `proxies` with its scheme and address only,
+// leaving out the credentials. Proxy host names are resolved.
+func Tag(ctx context.Context, set []onf.ONF, proxies []*url.URL) {
+	if len(proxies) == 0 {
+		return
+	}
+	addrs := make(map[string]string) // host:port -> proxy url
+	for _, v := range proxies {
+		port := v.Port()
+		if port == "" {
+			port = defaultPorts[v.Scheme]
+		}
+		name := (&url.URL{Scheme: v.Scheme, Host: v.Host}).String()
+		for _, ip := range resolve(ctx, v.Hostname()) {
+			addrs[net.JoinHostPort(ip, port)] = name
+		}
+	}
+	for i, v := range set {
+		if v.Dst == nil {
+			continue
+		}
+		if p, ok := addrs[v.Dst.String()]; ok {
+			set[i].Proxy = p
+		}
+	}
+}
+
+func resolve(ctx context.Context, host string) []string {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		log.Printf("Unable to resolve proxy %s: %v", host, err)
+	}
+	return ips
+}
@@ -0,0 +1,66 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jecoz/lsaddr/internal"
+)
+
+// scutilKinds maps the scutil key prefixes to the proxy scheme.
+var scutilKinds = []struct {
+	prefix, scheme string
+}{
+	{"HTTP", "http"},
+	{"HTTPS", "http"},
+	{"SOCKS", "socks5"},
+}
+
+// ParseScutil expects "r" to contain the output of a ``scutil --proxy''
+// call, and returns the enabled proxies.
+//
+// "r" lines examples:
+// "  HTTPEnable : 1"
+// "  HTTPProxy : 10.0.0.5"
+func ParseScutil(r io.Reader) []*url.URL {
+	kv := make(map[string]string)
+	internal.ScanLines(r, func(line string) error {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			kv[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		return nil
+	})
+
+	var acc []*url.URL
+	for _, v := range scutilKinds {
+		if kv[v.prefix+"Enable"] != "1" || kv[v.prefix+"Proxy"] == "" {
+			continue
+		}
+		host := kv[v.prefix+"Proxy"]
+		if port := kv[v.prefix+"Port"]; port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		if u := Parse(v.scheme + "://" + host); u != nil {
+			acc = append(acc, u)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,39 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func system() []*url.URL {
+	log.Printf("Executing: scutil --proxy")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	out, _, err := runner.Default.Run(ctx, "scutil", "--proxy")
+	if err != nil {
+		log.Printf("Unable to read system proxy settings: %v", err)
+		return nil
+	}
+	return ParseScutil(bytes.NewBuffer(out))
+}
@@ -0,0 +1,258 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package record stores series of snapshots as NDJSON, writing only
+// the differences between consecutive snapshots, with periodic full
+// keyframes: long recordings take a fraction of the space needed to
+// store every snapshot. Open network files whose fields changed
+// between two snapshots (see onf.Changed) are recorded as closed and
+// opened again, with their new fields. Recordings may also contain
+// periodic rollups, aggregating the snapshots of each period, which
+// downstream storage can keep even when the snapshots are sampled away.
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// DefaultKeyframe is the default number of snapshots between two
+// keyframes.
+const DefaultKeyframe = 60
+
+// Entry types.
+const (
+	Keyframe = "keyframe" // full snapshot
+	Delta    = "delta"    // difference from the previous snapshot
+	Rollup   = "rollup"   // aggregates of the snapshots of a period
+)
+
+// Stats aggregates the open network files of a command over the period
+// of a rollup.
+type Stats struct {
+	Cmd          string `json:"command"`
+	Destinations int    `json:"unique_destinations"` // distinct destination hosts
+	Opened       int    `json:"opened"`
+	Closed       int    `json:"closed"`
+}
+
+// entry is a line of a recording.
+type entry struct {
+	Type          string     `json:"type"`
+	SchemaVersion int        `json:"schema_version,omitempty"` // see onf.SchemaVersion, missing in older recordings
+	Since         *time.Time `json:"since,omitempty"`          // start of the period of a rollup
+	Time          time.Time  `json:"time"`
+	Files         []onf.ONF  `json:"files,omitempty"`
+	Opened        []onf.ONF  `json:"opened,omitempty"`
+	Closed        []onf.ONF  `json:"closed,omitempty"`
+	Rollup        []Stats    `json:"rollup,omitempty"`
+}
+
+// Writer appends snapshots to a recording.
+type Writer struct {
+	enc      *json.Encoder
+	keyframe int
+	n        int
+	prev     []onf.ONF
+
+	rollup time.Duration
+	since  time.Time
+	stats  map[string]*stats
+}
+
+// stats accumulates the Stats of a command.
+type stats struct {
+	dsts           map[string]bool
+	opened, closed int
+}
+
+// NewWriter returns a Writer writing a keyframe every `keyframe`
+// snapshots (DefaultKeyframe when not positive), and deltas otherwise.
+func NewWriter(w io.Writer, keyframe int) *Writer {
+	if keyframe <= 0 {
+		keyframe = DefaultKeyframe
+	}
+	return &Writer{enc: json.NewEncoder(w), keyframe: keyframe}
+}
+
+// NewWriterRollup is the same as NewWriter, but a rollup is also
+// written every `rollup` (i.e. every minute), after the snapshot
+// completing the period: for each command, it reports the distinct
+// destinations of the snapshots of the period, and the open network
+// files opened and closed during it. The rollup of the last, partial,
+// period is not written.
+func NewWriterRollup(w io.Writer, keyframe int, rollup time.Duration) *Writer {
+	wr := NewWriter(w, keyframe)
+	wr.rollup = rollup
+	return wr
+}
+
+// Write appends `s` to the recording.
+func (w *Writer) Write(s aggr.Snapshot) error {
+	e := entry{Type: Delta, SchemaVersion: onf.SchemaVersion, Time: s.Time}
+	if w.n%w.keyframe == 0 {
+		e.Type, e.Files = Keyframe, s.Set
+	} else {
+		e.Opened, e.Closed = onf.Diff(w.prev, s.Set)
+		before, after := onf.Changed(w.prev, s.Set)
+		e.Opened = append(e.Opened, after...)
+		e.Closed = append(e.Closed, before...)
+	}
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("unable to record snapshot: %w", err)
+	}
+	if w.rollup > 0 {
+		if err := w.roll(s); err != nil {
+			return err
+		}
+	}
+	w.n++
+	w.prev = s.Set
+	return nil
+}
+
+// roll adds `s` to the rollup of the current period, writing it when
+// the period is over.
+func (w *Writer) roll(s aggr.Snapshot) error {
+	if w.stats == nil {
+		w.since, w.stats = s.Time, make(map[string]*stats)
+	}
+	if w.n > 0 {
+		opened, closed := onf.Diff(w.prev, s.Set)
+		for _, v := range opened {
+			w.stat(v.Cmd).opened++
+		}
+		for _, v := range closed {
+			w.stat(v.Cmd).closed++
+		}
+	}
+	for _, v := range s.Set {
+		if host := dstHost(v); host != "" {
+			w.stat(v.Cmd).dsts[host] = true
+		}
+	}
+	if s.Time.Sub(w.since) < w.rollup {
+		return nil
+	}
+	since := w.since
+	e := entry{Type: Rollup, SchemaVersion: onf.SchemaVersion, Since: &since, Time: s.Time}
+	for k, v := range w.stats {
+		e.Rollup = append(e.Rollup, Stats{Cmd: k, Destinations: len(v.dsts), Opened: v.opened, Closed: v.closed})
+	}
+	sort.Slice(e.Rollup, func(i, j int) bool { return e.Rollup[i].Cmd < e.Rollup[j].Cmd })
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("unable to record rollup: %w", err)
+	}
+	w.since, w.stats = s.Time, make(map[string]*stats)
+	return nil
+}
+
+func (w *Writer) stat(cmd string) *stats {
+	st, ok := w.stats[cmd]
+	if !ok {
+		st = &stats{dsts: make(map[string]bool)}
+		w.stats[cmd] = st
+	}
+	return st
+}
+
+// dstHost returns the destination host of `f`, or an empty string
+// when it has none, as listening sockets.
+func dstHost(f onf.ONF) string {
+	if f.Dst == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(f.Dst.String())
+	if err != nil || host == "*" {
+		return ""
+	}
+	return host
+}
+
+// Reader reconstructs the snapshots of a recording.
+type Reader struct {
+	dec  *json.Decoder
+	prev []onf.ONF
+	init bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next snapshot of the recording, or io.EOF when
+// there are no more. Rollups are skipped.
+func (r *Reader) Next() (aggr.Snapshot, error) {
+	var e entry
+	for {
+		e = entry{}
+		if err := r.dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				return aggr.Snapshot{}, err
+			}
+			return aggr.Snapshot{}, fmt.Errorf("unable to decode recording: %w", err)
+		}
+		if e.SchemaVersion > onf.SchemaVersion {
+			return aggr.Snapshot{}, fmt.Errorf("unable to decode recording: schema version %d is newer than the supported %d", e.SchemaVersion, onf.SchemaVersion)
+		}
+		if e.Type != Rollup {
+			break
+		}
+	}
+	var set []onf.ONF
+	switch e.Type {
+	case Keyframe:
+		set = e.Files
+	case Delta:
+		if !r.init {
+			return aggr.Snapshot{}, errors.New("unable to decode recording: delta found before the first keyframe")
+		}
+		// The files of the previous snapshot that were not closed,
+		// followed by the opened ones.
+		set, _ = onf.Diff(e.Closed, r.prev)
+		set = append(set, e.Opened...)
+	default:
+		return aggr.Snapshot{}, fmt.Errorf("unable to decode recording: unknown entry type %q", e.Type)
+	}
+	if set == nil {
+		set = []onf.ONF{}
+	}
+	r.prev, r.init = set, true
+	return aggr.Snapshot{Time: e.Time, Set: set}, nil
+}
+
+// ReadAll returns every snapshot of the recording read from `r`.
+func ReadAll(r io.Reader) ([]aggr.Snapshot, error) {
+	var acc []aggr.Snapshot
+	rr := NewReader(r)
+	for {
+		s, err := rr.Next()
+		if err == io.EOF {
+			return acc, nil
+		}
+		if err != nil {
+			return acc, err
+		}
+		acc = append(acc, s)
+	}
+}
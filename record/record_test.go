@@ -0,0 +1,193 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package record_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/record"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	spotify := onf.ONF{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")}
+	curl := onf.ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "93.184.216.34:443")}
+	sshd := onf.ONF{Cmd: "sshd", Pid: 3, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "")}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	snaps := []aggr.Snapshot{
+		{Time: start, Set: []onf.ONF{spotify, sshd}},
+		{Time: start.Add(time.Minute), Set: []onf.ONF{spotify, sshd, curl}},
+		{Time: start.Add(2 * time.Minute), Set: []onf.ONF{sshd, curl}},
+		{Time: start.Add(3 * time.Minute), Set: []onf.ONF{sshd}},
+		{Time: start.Add(4 * time.Minute), Set: []onf.ONF{}},
+	}
+
+	var b bytes.Buffer
+	w := record.NewWriter(&b, 3)
+	for _, v := range snaps {
+		if err := w.Write(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(snaps) {
+		t.Fatalf("Unexpected number of entries: %d", len(lines))
+	}
+	for i, v := range lines {
+		keyframe := strings.Contains(v, `"type":"keyframe"`)
+		if keyframe != (i%3 == 0) {
+			t.Fatalf("%d: Unexpected entry: %s", i, v)
+		}
+	}
+
+	read, err := record.ReadAll(&b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(read) != len(snaps) {
+		t.Fatalf("Unexpected number of snapshots: %d", len(read))
+	}
+	for i, v := range read {
+		if !v.Time.Equal(snaps[i].Time) {
+			t.Fatalf("%d: Unexpected time: %v", i, v.Time)
+		}
+		if opened, closed := onf.Diff(snaps[i].Set, v.Set); len(v.Set) != len(snaps[i].Set) || len(opened) > 0 || len(closed) > 0 {
+			t.Fatalf("%d: Unexpected snapshot: wanted %v, found %v", i, snaps[i].Set, v.Set)
+		}
+	}
+}
+
+func TestRoundTrip_Changed(t *testing.T) {
+	t.Parallel()
+	syn := onf.ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "93.184.216.34:443"), State: "SYN_SENT"}
+	est := syn
+	est.State = "ESTABLISHED"
+	est.DstName = "example.com"
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	snaps := []aggr.Snapshot{
+		{Time: start, Set: []onf.ONF{syn}},
+		{Time: start.Add(time.Minute), Set: []onf.ONF{est}},
+		{Time: start.Add(2 * time.Minute), Set: []onf.ONF{est}},
+	}
+
+	var b bytes.Buffer
+	w := record.NewWriter(&b, 10)
+	for _, v := range snaps {
+		if err := w.Write(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	read, err := record.ReadAll(&b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(read) != len(snaps) {
+		t.Fatalf("Unexpected number of snapshots: %d", len(read))
+	}
+	for i, v := range read {
+		want := snaps[i].Set[0]
+		if len(v.Set) != 1 || v.Set[0].State != want.State || v.Set[0].DstName != want.DstName {
+			t.Fatalf("%d: Unexpected snapshot: wanted %v, found %v", i, snaps[i].Set, v.Set)
+		}
+	}
+}
+
+func TestWriter_Rollup(t *testing.T) {
+	t.Parallel()
+	spotify := onf.ONF{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")}
+	curl := onf.ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "93.184.216.34:443")}
+	sshd := onf.ONF{Cmd: "sshd", Pid: 3, Src: internal.NewAddr("tcp", "*:22"), Dst: internal.NewAddr("tcp", "")}
+	start := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	snaps := []aggr.Snapshot{
+		{Time: start, Set: []onf.ONF{spotify, sshd}},
+		{Time: start.Add(time.Minute), Set: []onf.ONF{spotify, sshd, curl}},
+		{Time: start.Add(2 * time.Minute), Set: []onf.ONF{sshd, curl}},
+		{Time: start.Add(3 * time.Minute), Set: []onf.ONF{sshd}},
+		{Time: start.Add(4 * time.Minute), Set: []onf.ONF{}},
+		{Time: start.Add(5 * time.Minute), Set: []onf.ONF{curl}},
+	}
+
+	var b bytes.Buffer
+	w := record.NewWriterRollup(&b, 3, 2*time.Minute)
+	for _, v := range snaps {
+		if err := w.Write(v); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	type rollup struct {
+		Since  time.Time      `json:"since"`
+		Time   time.Time      `json:"time"`
+		Rollup []record.Stats `json:"rollup"`
+	}
+	var rollups []rollup
+	for _, v := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if !strings.Contains(v, `"type":"rollup"`) {
+			continue
+		}
+		var r rollup
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rollups = append(rollups, r)
+	}
+	// The last, partial, period is not written.
+	if len(rollups) != 2 {
+		t.Fatalf("Unexpected rollups: %+v", rollups)
+	}
+	if r := rollups[0]; !r.Since.Equal(start) || !r.Time.Equal(start.Add(2*time.Minute)) || !reflect.DeepEqual(r.Rollup, []record.Stats{
+		{Cmd: "Spotify", Destinations: 1, Closed: 1},
+		{Cmd: "curl", Destinations: 1, Opened: 1},
+	}) {
+		t.Fatalf("Unexpected rollup: %+v", r)
+	}
+	if r := rollups[1]; !r.Since.Equal(start.Add(2*time.Minute)) || !reflect.DeepEqual(r.Rollup, []record.Stats{
+		{Cmd: "curl", Closed: 1},
+		{Cmd: "sshd", Closed: 1},
+	}) {
+		t.Fatalf("Unexpected rollup: %+v", r)
+	}
+
+	// Rollups are skipped when reading the snapshots back.
+	read, err := record.ReadAll(&b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(read) != len(snaps) {
+		t.Fatalf("Unexpected number of snapshots: %d", len(read))
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{
+		`{"type":"delta","time":"2019-11-01T00:00:00Z"}`,
+		`{"type":"frame","time":"2019-11-01T00:00:00Z"}`,
+		`{"type":`,
+		`{"type":"keyframe","schema_version":99,"time":"2019-11-01T00:00:00Z"}`,
+	} {
+		if _, err := record.ReadAll(strings.NewReader(v)); err == nil {
+			t.Fatalf("Unexpected nil error reading %s", v)
+		}
+	}
+}
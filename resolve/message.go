@@ -0,0 +1,154 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package resolve
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	typePTR   = 12
+	classINET = 1
+)
+
+// reverseName returns the name used to look up the PTR records of `ip`,
+// such as 4.3.2.1.in-addr.arpa.
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// newQuery builds a DNS message asking for the PTR records of `name`,
+// with recursion desired.
+func newQuery(id uint16, name string) []byte {
+	msg := make([]byte, 12, 12+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 1<<8) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)    // QDCOUNT
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, typePTR, 0, classINET)
+	return msg
+}
+
+// parsePTR extracts the names contained in the PTR records of the
+// answer section of `msg`, which must be a response to query `id`.
+func parsePTR(msg []byte, id uint16) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("dns message too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, errors.New("dns message id mismatch")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&(1<<15) == 0 {
+		return nil, errors.New("dns message is not a response")
+	}
+	if rcode := flags & 0x0f; rcode != 0 {
+		return nil, fmt.Errorf("dns server returned rcode %d", rcode)
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	an := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		var err error
+		if _, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4 // QTYPE, QCLASS
+	}
+	var names []string
+	for i := 0; i < an; i++ {
+		var err error
+		if _, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errors.New("dns record truncated")
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errors.New("dns record truncated")
+		}
+		if typ == typePTR {
+			name, _, err := readName(msg, off)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+		off += rdlen
+	}
+	return names, nil
+}
+
+// readName decodes the, possibly compressed, domain name starting at
+// `off`. Returns the name and the offset following it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errors.New("dns name truncated")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			off++
+			if next < 0 {
+				next = off
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errors.New("dns name truncated")
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, errors.New("dns name has too many pointers")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errors.New("dns name truncated")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
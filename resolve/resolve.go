@@ -0,0 +1,257 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package resolve performs reverse DNS lookups of the addresses found,
+// optionally using a resolver different from the system one, which may
+// be the very thing under investigation.
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Options configure how lookups are performed.
+type Options struct {
+	Server  string        // DNS server address, i.e. 1.1.1.1 or 1.1.1.1:53
+	DoH     string        // DNS over HTTPS endpoint, i.e. https://cloudflare-dns.com/dns-query
+	Rate    int           // maximum number of lookups started per second
+	Timeout time.Duration // timeout of each lookup
+}
+
+// DefaultOptions are used to fill the zero fields of the options
+// provided to New. When neither Server nor DoH are set, the system
+// resolver is used.
+var DefaultOptions = Options{
+	Rate:    10,
+	Timeout: 2 * time.Second,
+}
+
+// Resolver performs rate limited PTR lookups.
+type Resolver struct {
+	opts   Options
+	client *http.Client
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// New returns a Resolver configured with `opts`. Server and DoH are
+// mutually exclusive.
+func New(opts Options) (*Resolver, error) {
+	if opts.Server != "" && opts.DoH != "" {
+		return nil, errors.New("a DNS server and a DoH endpoint cannot be used together")
+	}
+	if opts.Rate <= 0 {
+		opts.Rate = DefaultOptions.Rate
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions.Timeout
+	}
+	if opts.Server != "" {
+		if _, _, err := net.SplitHostPort(opts.Server); err != nil {
+			opts.Server = net.JoinHostPort(opts.Server, "53")
+		}
+	}
+	if opts.DoH != "" && !strings.HasPrefix(opts.DoH, "https://") {
+		return nil, fmt.Errorf("DoH endpoint %s is not an https URL", opts.DoH)
+	}
+	return &Resolver{opts: opts, client: &http.Client{}}, nil
+}
+
+// LookupAddr returns the names `ip` resolves to. Calls block as long
+// as needed to respect the configured rate.
+func (r *Resolver) LookupAddr(ctx context.Context, ip net.IP) ([]string, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	if r.opts.Server == "" && r.opts.DoH == "" {
+		return net.DefaultResolver.LookupAddr(ctx, ip.String())
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := newQuery(id, reverseName(ip))
+	var resp []byte
+	var err error
+	if r.opts.DoH != "" {
+		resp, err = r.exchangeHTTPS(ctx, query)
+	} else {
+		resp, err = r.exchangeUDP(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePTR(resp, id)
+}
+
+// wait blocks until the next lookup slot is available.
+func (r *Resolver) wait(ctx context.Context) error {
+	interval := time.Second / time.Duration(r.opts.Rate)
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	slot := r.next
+	r.next = r.next.Add(interval)
+	r.mu.Unlock()
+
+	t := time.NewTimer(slot.Sub(now))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *Resolver) exchangeUDP(ctx context.Context, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", r.opts.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1232)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// exchangeHTTPS sends `query` to the DoH endpoint as described by
+// RFC 8484.
+func (r *Resolver) exchangeHTTPS(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, r.opts.DoH, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH endpoint replied with %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Addrs selects the addresses of the open network files resolved by
+// RunAddrs.
+type Addrs int
+
+const (
+	Dst Addrs = 1 << iota // destination addresses, filling DstName
+	Src                   // source addresses, filling SrcName
+)
+
+// Run resolves each unique destination host of `set` using `r`,
+// filling the DstName field of the open network files pointing to
+// it. Failed lookups are only logged.
+func Run(ctx context.Context, set []onf.ONF, r *Resolver) {
+	RunAddrs(ctx, set, r, Dst)
+}
+
+// RunAddrs is the same as Run, but the addresses resolved are selected
+// by `which`: when it includes Src, the SrcName field of the open
+// network files is filled too. Hosts appearing both as source and
+// destination are looked up once.
+func RunAddrs(ctx context.Context, set []onf.ONF, r *Resolver, which Addrs) {
+	hosts := make(map[string]bool)
+	for _, v := range set {
+		if host, ok := addrHost(v.Dst); ok && which&Dst != 0 {
+			hosts[host] = true
+		}
+		if host, ok := addrHost(v.Src); ok && which&Src != 0 {
+			hosts[host] = true
+		}
+	}
+
+	l := internal.LoggerFrom(ctx)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(map[string]string, len(hosts))
+	for host := range hosts {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(host string, ip net.IP) {
+			defer wg.Done()
+			res, err := r.LookupAddr(ctx, ip)
+			if err != nil || len(res) == 0 {
+				l.Printf("Reverse lookup of %s failed: %v", host, err)
+				return
+			}
+			mu.Lock()
+			names[host] = strings.TrimSuffix(res[0], ".")
+			mu.Unlock()
+		}(host, ip)
+	}
+	wg.Wait()
+
+	for i, v := range set {
+		if host, ok := addrHost(v.Dst); ok && which&Dst != 0 && names[host] != "" {
+			set[i].DstName = names[host]
+		}
+		if host, ok := addrHost(v.Src); ok && which&Src != 0 && names[host] != "" {
+			set[i].SrcName = names[host]
+		}
+	}
+}
+
+// addrHost returns the host part of `addr`. Returns false when it is
+// missing or unspecified ("*", "0.0.0.0" or "::"), as it happens for
+// listening sockets.
+func addrHost(addr net.Addr) (string, bool) {
+	if addr == nil {
+		return "", false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil || host == "" || host == "*" {
+		return "", false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return "", false
+	}
+	return host, true
+}
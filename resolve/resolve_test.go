@@ -0,0 +1,169 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package resolve
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// answer builds the response to `query`, containing a single PTR
+// record pointing to `name`.
+func answer(query []byte, name string) []byte {
+	resp := append([]byte{}, query...)
+	resp[2] |= 0x80                         // QR
+	binary.BigEndian.PutUint16(resp[6:], 1) // ANCOUNT
+	rdata := newQuery(0, name)[12:]
+	rdata = rdata[:len(rdata)-4] // drop QTYPE and QCLASS
+	resp = append(resp, 0xc0, 12, 0, typePTR, 0, classINET, 0, 0, 0, 60)
+	resp = append(resp, byte(len(rdata)>>8), byte(len(rdata)))
+	return append(resp, rdata...)
+}
+
+func TestReverseName(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		ip   string
+		name string
+	}{
+		{ip: "1.2.3.4", name: "4.3.2.1.in-addr.arpa."},
+		{ip: "2001:db8::1", name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+	for i, v := range tt {
+		if name := reverseName(net.ParseIP(v.ip)); name != v.name {
+			t.Fatalf("%d: Unexpected name: wanted %s, found %s", i, v.name, name)
+		}
+	}
+}
+
+func TestRun_Server(t *testing.T) {
+	t.Parallel()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(answer(buf[:n], "one.one.one.one."), addr)
+		}
+	}()
+
+	r, err := New(Options{Server: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := []onf.ONF{
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")},
+		{Src: internal.NewAddr("tcp", "*:22")},
+	}
+	Run(context.Background(), set, r)
+	if set[0].DstName != "one.one.one.one" {
+		t.Fatalf("Unexpected destination name: %q", set[0].DstName)
+	}
+	if set[1].DstName != "" {
+		t.Fatalf("Unexpected destination name for listening socket: %q", set[1].DstName)
+	}
+}
+
+func TestRunAddrs_Src(t *testing.T) {
+	t.Parallel()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(answer(buf[:n], "host.lan."), addr)
+		}
+	}()
+
+	r, err := New(Options{Server: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := []onf.ONF{
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")},
+		{Src: internal.NewAddr("tcp", "*:22")},
+		{Src: internal.NewAddr("tcp", "0.0.0.0:22")},
+		{Src: internal.NewAddr("tcp", "[::]:22")},
+	}
+	RunAddrs(context.Background(), set, r, Src)
+	if set[0].SrcName != "host.lan" || set[0].DstName != "" {
+		t.Fatalf("Unexpected names: %q, %q", set[0].SrcName, set[0].DstName)
+	}
+	for _, v := range set[1:] {
+		if v.SrcName != "" {
+			t.Fatalf("Unexpected source name for unspecified address %v: %q", v.Src, v.SrcName)
+		}
+	}
+}
+
+func TestLookupAddr_DoH(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		query, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer(query, "dns.google."))
+	}))
+	defer srv.Close()
+
+	r, err := New(Options{DoH: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.client = srv.Client()
+	names, err := r.LookupAddr(context.Background(), net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "dns.google." {
+		t.Fatalf("Unexpected names: %v", names)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	if _, err := New(Options{Server: "1.1.1.1", DoH: "https://1.1.1.1/dns-query"}); err == nil {
+		t.Fatalf("Expected an error when both a server and a DoH endpoint are provided")
+	}
+	if _, err := New(Options{DoH: "http://1.1.1.1/dns-query"}); err == nil {
+		t.Fatalf("Expected an error with a plain http DoH endpoint")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotAllowed is returned by Allowlist when a command that was
+// not explicitly enabled is executed.
+var ErrNotAllowed = errors.New("execution of external commands is not allowed")
+
+// Allowlist is a Runner that refuses to execute external commands,
+// unless they are explicitly enabled by name. Enabled commands are
+// run by their absolute path, so that PATH is never looked up. It is
+// meant for embedders that need to tightly control which processes
+// lsaddr spawns (hardened mode).
+type Allowlist struct {
+	// Runner executes the enabled commands. Local{} is used when
+	// nil. Note that a Local runner with LowPriority set executes
+	// nice and ionice as found in PATH.
+	Runner Runner
+
+	paths map[string]string
+}
+
+// NewAllowlist returns an Allowlist enabling the commands in `paths`,
+// which maps command names (i.e. lsof) to the absolute path of the
+// executable to run in their place. Each path is validated: it must
+// be absolute and point to a regular executable file which, on unix
+// systems, is not writable by group or others. An empty map disables
+// the execution of every external command.
+func NewAllowlist(paths map[string]string) (*Allowlist, error) {
+	acc := make(map[string]string, len(paths))
+	for name, path := range paths {
+		if err := checkTool(path); err != nil {
+			return nil, fmt.Errorf("unable to allow %s: %w", name, err)
+		}
+		acc[name] = path
+	}
+	return &Allowlist{paths: acc}, nil
+}
+
+// ParseAllowlist parses `raw`, a list of "<name>=<path>" assignments,
+// into the map accepted by NewAllowlist.
+func ParseAllowlist(raw []string) (map[string]string, error) {
+	paths := make(map[string]string, len(raw))
+	for _, v := range raw {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid allowlist entry %q: expected <name>=<path>", v)
+		}
+		paths[v[:i]] = v[i+1:]
+	}
+	return paths, nil
+}
+
+// Allowed returns the names of the enabled commands, sorted.
+func (a *Allowlist) Allowed() []string {
+	names := make([]string, 0, len(a.paths))
+	for k := range a.paths {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Path returns the absolute path of the executable run in place of
+// `name`, and whether it is enabled at all. Commands that cannot be
+// executed through a Runner, such as those streaming their output,
+// are started from it.
+func (a *Allowlist) Path(name string) (string, bool) {
+	path, ok := a.paths[name]
+	return path, ok
+}
+
+func (a *Allowlist) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	path, ok := a.paths[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unable to run %s: %w", name, ErrNotAllowed)
+	}
+	r := a.Runner
+	if r == nil {
+		r = Local{}
+	}
+	return r.Run(ctx, path, args...)
+}
+
+// checkTool validates the executable at `path`.
+func checkTool(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s is not an absolute path", path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return checkMode(path, fi.Mode())
+}
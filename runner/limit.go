@@ -0,0 +1,103 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package runner
+
+import (
+	"context"
+	"sync"
+)
+
+// Limit is a Runner bounding the number of commands executed
+// concurrently, so that lookups started at the same time (i.e. by
+// watch mode and enrichers, or by an embedder serving many clients)
+// do not stack external tool invocations on constrained hosts.
+// Commands exceeding the limits wait for a running one to exit, or
+// until their context is done.
+type Limit struct {
+	// Runner executes the commands. Local{} is used when nil.
+	Runner Runner
+
+	total chan struct{}
+	mu    sync.Mutex
+	per   int
+	cmds  map[string]chan struct{}
+}
+
+// NewLimit returns a Limit executing commands with `r`, at most
+// `total` at a time and at most `perCommand` instances of the same
+// command (i.e. lsof) at a time. Non positive values disable the
+// respective limit: a total of 1 runs one command at a time.
+func NewLimit(r Runner, total, perCommand int) *Limit {
+	l := &Limit{Runner: r, per: perCommand, cmds: make(map[string]chan struct{})}
+	if total > 0 {
+		l.total = make(chan struct{}, total)
+	}
+	return l
+}
+
+// Run waits for the limits to allow the execution of `name`, then runs
+// it with Runner. Returns the context error when `ctx` is done first.
+func (l *Limit) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	cmd := l.command(name)
+	if err := acquire(ctx, cmd); err != nil {
+		return nil, nil, err
+	}
+	defer release(cmd)
+	if err := acquire(ctx, l.total); err != nil {
+		return nil, nil, err
+	}
+	defer release(l.total)
+
+	r := l.Runner
+	if r == nil {
+		r = Local{}
+	}
+	return r.Run(ctx, name, args...)
+}
+
+// command returns the semaphore of `name`, nil when executions of the
+// same command are not limited.
+func (l *Limit) command(name string) chan struct{} {
+	if l.per <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.cmds[name]
+	if !ok {
+		sem = make(chan struct{}, l.per)
+		l.cmds[name] = sem
+	}
+	return sem
+}
+
+func acquire(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
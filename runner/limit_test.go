@@ -0,0 +1,94 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package runner_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func TestLimit(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		total, perCommand int
+		names             []string
+		max               int // maximum number of commands running at once
+	}{
+		{total: 1, names: []string{"lsof", "ps", "lsof", "ps"}, max: 1},
+		{perCommand: 1, names: []string{"lsof", "lsof", "lsof"}, max: 1},
+		{perCommand: 1, names: []string{"lsof", "ps", "lsof", "ps"}, max: 2},
+		{total: 3, perCommand: 2, names: []string{"lsof", "lsof", "lsof", "ps", "ps"}, max: 3},
+		{names: []string{"lsof", "lsof", "lsof"}, max: 3},
+	}
+	for i, v := range tt {
+		var (
+			mu            sync.Mutex
+			running, peak int
+		)
+		l := runner.NewLimit(runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return []byte(name), nil, nil
+		}), v.total, v.perCommand)
+
+		var wg sync.WaitGroup
+		for _, name := range v.names {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if out, _, err := l.Run(context.Background(), name); err != nil || string(out) != name {
+					t.Errorf("%d: Unexpected result: %q, %v", i, out, err)
+				}
+			}(name)
+		}
+		wg.Wait()
+		if peak > v.max {
+			t.Fatalf("%d: Unexpected number of concurrent commands: wanted at most %d, found %d", i, v.max, peak)
+		}
+	}
+}
+
+func TestLimitContext(t *testing.T) {
+	t.Parallel()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	l := runner.NewLimit(runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		close(started)
+		<-release
+		return nil, nil, nil
+	}), 1, 0)
+	go l.Run(context.Background(), "lsof")
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := l.Run(ctx, "ps"); err != context.DeadlineExceeded {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
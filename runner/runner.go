@@ -0,0 +1,66 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package runner abstracts the execution of the external tools
+// lsaddr depends on, so that embedders can run them through their own
+// transport (ssh, agents, test fakes) while reusing all parsing and
+// filtering logic.
+package runner
+
+import (
+	"bytes"
+	"context"
+)
+
+// Runner executes command `name` with `args`, returning its
+// standard output and standard error.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// Func is an adapter that allows ordinary functions to be used
+// as Runners.
+type Func func(ctx context.Context, name string, args ...string) ([]byte, []byte, error)
+
+// Run calls f(ctx, name, args...).
+func (f Func) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	return f(ctx, name, args...)
+}
+
+// Local runs commands on the local machine.
+type Local struct {
+	// LowPriority runs commands with reduced CPU and IO priority
+	// (nice and ionice on unix, below normal priority class on
+	// windows), for latency sensitive hosts.
+	LowPriority bool
+}
+
+// Run executes the command as a child process, which is killed
+// when `ctx` is done.
+func (l Local) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := command(ctx, l.LowPriority, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Default is the Runner used to execute external tools. Replace it
+// before performing any lookup to change how commands are executed.
+var Default Runner = Local{}
@@ -0,0 +1,54 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// command returns a command that, when lowPriority is set, is
+// wrapped with nice and, when available, ionice.
+func command(ctx context.Context, lowPriority bool, name string, args ...string) *exec.Cmd {
+	if lowPriority {
+		name, args = lowPriorityWrap(name, args)
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
+
+func lowPriorityWrap(name string, args []string) (string, []string) {
+	wrapped := append([]string{name}, args...)
+	if _, err := exec.LookPath("ionice"); err == nil {
+		wrapped = append([]string{"ionice", "-c", "3"}, wrapped...)
+	}
+	return "nice", append([]string{"-n", "19"}, wrapped...)
+}
+
+// checkMode ensures that the tool at `path` is executable, and that it
+// cannot be replaced by users other than its owner.
+func checkMode(path string, mode os.FileMode) error {
+	if mode&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	if mode&0022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
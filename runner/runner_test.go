@@ -0,0 +1,115 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package runner_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jecoz/lsaddr/runner"
+)
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+	for _, low := range []bool{false, true} {
+		stdout, _, err := runner.Local{LowPriority: low}.Run(context.Background(), "echo", "lsaddr")
+		if err != nil {
+			t.Fatalf("Unexpected error (low priority: %v): %v", low, err)
+		}
+		if string(stdout) != "lsaddr\n" {
+			t.Fatalf("Unexpected output (low priority: %v): \"%s\"", low, stdout)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-runner")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tool := func(name string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// WriteFile honours umask.
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return path
+	}
+	lsof := tool("lsof", 0755)
+	invalid := []map[string]string{
+		{"lsof": "lsof"},
+		{"lsof": dir},
+		{"lsof": filepath.Join(dir, "missing")},
+		{"lsof": tool("plain", 0644)},
+		{"lsof": tool("shared", 0775)},
+	}
+	for i, v := range invalid {
+		if _, err := runner.NewAllowlist(v); err == nil {
+			t.Fatalf("%d: expected an error allowing %v", i, v)
+		}
+	}
+
+	a, err := runner.NewAllowlist(map[string]string{"lsof": lsof})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var ran string
+	a.Runner = runner.Func(func(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+		ran = name
+		return nil, nil, nil
+	})
+	if _, _, err := a.Run(context.Background(), "lsof", "-i"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ran != lsof {
+		t.Fatalf("Unexpected command: wanted %s, found %s", lsof, ran)
+	}
+	if path, ok := a.Path("lsof"); !ok || path != lsof {
+		t.Fatalf("Unexpected path: wanted %s, found %s (%v)", lsof, path, ok)
+	}
+	if _, ok := a.Path("pgrep"); ok {
+		t.Fatalf("Unexpected path of a command that was not allowed")
+	}
+	if _, _, err := a.Run(context.Background(), "pgrep"); !errors.Is(err, runner.ErrNotAllowed) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", runner.ErrNotAllowed, err)
+	}
+}
+
+func TestParseAllowlist(t *testing.T) {
+	t.Parallel()
+	paths, err := runner.ParseAllowlist([]string{"lsof=/usr/sbin/lsof", "ps=/bin/ps"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(paths) != 2 || paths["lsof"] != "/usr/sbin/lsof" || paths["ps"] != "/bin/ps" {
+		t.Fatalf("Unexpected allowlist: %v", paths)
+	}
+	if _, err := runner.ParseAllowlist([]string{"/usr/sbin/lsof"}); err == nil {
+		t.Fatalf("Expected an error parsing an entry without name")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows
+
+package runner
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Process creation flags.
+const (
+	createNoWindow           = 0x08000000
+	belowNormalPriorityClass = 0x00004000
+)
+
+// command returns a command which does not flash a console window
+// when lsaddr is run from a GUI agent.
+func command(ctx context.Context, lowPriority bool, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	flags := uint32(createNoWindow)
+	if lowPriority {
+		flags |= belowNormalPriorityClass
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: flags,
+	}
+	return cmd
+}
+
+// checkMode is a no-op on windows, where permission bits do not
+// describe who may modify a file.
+func checkMode(path string, mode os.FileMode) error {
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package session persists the state of a watch to disk, that is the
+// open network files found by its last lookup and the time each of
+// them was first seen, so that a watch restarted (i.e. after a reboot
+// of the monitoring host) resumes from where the previous one stopped
+// instead of losing the connection history.
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Entry is an open network file of a State.
+type Entry struct {
+	FirstSeen time.Time `json:"first_seen"`
+	File      onf.ONF   `json:"file"`
+}
+
+// State is the state of a watch.
+type State struct {
+	SchemaVersion int       `json:"schema_version"` // see onf.SchemaVersion
+	Time          time.Time `json:"time"`           // time of the last lookup
+	Entries       []Entry   `json:"entries"`
+}
+
+// New returns the State of a watch whose first lookup, at time `t`,
+// found `set`.
+func New(set []onf.ONF, t time.Time) *State {
+	s := &State{SchemaVersion: onf.SchemaVersion, Time: t, Entries: []Entry{}}
+	for _, v := range set {
+		s.Entries = append(s.Entries, Entry{FirstSeen: t, File: v})
+	}
+	return s
+}
+
+// Files returns the open network files found by the last lookup.
+func (s *State) Files() []onf.ONF {
+	acc := make([]onf.ONF, 0, len(s.Entries))
+	for _, v := range s.Entries {
+		acc = append(acc, v.File)
+	}
+	return acc
+}
+
+// Apply updates `s` with change `c`: closed open network files are
+// removed, and opened ones are added, first seen at the time of `c`.
+func (s *State) Apply(c onf.Change) {
+	closed := make(map[string]bool, len(c.Closed))
+	for _, v := range c.Closed {
+		closed[onf.Identity(v)] = true
+	}
+	acc := make([]Entry, 0, len(s.Entries)+len(c.Opened))
+	for _, v := range s.Entries {
+		if !closed[onf.Identity(v.File)] {
+			acc = append(acc, v)
+		}
+	}
+	for _, v := range c.Opened {
+		acc = append(acc, Entry{FirstSeen: c.Time, File: v})
+	}
+	s.Entries, s.Time = acc, c.Time
+}
+
+// Store keeps the states of watches in Dir, one file each.
+type Store struct {
+	Dir string
+}
+
+// Key returns the key of the state of the watch configured with
+// `parts`, such as its backend, filter and flags: watches configured
+// differently do not share their states.
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Store) path(key string) string {
+	return filepath.Join(s.Dir, key+".json")
+}
+
+// Load returns the state stored under `key`, if present. Corrupted
+// states, and those written by newer versions, are discarded.
+func (s Store) Load(key string) (*State, bool) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("Discarding corrupted watch state %s: %v", key, err)
+		return nil, false
+	}
+	if st.SchemaVersion > onf.SchemaVersion {
+		log.Printf("Discarding watch state %s: schema version %d is newer than the supported %d", key, st.SchemaVersion, onf.SchemaVersion)
+		return nil, false
+	}
+	return &st, true
+}
+
+// Save stores `st` under `key`, replacing any previous state. The
+// state is replaced atomically, so that an interrupted Save does not
+// corrupt it.
+func (s Store) Save(key string, st *State) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("unable to create state directory: %w", err)
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("unable to encode watch state: %w", err)
+	}
+	f, err := ioutil.TempFile(s.Dir, key)
+	if err != nil {
+		return fmt.Errorf("unable to store watch state: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to store watch state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("unable to store watch state: %w", err)
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
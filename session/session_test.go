@@ -0,0 +1,100 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package session_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/session"
+)
+
+func TestState_Apply(t *testing.T) {
+	t.Parallel()
+	spotify := onf.ONF{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")}
+	curl := onf.ONF{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.1.1.1:443")}
+	ssh := onf.ONF{Cmd: "ssh", Pid: 3, Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "10.0.0.1:22")}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := start.Add(time.Minute)
+
+	s := session.New([]onf.ONF{spotify, curl}, start)
+	s.Apply(onf.Change{Opened: []onf.ONF{ssh}, Closed: []onf.ONF{curl}, Time: later})
+	if !s.Time.Equal(later) {
+		t.Fatalf("Unexpected state time: %v", s.Time)
+	}
+	if len(s.Entries) != 2 {
+		t.Fatalf("Unexpected entries: %v", s.Entries)
+	}
+	if e := s.Entries[0]; e.File.Cmd != "Spotify" || !e.FirstSeen.Equal(start) {
+		t.Fatalf("Unexpected entry: %v", e)
+	}
+	if e := s.Entries[1]; e.File.Cmd != "ssh" || !e.FirstSeen.Equal(later) {
+		t.Fatalf("Unexpected entry: %v", e)
+	}
+	if files := s.Files(); len(files) != 2 || files[1].Cmd != "ssh" {
+		t.Fatalf("Unexpected files: %v", files)
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := session.Store{Dir: filepath.Join(dir, "state")}
+	key := session.Key("lsof", "Spotify")
+	if _, ok := store.Load(key); ok {
+		t.Fatalf("Unexpected state in empty store")
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	set := []onf.ONF{{
+		Cmd: "Spotify",
+		Pid: 11778,
+		Src: internal.NewAddr("tcp", "192.168.0.61:51291"),
+		Dst: internal.NewAddr("tcp", "35.186.224.47:443"),
+	}}
+	if err := store.Save(key, session.New(set, start)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	st, ok := store.Load(key)
+	if !ok {
+		t.Fatalf("Expected stored state")
+	}
+	if !st.Time.Equal(start) || len(st.Entries) != 1 || !st.Entries[0].FirstSeen.Equal(start) {
+		t.Fatalf("Unexpected state: %+v", st)
+	}
+	if s := st.Entries[0].File.String(); s != set[0].String() {
+		t.Fatalf("Unexpected stored file: wanted %v, found %v", set[0], s)
+	}
+	if _, ok := store.Load(session.Key("lsof", "curl")); ok {
+		t.Fatalf("Unexpected state stored under another key")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(store.Dir, key+".json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Load(key); ok {
+		t.Fatalf("Unexpected corrupted state loaded")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package sockstat decodes the output of ``sockstat -46 -s'', the
+// FreeBSD tool listing open internet sockets together with their
+// owners.
+package sockstat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+type Socket struct {
+	Raw     string
+	User    string
+	Command string
+	Pid     int // 0 when the owner is unknown
+	Fd      int
+	Proto   string   // tcp4, tcp6, udp4, udp6, ...
+	SrcAddr net.Addr // network is tcp or udp
+	DstAddr net.Addr // empty for listening and unconnected sockets
+	State   string   // TCP state (i.e. ESTABLISHED), if reported
+}
+
+// ScanWith executes ``sockstat -46 -s'' using "r", calling `fn` with
+// each line of its output for which `match` returns true, as soon as
+// it is decoded (see ScanOutput).
+func ScanWith(r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	return ScanWithContext(context.Background(), r, match, fn)
+}
+
+// ScanWithContext is the same as ScanWith, but the execution is
+// aborted when `ctx` is done.
+func ScanWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	l := internal.LoggerFrom(ctx)
+	l.Printf("Executing: sockstat -46 -s")
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	out, _, err := r.Run(ctx, "sockstat", "-46", "-s")
+	if err != nil {
+		return fmt.Errorf("unable to run sockstat: %w", err)
+	}
+	return scanOutput(l, bytes.NewBuffer(out), match, fn)
+}
+
+// ParseOutput expects "r" to contain the output of a ``sockstat -46
+// -s'' call, returning the sockets it lists. Lines that cannot be
+// decoded, such as the header, are skipped.
+func ParseOutput(r io.Reader) ([]Socket, error) {
+	set := []Socket{}
+	err := ScanOutput(r, nil, func(v Socket) error {
+		set = append(set, v)
+		return nil
+	})
+	return set, err
+}
+
+// ScanOutput is the same as ParseOutput, but lines for which `match`
+// returns false are skipped before being decoded, and each decoded
+// line is passed to `fn` instead of being accumulated. A nil `match`
+// accepts every line. Scanning stops at the first error returned by
+// `fn`.
+func ScanOutput(r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return scanOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return internal.ScanLines(r, func(line string) error {
+		if strings.HasPrefix(line, "USER") || strings.TrimSpace(line) == "" {
+			return nil
+		}
+		if match != nil && !match(line) {
+			return nil
+		}
+		s, err := ParseSocket(line)
+		if err != nil {
+			l.Printf("skipping sockstat socket \"%s\": %v", line, err)
+			return nil
+		}
+		return fn(*s)
+	})
+}
+
+// ParseSocket expects "line" to be a single line of the output of a
+// ``sockstat -46 -s'' call. Sockets whose owner is not known are
+// reported by sockstat with "?" in place of user, command, pid and fd:
+// their Pid is 0.
+//
+// "line" examples:
+// "www      nginx      1201  6  tcp4   10.0.0.2:443          10.0.0.7:50000        ESTABLISHED"
+// "root     sshd       812   4  tcp6   *:22                  *:*                   LISTEN"
+// "root     syslogd    601   7  udp4   *:514                 *:*"
+func ParseSocket(line string) (*Socket, error) {
+	chunks, err := internal.ChunkLine(line, " ", 7)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{Raw: line, User: chunks[0], Command: chunks[1], Proto: chunks[4]}
+	if chunks[2] != "?" {
+		if s.Pid, err = strconv.Atoi(chunks[2]); err != nil {
+			return nil, fmt.Errorf("error parsing pid: %w", err)
+		}
+		if s.Fd, err = strconv.Atoi(chunks[3]); err != nil {
+			return nil, fmt.Errorf("error parsing fd: %w", err)
+		}
+	}
+	network := strings.TrimRight(s.Proto, "46")
+	if s.SrcAddr, err = parseAddr(network, chunks[5]); err != nil {
+		return nil, fmt.Errorf("error parsing local address: %w", err)
+	}
+	if s.DstAddr, err = parseAddr(network, chunks[6]); err != nil {
+		return nil, fmt.Errorf("error parsing foreign address: %w", err)
+	}
+	if len(chunks) > 7 && chunks[len(chunks)-1] != "??" {
+		s.State = chunks[len(chunks)-1]
+	}
+	return s, nil
+}
+
+// parseAddr parses an address as printed by sockstat, that does not
+// enclose IPv6 addresses in brackets (i.e. "::1:6010"). Wildcard
+// foreign addresses ("*:*") are returned as empty addresses.
+func parseAddr(network, addr string) (net.Addr, error) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("missing port in address %s", addr)
+	}
+	host, port := addr[:i], addr[i+1:]
+	if port == "*" {
+		return internal.NewAddr(network, ""), nil
+	}
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j]
+	}
+	if host == "*" {
+		return internal.ParseNetAddr(network, "*:"+port)
+	}
+	return internal.ParseNetAddr(network, net.JoinHostPort(host, port))
+}
@@ -0,0 +1,74 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package sockstat
+
+import (
+	"strings"
+	"testing"
+)
+
+const sockstatExample = `USER     COMMAND    PID   FD PROTO  LOCAL ADDRESS         FOREIGN ADDRESS       STATE
+root     sshd       812   4  tcp6   *:22                  *:*                   LISTEN
+www      nginx      1201  6  tcp4   10.0.0.2:443          10.0.0.7:50000        ESTABLISHED
+dan      firefox    4001  52 tcp6   ::1:6010              fe80::1%em0:5353      CLOSE_WAIT
+root     syslogd    601   7  udp4   *:514                 *:*
+?        ?          ?     ?  tcp4   10.0.0.2:51290        35.186.224.47:443     TIME_WAIT
+`
+
+func TestParseOutput(t *testing.T) {
+	t.Parallel()
+	set, err := ParseOutput(strings.NewReader(sockstatExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tt := []struct {
+		cmd             string
+		pid, fd         int
+		net             string
+		src, dst, state string
+	}{
+		{"sshd", 812, 4, "tcp", "*:22", "", "LISTEN"},
+		{"nginx", 1201, 6, "tcp", "10.0.0.2:443", "10.0.0.7:50000", "ESTABLISHED"},
+		{"firefox", 4001, 52, "tcp", "[::1]:6010", "[fe80::1]:5353", "CLOSE_WAIT"},
+		{"syslogd", 601, 7, "udp", "*:514", "", ""},
+		{"?", 0, 0, "tcp", "10.0.0.2:51290", "35.186.224.47:443", "TIME_WAIT"},
+	}
+	if len(set) != len(tt) {
+		t.Fatalf("Unexpected set length: wanted %d, found %d: %v", len(tt), len(set), set)
+	}
+	for i, v := range tt {
+		s := set[i]
+		if s.Command != v.cmd || s.Pid != v.pid || s.Fd != v.fd || s.SrcAddr.Network() != v.net {
+			t.Fatalf("%d: Unexpected socket: %+v", i, s)
+		}
+		if s.SrcAddr.String() != v.src || s.DstAddr.String() != v.dst || s.State != v.state {
+			t.Fatalf("%d: Unexpected socket: %s->%s (%s)", i, s.SrcAddr, s.DstAddr, s.State)
+		}
+	}
+}
+
+func TestParseSocket_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{
+		"root sshd 812 4 tcp6 *:22",
+		"root sshd pid 4 tcp6 *:22 *:*",
+		"root sshd 812 4 tcp6 localhost:22 *:*",
+	} {
+		if _, err := ParseSocket(v); err == nil {
+			t.Fatalf("Unexpected nil error parsing %q", v)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ss decodes the output of ``ss -tunap'', which enumerates
+// sockets through netlink: it is shipped by modern linux distributions
+// that do not include lsof, and is faster on systems with many
+// connections.
+package ss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/runner"
+)
+
+// User is a process owning a socket.
+type User struct {
+	Cmd string
+	Pid int
+	Fd  int
+}
+
+type Socket struct {
+	Raw     string
+	Proto   string // tcp, udp
+	State   string // normalized as lsof reports it (i.e. ESTABLISHED, CLOSE_WAIT)
+	SrcAddr net.Addr
+	DstAddr net.Addr // empty for listening and unconnected sockets
+	RecvQ   uint64
+	SendQ   uint64
+	Users   []User // empty when ss is not allowed to inspect the owners
+}
+
+// ScanWith executes ``ss -tunap'' using "r", calling `fn` with each
+// line of its output for which `match` returns true, as soon as it is
+// decoded (see ScanOutput).
+func ScanWith(r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	return ScanWithContext(context.Background(), r, match, fn)
+}
+
+// ScanWithContext is the same as ScanWith, but the execution is
+// aborted when `ctx` is done.
+func ScanWithContext(ctx context.Context, r runner.Runner, match func(string) bool, fn func(Socket) error) error {
+	l := internal.LoggerFrom(ctx)
+	l.Printf("Executing: ss -tunap")
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	out, _, err := r.Run(ctx, "ss", "-tunap")
+	if err != nil {
+		return fmt.Errorf("unable to run ss: %w", err)
+	}
+	return scanOutput(l, bytes.NewBuffer(out), match, fn)
+}
+
+// ParseOutput expects "r" to contain the output of a ``ss -tunap''
+// call, returning the sockets it lists. Lines that cannot be decoded,
+// such as the header, are skipped.
+func ParseOutput(r io.Reader) ([]Socket, error) {
+	set := []Socket{}
+	err := ScanOutput(r, nil, func(v Socket) error {
+		set = append(set, v)
+		return nil
+	})
+	return set, err
+}
+
+// ScanOutput is the same as ParseOutput, but lines for which `match`
+// returns false are skipped before being decoded, and each decoded
+// line is passed to `fn` instead of being accumulated. A nil `match`
+// accepts every line. Scanning stops at the first error returned by
+// `fn`.
+func ScanOutput(r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return scanOutput(internal.StdLogger, r, match, fn)
+}
+
+func scanOutput(l internal.Logger, r io.Reader, match func(string) bool, fn func(Socket) error) error {
+	return internal.ScanLines(r, func(line string) error {
+		if strings.HasPrefix(line, "Netid") || strings.TrimSpace(line) == "" {
+			return nil
+		}
+		if match != nil && !match(line) {
+			return nil
+		}
+		s, err := ParseSocket(line)
+		if err != nil {
+			l.Printf("skipping ss socket \"%s\": %v", line, err)
+			return nil
+		}
+		return fn(*s)
+	})
+}
+
+var states = map[string]string{
+	"ESTAB":      "ESTABLISHED",
+	"SYN-RECV":   "SYN_RECV",
+	"SYN-SENT":   "SYN_SENT",
+	"FIN-WAIT-1": "FIN_WAIT1",
+	"FIN-WAIT-2": "FIN_WAIT2",
+	"TIME-WAIT":  "TIME_WAIT",
+	"CLOSE-WAIT": "CLOSE_WAIT",
+	"LAST-ACK":   "LAST_ACK",
+	"UNCONN":     "",
+}
+
+// ParseSocket expects "line" to be a single line of the output of a
+// ``ss -tunap'' call, that is the protocol, the state, the receive
+// and send queues, the local and peer addresses and, when available,
+// the processes owning the socket.
+//
+// "line" examples:
+// "tcp   ESTAB  0      0      192.168.0.61:51291  35.186.224.47:443  users:(("Spotify",pid=11778,fd=128))"
+// "udp   UNCONN 0      0      127.0.0.53%lo:53    0.0.0.0:*          users:(("systemd-resolve",pid=577,fd=13))"
+// "tcp   LISTEN 0      128    [::]:22             [::]:*"
+func ParseSocket(line string) (*Socket, error) {
+	chunks, err := internal.ChunkLine(line, " ", 6)
+	if err != nil {
+		return nil, err
+	}
+	s := &Socket{Raw: line, Proto: chunks[0], State: chunks[1]}
+	if v, ok := states[s.State]; ok {
+		s.State = v
+	}
+	if s.RecvQ, err = strconv.ParseUint(chunks[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("error parsing receive queue: %w", err)
+	}
+	if s.SendQ, err = strconv.ParseUint(chunks[3], 10, 64); err != nil {
+		return nil, fmt.Errorf("error parsing send queue: %w", err)
+	}
+	if s.SrcAddr, err = parseAddr(s.Proto, chunks[4]); err != nil {
+		return nil, fmt.Errorf("error parsing local address: %w", err)
+	}
+	if s.DstAddr, err = parseAddr(s.Proto, chunks[5]); err != nil {
+		return nil, fmt.Errorf("error parsing peer address: %w", err)
+	}
+	if len(chunks) > 6 {
+		if s.Users, err = ParseUsers(strings.Join(chunks[6:], " ")); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseAddr parses an address as printed by ss, removing the interface
+// scope (i.e. "127.0.0.53%lo:53") and adding the brackets omitted by
+// older versions around IPv6 addresses (i.e. ":::22"). Peers with a
+// wildcard port, reported by listening and unconnected sockets, are
+// returned as empty addresses.
+func parseAddr(network, addr string) (net.Addr, error) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("missing port in address %s", addr)
+	}
+	host, port := addr[:i], addr[i+1:]
+	if port == "*" {
+		return internal.NewAddr(network, ""), nil
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if j := strings.Index(host, "%"); j >= 0 {
+		host = host[:j]
+	}
+	if host == "*" {
+		return internal.ParseNetAddr(network, "*:"+port)
+	}
+	return internal.ParseNetAddr(network, net.JoinHostPort(host, port))
+}
+
+var userRgx = regexp.MustCompile(`\("((?:[^"\\]|\\.)*)",pid=(\d+),fd=(\d+)\)`)
+
+// ParseUsers parses the process column of ss, that lists the processes
+// sharing a socket.
+//
+// "users" example:
+// "users:(("nginx",pid=1201,fd=6),("nginx",pid=1200,fd=6))"
+func ParseUsers(users string) ([]User, error) {
+	if !strings.HasPrefix(users, "users:(") {
+		return nil, fmt.Errorf("unable to parse users %q", users)
+	}
+	var acc []User
+	for _, m := range userRgx.FindAllStringSubmatch(users, -1) {
+		pid, _ := strconv.Atoi(m[2])
+		fd, _ := strconv.Atoi(m[3])
+		acc = append(acc, User{Cmd: m[1], Pid: pid, Fd: fd})
+	}
+	if len(acc) == 0 {
+		return nil, fmt.Errorf("unable to parse users %q", users)
+	}
+	return acc, nil
+}
@@ -0,0 +1,82 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package ss
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ssExample = `Netid State  Recv-Q Send-Q            Local Address:Port      Peer Address:Port Process
+udp   UNCONN 0      0             127.0.0.53%lo:53             0.0.0.0:*     users:(("systemd-resolve",pid=577,fd=13))
+tcp   LISTEN 0      4096                0.0.0.0:22             0.0.0.0:*     users:(("sshd",pid=812,fd=3))
+tcp   ESTAB  0      36             192.168.0.61:51291    35.186.224.47:443   users:(("Spotify",pid=11778,fd=128),("Spotify",pid=11779,fd=5))
+tcp   TIME-WAIT 0   0              192.168.0.61:51290    35.186.224.47:443
+tcp   LISTEN 0      128                    [::]:22                [::]:*     users:(("sshd",pid=812,fd=4))
+tcp   LISTEN 0      128                     :::8080                :::*
+tcp   ESTAB  0      0       [::ffff:192.168.0.61]:22  [::ffff:10.0.0.7]:50000 users:(("Web Content",pid=4001,fd=7))
+`
+
+func TestParseOutput(t *testing.T) {
+	t.Parallel()
+	set, err := ParseOutput(strings.NewReader(ssExample))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(set) != 7 {
+		t.Fatalf("Unexpected set length: wanted 7, found %d: %v", len(set), set)
+	}
+
+	tt := []struct {
+		src, dst, state string
+		users           []User
+	}{
+		{"127.0.0.53:53", "", "", []User{{Cmd: "systemd-resolve", Pid: 577, Fd: 13}}},
+		{"0.0.0.0:22", "", "LISTEN", []User{{Cmd: "sshd", Pid: 812, Fd: 3}}},
+		{"192.168.0.61:51291", "35.186.224.47:443", "ESTABLISHED", []User{{Cmd: "Spotify", Pid: 11778, Fd: 128}, {Cmd: "Spotify", Pid: 11779, Fd: 5}}},
+		{"192.168.0.61:51290", "35.186.224.47:443", "TIME_WAIT", nil},
+		{"[::]:22", "", "LISTEN", []User{{Cmd: "sshd", Pid: 812, Fd: 4}}},
+		{"[::]:8080", "", "LISTEN", nil},
+		{"[::ffff:192.168.0.61]:22", "[::ffff:10.0.0.7]:50000", "ESTABLISHED", []User{{Cmd: "Web Content", Pid: 4001, Fd: 7}}},
+	}
+	for i, v := range tt {
+		s := set[i]
+		if s.SrcAddr.String() != v.src || s.DstAddr.String() != v.dst || s.State != v.state {
+			t.Fatalf("%d: Unexpected socket: %s->%s (%s)", i, s.SrcAddr, s.DstAddr, s.State)
+		}
+		if !reflect.DeepEqual(v.users, s.Users) {
+			t.Fatalf("%d: Unexpected users: wanted %v, found %v", i, v.users, s.Users)
+		}
+	}
+	if set[2].SendQ != 36 || set[1].SendQ != 4096 {
+		t.Fatalf("Unexpected queues: %d, %d", set[2].SendQ, set[1].SendQ)
+	}
+}
+
+func TestParseSocket_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{
+		"tcp ESTAB 0 0 192.168.0.61:51291",
+		"tcp ESTAB x 0 192.168.0.61:51291 35.186.224.47:443",
+		"tcp ESTAB 0 0 myhost:51291 35.186.224.47:443",
+		"tcp ESTAB 0 0 192.168.0.61:51291 35.186.224.47:443 timer:(keepalive,1min,0)",
+	} {
+		if _, err := ParseSocket(v); err == nil {
+			t.Fatalf("Unexpected nil error parsing %q", v)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package suricata encodes the destinations of open network files into
+// a Suricata dataset, so that they can be monitored by existing IDS
+// deployments (i.e. using ``ip.dst; dataset:isset,lsaddr,type ip,
+// load lsaddr.lst;'' in a rule).
+package suricata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes a dataset of type ``ip'': one destination address
+// per line, without duplicates.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	w := bufio.NewWriter(e.w)
+	seen := make(map[string]bool)
+	for _, v := range set {
+		host, ok := aggr.DstHost(v)
+		if !ok || seen[host] {
+			continue
+		}
+		seen[host] = true
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			continue
+		}
+		fmt.Fprintln(w, host)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
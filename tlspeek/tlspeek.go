@@ -0,0 +1,164 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tlspeek labels TLS destinations with the certificate they
+// present, which usually tells the actual service behind a CDN address.
+// A handshake is performed with each destination, but no application
+// data is ever sent.
+package tlspeek
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Options configure which destinations are peeked, and how.
+type Options struct {
+	Ports   []string      // destination ports considered, "443" when empty
+	Rate    int           // maximum number of handshakes started per second
+	Timeout time.Duration // timeout of each handshake
+}
+
+// DefaultOptions are used to fill the zero fields of the options
+// provided to Run.
+var DefaultOptions = Options{
+	Ports:   []string{"443"},
+	Rate:    5,
+	Timeout: 3 * time.Second,
+}
+
+// Run performs a TLS handshake with each unique TCP destination of
+// `set` listening on one of the configured ports, filling the Cert
+// field of the open network files pointing to it. Certificates are not
+// verified: they are only inspected.
+//
+// The DstName of the open network files is sent as server name (SNI):
+// without it, servers hosting several names (i.e. CDNs) present their
+// default certificate, which rarely tells the service. Resolve the
+// destinations first (see package resolve) to fill it; a warning is
+// logged to the logger of `ctx` when some are left without a name.
+func Run(ctx context.Context, set []onf.ONF, opts Options) {
+	if len(opts.Ports) == 0 {
+		opts.Ports = DefaultOptions.Ports
+	}
+	if opts.Rate <= 0 {
+		opts.Rate = DefaultOptions.Rate
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions.Timeout
+	}
+	ports := make(map[string]bool, len(opts.Ports))
+	for _, v := range opts.Ports {
+		ports[v] = true
+	}
+
+	// destination address -> server name to use, if known.
+	targets := make(map[string]string)
+	for _, v := range set {
+		if _, ok := aggr.DstHost(v); !ok || v.Dst.Network() != "tcp" {
+			continue
+		}
+		_, port, err := net.SplitHostPort(v.Dst.String())
+		if err != nil || !ports[port] {
+			continue
+		}
+		if name, ok := targets[v.Dst.String()]; !ok || name == "" {
+			targets[v.Dst.String()] = v.DstName
+		}
+	}
+
+	var unnamed int
+	for _, name := range targets {
+		if name == "" {
+			unnamed++
+		}
+	}
+	if unnamed > 0 {
+		internal.LoggerFrom(ctx).Printf("TLS peek of %d destinations without a name: no server name is sent, their default certificate is reported", unnamed)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	certs := make(map[string]*onf.Cert, len(targets))
+	tick := time.NewTicker(time.Second / time.Duration(opts.Rate))
+	defer tick.Stop()
+	for addr, name := range targets {
+		select {
+		case <-ctx.Done():
+		case <-tick.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(addr, name string) {
+			defer wg.Done()
+			cert := peek(ctx, addr, name, opts.Timeout)
+			mu.Lock()
+			certs[addr] = cert
+			mu.Unlock()
+		}(addr, name)
+	}
+	wg.Wait()
+
+	for i, v := range set {
+		if v.Dst == nil || v.Dst.Network() != "tcp" {
+			continue
+		}
+		if c := certs[v.Dst.String()]; c != nil {
+			set[i].Cert = c
+		}
+	}
+}
+
+func peek(ctx context.Context, addr, name string, timeout time.Duration) *onf.Cert {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		internal.LoggerFrom(ctx).Printf("TLS peek of %s failed: %v", addr, err)
+		return nil
+	}
+	defer raw.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+
+	conn := tls.Client(raw, &tls.Config{
+		ServerName:         name,
+		InsecureSkipVerify: true,
+	})
+	if err := conn.Handshake(); err != nil {
+		internal.LoggerFrom(ctx).Printf("TLS peek of %s failed: %v", addr, err)
+		return nil
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return &onf.Cert{
+		Subject:  certs[0].Subject.CommonName,
+		DNSNames: certs[0].DNSNames,
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tlspeek_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/tlspeek"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	addr := srv.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	set := []onf.ONF{
+		{Src: internal.NewAddr("tcp", "127.0.0.1:1"), Dst: internal.NewAddr("tcp", addr)},
+		{Src: internal.NewAddr("tcp", "127.0.0.1:2"), Dst: internal.NewAddr("tcp", "127.0.0.1:1")},
+	}
+	var logs bytes.Buffer
+	ctx := internal.WithLogger(context.Background(), log.New(&logs, "", 0))
+	tlspeek.Run(ctx, set, tlspeek.Options{Ports: []string{port}})
+
+	if set[0].Cert == nil {
+		t.Fatalf("Expected certificate of %v to be peeked", set[0].Dst)
+	}
+	found := false
+	for _, v := range set[0].Cert.DNSNames {
+		found = found || v == "example.com"
+	}
+	if !found {
+		t.Fatalf("Unexpected certificate names: %v", set[0].Cert.DNSNames)
+	}
+	if set[1].Cert != nil {
+		t.Fatalf("Expected %v not to be peeked", set[1].Dst)
+	}
+	// The destination has no name, hence no server name was sent.
+	if !strings.Contains(logs.String(), "without a name") {
+		t.Fatalf("Unexpected log output: %q", logs.String())
+	}
+}
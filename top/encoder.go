@@ -0,0 +1,59 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package top encodes a report of the destinations contacted by the
+// largest number of distinct commands.
+package top
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// DefaultN is the number of destinations reported by default.
+const DefaultN = 10
+
+// Encoder writes a table with one destination per line, sorted by
+// number of distinct commands connected to it.
+type Encoder struct {
+	w io.Writer
+	n int
+}
+
+// NewEncoder returns an Encoder reporting the top `n` destinations.
+// If `n` is not positive, DefaultN is used.
+func NewEncoder(w io.Writer, n int) *Encoder {
+	if n <= 0 {
+		n = DefaultN
+	}
+	return &Encoder{w: w, n: n}
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	tw := tabwriter.NewWriter(e.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DST\tCMDS\tCOMMANDS")
+	for _, v := range aggr.TopDsts(set, e.n) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", v.Addr, len(v.Cmds), strings.Join(v.Cmds, ","))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
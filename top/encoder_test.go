@@ -0,0 +1,42 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package top_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/top"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Pid: 1, Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.1.1.1:53")},
+		{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.1.1.1:53")},
+		{Cmd: "curl", Pid: 2, Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+	}
+	var b bytes.Buffer
+	if err := top.NewEncoder(&b, 1).Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "DST         CMDS  COMMANDS\n1.1.1.1:53  2     Spotify,curl\n"
+	if b.String() != want {
+		t.Fatalf("Unexpected output:\nwanted\n%q\nfound\n%q", want, b.String())
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package transport delivers the encoded output to its destination,
+// independently of the encoder used to produce it.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configure the transports that support them.
+type Options struct {
+	ContentType string        // content type of HTTP requests
+	Retries     int           // number of retries of failed HTTP requests, negative to disable
+	Backoff     time.Duration // delay before the first retry, doubled at each attempt
+}
+
+// DefaultOptions are used to fill the zero fields of the options
+// provided to Open.
+var DefaultOptions = Options{
+	ContentType: "text/plain",
+	Retries:     3,
+	Backoff:     500 * time.Millisecond,
+}
+
+// Open returns the destination identified by `target`:
+// - "" or "-": standard output;
+// - "unix:<path>": the unix socket at <path>;
+// - "http://..." or "https://...": the output is POSTed to the URL
+// when the returned writer is closed, or each time it is flushed (it
+// implements Flush() error) by callers producing it over time;
+// - anything else: the file at that path, which is created or truncated.
+// Callers must always Close the returned writer.
+func Open(target string, opts Options) (io.WriteCloser, error) {
+	return OpenContext(context.Background(), target, opts)
+}
+
+// OpenContext is the same as Open, but connecting to the destination
+// and delivering the output, including the retries of failed HTTP
+// requests, are aborted as soon as `ctx` is done: a stalled collector
+// cannot hang the caller.
+func OpenContext(ctx context.Context, target string, opts Options) (io.WriteCloser, error) {
+	if opts.ContentType == "" {
+		opts.ContentType = DefaultOptions.ContentType
+	}
+	switch {
+	case opts.Retries == 0:
+		opts.Retries = DefaultOptions.Retries
+	case opts.Retries < 0:
+		opts.Retries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultOptions.Backoff
+	}
+
+	switch {
+	case target == "" || target == "-":
+		return nopCloser{os.Stdout}, nil
+	case strings.HasPrefix(target, "unix:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(target, "unix:"), "//")
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to %s: %w", target, err)
+		}
+		return conn, nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return &httpWriter{ctx: ctx, url: target, opts: opts}, nil
+	default:
+		f, err := os.Create(target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open output file: %w", err)
+		}
+		return f, nil
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// httpWriter buffers the output, which is POSTed on Flush and Close.
+type httpWriter struct {
+	bytes.Buffer
+	ctx     context.Context // bounds the requests
+	url     string
+	opts    Options
+	flushed bool
+}
+
+// Flush POSTs the output buffered so far, if any.
+func (w *httpWriter) Flush() error {
+	if w.Len() == 0 {
+		return nil
+	}
+	w.flushed = true
+	defer w.Reset()
+	return w.send()
+}
+
+// Close POSTs the output buffered, even when empty unless it was
+// flushed before.
+func (w *httpWriter) Close() error {
+	if w.flushed && w.Len() == 0 {
+		return nil
+	}
+	return w.send()
+}
+
+func (w *httpWriter) send() error {
+	body := w.Bytes()
+	backoff := w.opts.Backoff
+	var err error
+	for i := 0; i <= w.opts.Retries; i++ {
+		if i > 0 {
+			log.Printf("Retrying POST %s in %v: %v", w.url, backoff, err)
+			t := time.NewTimer(backoff)
+			select {
+			case <-w.ctx.Done():
+				t.Stop()
+				return fmt.Errorf("unable to POST output to %s: %w", w.url, w.ctx.Err())
+			case <-t.C:
+			}
+			backoff *= 2
+		}
+		if err = w.post(body); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to POST output to %s: %w", w.url, err)
+}
+
+func (w *httpWriter) post(body []byte) error {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.opts.ContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jecoz/lsaddr/transport"
+)
+
+func TestOpen_HTTP(t *testing.T) {
+	t.Parallel()
+	attempts := 0
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	w, err := transport.Open(srv.URL, transport.Options{Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.WriteString(w, "PID,CMD\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if attempts != 2 || string(body) != "PID,CMD\n" {
+		t.Fatalf("Unexpected delivery: %d attempts, body \"%s\"", attempts, body)
+	}
+}
+
+func TestOpen_HTTPFlush(t *testing.T) {
+	t.Parallel()
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	w, err := transport.Open(srv.URL, transport.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, ok := w.(interface{ Flush() error })
+	if !ok {
+		t.Fatalf("Unexpected http writer, not a flusher: %T", w)
+	}
+	for _, v := range []string{"+ curl\n", "", "- curl\n"} {
+		io.WriteString(w, v)
+		if err := f.Flush(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Empty flushes, and closing after flushing everything, send nothing.
+	if len(bodies) != 2 || bodies[0] != "+ curl\n" || bodies[1] != "- curl\n" {
+		t.Fatalf("Unexpected deliveries: %q", bodies)
+	}
+}
+
+func TestOpenContext_HTTP(t *testing.T) {
+	t.Parallel()
+	// A stalled collector, answering only when the test is done.
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w, err := transport.OpenContext(ctx, srv.URL, transport.Options{Backoff: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.WriteString(w, "PID,CMD\n")
+	start := time.Now()
+	if err := w.Close(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: wanted %v, found %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Unexpected delivery time: %v", d)
+	}
+}
+
+func TestOpen_FileAndUnix(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "lsaddr-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.csv")
+	w, err := transport.Open(path, transport.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.WriteString(w, "foo\n")
+	w.Close()
+	if data, _ := ioutil.ReadFile(path); string(data) != "foo\n" {
+		t.Fatalf("Unexpected file content: \"%s\"", data)
+	}
+
+	sock := filepath.Join(dir, "out.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+	w, err = transport.Open("unix://"+sock, transport.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	io.WriteString(w, "bar\n")
+	w.Close()
+	if data := <-received; data != "bar\n" {
+		t.Fatalf("Unexpected socket content: \"%s\"", data)
+	}
+}
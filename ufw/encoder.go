@@ -0,0 +1,88 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package ufw encodes the destinations of open network files into a
+// shell script of ufw commands, so that the outgoing traffic of an
+// application can be allowed, or blocked, on hosts denying outgoing
+// connections by default.
+package ufw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Encoder writes one ``ufw <action> out'' command per destination,
+// commented with the commands connected to it.
+type Encoder struct {
+	w      io.Writer
+	action string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, action: "allow"}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "action": "allow" (the default), "deny" or "reject".
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "action":
+			switch v {
+			case "allow", "deny", "reject":
+				e.action = v
+			default:
+				return nil, fmt.Errorf("invalid action %q: expected allow, deny or reject", v)
+			}
+		default:
+			return nil, fmt.Errorf("unknown ufw option %q", k)
+		}
+	}
+	return e, nil
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "#!/bin/sh")
+	for _, v := range aggr.Endpoints(set) {
+		fmt.Fprintf(w, "ufw %s out", e.action)
+		if v.Port != "" {
+			fmt.Fprintf(w, " proto %s to %s port %s", v.Proto, v.IP, v.Port)
+		} else {
+			fmt.Fprintf(w, " to %s", v.IP)
+		}
+		if len(v.Cmds) > 0 {
+			fmt.Fprintf(w, " comment '%s'", comment(v.Cmds))
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// comment joins `cmds`, dropping the characters that would break out
+// of a single quoted shell argument.
+func comment(cmds []string) string {
+	return strings.Replace(strings.Join(cmds, ", "), "'", "", -1)
+}
@@ -0,0 +1,49 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package ufw_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/ufw"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621"), Dst: internal.NewAddr("udp", "*:*")},
+		{Cmd: "it's", Src: internal.NewAddr("udp6", "[::1]:5353"), Dst: internal.NewAddr("udp6", "[2001:db8::1]:53")},
+	}
+	var b bytes.Buffer
+	e, err := ufw.NewEncoderOptions(&b, map[string]string{"action": "deny"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := e.Encode(set); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `#!/bin/sh
+ufw deny out proto tcp to 35.186.224.47 port 443 comment 'Spotify, curl'
+ufw deny out proto udp to 2001:db8::1 port 53 comment 'its'
+`
+	if b.String() != want {
+		t.Fatalf("Unexpected output: wanted %q, found %q", want, b.String())
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package verify cross-checks the open network files reported by two
+// different backends, so that parser bugs and missing data can be
+// spotted.
+package verify
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Source is the output of a backend.
+type Source struct {
+	Name string
+	Set  []onf.ONF
+}
+
+// Conn identifies a connection independently of the backend
+// that reported it.
+type Conn struct {
+	Net string
+	Src string
+	Dst string
+}
+
+func (c Conn) String() string {
+	if c.Dst == "" {
+		return fmt.Sprintf("%s %s", c.Net, c.Src)
+	}
+	return fmt.Sprintf("%s %s->%s", c.Net, c.Src, c.Dst)
+}
+
+// Discrepancy is a connection reported by one source only.
+type Discrepancy struct {
+	Conn    Conn
+	Found   string // name of the source reporting the connection
+	Missing string // name of the source not reporting it
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s: reported by %s, missing from %s", d.Conn, d.Found, d.Missing)
+}
+
+// Compare returns the connections that are reported by only one of
+// `a` and `b`, sorted. Addresses are normalized before being compared,
+// i.e. ``*:*'', ``0.0.0.0:0'' and ``[::]:0'' are the same address.
+func Compare(a, b Source) []Discrepancy {
+	ca, cb := conns(a.Set), conns(b.Set)
+	var acc []Discrepancy
+	for k := range ca {
+		if !cb[k] {
+			acc = append(acc, Discrepancy{Conn: k, Found: a.Name, Missing: b.Name})
+		}
+	}
+	for k := range cb {
+		if !ca[k] {
+			acc = append(acc, Discrepancy{Conn: k, Found: b.Name, Missing: a.Name})
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool {
+		if acc[i].Conn != acc[j].Conn {
+			return acc[i].Conn.String() < acc[j].Conn.String()
+		}
+		return acc[i].Found < acc[j].Found
+	})
+	return acc
+}
+
+func conns(set []onf.ONF) map[Conn]bool {
+	m := make(map[Conn]bool, len(set))
+	for _, v := range set {
+		if v.Src == nil {
+			continue
+		}
+		m[Conn{
+			Net: normalizeNet(v.Src.Network()),
+			Src: normalizeAddr(v.Src),
+			Dst: normalizeAddr(v.Dst),
+		}] = true
+	}
+	return m
+}
+
+func normalizeNet(s string) string {
+	return strings.TrimRight(strings.ToLower(s), "46")
+}
+
+// normalizeAddr returns the canonical representation of `addr`, or an
+// empty string if it is missing or completely unspecified.
+func normalizeAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if port == "0" {
+		port = "*"
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsUnspecified() {
+			host = "*"
+		} else if ip4 := ip.To4(); ip4 != nil {
+			host = ip4.String()
+		} else {
+			host = ip.String()
+		}
+	}
+	if host == "*" && port == "*" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package verify_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/verify"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	a := verify.Source{Name: "lsof", Set: []onf.ONF{
+		{Src: internal.NewAddr("tcp", "*:22")},
+		{Src: internal.NewAddr("udp", "*:5353"), Dst: internal.NewAddr("udp", "*:*")},
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "1.2.3.4:443")},
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "1.2.3.4:443")},
+	}}
+	b := verify.Source{Name: "procnet", Set: []onf.ONF{
+		{Src: internal.NewAddr("tcp", "0.0.0.0:22"), Dst: internal.NewAddr("tcp", "")},
+		{Src: internal.NewAddr("udp", "[::]:5353")},
+		{Src: internal.NewAddr("tcp", "[::ffff:10.0.0.2]:5000"), Dst: internal.NewAddr("tcp", "1.2.3.4:443")},
+		{Src: internal.NewAddr("tcp", "[::1]:631")},
+	}}
+	want := []verify.Discrepancy{
+		{Conn: verify.Conn{Net: "tcp", Src: "10.0.0.2:5001", Dst: "1.2.3.4:443"}, Found: "lsof", Missing: "procnet"},
+		{Conn: verify.Conn{Net: "tcp", Src: "[::1]:631"}, Found: "procnet", Missing: "lsof"},
+	}
+	if got := verify.Compare(a, b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected discrepancies: wanted %v, found %v", want, got)
+	}
+}
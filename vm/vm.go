@@ -0,0 +1,114 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+// Package vm attributes the open network files of hypervisor processes
+// (qemu, VirtualBox, VMware) to the virtual machines they run, whose
+// guest traffic would otherwise be mistaken for the hypervisor's own.
+package vm
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Detect reports whether `line`, the command line of a process (or its
+// image name on windows), runs a virtual machine, returning it. The
+// name of the virtual machine is taken from the arguments of the
+// hypervisor, when present: "-name" for qemu, "--comment" or
+// "--startvm" for VirtualBox and the .vmx file for VMware.
+func Detect(line string) (onf.VM, bool) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return onf.VM{}, false
+	}
+	exe := args[0]
+	if i := strings.LastIndexAny(exe, `/\`); i >= 0 {
+		exe = exe[i+1:]
+	}
+	exe = strings.TrimSuffix(strings.ToLower(exe), ".exe")
+	args = args[1:]
+
+	switch {
+	case strings.HasPrefix(exe, "qemu-system-") || exe == "qemu-kvm":
+		name := flagValue(args, "-name")
+		// i.e. -name guest=web01,debug-threads=on
+		name = strings.TrimPrefix(strings.SplitN(name, ",", 2)[0], "guest=")
+		return onf.VM{Hypervisor: "qemu", Name: name}, true
+	case exe == "vboxheadless" || exe == "virtualboxvm" || exe == "vboxsdl" ||
+		(exe == "virtualbox" && flagValue(args, "--startvm") != ""):
+		name := flagValue(args, "--comment")
+		if name == "" {
+			name = flagValue(args, "--startvm")
+		}
+		return onf.VM{Hypervisor: "virtualbox", Name: name}, true
+	case exe == "vmware-vmx":
+		var name string
+		for _, v := range args {
+			if strings.HasSuffix(strings.ToLower(v), ".vmx") {
+				name = v[strings.LastIndexAny(v, `/\`)+1 : len(v)-len(".vmx")]
+			}
+		}
+		return onf.VM{Hypervisor: "vmware", Name: name}, true
+	default:
+		return onf.VM{}, false
+	}
+}
+
+// flagValue returns the argument following `flag` in `args`, also
+// accepting the "<flag>=<value>" form, or an empty string.
+func flagValue(args []string, flag string) string {
+	for i, v := range args {
+		if v == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(v, flag+"=") {
+			return v[len(flag)+1:]
+		}
+	}
+	return ""
+}
+
+// Annotate fills the VM field of the open network files of `set` owned
+// by one of `procs` running a virtual machine.
+func Annotate(set []onf.ONF, procs []onf.Process) {
+	vms := make(map[int]onf.VM)
+	for _, v := range procs {
+		if vm, ok := Detect(v.Line); ok {
+			vms[v.Pid] = vm
+		}
+	}
+	for i, v := range set {
+		if vm, ok := vms[v.Pid]; ok {
+			set[i].VM = &vm
+		}
+	}
+}
+
+// Group orders `set` by virtual machine, after the open network files
+// not associated with any. The sort is stable.
+func Group(set []onf.ONF) {
+	key := func(f onf.ONF) string {
+		if f.VM == nil {
+			return ""
+		}
+		// Hypervisors are never empty, hence these keys sort after
+		// the files without a virtual machine.
+		return f.VM.Hypervisor + "/" + f.VM.Name
+	}
+	sort.SliceStable(set, func(i, j int) bool {
+		return key(set[i]) < key(set[j])
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/vm"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		line string
+		ok   bool
+		vm   onf.VM
+	}{
+		{"/usr/bin/qemu-system-x86_64 -name guest=web01,debug-threads=on -S -machine pc", true, onf.VM{Hypervisor: "qemu", Name: "web01"}},
+		{"qemu-kvm -m 2048 -name db", true, onf.VM{Hypervisor: "qemu", Name: "db"}},
+		{"qemu-system-aarch64 -m 2048", true, onf.VM{Hypervisor: "qemu"}},
+		{"/usr/lib/virtualbox/VBoxHeadless --comment build --startvm 5a8f0c8e-7a1c-4d2b-9d6e-1f2a3b4c5d6e --vrde config", true, onf.VM{Hypervisor: "virtualbox", Name: "build"}},
+		{"/usr/lib/virtualbox/VirtualBox --startvm win10", true, onf.VM{Hypervisor: "virtualbox", Name: "win10"}},
+		{"/usr/lib/virtualbox/VirtualBox", false, onf.VM{}},
+		{"/usr/lib/vmware/bin/vmware-vmx -s vmx.stdio.keep=TRUE -# product=1 /home/dan/vmware/ubuntu/ubuntu.vmx", true, onf.VM{Hypervisor: "vmware", Name: "ubuntu"}},
+		{"vmware-vmx.exe", true, onf.VM{Hypervisor: "vmware"}},
+		{"/usr/bin/firefox", false, onf.VM{}},
+		{"", false, onf.VM{}},
+	}
+	for _, v := range tt {
+		vm, ok := vm.Detect(v.line)
+		if ok != v.ok || vm != v.vm {
+			t.Fatalf("%q: Unexpected virtual machine: wanted %+v (%v), found %+v (%v)", v.line, v.vm, v.ok, vm, ok)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "qemu-syst", Pid: 2},
+		{Cmd: "firefox", Pid: 3},
+		{Cmd: "qemu-syst", Pid: 1},
+	}
+	procs := []onf.Process{
+		{Pid: 1, Line: "qemu-system-x86_64 -name db"},
+		{Pid: 2, Line: "qemu-system-x86_64 -name web"},
+		{Pid: 3, Line: "/usr/bin/firefox"},
+	}
+	vm.Annotate(set, procs)
+	vm.Group(set)
+	if set[0].VM != nil || set[1].VM.Name != "db" || set[2].VM.Name != "web" {
+		t.Fatalf("Unexpected open network files: %+v", set)
+	}
+}
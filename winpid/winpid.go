@@ -0,0 +1,79 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package winpid resolves windows services and top-level windows to
+// the pids of the processes running them, as executable names alone
+// (i.e. svchost.exe) are ambiguous on windows.
+package winpid
+
+import (
+	"sort"
+	"strings"
+)
+
+// Service is a running service, as listed by the Service Control
+// Manager.
+type Service struct {
+	Name        string // service name, i.e. Spooler
+	DisplayName string // i.e. Print Spooler
+	Pid         int
+}
+
+// Window is a visible top-level window.
+type Window struct {
+	Title string
+	Pid   int
+}
+
+// MatchServices returns the pids of the services of `list` whose
+// display name or service name is `name`, ignoring case. Pids are
+// sorted and deduplicated: several services may share a process.
+func MatchServices(list []Service, name string) []int {
+	var pids []int
+	for _, v := range list {
+		if v.Pid == 0 {
+			continue
+		}
+		if strings.EqualFold(v.DisplayName, name) || strings.EqualFold(v.Name, name) {
+			pids = append(pids, v.Pid)
+		}
+	}
+	return dedup(pids)
+}
+
+// MatchWindows returns the pids of the processes owning a window of
+// `list` whose title contains `sub`, ignoring case. Pids are sorted
+// and deduplicated.
+func MatchWindows(list []Window, sub string) []int {
+	sub = strings.ToLower(sub)
+	var pids []int
+	for _, v := range list {
+		if strings.Contains(strings.ToLower(v.Title), sub) {
+			pids = append(pids, v.Pid)
+		}
+	}
+	return dedup(pids)
+}
+
+func dedup(pids []int) []int {
+	sort.Ints(pids)
+	acc := pids[:0]
+	for i, v := range pids {
+		if i == 0 || v != pids[i-1] {
+			acc = append(acc, v)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,33 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package winpid
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Services is only supported on windows.
+func Services() ([]Service, error) {
+	return nil, fmt.Errorf("the Service Control Manager is not available on %s", runtime.GOOS)
+}
+
+// Windows is only supported on windows.
+func Windows() ([]Window, error) {
+	return nil, fmt.Errorf("enumerating windows is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package winpid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchServices(t *testing.T) {
+	t.Parallel()
+	list := []Service{
+		{Name: "Spooler", DisplayName: "Print Spooler", Pid: 2412},
+		{Name: "Dnscache", DisplayName: "DNS Client", Pid: 1788},
+		{Name: "NlaSvc", DisplayName: "Network Location Awareness", Pid: 1788},
+		{Name: "Stopped", DisplayName: "DNS Client", Pid: 0},
+	}
+	tt := []struct {
+		name string
+		pids []int
+	}{
+		{"Print Spooler", []int{2412}},
+		{"print spooler", []int{2412}},
+		{"spooler", []int{2412}},
+		{"DNS Client", []int{1788}},
+		{"Print", nil},
+	}
+	for i, v := range tt {
+		if pids := MatchServices(list, v.name); len(pids) != len(v.pids) || (len(pids) > 0 && !reflect.DeepEqual(pids, v.pids)) {
+			t.Fatalf("%d: Unexpected pids: wanted %v, found %v", i, v.pids, pids)
+		}
+	}
+}
+
+func TestMatchWindows(t *testing.T) {
+	t.Parallel()
+	list := []Window{
+		{Title: "Inbox - Outlook", Pid: 5120},
+		{Title: "Calendar - Outlook", Pid: 5120},
+		{Title: "Untitled - Notepad", Pid: 812},
+	}
+	if pids := MatchWindows(list, "outlook"); !reflect.DeepEqual(pids, []int{5120}) {
+		t.Fatalf("Unexpected pids: %v", pids)
+	}
+	if pids := MatchWindows(list, " - "); !reflect.DeepEqual(pids, []int{812, 5120}) {
+		t.Fatalf("Unexpected pids: %v", pids)
+	}
+	if pids := MatchWindows(list, "Word"); len(pids) != 0 {
+		t.Fatalf("Unexpected pids: %v", pids)
+	}
+}
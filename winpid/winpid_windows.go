@@ -0,0 +1,149 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows
+
+package winpid
+
+import (
+	"fmt"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32                 = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW       = advapi32.NewProc("OpenSCManagerW")
+	procEnumServicesStatusEx = advapi32.NewProc("EnumServicesStatusExW")
+	procCloseServiceHandle   = advapi32.NewProc("CloseServiceHandle")
+
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procIsWindowVisible          = user32.NewProc("IsWindowVisible")
+	procGetWindowTextLengthW     = user32.NewProc("GetWindowTextLengthW")
+	procGetWindowTextW           = user32.NewProc("GetWindowTextW")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+)
+
+const (
+	scManagerEnumerateService = 0x0004
+	scEnumProcessInfo         = 0    // SC_ENUM_PROCESS_INFO
+	serviceWin32              = 0x30 // SERVICE_WIN32
+	serviceActive             = 0x1  // SERVICE_ACTIVE
+
+	errorMoreData = 234
+)
+
+// enumServiceStatusProcess mirrors ENUM_SERVICE_STATUS_PROCESSW.
+type enumServiceStatusProcess struct {
+	ServiceName             *uint16
+	DisplayName             *uint16
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+	ProcessID               uint32
+	ServiceFlags            uint32
+}
+
+// Services lists the running services, using the Service Control
+// Manager.
+func Services() ([]Service, error) {
+	h, _, err := procOpenSCManagerW.Call(0, 0, scManagerEnumerateService)
+	if h == 0 {
+		return nil, fmt.Errorf("unable to open the Service Control Manager: %w", err)
+	}
+	defer procCloseServiceHandle.Call(h)
+
+	var acc []Service
+	var resume uint32
+	var buf []uint64 // pointer aligned
+	for {
+		var needed, n uint32
+		var p uintptr
+		if len(buf) > 0 {
+			p = uintptr(unsafe.Pointer(&buf[0]))
+		}
+		ret, _, err := procEnumServicesStatusEx.Call(
+			h,
+			scEnumProcessInfo,
+			serviceWin32,
+			serviceActive,
+			p,
+			uintptr(len(buf)*8),
+			uintptr(unsafe.Pointer(&needed)),
+			uintptr(unsafe.Pointer(&n)),
+			uintptr(unsafe.Pointer(&resume)),
+			0,
+		)
+		if ret == 0 && err != syscall.Errno(errorMoreData) {
+			return nil, fmt.Errorf("unable to enumerate services: %w", err)
+		}
+		if n > 0 {
+			entries := (*[1 << 16]enumServiceStatusProcess)(unsafe.Pointer(&buf[0]))[:n:n]
+			for _, v := range entries {
+				acc = append(acc, Service{
+					Name:        utf16PtrToString(v.ServiceName),
+					DisplayName: utf16PtrToString(v.DisplayName),
+					Pid:         int(v.ProcessID),
+				})
+			}
+		}
+		if ret != 0 {
+			return acc, nil
+		}
+		buf = make([]uint64, needed/8+1)
+	}
+}
+
+// Windows lists the visible top-level windows with a title.
+func Windows() ([]Window, error) {
+	var acc []Window
+	cb := syscall.NewCallback(func(hwnd syscall.Handle, _ uintptr) uintptr {
+		if visible, _, _ := procIsWindowVisible.Call(uintptr(hwnd)); visible == 0 {
+			return 1
+		}
+		size, _, _ := procGetWindowTextLengthW.Call(uintptr(hwnd))
+		if size == 0 {
+			return 1
+		}
+		title := make([]uint16, size+1)
+		procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&title[0])), size+1)
+		var pid uint32
+		procGetWindowThreadProcessId.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&pid)))
+		acc = append(acc, Window{Title: syscall.UTF16ToString(title), Pid: int(pid)})
+		return 1
+	})
+	if ret, _, err := procEnumWindows.Call(cb, 0); ret == 0 {
+		return nil, fmt.Errorf("unable to enumerate windows: %w", err)
+	}
+	return acc, nil
+}
+
+// utf16PtrToString decodes the NUL terminated string at `p`.
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	var s []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Pointer(uintptr(ptr) + 2) {
+		s = append(s, *(*uint16)(ptr))
+	}
+	return string(utf16.Decode(s))
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package zeek encodes the destinations of open network files into a
+// Zeek intel framework file, so that they can be monitored by existing
+// IDS deployments.
+package zeek
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jecoz/lsaddr/aggr"
+	"github.com/jecoz/lsaddr/onf"
+)
+
+// Source is the value of the meta.source field of each indicator.
+const Source = "lsaddr"
+
+// Encoder writes one Intel::ADDR indicator for each destination
+// address and, when enabled, one Intel::DOMAIN indicator for its host
+// name. The meta.desc field lists the commands connected to it.
+type Encoder struct {
+	w       io.Writer
+	domains bool
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// NewEncoderOptions returns an Encoder configured with `opts`.
+// Supported options are:
+// - "domains": "true" writes an Intel::DOMAIN indicator for the host
+// name of each destination, when known. Names come from PTR records,
+// which are chosen by the owner of the address: enable it only when
+// they can be trusted, as the IDS would flag any domain they claim.
+func NewEncoderOptions(w io.Writer, opts map[string]string) (*Encoder, error) {
+	e := NewEncoder(w)
+	for k, v := range opts {
+		switch k {
+		case "domains":
+			domains, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid domains option %q: %w", v, err)
+			}
+			e.domains = domains
+		default:
+			return nil, fmt.Errorf("unknown zeek option %q", k)
+		}
+	}
+	return e, nil
+}
+
+type indicator struct {
+	value string
+	typ   string
+	cmds  []string
+}
+
+func (e *Encoder) Encode(set []onf.ONF) error {
+	var acc []*indicator
+	index := make(map[string]*indicator)
+	add := func(value, typ, cmd string) {
+		i, ok := index[value]
+		if !ok {
+			i = &indicator{value: value, typ: typ}
+			index[value] = i
+			acc = append(acc, i)
+		}
+		if cmd = aggr.Printable(cmd); cmd == "" {
+			return
+		}
+		for _, v := range i.cmds {
+			if v == cmd {
+				return
+			}
+		}
+		i.cmds = append(i.cmds, cmd)
+	}
+	for _, v := range set {
+		host, ok := aggr.DstHost(v)
+		if !ok {
+			continue
+		}
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			continue
+		}
+		add(host, "Intel::ADDR", v.Cmd)
+		if e.domains && validDomain(v.DstName) {
+			add(v.DstName, "Intel::DOMAIN", v.Cmd)
+		}
+	}
+
+	w := bufio.NewWriter(e.w)
+	fmt.Fprintln(w, "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc")
+	for _, v := range acc {
+		desc := "-" // Zeek's empty field marker
+		if len(v.cmds) > 0 {
+			desc = "connected by " + strings.Join(v.cmds, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.value, v.typ, Source, desc)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to encode open network files: %w", err)
+	}
+	return nil
+}
+
+// validDomain reports whether `s` is a host name made of letters,
+// digits, "-" and "_", which cannot break the tab separated fields of
+// the intel file.
+func validDomain(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
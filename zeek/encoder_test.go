@@ -0,0 +1,68 @@
+// Copyright © 2019 Jecoz
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package zeek_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jecoz/lsaddr/internal"
+	"github.com/jecoz/lsaddr/onf"
+	"github.com/jecoz/lsaddr/zeek"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	set := []onf.ONF{
+		{Cmd: "Spotify", Src: internal.NewAddr("tcp", "10.0.0.2:5000"), Dst: internal.NewAddr("tcp", "35.186.224.47:443"), DstName: "spotify.com"},
+		{Cmd: "curl", Src: internal.NewAddr("tcp", "10.0.0.2:5001"), Dst: internal.NewAddr("tcp", "35.186.224.47:443")},
+		{Src: internal.NewAddr("tcp", "10.0.0.2:5002"), Dst: internal.NewAddr("tcp", "1.1.1.1:53")},
+		{Cmd: "Spotify", Src: internal.NewAddr("udp", "*:57621")},
+		// Names chosen by the processes and by the owners of the
+		// addresses, trying to add indicators.
+		{Cmd: "x\tevil.com", Src: internal.NewAddr("tcp", "10.0.0.2:5003"), Dst: internal.NewAddr("tcp", "9.9.9.9:443"), DstName: "a.com\tIntel::DOMAIN\tlsaddr\t-\nb.com"},
+	}
+	tt := []struct {
+		opts map[string]string
+		want string
+	}{
+		{nil, "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\n" +
+			"35.186.224.47\tIntel::ADDR\tlsaddr\tconnected by Spotify,curl\n" +
+			"1.1.1.1\tIntel::ADDR\tlsaddr\t-\n" +
+			"9.9.9.9\tIntel::ADDR\tlsaddr\tconnected by x?evil.com\n"},
+		{map[string]string{"domains": "true"}, "#fields\tindicator\tindicator_type\tmeta.source\tmeta.desc\n" +
+			"35.186.224.47\tIntel::ADDR\tlsaddr\tconnected by Spotify,curl\n" +
+			"spotify.com\tIntel::DOMAIN\tlsaddr\tconnected by Spotify\n" +
+			"1.1.1.1\tIntel::ADDR\tlsaddr\t-\n" +
+			"9.9.9.9\tIntel::ADDR\tlsaddr\tconnected by x?evil.com\n"},
+	}
+	for i, v := range tt {
+		var b bytes.Buffer
+		e, err := zeek.NewEncoderOptions(&b, v.opts)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := e.Encode(set); err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if b.String() != v.want {
+			t.Fatalf("%d: Unexpected output: wanted\n%q\nfound\n%q", i, v.want, b.String())
+		}
+	}
+	if _, err := zeek.NewEncoderOptions(&bytes.Buffer{}, map[string]string{"domains": "maybe"}); err == nil {
+		t.Fatalf("Unexpected nil error with an invalid domains option")
+	}
+}